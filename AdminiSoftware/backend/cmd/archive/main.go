@@ -0,0 +1,70 @@
+package main
+
+import (
+	"AdminiSoftware/internal/config"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  archive export -user <id> -out <file.tar.gz>")
+	fmt.Fprintln(os.Stderr, "  archive import -in <file.tar.gz> [-reseller <id>]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg := config.LoadConfig()
+	db, err := config.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	archiveService := services.NewAccountArchiveService(db, utils.NewLogger())
+
+	switch os.Args[1] {
+	case "export":
+		cmd := flag.NewFlagSet("export", flag.ExitOnError)
+		userID := cmd.Uint("user", 0, "ID of the account to export")
+		out := cmd.String("out", "", "path of the archive to write")
+		cmd.Parse(os.Args[2:])
+		if *userID == 0 || *out == "" {
+			usage()
+		}
+
+		if err := archiveService.ExportAccount(*userID, *out); err != nil {
+			log.Fatal("Export failed:", err)
+		}
+		log.Printf("Account %d exported to %s", *userID, *out)
+
+	case "import":
+		cmd := flag.NewFlagSet("import", flag.ExitOnError)
+		in := cmd.String("in", "", "path of the archive to import")
+		reseller := cmd.Uint("reseller", 0, "ID of the reseller to import under (default: the archived reseller)")
+		cmd.Parse(os.Args[2:])
+		if *in == "" {
+			usage()
+		}
+
+		var resellerID *uint
+		if *reseller != 0 {
+			resellerID = reseller
+		}
+		user, err := archiveService.ImportAccount(*in, resellerID, 0)
+		if err != nil {
+			log.Fatal("Import failed:", err)
+		}
+		log.Printf("Account %s imported as user %d", user.Username, user.ID)
+
+	default:
+		usage()
+	}
+}
@@ -1,76 +1,97 @@
-
 package main
 
 import (
-	"AdminiSoftware/internal/config"
 	"AdminiSoftware/internal/api"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/config"
+	"AdminiSoftware/internal/services"
 	"AdminiSoftware/internal/utils"
 	"log"
+	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.Load()
-	
+	cfg := config.LoadConfig()
+
 	// Initialize logger
 	logger := utils.NewLogger()
-	
+
+	// Backup manifests are signed so restores can trust them
+	if err := services.CheckBackupSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize database
 	db, err := config.InitDatabase(cfg)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	
+
 	// Initialize Redis
 	redis := config.InitRedis(cfg)
-	
-	// Setup API routes
-	router := api.SetupRouter(db, redis, logger)
-	
-	// Start server
-	logger.Info("Starting AdminiSoftware server on port " + cfg.Port)
-	if err := router.Run("0.0.0.0:" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+
+	// Background tasks that change shared state run on one node at a time;
+	// each takes a lease on every tick and skips the tick when another node
+	// holds it.
+
+	// Re-verify this node's backup archives against their manifests once a
+	// day
+	go services.NewBackupService(db, logger).StartVerification(24 * time.Hour)
+
+	// Suspend panel users that were removed from LDAP directories
+	ldapSyncInterval, err := time.ParseDuration(os.Getenv("LDAP_SYNC_INTERVAL"))
+	if err != nil || ldapSyncInterval <= 0 {
+		ldapSyncInterval = 15 * time.Minute
 	}
-}
-package main
+	go services.NewLDAPManager(db, logger).StartSync(ldapSyncInterval)
 
-import (
-	"AdminiSoftware/internal/api"
-	"AdminiSoftware/internal/config"
-	"log"
-	"net/http"
-	"time"
+	// Feed mail, FTP and SSH logins to brute-force protection and apply IP
+	// lockouts to this node's firewall
+	go services.NewAuthLogWatcher(auth.NewBruteForceProtection(db, redis), logger).Start()
 
-	"github.com/gin-gonic/gin"
-)
+	// Rotate the JWT signing key when due and drop keys past their grace
+	// period
+	go auth.NewKeyRing(db, logger).StartRotation(time.Hour)
 
-func main() {
-	// Load configuration
-	cfg := config.LoadConfig()
+	// Deliver queued mail and expire old password reset links
+	go services.NewMailQueue(db, logger).StartDelivery(15 * time.Second)
+	go auth.NewPasswordResetManager(db).StartCleanup(time.Hour)
+	go auth.NewSSOLoginManager(db).StartCleanup(time.Hour)
 
-	// Initialize database
-	db := config.InitDatabase(cfg)
+	// Bulk jobs cannot survive a restart and renames stop where they were;
+	// record those cut short here or on a node that stopped
+	bulkJobs := services.NewBulkJobService(db, logger)
+	bulkJobs.FailInterrupted()
+	go bulkJobs.StartRecovery(time.Minute)
+	renames := services.NewAccountRenameService(db, logger)
+	renames.MarkInterrupted()
+	go renames.StartRecovery(time.Minute)
 
-	// Initialize Redis
-	redis := config.InitRedis(cfg)
+	// Purge terminated accounts whose grace period has ended
+	go services.NewAccountLifecycle(db, logger).StartPurge(time.Hour)
+
+	// Meter billable usage daily and issue last month's statements
+	go services.NewBillingService(db, logger).StartMetering(time.Hour)
 
-	// Setup Gin router
-	r := gin.Default()
+	// Issue reseller panel hostnames' certificates, retry and renew them
+	go services.NewPanelHostnameService(db, logger).StartRenewal(time.Minute)
 
 	// Setup API routes
-	api.SetupRoutes(r, db, redis)
+	router := api.SetupRouter(db, redis, logger)
 
-	// Create server
+	// Backup progress is streamed over long-lived connections, so only the
+	// request headers are bounded
 	server := &http.Server{
-		Addr:           "0.0.0.0:5000",
-		Handler:        r,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Addr:              "0.0.0.0:" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		MaxHeaderBytes:    1 << 20,
 	}
 
-	log.Printf("Server starting on port 5000...")
+	logger.Info("Starting AdminiSoftware server on port " + cfg.Port)
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
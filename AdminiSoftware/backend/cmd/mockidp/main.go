@@ -0,0 +1,46 @@
+//go:build dev
+
+// Command mockidp is a minimal OpenID Connect provider for trying single
+// sign-on locally. It approves every authorization request for one configured
+// identity, enforces PKCE (S256) and signs ID tokens with a throwaway RSA key.
+// It is only built with the dev tag, so it never ships with the panel:
+//
+//	go run -tags dev ./cmd/mockidp -addr :9000 -email jane@example.com -groups panel-admins
+//
+// Register it in the panel with issuer http://localhost:9000, client ID
+// "panel" and any client secret.
+package main
+
+import (
+	"AdminiSoftware/internal/auth/oidctest"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL advertised in discovery and tokens")
+	clientID := flag.String("client-id", "panel", "accepted client ID")
+	subject := flag.String("sub", "mock-user-1", "subject of the signed-in identity")
+	email := flag.String("email", "jane@example.com", "email of the signed-in identity")
+	name := flag.String("name", "Jane Doe", "full name of the signed-in identity")
+	groups := flag.String("groups", "", "comma separated groups released in the groups claim")
+	flag.Parse()
+
+	identity := oidctest.Identity{Subject: *subject, Email: *email, Name: *name}
+	for _, group := range strings.Split(*groups, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			identity.Groups = append(identity.Groups, group)
+		}
+	}
+
+	idp, err := oidctest.New(*issuer, *clientID, identity)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+
+	log.Printf("Mock IdP for %s (groups %v) listening on %s", identity.Email, identity.Groups, *addr)
+	log.Fatal(http.ListenAndServe(*addr, idp.Handler()))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AccountLifecycleHandler suspends, reactivates and terminates accounts.
+// Administrators manage any account; resellers manage their own customers.
+type AccountLifecycleHandler struct {
+	db        *gorm.DB
+	lifecycle *services.AccountLifecycle
+	logger    *utils.Logger
+}
+
+func NewAccountLifecycleHandler(db *gorm.DB, logger *utils.Logger) *AccountLifecycleHandler {
+	return &AccountLifecycleHandler{
+		db:        db,
+		lifecycle: services.NewAccountLifecycle(db, logger),
+		logger:    logger,
+	}
+}
+
+type AccountTransitionRequest struct {
+	Status string `json:"status" binding:"required,oneof=active suspended terminated purged"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// Transition moves the account to another state. Terminated accounts are
+// purged once their grace period ends; only administrators purge earlier.
+func (h *AccountLifecycleHandler) Transition(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:update")
+	if !ok {
+		return
+	}
+
+	var req AccountTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == services.AccountPurged && !isGlobal(c, "accounts:delete") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can purge an account"})
+		return
+	}
+
+	transition, err := h.lifecycle.Transition(account.ID, req.Status, req.Reason, c.GetUint("user_id"))
+	if err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change account status"})
+		return
+	}
+	c.JSON(http.StatusOK, transition)
+}
+
+// History lists the account's status changes, newest first.
+func (h *AccountLifecycleHandler) History(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:read")
+	if !ok {
+		return
+	}
+
+	transitions, err := h.lifecycle.History(account.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      account.Status,
+		"purge_after": account.PurgeAfter,
+		"transitions": transitions,
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AccountRenameHandler changes account usernames and primary domains.
+// Administrators rename any account; resellers rename their own customers.
+type AccountRenameHandler struct {
+	db      *gorm.DB
+	renames *services.AccountRenameService
+	logger  *utils.Logger
+}
+
+func NewAccountRenameHandler(db *gorm.DB, logger *utils.Logger) *AccountRenameHandler {
+	return &AccountRenameHandler{
+		db:      db,
+		renames: services.NewAccountRenameService(db, logger),
+		logger:  logger,
+	}
+}
+
+// RenameAccountRequest leaves out what should stay as it is.
+type RenameAccountRequest struct {
+	Username string `json:"username" binding:"max=32"`
+	Domain   string `json:"domain" binding:"max=253"`
+}
+
+// Rename renames the account. A rename whose steps failed is rolled back
+// and returned with the error.
+func (h *AccountRenameHandler) Rename(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:update")
+	if !ok {
+		return
+	}
+
+	var req RenameAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rename, err := h.renames.Rename(account.ID, req.Username, req.Domain, c.GetUint("user_id"))
+	h.respond(c, rename, err, "Failed to rename account")
+}
+
+// History lists the account's renames with their steps.
+func (h *AccountRenameHandler) History(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:read")
+	if !ok {
+		return
+	}
+
+	renames, err := h.renames.History(account.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load renames"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"renames": renames})
+}
+
+// Resume continues a failed or interrupted rename.
+func (h *AccountRenameHandler) Resume(c *gin.Context) {
+	account, renameID, ok := h.renameParams(c)
+	if !ok {
+		return
+	}
+	rename, err := h.renames.Resume(renameID, account.ID)
+	h.respond(c, rename, err, "Failed to resume rename")
+}
+
+// Rollback undoes a failed or interrupted rename.
+func (h *AccountRenameHandler) Rollback(c *gin.Context) {
+	account, renameID, ok := h.renameParams(c)
+	if !ok {
+		return
+	}
+	rename, err := h.renames.Rollback(renameID, account.ID)
+	h.respond(c, rename, err, "Failed to roll back rename")
+}
+
+func (h *AccountRenameHandler) renameParams(c *gin.Context) (*models.User, uint, bool) {
+	account, ok := scopedAccount(c, h.db, "accounts:update")
+	if !ok {
+		return nil, 0, false
+	}
+	id, err := strconv.Atoi(c.Param("rename_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rename ID"})
+		return nil, 0, false
+	}
+	return account, uint(id), true
+}
+
+func (h *AccountRenameHandler) respond(c *gin.Context, rename *models.AccountRename, err error, message string) {
+	if err == nil {
+		c.JSON(http.StatusOK, rename)
+		return
+	}
+	if status, ok := services.AccountRenameErrorStatus(err); ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if rename != nil {
+		// The rename ran and its status tells whether it was rolled back
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "rename": rename})
+		return
+	}
+	h.logger.Error(err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
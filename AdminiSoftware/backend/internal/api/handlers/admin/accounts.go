@@ -197,6 +197,8 @@ package admin
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
 	"net/http"
 	"strconv"
 
@@ -205,11 +207,12 @@ import (
 )
 
 type AccountHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	lifecycle *services.AccountLifecycle
 }
 
 func NewAccountHandler(db *gorm.DB) *AccountHandler {
-	return &AccountHandler{db: db}
+	return &AccountHandler{db: db, lifecycle: services.NewAccountLifecycle(db, utils.NewLogger())}
 }
 
 func (h *AccountHandler) ListAccounts(c *gin.Context) {
@@ -336,9 +339,6 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 	if req.Role != "" {
 		user.Role = req.Role
 	}
-	if req.Status != "" {
-		user.Status = req.Status
-	}
 	if req.PackageID != nil {
 		user.PackageID = req.PackageID
 	}
@@ -351,6 +351,15 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 		return
 	}
 
+	// Status changes drive the account's services, so they go through the
+	// lifecycle
+	if req.Status != "" && req.Status != user.Status {
+		if !h.transition(c, user.ID, req.Status, "Failed to update account") {
+			return
+		}
+		user.Status = req.Status
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Account updated successfully",
 		"user":    user,
@@ -359,16 +368,7 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 
 func (h *AccountHandler) SuspendAccount(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	
-	var user models.User
-	if err := h.db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-		return
-	}
-
-	user.Status = "suspended"
-	if err := h.db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend account"})
+	if !h.transition(c, uint(id), services.AccountSuspended, "Failed to suspend account") {
 		return
 	}
 
@@ -377,32 +377,23 @@ func (h *AccountHandler) SuspendAccount(c *gin.Context) {
 
 func (h *AccountHandler) UnsuspendAccount(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	
-	var user models.User
-	if err := h.db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-		return
-	}
-
-	user.Status = "active"
-	if err := h.db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend account"})
+	if !h.transition(c, uint(id), services.AccountActive, "Failed to unsuspend account") {
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Account unsuspended successfully"})
 }
 
+// DeleteAccount terminates the account and purges it, so its services are
+// taken down before its data is removed.
 func (h *AccountHandler) DeleteAccount(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	
-	var user models.User
-	if err := h.db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-		return
-	}
 
-	if err := h.db.Delete(&user).Error; err != nil {
+	if _, err := h.lifecycle.Remove(uint(id), "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
@@ -410,6 +401,20 @@ func (h *AccountHandler) DeleteAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 }
 
+// transition moves the account through the lifecycle and answers the
+// request itself when that fails.
+func (h *AccountHandler) transition(c *gin.Context, userID uint, to, failure string) bool {
+	if _, err := h.lifecycle.Transition(userID, to, "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	return true
+}
+
 func (h *AccountHandler) GetAccountStats(c *gin.Context) {
 	var stats struct {
 		TotalUsers      int64 `json:"total_users"`
@@ -439,6 +444,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// accountActionRequest is the optional body of a delete, suspend or
+// unsuspend request. The reason is recorded with the status change.
+type accountActionRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
 type AccountHandler struct {
 	accountService *services.AccountService
 	logger        *utils.Logger
@@ -494,13 +505,16 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 		return
 	}
 
-	var req models.UpdateAccountRequest
+	var req struct {
+		models.UpdateAccountRequest
+		Reason string `json:"reason" binding:"max=500"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	account, err := h.accountService.UpdateAccount(uint(id), &req)
+	account, err := h.accountService.UpdateAccount(uint(id), &req.UpdateAccountRequest, req.Reason, c.GetUint("user_id"))
 	if err != nil {
 		h.logger.Error("Failed to update account: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
@@ -517,7 +531,16 @@ func (h *AccountHandler) DeleteAccount(c *gin.Context) {
 		return
 	}
 
-	if err := h.accountService.DeleteAccount(uint(id)); err != nil {
+	var req accountActionRequest
+	if !bindOptional(c, &req) {
+		return
+	}
+
+	if err := h.accountService.DeleteAccount(uint(id), req.Reason, c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Error("Failed to delete account: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
@@ -533,7 +556,16 @@ func (h *AccountHandler) SuspendAccount(c *gin.Context) {
 		return
 	}
 
-	if err := h.accountService.SuspendAccount(uint(id)); err != nil {
+	var req accountActionRequest
+	if !bindOptional(c, &req) {
+		return
+	}
+
+	if err := h.accountService.SuspendAccount(uint(id), req.Reason, c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Error("Failed to suspend account: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend account"})
 		return
@@ -549,7 +581,16 @@ func (h *AccountHandler) UnsuspendAccount(c *gin.Context) {
 		return
 	}
 
-	if err := h.accountService.UnsuspendAccount(uint(id)); err != nil {
+	var req accountActionRequest
+	if !bindOptional(c, &req) {
+		return
+	}
+
+	if err := h.accountService.UnsuspendAccount(uint(id), req.Reason, c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Error("Failed to unsuspend account: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend account"})
 		return
@@ -557,3 +598,16 @@ func (h *AccountHandler) UnsuspendAccount(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Account unsuspended successfully"})
 }
+
+// bindOptional binds the JSON body into req when there is one, so clients
+// may leave out the body of an action whose fields are all optional.
+func bindOptional(c *gin.Context, req interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
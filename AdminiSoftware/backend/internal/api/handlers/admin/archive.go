@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const accountArchiveDir = "/var/backups/accounts"
+
+type ArchiveHandler struct {
+	db             *gorm.DB
+	logger         *utils.Logger
+	archiveService *services.AccountArchiveService
+}
+
+func NewArchiveHandler(db *gorm.DB, logger *utils.Logger) *ArchiveHandler {
+	return &ArchiveHandler{
+		db:             db,
+		logger:         logger,
+		archiveService: services.NewAccountArchiveService(db, logger),
+	}
+}
+
+func (h *ArchiveHandler) ExportAccount(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	if err := os.MkdirAll(accountArchiveDir, 0700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export directory"})
+		return
+	}
+
+	filename := fmt.Sprintf("account_%d_%s.tar.gz", id, time.Now().Format("20060102_150405"))
+	archivePath := filepath.Join(accountArchiveDir, filename)
+	defer os.Remove(archivePath)
+
+	if err := h.archiveService.ExportAccount(uint(id), archivePath); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to export account %d: %v", id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.FileAttachment(archivePath, filename)
+}
+
+func (h *ArchiveHandler) ImportAccount(c *gin.Context) {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Archive file is required"})
+		return
+	}
+
+	if err := os.MkdirAll(accountArchiveDir, 0700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare import directory"})
+		return
+	}
+
+	archivePath := filepath.Join(accountArchiveDir, fmt.Sprintf("import_%d.tar.gz", time.Now().UnixNano()))
+	if err := c.SaveUploadedFile(file, archivePath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save archive"})
+		return
+	}
+	defer os.Remove(archivePath)
+
+	// The account joins the chosen reseller, or the archived one when it
+	// exists here
+	var resellerID *uint
+	if value := c.PostForm("reseller_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reseller ID"})
+			return
+		}
+		var count int64
+		h.db.Model(&models.User{}).Where("id = ? AND role = ?", id, "reseller").Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reseller not found"})
+			return
+		}
+		reseller := uint(id)
+		resellerID = &reseller
+	}
+
+	user, err := h.archiveService.ImportAccount(archivePath, resellerID, c.GetUint("user_id"))
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to import account archive %s: %v", file.Filename, err))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Account imported successfully",
+		"user":    user,
+	})
+}
@@ -120,6 +120,8 @@ package admin
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
 	"net/http"
 	"strconv"
 
@@ -128,11 +130,14 @@ import (
 )
 
 type DNSHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	nameservers *services.NameserverService
+	logger      *utils.Logger
 }
 
 func NewDNSHandler(db *gorm.DB) *DNSHandler {
-	return &DNSHandler{db: db}
+	logger := utils.NewLogger()
+	return &DNSHandler{db: db, nameservers: services.NewNameserverService(db, logger), logger: logger}
 }
 
 func (h *DNSHandler) GetDNSZones(c *gin.Context) {
@@ -155,6 +160,13 @@ func (h *DNSHandler) CreateDNSZone(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create DNS zone"})
 		return
 	}
+	// The zone gets the nameservers of its domain owner's reseller
+	var domain models.Domain
+	if err := h.db.First(&domain, zone.DomainID).Error; err == nil {
+		if err := h.nameservers.ApplyToDomain(&domain); err != nil {
+			h.logger.Error(err.Error())
+		}
+	}
 
 	c.JSON(http.StatusCreated, zone)
 }
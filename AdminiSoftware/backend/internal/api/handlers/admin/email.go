@@ -1,8 +1,8 @@
-
 package admin
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
 	"net/http"
 	"strconv"
 
@@ -11,11 +11,15 @@ import (
 )
 
 type EmailHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	quotas *services.QuotaService
 }
 
 func NewEmailHandler(db *gorm.DB) *EmailHandler {
-	return &EmailHandler{db: db}
+	return &EmailHandler{
+		db:     db,
+		quotas: services.NewQuotaService(db),
+	}
 }
 
 func (h *EmailHandler) GetEmailAccounts(c *gin.Context) {
@@ -35,7 +39,13 @@ func (h *EmailHandler) CreateEmailAccount(c *gin.Context) {
 	}
 
 	account.Status = "active"
-	if err := h.db.Create(&account).Error; err != nil {
+	if err := h.quotas.Create(account.UserID, services.QuotaEmailAccounts, func(tx *gorm.DB) error {
+		return tx.Create(&account).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create email account"})
 		return
 	}
@@ -126,32 +136,32 @@ func (h *EmailHandler) GetMailQueue(c *gin.Context) {
 
 func (h *EmailHandler) GetMailStats(c *gin.Context) {
 	stats := map[string]interface{}{
-		"sent_today":     245,
-		"sent_this_week": 1680,
+		"sent_today":      245,
+		"sent_this_week":  1680,
 		"sent_this_month": 6420,
-		"queued":         3,
-		"failed":         12,
-		"bounced":        8,
-		"spam_blocked":   67,
-		"disk_usage":     "2.4GB",
-		"quota":          "10GB",
+		"queued":          3,
+		"failed":          12,
+		"bounced":         8,
+		"spam_blocked":    67,
+		"disk_usage":      "2.4GB",
+		"quota":           "10GB",
 	}
 	c.JSON(http.StatusOK, stats)
 }
 
 func (h *EmailHandler) GetSpamSettings(c *gin.Context) {
 	settings := map[string]interface{}{
-		"spam_assassin_enabled":  true,
-		"spam_threshold":         5.0,
-		"auto_delete_spam":       false,
-		"quarantine_enabled":     true,
-		"whitelist":              []string{"trusted@example.com"},
-		"blacklist":              []string{"spam@example.com"},
-		"greylisting_enabled":    true,
-		"rbl_checks_enabled":     true,
-		"dkim_enabled":           true,
-		"spf_enabled":            true,
-		"dmarc_enabled":          true,
+		"spam_assassin_enabled": true,
+		"spam_threshold":        5.0,
+		"auto_delete_spam":      false,
+		"quarantine_enabled":    true,
+		"whitelist":             []string{"trusted@example.com"},
+		"blacklist":             []string{"spam@example.com"},
+		"greylisting_enabled":   true,
+		"rbl_checks_enabled":    true,
+		"dkim_enabled":          true,
+		"spf_enabled":           true,
+		"dmarc_enabled":         true,
 	}
 	c.JSON(http.StatusOK, settings)
 }
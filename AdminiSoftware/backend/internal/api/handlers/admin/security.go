@@ -1,7 +1,7 @@
-
 package admin
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"net/http"
 
@@ -19,19 +19,19 @@ func NewSecurityHandler(db *gorm.DB) *SecurityHandler {
 
 func (h *SecurityHandler) GetSecurityOverview(c *gin.Context) {
 	overview := map[string]interface{}{
-		"two_factor_enabled":      true,
-		"brute_force_protection":  true,
-		"mod_security_enabled":    true,
-		"csf_enabled":             true,
-		"imunify360_enabled":      false,
-		"failed_login_attempts":   0,
-		"blocked_ips":             []string{},
-		"security_scan_status":    "clean",
-		"last_security_scan":      "2024-01-15T10:30:00Z",
-		"ssl_certificates":        12,
-		"firewall_rules":          25,
-		"malware_detected":        0,
-		"security_notifications":  []string{},
+		"two_factor_enabled":     true,
+		"brute_force_protection": true,
+		"mod_security_enabled":   true,
+		"csf_enabled":            true,
+		"imunify360_enabled":     false,
+		"failed_login_attempts":  0,
+		"blocked_ips":            []string{},
+		"security_scan_status":   "clean",
+		"last_security_scan":     "2024-01-15T10:30:00Z",
+		"ssl_certificates":       12,
+		"firewall_rules":         25,
+		"malware_detected":       0,
+		"security_notifications": []string{},
 	}
 	c.JSON(http.StatusOK, overview)
 }
@@ -91,20 +91,17 @@ func (h *SecurityHandler) RunSecurityScan(c *gin.Context) {
 
 func (h *SecurityHandler) GetSecuritySettings(c *gin.Context) {
 	settings := map[string]interface{}{
-		"max_login_attempts":        5,
-		"lockout_duration":          30,
-		"password_min_length":       8,
-		"password_require_numbers":  true,
-		"password_require_symbols":  true,
-		"password_require_mixed":    true,
-		"session_timeout":           1440,
-		"two_factor_required":       false,
-		"ip_whitelist_enabled":      false,
-		"ip_whitelist":              []string{},
-		"email_notifications":       true,
-		"security_headers_enabled":  true,
-		"csrf_protection_enabled":   true,
-		"xss_protection_enabled":    true,
+		"max_login_attempts":       5,
+		"lockout_duration":         30,
+		"password_policy":          auth.NewPasswordPolicy(h.db).Config(),
+		"session_timeout":          1440,
+		"two_factor_required":      false,
+		"ip_whitelist_enabled":     false,
+		"ip_whitelist":             []string{},
+		"email_notifications":      true,
+		"security_headers_enabled": true,
+		"csrf_protection_enabled":  true,
+		"xss_protection_enabled":   true,
 	}
 	c.JSON(http.StatusOK, settings)
 }
@@ -89,6 +89,7 @@ package admin
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
 	"net/http"
 	"strconv"
 
@@ -97,11 +98,15 @@ import (
 )
 
 type SSLHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	quotas *services.QuotaService
 }
 
 func NewSSLHandler(db *gorm.DB) *SSLHandler {
-	return &SSLHandler{db: db}
+	return &SSLHandler{
+		db:     db,
+		quotas: services.NewQuotaService(db),
+	}
 }
 
 func (h *SSLHandler) GetSSLCertificates(c *gin.Context) {
@@ -120,7 +125,13 @@ func (h *SSLHandler) CreateSSLCertificate(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Create(&cert).Error; err != nil {
+	if err := h.quotas.Create(cert.UserID, services.QuotaSSLCertificates, func(tx *gorm.DB) error {
+		return tx.Create(&cert).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create SSL certificate"})
 		return
 	}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type APITokenHandler struct {
+	db        *gorm.DB
+	apiTokens *auth.APITokenManager
+	logger    *utils.Logger
+}
+
+func NewAPITokenHandler(db *gorm.DB, logger *utils.Logger) *APITokenHandler {
+	return &APITokenHandler{
+		db:        db,
+		apiTokens: auth.NewAPITokenManager(db),
+		logger:    logger,
+	}
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	AllowedIPs    []string `json:"allowed_ips"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the token does not expire
+}
+
+func (h *APITokenHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.apiTokens.List(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API tokens"})
+		return
+	}
+
+	for i := range tokens {
+		tokens[i].User = nil
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":    tokens,
+		"resources": auth.APITokenResources,
+	})
+}
+
+// CreateToken issues a token for the current user. The plaintext token is
+// only included in this response.
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days cannot be negative"})
+		return
+	}
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	userID := c.GetUint("user_id")
+	token, plaintext, err := h.apiTokens.Create(userID, req.Name, req.Scopes, req.AllowedIPs, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("API token %q (%s) created by user %d with scopes %s", token.Name, token.Prefix, userID, token.Scopes))
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Copy this token now; it will not be shown again",
+		"api_token": token,
+		"token":     plaintext,
+	})
+}
+
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.apiTokens.Revoke(uint(id), c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
+
+// AdminListTokens lists every live token, or those of ?user_id.
+func (h *APITokenHandler) AdminListTokens(c *gin.Context) {
+	var userID uint
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = uint(id)
+	}
+
+	tokens, err := h.apiTokens.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *APITokenHandler) AdminRevokeToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.apiTokens.Revoke(uint(id), 0); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("API token %d revoked by admin %d", id, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
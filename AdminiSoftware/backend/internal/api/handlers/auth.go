@@ -13,14 +13,18 @@ import (
 )
 
 type AuthHandler struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db         *gorm.DB
+	jwtManager *auth.JWTManager
+	sessions   *auth.SessionManager
+	logger     *utils.Logger
 }
 
-func NewAuthHandler(db *gorm.DB, logger *utils.Logger) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, jwtManager *auth.JWTManager, logger *utils.Logger) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
-		logger: logger,
+		db:         db,
+		jwtManager: jwtManager,
+		sessions:   auth.NewSessionManager(db),
+		logger:     logger,
 	}
 }
 
@@ -64,15 +68,19 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := auth.GenerateJWT(user.ID, user.Role)
+	authMethods := []string{auth.AuthMethodPassword}
+	if user.TwoFactorEnabled {
+		authMethods = append(authMethods, auth.AuthMethodOTP)
+	}
+	session, refreshToken, err := h.sessions.Create(user.ID, c.ClientIP(), c.GetHeader("User-Agent"), "", authMethods)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
-	refreshToken, err := auth.GenerateRefreshToken(user.ID)
+	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role, session)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
@@ -104,25 +112,25 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	userID, err := auth.ValidateRefreshToken(req.RefreshToken)
+	session, refreshToken, err := h.sessions.Rotate(req.RefreshToken, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.First(&user, session.UserID).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	token, err := auth.GenerateJWT(user.ID, user.Role)
+	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role, session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
 }
 
 func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
@@ -255,7 +263,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var request struct {
 		Email     string `json:"email" binding:"required,email"`
-		Password  string `json:"password" binding:"required,min=8"`
+		Password  string `json:"password" binding:"required"`
 		FirstName string `json:"first_name" binding:"required"`
 		LastName  string `json:"last_name" binding:"required"`
 		Username  string `json:"username" binding:"required"`
@@ -303,9 +311,14 @@ package handlers
 import (
 	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
 	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -317,15 +330,39 @@ type AuthHandler struct {
 	jwtManager *auth.JWTManager
 	bruteForce *auth.BruteForceProtection
 	twoFactor  *auth.TwoFactorManager
+	sessions   *auth.SessionManager
+	webAuthn   *auth.WebAuthnManager
+	mfaPolicy  *auth.MFAPolicy
+	oidc       *auth.OIDCManager
+	ldap       *auth.LDAPManager
+	providers  *auth.Authenticator
+	passwords  *auth.PasswordPolicy
+	resets     *auth.PasswordResetManager
+	ssoLogins  *auth.SSOLoginManager
+	mail       *services.MailQueue
 	logger     *utils.Logger
 }
 
-func NewAuthHandler(db *gorm.DB, jwtManager *auth.JWTManager, bruteForce *auth.BruteForceProtection, logger *utils.Logger) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, jwtManager *auth.JWTManager, bruteForce *auth.BruteForceProtection, webAuthn *auth.WebAuthnManager, logger *utils.Logger) *AuthHandler {
+	oidc := auth.NewOIDCManager(db)
+	oidc.SetAccountPool(services.NewResellerPoolService(db))
+	ldap := services.NewLDAPManager(db, logger)
+
 	return &AuthHandler{
 		db:         db,
 		jwtManager: jwtManager,
 		bruteForce: bruteForce,
-		twoFactor:  auth.NewTwoFactorManager(),
+		twoFactor:  auth.NewTwoFactorManager(db),
+		sessions:   auth.NewSessionManager(db),
+		webAuthn:   webAuthn,
+		mfaPolicy:  auth.NewMFAPolicy(db),
+		oidc:       oidc,
+		ldap:       ldap,
+		providers:  auth.NewAuthenticator(auth.NewLocalProvider(db), ldap),
+		passwords:  auth.NewPasswordPolicy(db),
+		resets:     auth.NewPasswordResetManager(db),
+		ssoLogins:  auth.NewSSOLoginManager(db),
+		mail:       services.NewMailQueue(db, logger),
 		logger:     logger,
 	}
 }
@@ -334,12 +371,52 @@ type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	TwoFA    string `json:"two_fa,omitempty"`
+	Device   string `json:"device,omitempty"`
+	// TrustDevice skips the one-time code on this browser for a while
+	TrustDevice bool `json:"trust_device,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	AllSessions bool `json:"all_sessions"`
+}
+
+type OIDCCallbackRequest struct {
+	State  string `json:"state" binding:"required"`
+	Code   string `json:"code" binding:"required"`
+	Device string `json:"device,omitempty"`
+}
+
+type SSOLoginRequest struct {
+	Token  string `json:"token" binding:"required"`
+	Device string `json:"device,omitempty"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"` // email address or username
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 type RegisterRequest struct {
 	Username  string `json:"username" binding:"required"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=8"`
+	Password  string `json:"password" binding:"required"`
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 }
@@ -351,49 +428,379 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	clientIP := utils.GetClientIP(c.Request.RemoteAddr, c.GetHeader("X-Forwarded-For"), c.GetHeader("X-Real-IP"))
+	clientIP := c.ClientIP()
 
 	// Check brute force protection
-	if h.bruteForce.IsBlocked(clientIP) {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "Too many failed attempts. Please try again later.",
-		})
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, req.Username); decision.Blocked {
+		tooManyAttempts(c, decision)
 		return
 	}
 
-	var user models.User
-	if err := h.db.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
-		h.bruteForce.RecordAttempt(clientIP, false)
+	// Local accounts first, then any configured directories
+	authenticated, provider, err := h.providers.Authenticate(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		// A wrapped error carries a directory failure worth logging
+		if err != auth.ErrInvalidCredentials {
+			h.logger.Error(fmt.Sprintf("Login of %s failed: %v", req.Username, err))
+		}
+		h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	user := *authenticated
+	if provider != "local" {
+		h.logger.Info(fmt.Sprintf("User %s authenticated by %s provider", user.Username, provider))
+	}
 
-	if !utils.CheckPasswordHash(req.Password, user.Password) {
-		h.bruteForce.RecordAttempt(clientIP, false)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-		return
+	authMethods := []string{auth.AuthMethodPassword}
+
+	// Registered security keys are offered as a second factor. When the role
+	// requires phishing-resistant MFA they are the only one accepted.
+	hasKeys := h.webAuthn.HasCredentials(user.ID)
+	keyRequired := hasKeys && h.mfaPolicy.RequiredFor(user.Role)
+
+	// A device the user trusted stands in for the one-time code, but not
+	// for a security key the role requires
+	trusted := false
+	if user.TwoFactorEnabled && !keyRequired {
+		if cookie, err := c.Cookie(auth.TrustedDeviceCookie); err == nil {
+			trusted = h.twoFactor.IsTrustedDevice(user.ID, cookie)
+		}
 	}
 
-	// Check 2FA if enabled
-	if user.TwoFactorEnabled {
-		if req.TwoFA == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":           "Two-factor authentication required",
-				"requires_2fa":    true,
-				"temp_token":      h.generateTempToken(user.ID),
-			})
+	if trusted {
+		authMethods = append(authMethods, auth.AuthMethodTrustedDevice)
+	} else if user.TwoFactorEnabled || hasKeys {
+		if req.TwoFA == "" || keyRequired {
+			response := gin.H{
+				"error":        "Two-factor authentication required",
+				"requires_2fa": true,
+			}
+
+			methods := []string{}
+			if user.TwoFactorEnabled && !keyRequired {
+				methods = append(methods, "totp")
+				response["temp_token"] = h.generateTempToken(user.ID)
+			}
+			if hasKeys {
+				options, ceremonyID, err := h.webAuthn.BeginMFA(&user)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start security key challenge"})
+					return
+				}
+				methods = append(methods, "webauthn")
+				response["webauthn"] = options
+				response["ceremony_id"] = ceremonyID
+			}
+			response["methods"] = methods
+
+			c.JSON(http.StatusBadRequest, response)
 			return
 		}
 
-		if !h.twoFactor.ValidateCode(user.TwoFactorSecret, req.TwoFA) {
-			h.bruteForce.RecordAttempt(clientIP, false)
+		// A code is accepted once; backup codes work when the app is lost
+		if !h.twoFactor.Verify(&user, req.TwoFA) {
+			h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, req.Username)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
 			return
 		}
+		authMethods = append(authMethods, auth.AuthMethodOTP)
+
+		if req.TrustDevice && h.twoFactor.TrustDays() > 0 {
+			cookie, expires, err := h.twoFactor.TrustDevice(user.ID, c.GetHeader("User-Agent"), clientIP)
+			if err != nil {
+				h.logger.Error(err.Error())
+			} else {
+				c.SetSameSite(http.SameSiteStrictMode)
+				c.SetCookie(auth.TrustedDeviceCookie, cookie, int(time.Until(expires).Seconds()), "/api/auth", "", true, true)
+			}
+		}
+	}
+
+	h.completeLogin(c, &user, clientIP, req.Device, authMethods)
+}
+
+// BeginPasskeyLogin starts a passwordless login with a discoverable credential.
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, ""); decision.Blocked {
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	options, ceremonyID, err := h.webAuthn.BeginLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"webauthn":    options,
+	})
+}
+
+// FinishPasskeyLogin verifies the assertion for a ceremony started by
+// BeginPasskeyLogin or by a password login that asked for a second factor.
+// The request body is the PublicKeyCredential returned by the browser.
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, ""); decision.Blocked {
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	user, ceremonyType, err := h.webAuthn.FinishLogin(c.Query("ceremony_id"), c.Request)
+	if err != nil {
+		h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, "")
+		if errors.Is(err, auth.ErrCredentialCloned) {
+			h.logger.Error(fmt.Sprintf("Possible cloned security key used from %s", clientIP))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Security key verification failed"})
+		return
+	}
+
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	authMethods := []string{auth.AuthMethodWebAuthn}
+	if ceremonyType == auth.CeremonyMFA {
+		authMethods = []string{auth.AuthMethodPassword, auth.AuthMethodWebAuthn}
+	}
+
+	h.completeLogin(c, user, clientIP, c.Query("device"), authMethods)
+}
+
+// ListOIDCProviders returns the single sign-on providers to show on the login
+// page. Reseller-branded login pages pass ?reseller_id to include their own.
+func (h *AuthHandler) ListOIDCProviders(c *gin.Context) {
+	var resellerID *uint
+	if value := c.Query("reseller_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reseller ID"})
+			return
+		}
+		rid := uint(id)
+		resellerID = &rid
 	}
 
-	// Generate JWT token
-	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role)
+	providers, err := h.oidc.ListProviders(resellerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list identity providers"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(providers))
+	for _, provider := range providers {
+		result = append(result, gin.H{"id": provider.ID, "name": provider.Name})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": result})
+}
+
+// BeginOIDCLogin returns the authorization URL the browser should be sent to.
+func (h *AuthHandler) BeginOIDCLogin(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid provider ID"})
+		return
+	}
+
+	authURL, err := h.oidc.Begin(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+			return
+		}
+		h.logger.Error(fmt.Sprintf("Failed to start OIDC login with provider %d: %v", id, err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// LinkOIDCIdentity starts a sign-in at the provider whose identity is then
+// linked to the signed-in user; the IdP redirects back to the usual callback.
+func (h *AuthHandler) LinkOIDCIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid provider ID"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	authURL, err := h.oidc.BeginLink(c.Request.Context(), uint(id), &user)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+			return
+		}
+		h.logger.Error(fmt.Sprintf("Failed to start OIDC link with provider %d: %v", id, err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+type LinkLDAPRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LinkLDAPIdentity links a directory user to the signed-in account once its
+// directory password checks out, so the account can sign in through it.
+func (h *AuthHandler) LinkLDAPIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid directory ID"})
+		return
+	}
+
+	var req LinkLDAPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, req.Username); decision.Blocked {
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = h.ldap.Link(uint(id), &user, req.Username, req.Password)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrLDAPDirectoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found"})
+		return
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, req.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	case errors.Is(err, auth.ErrLDAPAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, auth.ErrLDAPIdentityLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		h.logger.Error(fmt.Sprintf("Failed to link directory %d for user %d: %v", id, user.ID, err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Directory is unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Directory account linked"})
+}
+
+// FinishOIDCLogin redeems the state and code the IdP redirected back with.
+func (h *AuthHandler) FinishOIDCLogin(c *gin.Context) {
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, ""); decision.Blocked {
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	user, err := h.oidc.Complete(c.Request.Context(), req.State, req.Code)
+	if err != nil {
+		h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, "")
+		switch {
+		case errors.Is(err, auth.ErrOIDCAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your identity provider groups do not grant access to this panel"})
+		case errors.Is(err, auth.ErrOIDCNoAccount):
+			c.JSON(http.StatusForbidden, gin.H{"error": "No account is linked to this identity"})
+		case errors.Is(err, auth.ErrOIDCIdentityLinked):
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to another account"})
+		default:
+			h.logger.Error(fmt.Sprintf("OIDC login from %s failed: %v", clientIP, err))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed"})
+		}
+		return
+	}
+
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	h.completeLogin(c, user, clientIP, req.Device, []string{auth.AuthMethodFederated})
+}
+
+// FinishSSOLogin redeems a login link a billing system issued for the
+// customer. Links only sign in accounts without two-factor authentication
+// or security keys, whose role does not require one; the others are sent
+// to the password login.
+func (h *AuthHandler) FinishSSOLogin(c *gin.Context) {
+	var req SSOLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if decision := h.bruteForce.Check(auth.SourcePanel, clientIP, ""); decision.Blocked {
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	user, err := h.ssoLogins.Redeem(req.Token)
+	if errors.Is(err, auth.ErrSSOLoginMFA) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account uses two-factor authentication; sign in with your password and second factor"})
+		return
+	}
+	if err != nil {
+		h.bruteForce.RecordFailure(auth.SourcePanel, clientIP, "")
+		if !errors.Is(err, auth.ErrInvalidSSOToken) {
+			h.logger.Error(fmt.Sprintf("Login link from %s failed: %v", clientIP, err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidSSOToken.Error()})
+		return
+	}
+
+	h.completeLogin(c, user, clientIP, req.Device, []string{auth.AuthMethodSSOLink})
+}
+
+// completeLogin opens a session for a fully authenticated user and responds
+// with the first token pair.
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User, clientIP, device string, authMethods []string) {
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is suspended"})
+		return
+	}
+
+	// Open a session and issue the first token pair
+	token, refreshToken, err := h.startSession(c, user, clientIP, device, authMethods)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -402,21 +809,23 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Update last login
 	now := time.Now()
 	user.LastLogin = &now
-	h.db.Save(&user)
+	h.db.Save(user)
 
 	// Record successful login
-	h.bruteForce.RecordAttempt(clientIP, true)
+	h.bruteForce.RecordSuccess(auth.SourcePanel, clientIP, user.Username, user.Email)
 
 	// Log login attempt
 	h.db.Create(&models.LoginAttempt{
-		Username:  req.Username,
+		Username:  user.Username,
 		IP:        clientIP,
 		Success:   true,
 		UserAgent: c.GetHeader("User-Agent"),
 	})
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+	response := gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenDuration.Seconds()),
 		"user": gin.H{
 			"id":         user.ID,
 			"username":   user.Username,
@@ -425,7 +834,20 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			"first_name": user.FirstName,
 			"last_name":  user.LastName,
 		},
-	})
+	}
+
+	// Users of roles that require a security key may only enrol one until
+	// they sign in with it.
+	if h.mfaPolicy.RequiredFor(user.Role) && !auth.IsPhishingResistant(authMethods) {
+		response["mfa_enrollment_required"] = true
+	}
+
+	// An expired password only matters when it was used to sign in
+	if utils.Contains(authMethods, auth.AuthMethodPassword) && h.passwords.PasswordExpired(user) {
+		response["password_change_required"] = true
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -446,8 +868,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	if !utils.IsValidPassword(req.Password) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters with uppercase, lowercase, and number"})
+	if err := h.passwords.Validate(req.Password, auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		Username: req.Username,
+		Email:    req.Email,
+	}); err != nil {
+		respondPasswordError(c, err)
 		return
 	}
 
@@ -466,30 +892,35 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Create user
+	now := time.Now()
 	user := models.User{
-		Username:  req.Username,
-		Email:     req.Email,
-		Password:  hashedPassword,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		Role:      "user",
-		Status:    "active",
+		Username:          req.Username,
+		Email:             req.Email,
+		Password:          hashedPassword,
+		PasswordChangedAt: &now,
+		FirstName:         req.FirstName,
+		LastName:          req.LastName,
+		Role:              "user",
+		Status:            "active",
 	}
 
 	if err := h.db.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	h.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindPanel, OwnerID: user.ID}, hashedPassword)
 
-	// Generate JWT token
-	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role)
+	clientIP := c.ClientIP()
+	token, refreshToken, err := h.startSession(c, &user, clientIP, "", []string{auth.AuthMethodPassword})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenDuration.Seconds()),
 		"user": gin.H{
 			"id":         user.ID,
 			"username":   user.Username,
@@ -501,6 +932,83 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	})
 }
 
+// RefreshToken rotates the refresh token and issues a new access token for the
+// same session. Reusing an old refresh token revokes the session.
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+
+	session, refreshToken, err := h.sessions.Rotate(req.RefreshToken, clientIP, c.GetHeader("User-Agent"))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			h.logger.Error(fmt.Sprintf("Refresh token reuse detected from %s, session revoked", clientIP))
+			h.db.Create(&models.SecurityEvent{
+				Type:        "refresh_token_reuse",
+				Severity:    "high",
+				Source:      clientIP,
+				Description: "A rotated refresh token was presented again; the session was revoked",
+			})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, session.UserID).Error; err != nil || user.Status != "active" {
+		h.sessions.Revoke(session.ID, 0, "account_inactive")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenDuration.Seconds()),
+	})
+}
+
+// Logout revokes the current session, or every session of the user when
+// all_sessions is set.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	c.ShouldBindJSON(&req)
+
+	userID := c.GetUint("user_id")
+	sessionID := c.GetString("session_id")
+
+	if req.AllSessions && c.GetUint("impersonator_id") != 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "Cannot sign the user out of all sessions while impersonating",
+			"impersonating": true,
+		})
+		return
+	}
+
+	var err error
+	if req.AllSessions {
+		_, err = h.sessions.RevokeAll(userID, "", "logout")
+	} else {
+		err = h.sessions.RevokeByPublicID(sessionID, "logout")
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -514,7 +1022,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"user": gin.H{
 			"id":                 user.ID,
 			"username":           user.Username,
@@ -530,7 +1038,20 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 			"package":            user.Package,
 			"created_at":         user.CreatedAt,
 		},
-	})
+	}
+
+	// Lets the frontend show a banner while support is signed in as the user
+	if actorID := c.GetUint("impersonator_id"); actorID != 0 {
+		response["impersonating"] = true
+		response["impersonator"] = gin.H{
+			"id":       actorID,
+			"username": c.GetString("impersonator_username"),
+		}
+	} else {
+		response["impersonating"] = false
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AuthHandler) UpdateProfile(c *gin.Context) {
@@ -538,28 +1059,276 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
+// ChangePassword replaces the user's panel password after checking the
+// current one and the password policy. Every other session of the user is
+// signed out.
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
-	// Implementation for changing password
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if h.passwords.DirectoryManaged(user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your password is managed by your organisation's directory"})
+		return
+	}
+
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	subject := auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		OwnerID:  user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if err := h.passwords.Validate(req.NewPassword, subject); err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.Model(&user).Updates(map[string]interface{}{
+		"password":            hashedPassword,
+		"password_changed_at": now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if err := h.passwords.Record(subject, hashedPassword); err != nil {
+		h.logger.Error(err.Error())
+	}
+
+	if err := h.resets.Invalidate(user.ID); err != nil {
+		h.logger.Error(err.Error())
+	}
+
+	// Anyone holding a session opened with the old password is signed out
+	if _, err := h.sessions.RevokeAll(user.ID, c.GetString("session_id"), "password_changed"); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to revoke sessions of user %d after password change: %v", user.ID, err))
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
 
+// Enable2FA generates a TOTP secret for the user to add to an
+// authenticator app. It is not required at sign-in until confirmed with
+// Confirm2FA.
 func (h *AuthHandler) Enable2FA(c *gin.Context) {
-	// Implementation for enabling 2FA
-	c.JSON(http.StatusOK, gin.H{"message": "2FA enabled successfully"})
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	secret, otpauthURL, err := h.twoFactor.Begin(&user)
+	if errors.Is(err, auth.ErrTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrolment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": otpauthURL,
+	})
 }
 
+// Confirm2FA turns two-factor authentication on with a code from the
+// authenticator app and returns the backup codes, which are not shown
+// again.
+func (h *AuthHandler) Confirm2FA(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	codes, err := h.twoFactor.Confirm(&user, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, auth.ErrTwoFactorEnabled), errors.Is(err, auth.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Two-factor authentication enabled by user %d", user.ID))
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "2FA enabled successfully",
+		"backup_codes": codes,
+	})
+}
+
+// Disable2FA turns two-factor authentication off after checking a current
+// code or backup code.
 func (h *AuthHandler) Disable2FA(c *gin.Context) {
-	// Implementation for disabling 2FA
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": auth.ErrTwoFactorNotEnabled.Error()})
+		return
+	}
+	if !h.twoFactor.Verify(&user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrInvalidTwoFactorCode.Error()})
+		return
+	}
+
+	if err := h.twoFactor.Disable(user.ID); err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Two-factor authentication disabled by user %d", user.ID))
 	c.JSON(http.StatusOK, gin.H{"message": "2FA disabled successfully"})
 }
 
+// ForgotPassword mails a reset link to the account with the given email
+// address or username. The response is the same whether or not there is
+// such an account, and the work happens after responding so the response
+// time does not tell either.
 func (h *AuthHandler) ForgotPassword(c *gin.Context) {
-	// Implementation for forgot password
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset email sent"})
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	go h.sendPasswordReset(strings.TrimSpace(req.Email), clientIP)
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset link has been sent to its email address"})
 }
 
+func (h *AuthHandler) sendPasswordReset(login, clientIP string) {
+	var user models.User
+	if err := h.db.Where("email = ? OR username = ?", login, login).First(&user).Error; err != nil {
+		return
+	}
+
+	token, err := h.resets.Issue(&user, clientIP)
+	if err != nil {
+		h.logger.Info(fmt.Sprintf("Password reset for user %d from %s not sent: %v", user.ID, clientIP, err))
+		return
+	}
+
+	resetURL := services.PanelURL(h.db, user.ResellerID) + "/reset-password?token=" + url.QueryEscape(token)
+	if err := h.mail.EnqueueTemplateUntil(services.MailTemplatePasswordReset, user.ResellerID, user.Email, map[string]interface{}{
+		"User":      services.NewMailUser(&user),
+		"ResetURL":  resetURL,
+		"ExpiresIn": fmt.Sprintf("%d minutes", int(h.resets.TTL().Minutes())),
+	}, time.Now().Add(h.resets.TTL())); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to queue password reset for user %d: %v", user.ID, err))
+		return
+	}
+	h.logger.Info(fmt.Sprintf("Password reset for user %d requested from %s", user.ID, clientIP))
+}
+
+// ResetPassword sets a new password with a token from a reset link, signs
+// out every session, forgets the trusted devices and tells the user by email.
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
-	// Implementation for reset password
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token is only used up once the password has been accepted
+	user, err := h.resets.Lookup(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrInvalidResetToken.Error()})
+		return
+	}
+
+	subject := auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		OwnerID:  user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if err := h.passwords.Validate(req.NewPassword, subject); err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = h.resets.Redeem(req.Token, func(tx *gorm.DB, user *models.User) error {
+		return tx.Model(user).Updates(map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": time.Now(),
+		}).Error
+	})
+	if errors.Is(err, auth.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to reset password of user %d: %v", user.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if err := h.passwords.Record(subject, hashedPassword); err != nil {
+		h.logger.Error(err.Error())
+	}
+
+	if _, err := h.sessions.RevokeAll(user.ID, "", "password_reset"); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to revoke sessions of user %d after password reset: %v", user.ID, err))
+	}
+
+	clientIP := c.ClientIP()
+	if err := h.mail.EnqueueTemplate(services.MailTemplatePasswordChanged, user.ResellerID, user.Email, map[string]interface{}{
+		"User":     services.NewMailUser(user),
+		"ClientIP": clientIP,
+	}); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to queue password change notice for user %d: %v", user.ID, err))
+	}
+
+	h.logger.Info(fmt.Sprintf("Password of user %d reset from %s", user.ID, clientIP))
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
@@ -568,6 +1337,45 @@ func (h *AuthHandler) Verify2FA(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "2FA verified successfully"})
 }
 
+// startSession registers a session for the user and returns an access token
+// bound to it together with the session's first refresh token.
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, clientIP, device string, authMethods []string) (string, string, error) {
+	session, refreshToken, err := h.sessions.Create(user.ID, clientIP, c.GetHeader("User-Agent"), device, authMethods)
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role, session)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
 func (h *AuthHandler) generateTempToken(userID uint) string {
 	return utils.GenerateRandomString(32) + ":" + strconv.Itoa(int(userID))
 }
+
+// tooManyAttempts responds to an attempt held back by brute-force protection.
+func tooManyAttempts(c *gin.Context, decision auth.BruteForceDecision) {
+	retryAfter := int(decision.RetryAfter/time.Second) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed attempts. Please try again later.",
+		"retry_after": retryAfter,
+	})
+}
+
+// respondPasswordError reports a password the policy rejected, or a failure
+// to check it.
+func respondPasswordError(c *gin.Context, err error) {
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": policyErr.Violations,
+		})
+		return
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to check the password right now, please try again"})
+}
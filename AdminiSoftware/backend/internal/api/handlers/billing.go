@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BillingHandler serves metered usage and monthly statements. Administrators
+// see every statement, resellers their own and those they issued to their
+// customers, and customers their own.
+type BillingHandler struct {
+	db      *gorm.DB
+	billing *services.BillingService
+	logger  *utils.Logger
+}
+
+func NewBillingHandler(db *gorm.DB, logger *utils.Logger) *BillingHandler {
+	return &BillingHandler{
+		db:      db,
+		billing: services.NewBillingService(db, logger),
+		logger:  logger,
+	}
+}
+
+type GenerateStatementsRequest struct {
+	Period string `json:"period" binding:"required"`
+}
+
+// ListStatements lists statements, optionally of one period or kind.
+func (h *BillingHandler) ListStatements(c *gin.Context) {
+	statements, err := h.billing.List(h.scope(c), c.Query("period"), c.Query("kind"))
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load statements"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
+
+// GetStatement returns a statement as JSON, or as CSV or PDF with format.
+func (h *BillingHandler) GetStatement(c *gin.Context) {
+	h.serveStatement(c, h.scope(c))
+}
+
+// MyStatements lists the customer's own statements.
+func (h *BillingHandler) MyStatements(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	statements, err := h.billing.List(services.StatementScope{CustomerID: &userID}, c.Query("period"), "")
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load statements"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
+
+// MyStatement returns one of the customer's own statements.
+func (h *BillingHandler) MyStatement(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	h.serveStatement(c, services.StatementScope{CustomerID: &userID})
+}
+
+// GenerateStatements prices a month that has ended. Statements already
+// issued for it are kept; when some cannot be stored, the others still are
+// and running it again adds the rest.
+func (h *BillingHandler) GenerateStatements(c *gin.Context) {
+	var req GenerateStatementsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.billing.Generate(req.Period)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate statements", "created": created})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"period": req.Period, "created": created})
+}
+
+// Export feeds statement lines to accounting. Callers pass the next_since
+// of the previous page to receive only lines added since.
+func (h *BillingHandler) Export(c *gin.Context) {
+	since, _ := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "0"))
+
+	rows, err := h.billing.Export(uint(since), limit)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export statements"})
+		return
+	}
+	next := uint(since)
+	if len(rows) > 0 {
+		next = rows[len(rows)-1].LineID
+	}
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		if err := h.billing.WriteExportCSV(rows, &buf); err != nil {
+			h.logger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export statements"})
+			return
+		}
+		c.Header("X-Next-Since", strconv.FormatUint(uint64(next), 10))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lines": rows, "next_since": next})
+}
+
+// AccountMeter returns an account's daily readings of a month, the current
+// one by default.
+func (h *BillingHandler) AccountMeter(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "billing:read")
+	if !ok {
+		return
+	}
+
+	period := c.DefaultQuery("period", time.Now().Format("2006-01"))
+	readings, err := h.billing.Readings(account.ID, period)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+			return
+		}
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load meter readings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"period": period, "readings": readings})
+}
+
+func (h *BillingHandler) serveStatement(c *gin.Context, scope services.StatementScope) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid statement ID"})
+		return
+	}
+	statement, err := h.billing.Get(uint(id), scope)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Statement not found"})
+		return
+	}
+
+	switch c.Query("format") {
+	case "csv":
+		var buf bytes.Buffer
+		if err := h.billing.WriteCSV(statement, &buf); err != nil {
+			h.logger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement"})
+			return
+		}
+		h.attach(c, statement, "csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "pdf":
+		h.attach(c, statement, "pdf")
+		c.Data(http.StatusOK, "application/pdf", h.billing.PDF(statement))
+	default:
+		c.JSON(http.StatusOK, gin.H{"statement": statement})
+	}
+}
+
+func (h *BillingHandler) attach(c *gin.Context, statement *models.Statement, extension string) {
+	c.Header("Content-Disposition", `attachment; filename="statement-`+statement.Number+`.`+extension+`"`)
+}
+
+// scope is unrestricted for callers holding billing:read globally and the
+// caller's reseller otherwise.
+func (h *BillingHandler) scope(c *gin.Context) services.StatementScope {
+	if isGlobal(c, "billing:read") {
+		return services.StatementScope{}
+	}
+	resellerID := middleware.ResellerID(c)
+	return services.StatementScope{ResellerID: &resellerID}
+}
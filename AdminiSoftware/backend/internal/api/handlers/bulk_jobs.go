@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBulkCSVSize bounds account imports uploaded as a file.
+const maxBulkCSVSize = 5 << 20
+
+// BulkJobHandler starts operations on many accounts and reports on them.
+// Administrators work on any accounts; resellers on their own customers.
+type BulkJobHandler struct {
+	db     *gorm.DB
+	jobs   *services.BulkJobService
+	logger *utils.Logger
+}
+
+func NewBulkJobHandler(db *gorm.DB, logger *utils.Logger) *BulkJobHandler {
+	return &BulkJobHandler{
+		db:     db,
+		jobs:   services.NewBulkJobService(db, logger),
+		logger: logger,
+	}
+}
+
+// StartBulkJobRequest is sent as JSON or, to upload an account import as
+// the file field, as a multipart form.
+type StartBulkJobRequest struct {
+	AccountIDs  []uint `json:"account_ids" form:"account_ids"`
+	CSV         string `json:"csv" form:"csv"`
+	PackageID   uint   `json:"package_id" form:"package_id"`
+	Force       bool   `json:"force" form:"force"`
+	Reason      string `json:"reason" form:"reason" binding:"max=500"`
+	DryRun      bool   `json:"dry_run" form:"dry_run"`
+	Concurrency int    `json:"concurrency" form:"concurrency" binding:"min=0,max=16"`
+}
+
+// Start returns a handler that starts a bulk job of the operation. The
+// route checks the permission the operation needs.
+func (h *BulkJobHandler) Start(operation, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req StartBulkJobRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if operation == services.BulkCreate {
+			if file, err := c.FormFile("file"); err == nil {
+				if file.Size > maxBulkCSVSize {
+					c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Account import is too large"})
+					return
+				}
+				upload, err := file.Open()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read account import"})
+					return
+				}
+				data, err := io.ReadAll(io.LimitReader(upload, maxBulkCSVSize))
+				upload.Close()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read account import"})
+					return
+				}
+				req.CSV = string(data)
+			}
+		}
+
+		scope := h.scope(c, permission)
+		if req.Force && scope != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can force a package change"})
+			return
+		}
+
+		job, err := h.jobs.Start(services.BulkJobRequest{
+			Operation:   operation,
+			ResellerID:  scope,
+			ActorID:     c.GetUint("user_id"),
+			AccountIDs:  req.AccountIDs,
+			CSV:         req.CSV,
+			PackageID:   req.PackageID,
+			Force:       req.Force,
+			Reason:      req.Reason,
+			DryRun:      req.DryRun,
+			Concurrency: req.Concurrency,
+			ClientIP:    c.ClientIP(),
+		})
+		if err != nil {
+			h.respondError(c, err, "Failed to start bulk job")
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// ListJobs returns the most recent bulk jobs.
+func (h *BulkJobHandler) ListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	jobs, err := h.jobs.List(h.scope(c, "accounts:read"), limit)
+	if err != nil {
+		h.respondError(c, err, "Failed to list bulk jobs")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// GetJob returns a bulk job with the result for every account.
+func (h *BulkJobHandler) GetJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobs.Get(uint(id), h.scope(c, "accounts:read"))
+	if err != nil {
+		h.respondError(c, err, "Failed to load bulk job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob stops a running bulk job; accounts not reached are skipped.
+func (h *BulkJobHandler) CancelJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	if err := h.jobs.Cancel(uint(id), h.scope(c, "accounts:update")); err != nil {
+		h.respondError(c, err, "Failed to cancel bulk job")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Bulk job is being cancelled"})
+}
+
+// scope is nil for callers holding the permission globally and the
+// caller's reseller otherwise.
+func (h *BulkJobHandler) scope(c *gin.Context, permission string) *uint {
+	if isGlobal(c, permission) {
+		return nil
+	}
+	resellerID := middleware.ResellerID(c)
+	return &resellerID
+}
+
+func (h *BulkJobHandler) respondError(c *gin.Context, err error, message string) {
+	if status, ok := services.BulkJobErrorStatus(err); ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	h.logger.Error(err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailTemplateHandler manages overrides of the emails sent to customers.
+// Resellers brand the emails of their own customers; administrators change
+// the panel-wide templates, or a reseller's with ?reseller_id=.
+type EmailTemplateHandler struct {
+	db     *gorm.DB
+	logger *utils.Logger
+}
+
+func NewEmailTemplateHandler(db *gorm.DB, logger *utils.Logger) *EmailTemplateHandler {
+	return &EmailTemplateHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type EmailTemplateRequest struct {
+	Subject  string `json:"subject" binding:"required"`
+	TextBody string `json:"text_body" binding:"required"`
+	HTMLBody string `json:"html_body"`
+}
+
+// ListTemplates returns every template as the caller's customers receive it,
+// and whether the caller has overridden it.
+func (h *EmailTemplateHandler) ListTemplates(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	templates := make([]gin.H, 0, len(services.MailTemplateNames()))
+	for _, name := range services.MailTemplateNames() {
+		effective, err := services.ResolveMailTemplate(h.db, name, owner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load email templates"})
+			return
+		}
+		builtIn, _ := services.DefaultMailTemplate(name)
+		templates = append(templates, gin.H{
+			"name":       name,
+			"template":   effective,
+			"overridden": effective.ID != 0 && sameOwner(effective.ResellerID, owner),
+			"default":    builtIn,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// UpdateTemplate saves the caller's version of a template after checking
+// that it renders.
+func (h *EmailTemplateHandler) UpdateTemplate(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	var req EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := models.EmailTemplate{
+		ResellerID: owner,
+		Name:       c.Param("name"),
+		Subject:    req.Subject,
+		TextBody:   req.TextBody,
+		HTMLBody:   req.HTMLBody,
+	}
+	if err := services.ValidateMailTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing models.EmailTemplate
+	if err := h.scoped(owner).Where("name = ?", template.Name).First(&existing).Error; err == nil {
+		template.ID = existing.ID
+		template.CreatedAt = existing.CreatedAt
+	}
+	if err := h.db.Save(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email template"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Email template %s of %s updated by user %d", template.Name, templateOwnerName(owner), c.GetUint("user_id")))
+	c.JSON(http.StatusOK, template)
+}
+
+// ResetTemplate deletes the caller's version of a template, so the
+// panel-wide or built-in one applies again.
+func (h *EmailTemplateHandler) ResetTemplate(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(owner).Where("name = ?", c.Param("name")).Delete(&models.EmailTemplate{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset email template"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Email template %s of %s reset by user %d", c.Param("name"), templateOwnerName(owner), c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Email template reset to default"})
+}
+
+// owner returns the reseller whose templates the caller manages, nil for the
+// panel-wide ones. It writes the error response itself.
+func (h *EmailTemplateHandler) owner(c *gin.Context) (*uint, bool) {
+	if !isGlobal(c, "branding:manage") {
+		resellerID := middleware.ResellerID(c)
+		return &resellerID, true
+	}
+
+	query := c.Query("reseller_id")
+	if query == "" {
+		return nil, true
+	}
+	id, err := strconv.Atoi(query)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reseller ID"})
+		return nil, false
+	}
+	resellerID := uint(id)
+	return &resellerID, true
+}
+
+func (h *EmailTemplateHandler) scoped(owner *uint) *gorm.DB {
+	if owner == nil {
+		return h.db.Where("reseller_id IS NULL")
+	}
+	return h.db.Where("reseller_id = ?", *owner)
+}
+
+func sameOwner(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func templateOwnerName(owner *uint) string {
+	if owner == nil {
+		return "the panel"
+	}
+	return fmt.Sprintf("reseller %d", *owner)
+}
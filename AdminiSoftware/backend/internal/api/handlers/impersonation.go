@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ImpersonationHandler struct {
+	db            *gorm.DB
+	impersonation *auth.ImpersonationManager
+	permissions   *auth.PermissionResolver
+	logger        *utils.Logger
+}
+
+func NewImpersonationHandler(db *gorm.DB, jwtManager *auth.JWTManager, logger *utils.Logger) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		db:            db,
+		impersonation: auth.NewImpersonationManager(db, jwtManager),
+		permissions:   auth.NewPermissionResolver(db),
+		logger:        logger,
+	}
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// StartImpersonation mints a short-lived token to act as the account. Callers
+// holding accounts:impersonate globally may impersonate any non-admin;
+// resellers only the customers of the reseller they act for. Either way the
+// caller must hold every permission the account has, so impersonation never
+// widens what they can do.
+func (h *ImpersonationHandler) StartImpersonation(c *gin.Context) {
+	if _, isToken := c.Get("api_token_id"); isToken {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation requires an interactive session"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to impersonate a user"})
+		return
+	}
+
+	var actor models.User
+	if err := h.db.First(&actor, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var subject models.User
+	if err := h.db.First(&subject, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	if subject.ID == actor.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself"})
+		return
+	}
+	if subject.Role == "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Administrators cannot be impersonated"})
+		return
+	}
+	value, _ := c.Get("user_permissions")
+	grants, ok := value.(*auth.Grants)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User permissions not found"})
+		return
+	}
+	held := grants.Global
+	if !grants.Allows("accounts:impersonate") {
+		resellerID := middleware.ResellerID(c)
+		if subject.ResellerID == nil || *subject.ResellerID != resellerID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		held = append(append([]string{}, grants.Global...), grants.Scoped[resellerID]...)
+	}
+
+	subjectGrants, err := h.permissions.Resolve(subject.ID, subject.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve account permissions"})
+		return
+	}
+	if !auth.CoversAll(held, subjectGrants.All()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot impersonate an account with permissions you do not hold"})
+		return
+	}
+	if subject.Status != "active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	actorMethods, _ := c.Get("auth_methods")
+	methods, _ := actorMethods.([]string)
+	clientIP := c.ClientIP()
+
+	token, impersonation, err := h.impersonation.Start(&actor, &subject, req.Reason, clientIP, c.GetHeader("User-Agent"), methods)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to start impersonation of user %d by %d: %v", subject.ID, actor.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	h.db.Create(&models.SecurityEvent{
+		Type:        "impersonation_started",
+		Severity:    "info",
+		Source:      clientIP,
+		Description: fmt.Sprintf("%s signed in as %s: %s", actor.Username, subject.Username, req.Reason),
+		UserID:      &subject.ID,
+	})
+	h.logger.Info(fmt.Sprintf("User %s started impersonating %s", actor.Username, subject.Username))
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":            token,
+		"expires_in":       int(auth.ImpersonationDuration.Seconds()),
+		"impersonating":    true,
+		"impersonation_id": impersonation.ID,
+		"user": gin.H{
+			"id":       subject.ID,
+			"username": subject.Username,
+			"email":    subject.Email,
+			"role":     subject.Role,
+		},
+	})
+}
+
+// EndImpersonation is called with the impersonation token to hand control
+// back; the token stops working immediately.
+func (h *ImpersonationHandler) EndImpersonation(c *gin.Context) {
+	actorID := c.GetUint("impersonator_id")
+	if actorID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+
+	if err := h.impersonation.End(c.GetUint("impersonation_id"), actorID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+// ListImpersonations returns recent impersonations, optionally filtered by
+// ?actor_id or ?subject_id.
+func (h *ImpersonationHandler) ListImpersonations(c *gin.Context) {
+	query, ok := filterAudit(c, h.db.Preload("Actor").Preload("Subject"))
+	if !ok {
+		return
+	}
+
+	var impersonations []models.Impersonation
+	if err := query.Order("created_at DESC").Limit(200).Find(&impersonations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": impersonations})
+}
+
+// ListAuditLog returns the requests made while impersonating and the
+// sensitive actions staff took on accounts, optionally filtered by
+// ?actor_id, ?subject_id, ?impersonation_id or ?action.
+func (h *ImpersonationHandler) ListAuditLog(c *gin.Context) {
+	query, ok := filterAudit(c, h.db)
+	if !ok {
+		return
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if value := c.Query("impersonation_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID"})
+			return
+		}
+		query = query.Where("impersonation_id = ?", id)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC").Limit(500).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func filterAudit(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	for _, field := range []string{"actor_id", "subject_id"} {
+		value := c.Query(field)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field})
+			return nil, false
+		}
+		query = query.Where(field+" = ?", id)
+	}
+	return query, true
+}
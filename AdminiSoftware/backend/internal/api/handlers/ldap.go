@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LDAPDirectoryHandler manages the LDAP directories panel logins are checked
+// against. Like identity providers, resellers only manage their own.
+type LDAPDirectoryHandler struct {
+	db     *gorm.DB
+	ldap   *auth.LDAPManager
+	logger *utils.Logger
+}
+
+func NewLDAPDirectoryHandler(db *gorm.DB, logger *utils.Logger) *LDAPDirectoryHandler {
+	return &LDAPDirectoryHandler{
+		db:     db,
+		ldap:   services.NewLDAPManager(db, logger),
+		logger: logger,
+	}
+}
+
+type LDAPDirectoryRequest struct {
+	Name               string `json:"name" binding:"required"`
+	ResellerID         *uint  `json:"reseller_id"`
+	URL                string `json:"url" binding:"required"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	BindDN             string `json:"bind_dn"`
+	BindPassword       string `json:"bind_password"`
+	BaseDN             string `json:"base_dn" binding:"required"`
+	UserFilter         string `json:"user_filter"`
+	UserDNTemplate     string `json:"user_dn_template"`
+	EmailAttribute     string `json:"email_attribute"`
+	FirstNameAttribute string `json:"first_name_attribute"`
+	LastNameAttribute  string `json:"last_name_attribute"`
+	GroupAttribute     string `json:"group_attribute"`
+	GroupBaseDN        string `json:"group_base_dn"`
+	GroupFilter        string `json:"group_filter"`
+	AdminGroups        string `json:"admin_groups"`
+	ResellerGroups     string `json:"reseller_groups"`
+	UserGroups         string `json:"user_groups"`
+	DefaultRole        string `json:"default_role"`
+	AutoProvision      *bool  `json:"auto_provision"`
+	SyncEnabled        *bool  `json:"sync_enabled"`
+	Enabled            *bool  `json:"enabled"`
+}
+
+func (h *LDAPDirectoryHandler) ListDirectories(c *gin.Context) {
+	var directories []models.LDAPDirectory
+	if err := h.scoped(c).Order("name").Find(&directories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch directories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"directories": directories})
+}
+
+func (h *LDAPDirectoryHandler) CreateDirectory(c *gin.Context) {
+	var req LDAPDirectoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	directory := models.LDAPDirectory{
+		UserFilter:         "(uid=%s)",
+		EmailAttribute:     "mail",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		GroupAttribute:     "memberOf",
+		GroupFilter:        "(|(member=%s)(uniqueMember=%s))",
+		DefaultRole:        "user",
+		AutoProvision:      true,
+		SyncEnabled:        true,
+		Enabled:            true,
+	}
+	if !h.apply(c, &directory, &req) {
+		return
+	}
+
+	if err := h.db.Create(&directory).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("LDAP directory %q (%s) created by user %d", directory.Name, directory.URL, c.GetUint("user_id")))
+	c.JSON(http.StatusCreated, directory)
+}
+
+func (h *LDAPDirectoryHandler) UpdateDirectory(c *gin.Context) {
+	directory, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	var req LDAPDirectoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.apply(c, directory, &req) {
+		return
+	}
+
+	if err := h.db.Save(directory).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update directory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, directory)
+}
+
+// DeleteDirectory removes a directory and its links. Linked users keep their
+// accounts but can only sign in once they set a local password.
+func (h *LDAPDirectoryHandler) DeleteDirectory(c *gin.Context) {
+	directory, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("directory_id = ?", directory.ID).Delete(&models.LDAPIdentity{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(directory).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete directory"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("LDAP directory %q deleted by user %d", directory.Name, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Directory deleted"})
+}
+
+// TestDirectory checks the connection and service account of a saved
+// directory.
+func (h *LDAPDirectoryHandler) TestDirectory(c *gin.Context) {
+	directory, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if err := h.ldap.Test(directory); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Connection successful"})
+}
+
+// SyncDirectory runs a sync now instead of waiting for the next scheduled one.
+func (h *LDAPDirectoryHandler) SyncDirectory(c *gin.Context) {
+	directory, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.ldap.Sync(directory)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("LDAP directory %q synced by user %d", directory.Name, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, result)
+}
+
+// ListIdentities lists the users linked to a directory.
+func (h *LDAPDirectoryHandler) ListIdentities(c *gin.Context) {
+	directory, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	var identities []models.LDAPIdentity
+	if err := h.db.Preload("User").Where("directory_id = ?", directory.ID).Order("username").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// scoped restricts queries to the reseller's directories unless the caller
+// holds sso:manage globally.
+func (h *LDAPDirectoryHandler) scoped(c *gin.Context) *gorm.DB {
+	if isGlobal(c, "sso:manage") {
+		return h.db
+	}
+	return h.db.Where("reseller_id = ?", middleware.ResellerID(c))
+}
+
+func (h *LDAPDirectoryHandler) find(c *gin.Context) (*models.LDAPDirectory, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid directory ID"})
+		return nil, false
+	}
+
+	var directory models.LDAPDirectory
+	if err := h.scoped(c).First(&directory, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found"})
+		return nil, false
+	}
+	return &directory, true
+}
+
+// apply copies the request onto the directory. It writes the error response
+// itself.
+func (h *LDAPDirectoryHandler) apply(c *gin.Context, directory *models.LDAPDirectory, req *LDAPDirectoryRequest) bool {
+	if req.DefaultRole != "" && req.DefaultRole != "admin" && req.DefaultRole != "reseller" && req.DefaultRole != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.DefaultRole})
+		return false
+	}
+
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "ldap" && parsed.Scheme != "ldaps") || parsed.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Directory URL must be ldap://host[:port] or ldaps://host[:port]"})
+		return false
+	}
+	if req.UserFilter != "" && !strings.Contains(req.UserFilter, "%s") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User filter must contain %s for the login name"})
+		return false
+	}
+	if req.UserDNTemplate != "" && !strings.Contains(req.UserDNTemplate, "%s") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User DN template must contain %s for the login name"})
+		return false
+	}
+
+	directory.Name = req.Name
+	directory.URL = req.URL
+	directory.StartTLS = req.StartTLS
+	directory.InsecureSkipVerify = req.InsecureSkipVerify
+	directory.BindDN = req.BindDN
+	if req.BindPassword != "" {
+		directory.BindPassword = req.BindPassword
+	}
+	directory.BaseDN = req.BaseDN
+	if req.UserFilter != "" {
+		directory.UserFilter = req.UserFilter
+	}
+	directory.UserDNTemplate = req.UserDNTemplate
+	if req.EmailAttribute != "" {
+		directory.EmailAttribute = req.EmailAttribute
+	}
+	if req.FirstNameAttribute != "" {
+		directory.FirstNameAttribute = req.FirstNameAttribute
+	}
+	if req.LastNameAttribute != "" {
+		directory.LastNameAttribute = req.LastNameAttribute
+	}
+	if req.GroupAttribute != "" {
+		directory.GroupAttribute = req.GroupAttribute
+	}
+	directory.GroupBaseDN = req.GroupBaseDN
+	if req.GroupFilter != "" {
+		directory.GroupFilter = req.GroupFilter
+	}
+	directory.AdminGroups = req.AdminGroups
+	directory.ResellerGroups = req.ResellerGroups
+	directory.UserGroups = req.UserGroups
+	if req.DefaultRole != "" {
+		directory.DefaultRole = req.DefaultRole
+	}
+	if req.AutoProvision != nil {
+		directory.AutoProvision = *req.AutoProvision
+	}
+	if req.SyncEnabled != nil {
+		directory.SyncEnabled = *req.SyncEnabled
+	}
+	if req.Enabled != nil {
+		directory.Enabled = *req.Enabled
+	}
+
+	// Resellers always own their directories, which can only sign in customers.
+	if isGlobal(c, "sso:manage") {
+		directory.ResellerID = req.ResellerID
+	} else {
+		resellerID := middleware.ResellerID(c)
+		directory.ResellerID = &resellerID
+		directory.AdminGroups = ""
+		directory.ResellerGroups = ""
+		directory.DefaultRole = "user"
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LockoutHandler struct {
+	db         *gorm.DB
+	bruteForce *auth.BruteForceProtection
+	logger     *utils.Logger
+}
+
+func NewLockoutHandler(db *gorm.DB, bruteForce *auth.BruteForceProtection, logger *utils.Logger) *LockoutHandler {
+	return &LockoutHandler{
+		db:         db,
+		bruteForce: bruteForce,
+		logger:     logger,
+	}
+}
+
+type ReleaseLockoutRequest struct {
+	Scope    string `json:"scope" binding:"required,oneof=ip user pair"`
+	Source   string `json:"source"`
+	IP       string `json:"ip"`
+	Username string `json:"username"`
+}
+
+// ListLockouts returns the lockouts in force on every node.
+func (h *LockoutHandler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.bruteForce.Lockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockouts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// ReleaseLockout lifts a lockout before it expires, including the firewall
+// block of a locked IP.
+func (h *LockoutHandler) ReleaseLockout(c *gin.Context) {
+	var req ReleaseLockoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Scope != auth.LockScopeUser && net.ParseIP(req.IP) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid IP address is required"})
+		return
+	}
+	if req.Scope != auth.LockScopeIP && (req.Source == "" || req.Username == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and username are required"})
+		return
+	}
+
+	if err := h.bruteForce.Release(req.Scope, req.Source, req.IP, req.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release lockout"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Lockout %s %s %s %s released by admin %d", req.Scope, req.Source, req.IP, req.Username, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout released"})
+}
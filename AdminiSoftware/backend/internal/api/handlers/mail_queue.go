@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MailQueueHandler lets administrators see what the outbox is doing and
+// send failed messages again.
+type MailQueueHandler struct {
+	db     *gorm.DB
+	mail   *services.MailQueue
+	logger *utils.Logger
+}
+
+func NewMailQueueHandler(db *gorm.DB, logger *utils.Logger) *MailQueueHandler {
+	return &MailQueueHandler{
+		db:     db,
+		mail:   services.NewMailQueue(db, logger),
+		logger: logger,
+	}
+}
+
+// ListMail returns the newest 100 messages, optionally only those with
+// ?status=.
+func (h *MailQueueHandler) ListMail(c *gin.Context) {
+	query := h.db.Order("created_at DESC").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var messages []models.OutboundMail
+	if err := query.Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list emails"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"emails": messages})
+}
+
+// RetryMail queues a failed message for delivery again.
+func (h *MailQueueHandler) RetryMail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return
+	}
+
+	err = h.mail.Retry(uint(id))
+	if errors.Is(err, services.ErrMailNotRetryable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry email"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Email %d queued again by admin %d", id, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Email queued for delivery"})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OIDCProviderHandler manages single sign-on providers. Admins see every
+// provider; resellers only manage the ones serving their own customers.
+type OIDCProviderHandler struct {
+	db     *gorm.DB
+	oidc   *auth.OIDCManager
+	logger *utils.Logger
+}
+
+func NewOIDCProviderHandler(db *gorm.DB, logger *utils.Logger) *OIDCProviderHandler {
+	return &OIDCProviderHandler{
+		db:     db,
+		oidc:   auth.NewOIDCManager(db),
+		logger: logger,
+	}
+}
+
+type OIDCProviderRequest struct {
+	Name           string `json:"name" binding:"required"`
+	ResellerID     *uint  `json:"reseller_id"`
+	Issuer         string `json:"issuer" binding:"required,url"`
+	ClientID       string `json:"client_id" binding:"required"`
+	ClientSecret   string `json:"client_secret"`
+	Scopes         string `json:"scopes"`
+	GroupsClaim    string `json:"groups_claim"`
+	AdminGroups    string `json:"admin_groups"`
+	ResellerGroups string `json:"reseller_groups"`
+	UserGroups     string `json:"user_groups"`
+	DefaultRole    string `json:"default_role"`
+	AutoProvision  *bool  `json:"auto_provision"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+func (h *OIDCProviderHandler) ListProviders(c *gin.Context) {
+	var providers []models.OIDCProvider
+	if err := h.scoped(c).Order("name").Find(&providers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identity providers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers":    providers,
+		"redirect_url": h.oidc.RedirectURL(),
+	})
+}
+
+func (h *OIDCProviderHandler) CreateProvider(c *gin.Context) {
+	var req OIDCProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider := models.OIDCProvider{
+		GroupsClaim:   "groups",
+		DefaultRole:   "user",
+		Scopes:        "openid profile email",
+		AutoProvision: true,
+		Enabled:       true,
+	}
+	if !h.apply(c, &provider, &req) {
+		return
+	}
+
+	if err := h.db.Create(&provider).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create identity provider"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Identity provider %q (%s) created by user %d", provider.Name, provider.Issuer, c.GetUint("user_id")))
+	c.JSON(http.StatusCreated, provider)
+}
+
+func (h *OIDCProviderHandler) UpdateProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid provider ID"})
+		return
+	}
+
+	var provider models.OIDCProvider
+	if err := h.scoped(c).First(&provider, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	var req OIDCProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.apply(c, &provider, &req) {
+		return
+	}
+
+	if err := h.db.Save(&provider).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update identity provider"})
+		return
+	}
+
+	c.JSON(http.StatusOK, provider)
+}
+
+func (h *OIDCProviderHandler) DeleteProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid provider ID"})
+		return
+	}
+
+	var provider models.OIDCProvider
+	if err := h.scoped(c).First(&provider, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("provider_id = ?", provider.ID).Delete(&models.OIDCIdentity{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&provider).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete identity provider"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Identity provider %q deleted by user %d", provider.Name, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Identity provider deleted"})
+}
+
+// scoped restricts queries to the reseller's providers unless the caller holds
+// sso:manage globally.
+func (h *OIDCProviderHandler) scoped(c *gin.Context) *gorm.DB {
+	if isGlobal(c, "sso:manage") {
+		return h.db
+	}
+	return h.db.Where("reseller_id = ?", middleware.ResellerID(c))
+}
+
+// apply copies the request onto the provider after checking that the issuer
+// publishes discovery metadata. It writes the error response itself.
+func (h *OIDCProviderHandler) apply(c *gin.Context, provider *models.OIDCProvider, req *OIDCProviderRequest) bool {
+	if req.DefaultRole != "" && req.DefaultRole != "admin" && req.DefaultRole != "reseller" && req.DefaultRole != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.DefaultRole})
+		return false
+	}
+
+	provider.Name = req.Name
+	provider.ClientID = req.ClientID
+	if req.ClientSecret != "" {
+		provider.ClientSecret = req.ClientSecret
+	}
+	if req.Scopes != "" {
+		provider.Scopes = req.Scopes
+	}
+	if req.GroupsClaim != "" {
+		provider.GroupsClaim = req.GroupsClaim
+	}
+	provider.AdminGroups = req.AdminGroups
+	provider.ResellerGroups = req.ResellerGroups
+	provider.UserGroups = req.UserGroups
+	if req.DefaultRole != "" {
+		provider.DefaultRole = req.DefaultRole
+	}
+	if req.AutoProvision != nil {
+		provider.AutoProvision = *req.AutoProvision
+	}
+	if req.Enabled != nil {
+		provider.Enabled = *req.Enabled
+	}
+
+	// Resellers always own their providers, which can only sign in customers.
+	if isGlobal(c, "sso:manage") {
+		provider.ResellerID = req.ResellerID
+	} else {
+		resellerID := middleware.ResellerID(c)
+		provider.ResellerID = &resellerID
+		provider.AdminGroups = ""
+		provider.ResellerGroups = ""
+		provider.DefaultRole = "user"
+	}
+
+	// A reseller's issuer may only point at public addresses
+	issuer := strings.TrimSuffix(req.Issuer, "/")
+	if _, err := h.oidc.Discover(c.Request.Context(), issuer, provider.ResellerID != nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	provider.Issuer = issuer
+	return true
+}
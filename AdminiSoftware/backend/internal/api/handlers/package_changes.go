@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PackageChangeHandler moves accounts between packages. Administrators
+// change any account; resellers change their own customers.
+type PackageChangeHandler struct {
+	db       *gorm.DB
+	packages *services.PackageChangeService
+	logger   *utils.Logger
+}
+
+func NewPackageChangeHandler(db *gorm.DB, logger *utils.Logger) *PackageChangeHandler {
+	return &PackageChangeHandler{
+		db:       db,
+		packages: services.NewPackageChangeService(db, logger),
+		logger:   logger,
+	}
+}
+
+type ChangePackageRequest struct {
+	PackageID uint   `json:"package_id" binding:"required"`
+	Force     bool   `json:"force"` // apply although usage exceeds the new limits
+	Reason    string `json:"reason"`
+}
+
+// PreviewChange shows the account's usage against ?package_id= and what
+// would exceed it, without changing anything.
+func (h *PackageChangeHandler) PreviewChange(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:read")
+	if !ok {
+		return
+	}
+
+	packageID, err := strconv.Atoi(c.Query("package_id"))
+	if err != nil || packageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid package ID"})
+		return
+	}
+
+	plan, err := h.packages.Plan(account.ID, uint(packageID))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// ChangePackage moves the account to another package. Downgrades the
+// account has outgrown are refused unless an administrator forces them.
+func (h *PackageChangeHandler) ChangePackage(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:update")
+	if !ok {
+		return
+	}
+
+	var req ChangePackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Force && !isGlobal(c, "accounts:update") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can force a package change"})
+		return
+	}
+
+	result, err := h.packages.Change(account.ID, req.PackageID, services.PackageChangeOptions{
+		ActorID: c.GetUint("user_id"),
+		Force:   req.Force,
+		Reason:  req.Reason,
+	})
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// PackageHistory lists the account's package changes, newest first.
+func (h *PackageChangeHandler) PackageHistory(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:read")
+	if !ok {
+		return
+	}
+
+	changes, err := h.packages.History(account.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load package history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func (h *PackageChangeHandler) respondError(c *gin.Context, err error) {
+	var exceeded *services.PackageDowngradeError
+	switch {
+	case errors.As(err, &exceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "violations": exceeded.Violations})
+	case errors.Is(err, services.ErrPackageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSamePackage), errors.Is(err, services.ErrPackageInactive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		if status, ok := services.ResellerPoolErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change package"})
+	}
+}
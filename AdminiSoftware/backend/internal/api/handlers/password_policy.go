@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PasswordPolicyHandler struct {
+	db        *gorm.DB
+	passwords *auth.PasswordPolicy
+	logger    *utils.Logger
+}
+
+func NewPasswordPolicyHandler(db *gorm.DB, logger *utils.Logger) *PasswordPolicyHandler {
+	return &PasswordPolicyHandler{
+		db:        db,
+		passwords: auth.NewPasswordPolicy(db),
+		logger:    logger,
+	}
+}
+
+// GetPolicy returns the password policy so forms can show its rules before
+// the user submits a password.
+func (h *PasswordPolicyHandler) GetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"policy":                 h.passwords.Config(),
+		"breach_check_available": h.passwords.BreachCheckAvailable(),
+	})
+}
+
+// UpdatePolicy replaces the password policy. Existing passwords are not
+// affected until they are next changed, except for the maximum age.
+func (h *PasswordPolicyHandler) UpdatePolicy(c *gin.Context) {
+	var config auth.PasswordPolicyConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwords.SetConfig(config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Password policy updated by admin %d", c.GetUint("user_id")))
+	h.GetPolicy(c)
+}
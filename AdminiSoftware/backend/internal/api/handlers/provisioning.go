@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProvisioningHandler is the API billing modules such as WHMCS and Blesta
+// call. It only accepts API tokens with the provisioning scope. Every
+// response has "result": "success" when the call did what was asked, even
+// if nothing needed doing, which "changed" then reports as false.
+type ProvisioningHandler struct {
+	db           *gorm.DB
+	provisioning *services.ProvisioningService
+	logger       *utils.Logger
+}
+
+func NewProvisioningHandler(db *gorm.DB, logger *utils.Logger) *ProvisioningHandler {
+	return &ProvisioningHandler{
+		db:           db,
+		provisioning: services.NewProvisioningService(db, logger),
+		logger:       logger,
+	}
+}
+
+type ProvisionServiceRequest struct {
+	ServiceID string `json:"service_id" binding:"required,max=100"`
+	Username  string `json:"username" binding:"required,max=32"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required"`
+	Domain    string `json:"domain" binding:"max=253"`
+	PackageID uint   `json:"package_id"`
+	Package   string `json:"package" binding:"max=255"`
+}
+
+type ServiceActionRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type ServicePackageRequest struct {
+	PackageID uint   `json:"package_id"`
+	Package   string `json:"package" binding:"max=255"`
+	Force     bool   `json:"force"`
+}
+
+type ServicePasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateService provisions an account for a billing service. Repeating the
+// call for a service that exists returns its account with status 200.
+func (h *ProvisioningHandler) CreateService(c *gin.Context) {
+	var req ProvisionServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.IsValidUsername(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid username"})
+		return
+	}
+	if req.Domain != "" && !utils.IsValidDomain(req.Domain) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain"})
+		return
+	}
+
+	service, created, err := h.provisioning.Create(h.scope(c), services.ProvisionRequest{
+		ServiceID: req.ServiceID,
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  req.Password,
+		Domain:    req.Domain,
+		PackageID: req.PackageID,
+		Package:   req.Package,
+	})
+	if err != nil {
+		h.respondError(c, err, "Failed to provision service")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"result": "success", "changed": created, "service": service})
+}
+
+// GetService returns the service with its account.
+func (h *ProvisioningHandler) GetService(c *gin.Context) {
+	service, err := h.provisioning.Get(h.scope(c), c.Param("service_id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to load service")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "service": service})
+}
+
+func (h *ProvisioningHandler) SuspendService(c *gin.Context) {
+	var req ServiceActionRequest
+	if !h.bindOptional(c, &req) {
+		return
+	}
+	changed, err := h.provisioning.Suspend(h.scope(c), c.Param("service_id"), req.Reason, c.GetUint("user_id"))
+	h.respondAction(c, changed, err, "Failed to suspend service")
+}
+
+func (h *ProvisioningHandler) UnsuspendService(c *gin.Context) {
+	changed, err := h.provisioning.Unsuspend(h.scope(c), c.Param("service_id"), c.GetUint("user_id"))
+	h.respondAction(c, changed, err, "Failed to unsuspend service")
+}
+
+func (h *ProvisioningHandler) TerminateService(c *gin.Context) {
+	var req ServiceActionRequest
+	if !h.bindOptional(c, &req) {
+		return
+	}
+	changed, err := h.provisioning.Terminate(h.scope(c), c.Param("service_id"), req.Reason, c.GetUint("user_id"))
+	h.respondAction(c, changed, err, "Failed to terminate service")
+}
+
+// ChangePackage moves the service to another package. Downgrades below the
+// account's usage fail unless an administrator forces them.
+func (h *ProvisioningHandler) ChangePackage(c *gin.Context) {
+	var req ServicePackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Force && !isGlobal(c, "accounts:provision") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can force a package change"})
+		return
+	}
+
+	result, err := h.provisioning.ChangePackage(h.scope(c), c.Param("service_id"), req.PackageID, req.Package, req.Force, c.GetUint("user_id"))
+	if err != nil {
+		var downgrade *services.PackageDowngradeError
+		if errors.As(err, &downgrade) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "violations": downgrade.Violations})
+			return
+		}
+		h.respondError(c, err, "Failed to change package")
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusOK, gin.H{"result": "success", "changed": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "changed": true, "change": result.Change, "warnings": result.Warnings})
+}
+
+func (h *ProvisioningHandler) ChangePassword(c *gin.Context) {
+	var req ServicePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.provisioning.ChangePassword(h.scope(c), c.Param("service_id"), req.Password)
+	h.respondAction(c, true, err, "Failed to change password")
+}
+
+// LoginLink returns a one-time URL that signs the customer into the panel.
+func (h *ProvisioningHandler) LoginLink(c *gin.Context) {
+	clientIP := c.ClientIP()
+	loginURL, ttl, err := h.provisioning.LoginURL(h.scope(c), c.Param("service_id"), c.GetUint("api_token_id"), clientIP)
+	if err != nil {
+		h.respondError(c, err, "Failed to create login link")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "url": loginURL, "expires_in": int(ttl.Seconds())})
+}
+
+// ServiceUsage returns one service's disk and bandwidth use and limits.
+func (h *ProvisioningHandler) ServiceUsage(c *gin.Context) {
+	usage, err := h.provisioning.Usage(h.scope(c), c.Param("service_id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to load usage")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "usage": usage})
+}
+
+// Usage returns the use of every live service, for a usage update run.
+func (h *ProvisioningHandler) Usage(c *gin.Context) {
+	usage, err := h.provisioning.UsageAll(h.scope(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to load usage")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "services": usage})
+}
+
+// scope is 0 for callers holding the permission globally and the caller's
+// reseller otherwise.
+func (h *ProvisioningHandler) scope(c *gin.Context) uint {
+	if isGlobal(c, "accounts:provision") {
+		return 0
+	}
+	return middleware.ResellerID(c)
+}
+
+// bindOptional binds a JSON body that billing modules may leave out.
+func (h *ProvisioningHandler) bindOptional(c *gin.Context, req interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *ProvisioningHandler) respondAction(c *gin.Context, changed bool, err error, message string) {
+	if err != nil {
+		h.respondError(c, err, message)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success", "changed": changed})
+}
+
+func (h *ProvisioningHandler) respondError(c *gin.Context, err error, message string) {
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		respondPasswordError(c, err)
+		return
+	}
+	if status, ok := services.ProvisioningErrorStatus(err); ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	h.logger.Error(err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// QuotaHandler reports how much of its package an account uses.
+type QuotaHandler struct {
+	db     *gorm.DB
+	quotas *services.QuotaService
+	logger *utils.Logger
+}
+
+func NewQuotaHandler(db *gorm.DB, logger *utils.Logger) *QuotaHandler {
+	return &QuotaHandler{
+		db:     db,
+		quotas: services.NewQuotaService(db),
+		logger: logger,
+	}
+}
+
+// GetUsage returns the caller's own usage against their package limits.
+func (h *QuotaHandler) GetUsage(c *gin.Context) {
+	h.respond(c, c.GetUint("user_id"))
+}
+
+// AccountUsage returns the usage of any account for administrators, and of
+// their own customers for resellers.
+func (h *QuotaHandler) AccountUsage(c *gin.Context) {
+	account, ok := scopedAccount(c, h.db, "accounts:read")
+	if !ok {
+		return
+	}
+	h.respond(c, account.ID)
+}
+
+func (h *QuotaHandler) respond(c *gin.Context, userID uint) {
+	usage, err := h.quotas.Usage(userID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load quota usage"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "quotas": usage})
+}
+
+// scopedAccount loads the account named by :id, which a caller without the
+// global permission may only reach if it belongs to their reseller. It
+// writes the error response itself.
+func scopedAccount(c *gin.Context, db *gorm.DB, permission string) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return nil, false
+	}
+
+	var account models.User
+	if err := db.First(&account, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return nil, false
+	}
+	if !isGlobal(c, permission) {
+		resellerID := middleware.ResellerID(c)
+		if account.ResellerID == nil || *account.ResellerID != resellerID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return nil, false
+		}
+	}
+	return &account, true
+}
@@ -2,7 +2,10 @@
 package reseller
 
 import (
+	"AdminiSoftware/internal/api/middleware"
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
 	"net/http"
 	"strconv"
 
@@ -11,15 +14,16 @@ import (
 )
 
 type AccountHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	lifecycle *services.AccountLifecycle
 }
 
 func NewAccountHandler(db *gorm.DB) *AccountHandler {
-	return &AccountHandler{db: db}
+	return &AccountHandler{db: db, lifecycle: services.NewAccountLifecycle(db, utils.NewLogger())}
 }
 
 func (h *AccountHandler) GetAccounts(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	var accounts []models.User
 	if err := h.db.Where("reseller_id = ?", resellerID).Find(&accounts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
@@ -29,7 +33,7 @@ func (h *AccountHandler) GetAccounts(c *gin.Context) {
 }
 
 func (h *AccountHandler) CreateAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -49,9 +53,9 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 }
 
 func (h *AccountHandler) UpdateAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var user models.User
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
@@ -72,17 +76,20 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 }
 
 func (h *AccountHandler) SuspendAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var user models.User
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
 		return
 	}
 
-	user.Status = "suspended"
-	if err := h.db.Save(&user).Error; err != nil {
+	if _, err := h.lifecycle.Transition(user.ID, services.AccountSuspended, "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend account"})
 		return
 	}
@@ -91,17 +98,20 @@ func (h *AccountHandler) SuspendAccount(c *gin.Context) {
 }
 
 func (h *AccountHandler) UnsuspendAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var user models.User
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
 		return
 	}
 
-	user.Status = "active"
-	if err := h.db.Save(&user).Error; err != nil {
+	if _, err := h.lifecycle.Transition(user.ID, services.AccountActive, "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend account"})
 		return
 	}
@@ -110,10 +120,21 @@ func (h *AccountHandler) UnsuspendAccount(c *gin.Context) {
 }
 
 func (h *AccountHandler) DeleteAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
-	
-	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).Delete(&models.User{}).Error; err != nil {
+
+	var account models.User
+	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	// The account is terminated, taking its services down, then purged
+	if _, err := h.lifecycle.Remove(account.ID, "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
@@ -122,7 +143,7 @@ func (h *AccountHandler) DeleteAccount(c *gin.Context) {
 }
 
 func (h *AccountHandler) GetAccountStats(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	var totalAccounts int64
 	var activeAccounts int64
 	var suspendedAccounts int64
@@ -150,7 +171,12 @@ func (h *AccountHandler) GetAccountStats(c *gin.Context) {
 package reseller
 
 import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -159,27 +185,59 @@ import (
 )
 
 type ResellerAccountHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	accounts  *services.AccountService
+	lifecycle *services.AccountLifecycle
+}
+
+func NewResellerAccountHandler(db *gorm.DB, logger *utils.Logger) *ResellerAccountHandler {
+	return &ResellerAccountHandler{
+		db:        db,
+		accounts:  services.NewAccountService(db, logger),
+		lifecycle: services.NewAccountLifecycle(db, logger),
+	}
 }
 
-func NewResellerAccountHandler(db *gorm.DB) *ResellerAccountHandler {
-	return &ResellerAccountHandler{db: db}
+type CreateAccountRequest struct {
+	Username  string `json:"username" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required"`
+	Domain    string `json:"domain"`
+	PackageID *uint  `json:"package_id"`
 }
 
+// CreateAccount creates a customer within the reseller's pool. The password
+// must meet the password policy like any other panel password.
 func (h *ResellerAccountHandler) CreateAccount(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
-	
-	var account models.User
-	if err := c.ShouldBindJSON(&account); err != nil {
+	resellerID := middleware.ResellerID(c)
+
+	var req CreateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	account.ResellerID = &resellerID
-	account.Role = "user"
-	account.Status = "active"
-
-	if err := h.db.Create(&account).Error; err != nil {
+	account, err := h.accounts.Provision(services.NewAccount{
+		Username:   req.Username,
+		Email:      req.Email,
+		Password:   req.Password,
+		Domain:     req.Domain,
+		PackageID:  req.PackageID,
+		ResellerID: &resellerID,
+	})
+	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Password does not meet the password policy",
+				"violations": policyErr.Violations,
+			})
+			return
+		}
+		if status, ok := services.ProvisioningErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
 		return
 	}
@@ -188,8 +246,8 @@ func (h *ResellerAccountHandler) CreateAccount(c *gin.Context) {
 }
 
 func (h *ResellerAccountHandler) GetAccounts(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	var accounts []models.User
 	if err := h.db.Where("reseller_id = ?", resellerID).Find(&accounts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
@@ -199,24 +257,60 @@ func (h *ResellerAccountHandler) GetAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
 }
 
+// UpdateAccountRequest holds the contact details a reseller may change.
+// Role, status and package each have their own workflow.
+type UpdateAccountRequest struct {
+	Email        *string `json:"email" binding:"omitempty,email"`
+	FirstName    *string `json:"first_name" binding:"omitempty,max=100"`
+	LastName     *string `json:"last_name" binding:"omitempty,max=100"`
+	ContactEmail *string `json:"contact_email" binding:"omitempty,email"`
+	Language     *string `json:"language" binding:"omitempty,max=10"`
+}
+
 func (h *ResellerAccountHandler) UpdateAccount(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	var account models.User
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&account).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&account); err != nil {
+	var req UpdateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.db.Save(&account).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
-		return
+	updates := map[string]interface{}{}
+	if req.Email != nil && *req.Email != account.Email {
+		var taken int64
+		h.db.Model(&models.User{}).Where("email = ? AND id <> ?", *req.Email, account.ID).Count(&taken)
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+			return
+		}
+		updates["email"] = *req.Email
+	}
+	if req.FirstName != nil {
+		updates["first_name"] = *req.FirstName
+	}
+	if req.LastName != nil {
+		updates["last_name"] = *req.LastName
+	}
+	if req.ContactEmail != nil {
+		updates["contact_email"] = *req.ContactEmail
+	}
+	if req.Language != nil {
+		updates["language"] = *req.Language
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.Model(&account).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, account)
@@ -224,16 +318,30 @@ func (h *ResellerAccountHandler) UpdateAccount(c *gin.Context) {
 
 func (h *ResellerAccountHandler) SuspendAccount(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	var account models.User
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&account).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
 		return
 	}
 
-	account.Status = "suspended"
-	if err := h.db.Save(&account).Error; err != nil {
+	var req struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	// The reason is optional, so an empty body is accepted
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := h.lifecycle.Transition(account.ID, services.AccountSuspended, req.Reason, c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend account"})
 		return
 	}
@@ -243,9 +351,20 @@ func (h *ResellerAccountHandler) SuspendAccount(c *gin.Context) {
 
 func (h *ResellerAccountHandler) DeleteAccount(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	resellerID := c.GetUint("user_id")
-	
-	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).Delete(&models.User{}).Error; err != nil {
+	resellerID := middleware.ResellerID(c)
+
+	var account models.User
+	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	// The account is terminated, taking its services down, then purged
+	if _, err := h.lifecycle.Remove(account.ID, "", c.GetUint("user_id")); err != nil {
+		if status, ok := services.AccountLifecycleErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
@@ -37,6 +37,7 @@ func (h *PackageHandler) CreatePackage(c *gin.Context) {
 	}
 
 	pkg.ResellerID = &resellerID
+	withoutWholesale(&pkg, 0)
 	if err := h.db.Create(&pkg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create package"})
 		return
@@ -55,10 +56,12 @@ func (h *PackageHandler) UpdatePackage(c *gin.Context) {
 		return
 	}
 
+	wholesale := pkg.WholesalePrice
 	if err := c.ShouldBindJSON(&pkg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	withoutWholesale(&pkg, wholesale)
 
 	if err := h.db.Save(&pkg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update package"})
@@ -68,6 +71,19 @@ func (h *PackageHandler) UpdatePackage(c *gin.Context) {
 	c.JSON(http.StatusOK, pkg)
 }
 
+// withoutWholesale keeps the wholesale price administrators charge for the
+// package and drops any wholesale overage tiers from a reseller's request.
+func withoutWholesale(pkg *models.Package, price float64) {
+	pkg.WholesalePrice = price
+	tiers := pkg.OverageTiers[:0]
+	for _, tier := range pkg.OverageTiers {
+		if !tier.Wholesale {
+			tiers = append(tiers, tier)
+		}
+	}
+	pkg.OverageTiers = tiers
+}
+
 func (h *PackageHandler) DeletePackage(c *gin.Context) {
 	resellerID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
@@ -102,7 +118,9 @@ func (h *PackageHandler) GetPackageUsage(c *gin.Context) {
 package reseller
 
 import (
+	"AdminiSoftware/internal/api/middleware"
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
 	"net/http"
 	"strconv"
 
@@ -111,15 +129,19 @@ import (
 )
 
 type ResellerPackageHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	pools *services.ResellerPoolService
 }
 
 func NewResellerPackageHandler(db *gorm.DB) *ResellerPackageHandler {
-	return &ResellerPackageHandler{db: db}
+	return &ResellerPackageHandler{
+		db:    db,
+		pools: services.NewResellerPoolService(db),
+	}
 }
 
 func (h *ResellerPackageHandler) CreatePackage(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	
 	var pkg models.Package
 	if err := c.ShouldBindJSON(&pkg); err != nil {
@@ -128,6 +150,15 @@ func (h *ResellerPackageHandler) CreatePackage(c *gin.Context) {
 	}
 
 	pkg.ResellerID = &resellerID
+	withoutWholesale(&pkg, 0)
+	if err := h.pools.CheckPackage(resellerID, &pkg); err != nil {
+		if status, ok := services.ResellerPoolErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create package"})
+		return
+	}
 
 	if err := h.db.Create(&pkg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create package"})
@@ -138,7 +169,7 @@ func (h *ResellerPackageHandler) CreatePackage(c *gin.Context) {
 }
 
 func (h *ResellerPackageHandler) GetPackages(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	
 	var packages []models.Package
 	if err := h.db.Where("reseller_id = ?", resellerID).Find(&packages).Error; err != nil {
@@ -151,7 +182,7 @@ func (h *ResellerPackageHandler) GetPackages(c *gin.Context) {
 
 func (h *ResellerPackageHandler) UpdatePackage(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	
 	var pkg models.Package
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).First(&pkg).Error; err != nil {
@@ -159,10 +190,21 @@ func (h *ResellerPackageHandler) UpdatePackage(c *gin.Context) {
 		return
 	}
 
+	wholesale := pkg.WholesalePrice
 	if err := c.ShouldBindJSON(&pkg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	pkg.ResellerID = &resellerID
+	withoutWholesale(&pkg, wholesale)
+	if err := h.pools.CheckPackage(resellerID, &pkg); err != nil {
+		if status, ok := services.ResellerPoolErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update package"})
+		return
+	}
 
 	if err := h.db.Save(&pkg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update package"})
@@ -172,9 +214,22 @@ func (h *ResellerPackageHandler) UpdatePackage(c *gin.Context) {
 	c.JSON(http.StatusOK, pkg)
 }
 
+// withoutWholesale keeps the wholesale price administrators charge for the
+// package and drops any wholesale overage tiers from a reseller's request.
+func withoutWholesale(pkg *models.Package, price float64) {
+	pkg.WholesalePrice = price
+	tiers := pkg.OverageTiers[:0]
+	for _, tier := range pkg.OverageTiers {
+		if !tier.Wholesale {
+			tiers = append(tiers, tier)
+		}
+	}
+	pkg.OverageTiers = tiers
+}
+
 func (h *ResellerPackageHandler) DeletePackage(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	resellerID := c.GetUint("user_id")
+	resellerID := middleware.ResellerID(c)
 	
 	if err := h.db.Where("id = ? AND reseller_id = ?", id, resellerID).Delete(&models.Package{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete package"})
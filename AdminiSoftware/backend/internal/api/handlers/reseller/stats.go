@@ -1,7 +1,7 @@
-
 package reseller
 
 import (
+	"AdminiSoftware/internal/api/middleware"
 	"AdminiSoftware/internal/models"
 	"net/http"
 
@@ -18,8 +18,8 @@ func NewStatsHandler(db *gorm.DB) *StatsHandler {
 }
 
 func (h *StatsHandler) GetDashboardStats(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	var totalAccounts int64
 	var activeAccounts int64
 	var totalPackages int64
@@ -68,19 +68,19 @@ func (h *StatsHandler) GetDashboardStats(c *gin.Context) {
 		},
 		"top_customers": []map[string]interface{}{
 			{
-				"username":   "customer1",
-				"disk_used":  "15.6 GB",
-				"bandwidth":  "145.2 GB",
+				"username":  "customer1",
+				"disk_used": "15.6 GB",
+				"bandwidth": "145.2 GB",
 			},
 			{
-				"username":   "customer2",
-				"disk_used":  "12.3 GB",
-				"bandwidth":  "98.7 GB",
+				"username":  "customer2",
+				"disk_used": "12.3 GB",
+				"bandwidth": "98.7 GB",
 			},
 			{
-				"username":   "customer3",
-				"disk_used":  "10.8 GB",
-				"bandwidth":  "76.4 GB",
+				"username":  "customer3",
+				"disk_used": "10.8 GB",
+				"bandwidth": "76.4 GB",
 			},
 		},
 	}
@@ -89,8 +89,8 @@ func (h *StatsHandler) GetDashboardStats(c *gin.Context) {
 }
 
 func (h *StatsHandler) GetResourceUsage(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	usage := map[string]interface{}{
 		"reseller_id": resellerID,
 		"limits": map[string]interface{}{
@@ -122,13 +122,13 @@ func (h *StatsHandler) GetResourceUsage(c *gin.Context) {
 }
 
 func (h *StatsHandler) GetBandwidthStats(c *gin.Context) {
-	resellerID := c.GetUint("user_id")
-	
+	resellerID := middleware.ResellerID(c)
+
 	bandwidth := map[string]interface{}{
 		"reseller_id": resellerID,
 		"current_month": map[string]interface{}{
-			"used":  "1.8 TB",
-			"limit": "2.5 TB",
+			"used":       "1.8 TB",
+			"limit":      "2.5 TB",
 			"percentage": 72.0,
 		},
 		"daily_usage": []map[string]interface{}{
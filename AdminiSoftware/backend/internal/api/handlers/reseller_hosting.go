@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ResellerHostingHandler lets resellers present the panel as their own:
+// private nameservers on their customers' zones and a panel hostname with
+// its own certificate and the reseller's branding.
+type ResellerHostingHandler struct {
+	db          *gorm.DB
+	nameservers *services.NameserverService
+	hostnames   *services.PanelHostnameService
+	logger      *utils.Logger
+}
+
+func NewResellerHostingHandler(db *gorm.DB, logger *utils.Logger) *ResellerHostingHandler {
+	return &ResellerHostingHandler{
+		db:          db,
+		nameservers: services.NewNameserverService(db, logger),
+		hostnames:   services.NewPanelHostnameService(db, logger),
+		logger:      logger,
+	}
+}
+
+type SetNameserversRequest struct {
+	Nameservers []services.NameserverEntry `json:"nameservers" binding:"max=4"`
+}
+
+type SetPanelHostnameRequest struct {
+	Hostname string `json:"hostname" binding:"required,max=253"`
+}
+
+// ListNameservers returns the reseller's private nameservers and those its
+// customers' zones use.
+func (h *ResellerHostingHandler) ListNameservers(c *gin.Context) {
+	resellerID := middleware.ResellerID(c)
+	nameservers, err := h.nameservers.List(resellerID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load nameservers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nameservers": nameservers, "effective": h.nameservers.For(&resellerID)})
+}
+
+// SetNameservers replaces the reseller's private nameservers and moves its
+// customers' zones onto them. An empty list goes back to the server's.
+func (h *ResellerHostingHandler) SetNameservers(c *gin.Context) {
+	var req SetNameserversRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resellerID := middleware.ResellerID(c)
+	nameservers, err := h.nameservers.Set(resellerID, req.Nameservers)
+	if err != nil {
+		h.respondError(c, err, "Failed to set nameservers")
+		return
+	}
+	glue, err := h.nameservers.Glue(resellerID)
+	if err != nil {
+		h.logger.Error(err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{"nameservers": nameservers, "glue": glue})
+}
+
+// Glue returns the glue records to register for each nameserver.
+func (h *ResellerHostingHandler) Glue(c *gin.Context) {
+	glue, err := h.nameservers.Glue(middleware.ResellerID(c))
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load nameservers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"glue": glue})
+}
+
+// ApplyNameservers puts the nameservers back on customer zones whose NS
+// records were changed by hand.
+func (h *ResellerHostingHandler) ApplyNameservers(c *gin.Context) {
+	changed, err := h.nameservers.Apply(middleware.ResellerID(c))
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update zones"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"zones_changed": changed})
+}
+
+func (h *ResellerHostingHandler) GetPanelHostname(c *gin.Context) {
+	hostname, err := h.hostnames.Get(middleware.ResellerID(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to load panel hostname")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"panel_hostname": hostname})
+}
+
+// SetPanelHostname sets the reseller's panel hostname. Its certificate is
+// issued by the renewal loop within a minute; the status shows when it is
+// served.
+func (h *ResellerHostingHandler) SetPanelHostname(c *gin.Context) {
+	var req SetPanelHostnameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hostname, err := h.hostnames.Set(middleware.ResellerID(c), req.Hostname)
+	if err != nil {
+		h.respondError(c, err, "Failed to set panel hostname")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"panel_hostname": hostname})
+}
+
+// RetryPanelHostname issues the certificate again, once DNS is in place.
+func (h *ResellerHostingHandler) RetryPanelHostname(c *gin.Context) {
+	hostname, err := h.hostnames.Get(middleware.ResellerID(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to load panel hostname")
+		return
+	}
+	issueErr := h.hostnames.Issue(hostname.ID)
+	hostname, err = h.hostnames.Get(hostname.ResellerID)
+	if err != nil {
+		h.respondError(c, err, "Failed to load panel hostname")
+		return
+	}
+	if issueErr != nil {
+		// The failure is recorded on the hostname as its last error
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": issueErr.Error(), "panel_hostname": hostname})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"panel_hostname": hostname})
+}
+
+func (h *ResellerHostingHandler) RemovePanelHostname(c *gin.Context) {
+	if err := h.hostnames.Remove(middleware.ResellerID(c)); err != nil {
+		h.respondError(c, err, "Failed to remove panel hostname")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Panel hostname removed"})
+}
+
+// ListPanelHostnames returns every reseller's panel hostname.
+func (h *ResellerHostingHandler) ListPanelHostnames(c *gin.Context) {
+	hostnames, err := h.hostnames.List()
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load panel hostnames"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"panel_hostnames": hostnames})
+}
+
+// Branding returns the branding for the hostname the panel is opened on,
+// so the login page looks like the reseller's before anyone signs in.
+func (h *ResellerHostingHandler) Branding(c *gin.Context) {
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	brand, resellerID := h.hostnames.Branding(host)
+	c.JSON(http.StatusOK, gin.H{
+		"branding":    publicBranding(brand),
+		"nameservers": h.nameservers.For(resellerID),
+	})
+}
+
+// MyNameservers returns the nameservers the customer's domains should be
+// delegated to.
+func (h *ResellerHostingHandler) MyNameservers(c *gin.Context) {
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nameservers": h.nameservers.For(user.ResellerID)})
+}
+
+func (h *ResellerHostingHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrPanelHostnameNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNameserverTaken), errors.Is(err, services.ErrNameserverForeign),
+		errors.Is(err, services.ErrPanelHostnameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNameserverCount), errors.Is(err, services.ErrNameserverHostname),
+		errors.Is(err, services.ErrNameserverAddress), errors.Is(err, services.ErrPanelHostnameInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPanelHostnameUnknown):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// publicBranding is what anyone may see of a reseller's branding.
+func publicBranding(brand models.Branding) gin.H {
+	return gin.H{
+		"company_name":    brand.CompanyName,
+		"logo_url":        brand.LogoURL,
+		"support_url":     brand.SupportURL,
+		"terms_url":       brand.TermsURL,
+		"theme_color":     brand.ThemeColor,
+		"custom_css":      brand.CustomCSS,
+		"show_powered_by": brand.ShowPoweredBy,
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ResellerPoolHandler lets administrators set how much each reseller may
+// share out among its customers, and compare that with what they use.
+type ResellerPoolHandler struct {
+	db     *gorm.DB
+	pools  *services.ResellerPoolService
+	logger *utils.Logger
+}
+
+func NewResellerPoolHandler(db *gorm.DB, logger *utils.Logger) *ResellerPoolHandler {
+	return &ResellerPoolHandler{
+		db:     db,
+		pools:  services.NewResellerPoolService(db),
+		logger: logger,
+	}
+}
+
+type ResellerAllocationRequest struct {
+	MaxAccounts      int    `json:"max_accounts" binding:"min=0"`
+	DiskMB           int    `json:"disk_mb" binding:"min=0"`
+	BandwidthMB      int    `json:"bandwidth_mb" binding:"min=0"`
+	AllowOverselling bool   `json:"allow_overselling"`
+	PackageIDs       []uint `json:"package_ids"` // administrator packages the reseller may assign; empty allows all
+}
+
+// Report returns every reseller's allocation against its accounts.
+func (h *ResellerPoolHandler) Report(c *gin.Context) {
+	report, err := h.pools.Report()
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build reseller report"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"resellers": report})
+}
+
+// GetAllocation returns one reseller's allocation and usage.
+func (h *ResellerPoolHandler) GetAllocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reseller ID"})
+		return
+	}
+	h.respondUsage(c, uint(id))
+}
+
+// UpdateAllocation replaces a reseller's allocation. Existing accounts are
+// kept even if they no longer fit; the report shows the reseller oversold.
+func (h *ResellerPoolHandler) UpdateAllocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reseller ID"})
+		return
+	}
+
+	var req ResellerAllocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allocation := models.ResellerAllocation{
+		ResellerID:       uint(id),
+		MaxAccounts:      req.MaxAccounts,
+		DiskMB:           req.DiskMB,
+		BandwidthMB:      req.BandwidthMB,
+		AllowOverselling: req.AllowOverselling,
+	}
+	if err := h.pools.SetAllocation(&allocation, req.PackageIDs); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResellerNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPackageNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Allowed packages must be existing administrator packages"})
+		default:
+			h.logger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update allocation"})
+		}
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Allocation of reseller %d updated by admin %d", id, c.GetUint("user_id")))
+	h.respondUsage(c, uint(id))
+}
+
+// MyAllocation returns the calling reseller's own allocation and usage.
+func (h *ResellerPoolHandler) MyAllocation(c *gin.Context) {
+	h.respondUsage(c, middleware.ResellerID(c))
+}
+
+func (h *ResellerPoolHandler) respondUsage(c *gin.Context, resellerID uint) {
+	usage, err := h.pools.Usage(resellerID)
+	if errors.Is(err, services.ErrResellerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reseller allocation"})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
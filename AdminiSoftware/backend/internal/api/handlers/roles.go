@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/api/middleware"
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RoleHandler manages custom roles and their assignment. Callers holding
+// roles:manage globally manage every role; resellers manage roles scoped to
+// their own accounts and can only hand out permissions they hold themselves.
+type RoleHandler struct {
+	db       *gorm.DB
+	resolver *auth.PermissionResolver
+	logger   *utils.Logger
+}
+
+func NewRoleHandler(db *gorm.DB, logger *utils.Logger) *RoleHandler {
+	return &RoleHandler{
+		db:       db,
+		resolver: auth.NewPermissionResolver(db),
+		logger:   logger,
+	}
+}
+
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type RoleAssignmentRequest struct {
+	UserID     uint  `json:"user_id" binding:"required"`
+	RoleID     uint  `json:"role_id" binding:"required"`
+	ResellerID *uint `json:"reseller_id"`
+}
+
+// ListPermissions returns the permission catalog, the built-in roles and the
+// caller's own effective permissions.
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	grants, err := h.resolver.Resolve(c.GetUint("user_id"), c.GetString("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": auth.Permissions,
+		"built_in_roles": gin.H{
+			"admin":    auth.BuiltInPermissions("admin"),
+			"reseller": auth.BuiltInPermissions("reseller"),
+			"user":     auth.BuiltInPermissions("user"),
+		},
+		"granted": grants.All(),
+	})
+}
+
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	query := h.db.Order("name")
+	if resellerID, scoped := h.scope(c); scoped {
+		query = query.Where("reseller_id IS NULL OR reseller_id = ?", resellerID)
+	}
+
+	var roles []models.Role
+	if err := query.Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.Role{}
+	if resellerID, scoped := h.scope(c); scoped {
+		role.ResellerID = &resellerID
+	}
+	if !h.applyRole(c, &role, &req) {
+		return
+	}
+
+	if err := h.db.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Role %q created by user %d with permissions %s", role.Name, c.GetUint("user_id"), role.Permissions))
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	role, ok := h.findRole(c)
+	if !ok {
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.applyRole(c, role, &req) {
+		return
+	}
+
+	if err := h.db.Save(role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Role %q updated by user %d with permissions %s", role.Name, c.GetUint("user_id"), role.Permissions))
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	role, ok := h.findRole(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Role %q deleted by user %d", role.Name, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// ListAssignments lists role assignments, optionally for ?user_id.
+func (h *RoleHandler) ListAssignments(c *gin.Context) {
+	query := h.db.Preload("Role").Preload("User")
+	if resellerID, scoped := h.scope(c); scoped {
+		query = query.Where("reseller_id = ?", resellerID)
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var assignments []models.RoleAssignment
+	if err := query.Order("created_at DESC").Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments})
+}
+
+// AssignRole grants a role to a user. Scoped callers can only assign to their
+// own customers and the assignment is always limited to their accounts.
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	var req RoleAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if err := h.db.First(&role, req.RoleID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var target models.User
+	if err := h.db.First(&target, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	resellerID, scoped := h.scope(c)
+	if scoped {
+		if role.ResellerID != nil && *role.ResellerID != resellerID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		if target.ResellerID == nil || *target.ResellerID != resellerID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only assign roles to your own accounts"})
+			return
+		}
+		req.ResellerID = &resellerID
+	} else if role.ResellerID != nil {
+		req.ResellerID = role.ResellerID
+	}
+
+	if !h.canGrant(c, auth.RolePermissions(&role)) {
+		return
+	}
+
+	var existing int64
+	query := h.db.Model(&models.RoleAssignment{}).Where("user_id = ? AND role_id = ?", req.UserID, req.RoleID)
+	if req.ResellerID == nil {
+		query = query.Where("reseller_id IS NULL")
+	} else {
+		query = query.Where("reseller_id = ?", *req.ResellerID)
+	}
+	query.Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is already assigned to this user"})
+		return
+	}
+
+	assignment := models.RoleAssignment{
+		UserID:     req.UserID,
+		RoleID:     req.RoleID,
+		ResellerID: req.ResellerID,
+		GrantedBy:  c.GetUint("user_id"),
+	}
+	if err := h.db.Create(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Role %q assigned to user %d by user %d", role.Name, req.UserID, c.GetUint("user_id")))
+	c.JSON(http.StatusCreated, assignment)
+}
+
+func (h *RoleHandler) UnassignRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	query := h.db.Where("id = ?", id)
+	if resellerID, scoped := h.scope(c); scoped {
+		query = query.Where("reseller_id = ?", resellerID)
+	}
+
+	result := query.Delete(&models.RoleAssignment{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role assignment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role assignment not found"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Role assignment %d removed by user %d", id, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Role assignment removed"})
+}
+
+// scope returns the reseller the caller manages roles for, or false when they
+// hold roles:manage globally.
+func (h *RoleHandler) scope(c *gin.Context) (uint, bool) {
+	if isGlobal(c, "roles:manage") {
+		return 0, false
+	}
+	return middleware.ResellerID(c), true
+}
+
+func (h *RoleHandler) findRole(c *gin.Context) (*models.Role, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return nil, false
+	}
+
+	query := h.db.Where("id = ?", id)
+	if resellerID, scoped := h.scope(c); scoped {
+		query = query.Where("reseller_id = ?", resellerID)
+	}
+
+	var role models.Role
+	if err := query.First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return nil, false
+	}
+	return &role, true
+}
+
+func (h *RoleHandler) applyRole(c *gin.Context, role *models.Role, req *RoleRequest) bool {
+	name := strings.TrimSpace(req.Name)
+	if name == "admin" || name == "reseller" || name == "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is reserved for a built-in role"})
+		return false
+	}
+
+	for _, permission := range req.Permissions {
+		if err := auth.ValidatePermission(permission); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	if !h.canGrant(c, req.Permissions) {
+		return false
+	}
+
+	var count int64
+	query := h.db.Model(&models.Role{}).Where("name = ? AND id <> ?", name, role.ID)
+	if role.ResellerID == nil {
+		query = query.Where("reseller_id IS NULL")
+	} else {
+		query = query.Where("reseller_id = ?", *role.ResellerID)
+	}
+	query.Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+		return false
+	}
+
+	role.Name = name
+	role.Description = req.Description
+	role.Permissions = strings.Join(req.Permissions, ",")
+	return true
+}
+
+// canGrant stops callers from creating or assigning roles with permissions
+// they do not hold themselves.
+func (h *RoleHandler) canGrant(c *gin.Context, permissions []string) bool {
+	value, _ := c.Get("user_permissions")
+	grants, ok := value.(*auth.Grants)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User permissions not found"})
+		return false
+	}
+
+	held := grants.Global
+	if resellerID, scoped := h.scope(c); scoped {
+		held = append(append([]string{}, grants.Global...), grants.Scoped[resellerID]...)
+	}
+
+	if !auth.CoversAll(held, permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant permissions you do not hold"})
+		return false
+	}
+	return true
+}
+
+// isGlobal reports whether the request's grants include the permission
+// without a reseller restriction.
+func isGlobal(c *gin.Context, permission string) bool {
+	value, _ := c.Get("user_permissions")
+	grants, ok := value.(*auth.Grants)
+	return ok && grants.Allows(permission)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SessionHandler struct {
+	db       *gorm.DB
+	sessions *auth.SessionManager
+	logger   *utils.Logger
+}
+
+func NewSessionHandler(db *gorm.DB, logger *utils.Logger) *SessionHandler {
+	return &SessionHandler{
+		db:       db,
+		sessions: auth.NewSessionManager(db),
+		logger:   logger,
+	}
+}
+
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	sessions, err := h.sessions.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetString("session_id")
+	views := make([]sessionView, 0, len(sessions))
+	for _, session := range sessions {
+		session.User = nil
+		views = append(views, sessionView{Session: session, Current: session.PublicID == current})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": views})
+}
+
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.sessions.Revoke(uint(id), userID, "revoked_by_user"); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session.
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	count, err := h.sessions.RevokeAll(userID, c.GetString("session_id"), "revoked_by_user")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": count})
+}
+
+func (h *SessionHandler) AdminListSessions(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+
+	sessions, err := h.sessions.List(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *SessionHandler) AdminRevokeSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.sessions.Revoke(uint(id), 0, "revoked_by_admin"); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Session %d revoked by admin %d", id, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func (h *SessionHandler) AdminRevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	count, err := h.sessions.RevokeAll(uint(id), "", "revoked_by_admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("All sessions of user %d revoked by admin %d", id, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": count})
+}
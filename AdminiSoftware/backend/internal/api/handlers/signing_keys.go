@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SigningKeyHandler struct {
+	db     *gorm.DB
+	keys   *auth.KeyRing
+	logger *utils.Logger
+}
+
+func NewSigningKeyHandler(db *gorm.DB, keys *auth.KeyRing, logger *utils.Logger) *SigningKeyHandler {
+	return &SigningKeyHandler{
+		db:     db,
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+type RotateSigningKeyRequest struct {
+	RevokePrevious bool `json:"revoke_previous"`
+}
+
+// JWKS publishes the keys that verify access tokens. Verifiers may cache it
+// briefly; new keys are published well before they sign.
+func (h *SigningKeyHandler) JWKS(c *gin.Context) {
+	jwks, err := h.keys.JWKS()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Signing keys are unavailable"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
+
+// ListKeys returns the keys in the ring without their private halves.
+func (h *SigningKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.keys.Keys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list signing keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RotateKey rotates the signing key now; the body is optional. With revoke_previous the old keys
+// stop verifying at once, for use after a key compromise.
+func (h *SigningKeyHandler) RotateKey(c *gin.Context) {
+	var req RotateSigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.keys.Rotate(true, req.RevokePrevious); err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("JWT signing key rotated by admin %d (revoke previous: %t)", c.GetUint("user_id"), req.RevokePrevious))
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key rotated"})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TwoFactorHandler manages backup codes and trusted devices, and lets
+// administrators reset the two-factor authentication of a user who lost
+// their authenticator.
+type TwoFactorHandler struct {
+	db        *gorm.DB
+	twoFactor *auth.TwoFactorManager
+	sessions  *auth.SessionManager
+	mail      *services.MailQueue
+	logger    *utils.Logger
+}
+
+func NewTwoFactorHandler(db *gorm.DB, logger *utils.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		db:        db,
+		twoFactor: auth.NewTwoFactorManager(db),
+		sessions:  auth.NewSessionManager(db),
+		mail:      services.NewMailQueue(db, logger),
+		logger:    logger,
+	}
+}
+
+// Reset2FARequest records how support confirmed that the person asking for
+// the reset owns the account.
+type Reset2FARequest struct {
+	VerificationMethod string `json:"verification_method" binding:"required,oneof=id_document video_call phone_callback support_pin other"`
+	Reference          string `json:"reference" binding:"required"` // ticket number or similar
+	Notes              string `json:"notes"`
+}
+
+// BackupCodeStatus reports how many unused backup codes the user has left.
+func (h *TwoFactorHandler) BackupCodeStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"remaining": h.twoFactor.RemainingBackupCodes(c.GetUint("user_id"))})
+}
+
+// RegenerateBackupCodes replaces the user's backup codes after checking a
+// current code. The new codes are only shown in this response.
+func (h *TwoFactorHandler) RegenerateBackupCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": auth.ErrTwoFactorNotEnabled.Error()})
+		return
+	}
+	if !h.twoFactor.Verify(&user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrInvalidTwoFactorCode.Error()})
+		return
+	}
+
+	codes, err := h.twoFactor.ReplaceBackupCodes(user.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate backup codes"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Backup codes regenerated by user %d", user.ID))
+	c.JSON(http.StatusOK, gin.H{"backup_codes": codes})
+}
+
+// ListTrustedDevices returns the devices that skip the one-time code.
+func (h *TwoFactorHandler) ListTrustedDevices(c *gin.Context) {
+	devices, err := h.twoFactor.TrustedDevices(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list trusted devices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"devices":    devices,
+		"trust_days": h.twoFactor.TrustDays(),
+	})
+}
+
+// RevokeTrustedDevice makes one device ask for a code again.
+func (h *TwoFactorHandler) RevokeTrustedDevice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	revoked, err := h.twoFactor.RevokeTrustedDevices(c.GetUint("user_id"), uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke trusted device"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trusted device not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trusted device revoked"})
+}
+
+// RevokeTrustedDevices makes every device ask for a code again.
+func (h *TwoFactorHandler) RevokeTrustedDevices(c *gin.Context) {
+	revoked, err := h.twoFactor.RevokeTrustedDevices(c.GetUint("user_id"), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke trusted devices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// AdminReset2FA turns off the two-factor authentication of a user who lost
+// their authenticator and backup codes. Support must record how they
+// verified the user's identity; the reset is written to the audit log, the
+// user's sessions are ended and the user is told by email.
+func (h *TwoFactorHandler) AdminReset2FA(c *gin.Context) {
+	if _, isToken := c.Get("api_token_id"); isToken {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Resetting two-factor authentication requires an interactive session"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req Reset2FARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := c.GetUint("user_id")
+	var subject models.User
+	if err := h.db.First(&subject, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	if subject.ID == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot reset your own two-factor authentication"})
+		return
+	}
+	if !subject.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": auth.ErrTwoFactorNotEnabled.Error()})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	details := fmt.Sprintf("Identity verified by %s, reference %s", req.VerificationMethod, strings.TrimSpace(req.Reference))
+	if notes := strings.TrimSpace(req.Notes); notes != "" {
+		details += ": " + notes
+	}
+	if err := h.twoFactor.DisableAudited(subject.ID, &models.AuditLog{
+		ActorID:   actorID,
+		SubjectID: subject.ID,
+		Action:    "two_factor_reset",
+		Details:   details,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    http.StatusOK,
+		IP:        clientIP,
+		UserAgent: c.GetHeader("User-Agent"),
+	}); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to reset two-factor authentication of user %d: %v", subject.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	if _, err := h.sessions.RevokeAll(subject.ID, "", "two_factor_reset"); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to revoke sessions of user %d after two-factor reset: %v", subject.ID, err))
+	}
+	if err := h.mail.EnqueueTemplate(services.MailTemplateTwoFactorReset, subject.ResellerID, subject.Email, map[string]interface{}{
+		"User":     services.NewMailUser(&subject),
+		"ClientIP": clientIP,
+	}); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to queue two-factor reset notice for user %d: %v", subject.ID, err))
+	}
+
+	h.logger.Info(fmt.Sprintf("Two-factor authentication of user %d reset by admin %d (%s)", subject.ID, actorID, details))
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
@@ -1,4 +1,3 @@
-
 package user
 
 import (
@@ -74,7 +73,7 @@ func (h *AppsHandler) GetAvailableApplications(c *gin.Context) {
 
 func (h *AppsHandler) InstallApplication(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
 		Name        string `json:"name" binding:"required"`
 		DomainID    uint   `json:"domain_id" binding:"required"`
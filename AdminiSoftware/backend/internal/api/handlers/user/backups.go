@@ -0,0 +1,233 @@
+package user
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+type BackupHandler struct {
+	db            *gorm.DB
+	logger        *utils.Logger
+	backupService *services.BackupService
+	upgrader      websocket.Upgrader
+}
+
+func NewBackupHandler(db *gorm.DB, logger *utils.Logger) *BackupHandler {
+	return &BackupHandler{
+		db:            db,
+		logger:        logger,
+		backupService: services.NewBackupService(db, logger),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+	}
+}
+
+func (h *BackupHandler) GetBackups(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	backups, total, err := h.backupService.GetBackups(userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backups": backups, "total": total, "page": page, "limit": limit})
+}
+
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req models.CreateBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	backup, err := h.backupService.CreateBackup(userID, &req)
+	if err != nil {
+		h.logger.Error("Failed to create backup: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, h.jobStarted(backup.ID, userID, gin.H{"backup": backup}))
+}
+
+func (h *BackupHandler) RestoreBackup(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := h.backupService.RestoreBackup(uint(id), userID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		case errors.Is(err, services.ErrBackupJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, h.jobStarted(uint(id), userID, gin.H{"message": "Restore started"}))
+}
+
+// jobStarted adds the job's first progress snapshot and a stream ticket to
+// the response, so clients can open the progress stream without another
+// round trip. A job that already finished leaves both out.
+func (h *BackupHandler) jobStarted(backupID, userID uint, response gin.H) gin.H {
+	response["progress_url"] = fmt.Sprintf("/api/panel/backups/%d/progress", backupID)
+	if progress, err := h.backupService.GetProgress(backupID, userID); err == nil {
+		response["progress"] = progress
+	}
+	if ticket, expiresAt, err := h.backupService.ProgressTicket(backupID, userID); err == nil {
+		response["stream_url"] = fmt.Sprintf("/api/panel/backups/%d/progress/ws?ticket=%s", backupID, ticket)
+		response["ticket_expires_at"] = expiresAt
+	}
+	return response
+}
+
+func (h *BackupHandler) DeleteBackup(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if _, err := h.backupService.GetProgress(uint(id), userID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrBackupJobRunning.Error()})
+		return
+	}
+
+	if err := h.backupService.DeleteBackup(uint(id), userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete backup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Backup deleted successfully"})
+}
+
+func (h *BackupHandler) GetProgress(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	progress, err := h.backupService.GetProgress(uint(id), userID)
+	if err != nil {
+		backup, err := h.backupService.GetBackup(uint(id), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"backup_id": backup.ID,
+			"phase":     backup.Status,
+			"progress":  backup.Progress,
+			"error":     backup.ErrorLog,
+			"done":      true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// ProgressTicket issues the ticket StreamProgress is opened with.
+func (h *BackupHandler) ProgressTicket(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	ticket, expiresAt, err := h.backupService.ProgressTicket(uint(id), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No running job for this backup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_at": expiresAt})
+}
+
+// StreamProgress upgrades to a WebSocket and pushes progress events until the
+// job finishes or the client disconnects. Browsers cannot authenticate a
+// WebSocket with a header, so it is opened with ?ticket= from ProgressTicket.
+func (h *BackupHandler) StreamProgress(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, err := h.backupService.RedeemProgressTicket(uint(id), c.Query("ticket"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, unsubscribe, err := h.backupService.SubscribeProgress(uint(id), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No running job for this backup"})
+		return
+	}
+	defer unsubscribe()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.Error("Failed to upgrade backup progress connection: " + err.Error())
+		return
+	}
+	defer conn.Close()
+
+	// Drain client frames so close messages are processed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job finished"),
+					time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (h *BackupHandler) CancelJob(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := h.backupService.CancelJob(uint(id), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No running job for this backup"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Cancellation requested"})
+}
@@ -1,8 +1,8 @@
-
 package user
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
 	"net/http"
 	"strconv"
 
@@ -11,11 +11,15 @@ import (
 )
 
 type DatabaseHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	quotas *services.QuotaService
 }
 
 func NewDatabaseHandler(db *gorm.DB) *DatabaseHandler {
-	return &DatabaseHandler{db: db}
+	return &DatabaseHandler{
+		db:     db,
+		quotas: services.NewQuotaService(db),
+	}
 }
 
 func (h *DatabaseHandler) GetDatabases(c *gin.Context) {
@@ -41,7 +45,13 @@ func (h *DatabaseHandler) CreateDatabase(c *gin.Context) {
 	database.Host = "localhost"
 	database.Port = 3306
 
-	if err := h.db.Create(&database).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaDatabases, func(tx *gorm.DB) error {
+		return tx.Create(&database).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create database"})
 		return
 	}
@@ -52,7 +62,7 @@ func (h *DatabaseHandler) CreateDatabase(c *gin.Context) {
 func (h *DatabaseHandler) DeleteDatabase(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	if err := h.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Database{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete database"})
 		return
@@ -101,7 +111,7 @@ func (h *DatabaseHandler) CreateDatabaseUser(c *gin.Context) {
 func (h *DatabaseHandler) UpdateDatabaseUser(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var dbUser models.DatabaseUser
 	if err := h.db.Joins("JOIN databases ON database_users.database_id = databases.id").
 		Where("database_users.id = ? AND databases.user_id = ?", id, userID).
@@ -126,7 +136,7 @@ func (h *DatabaseHandler) UpdateDatabaseUser(c *gin.Context) {
 func (h *DatabaseHandler) DeleteDatabaseUser(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	if err := h.db.Joins("JOIN databases ON database_users.database_id = databases.id").
 		Where("database_users.id = ? AND databases.user_id = ?", id, userID).
 		Delete(&models.DatabaseUser{}).Error; err != nil {
@@ -150,7 +160,7 @@ func (h *DatabaseHandler) GetDatabasePrivileges(c *gin.Context) {
 func (h *DatabaseHandler) UpdateDatabasePrivileges(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var request struct {
 		Privileges []string `json:"privileges"`
 	}
@@ -188,7 +198,7 @@ func (h *DatabaseHandler) UpdateDatabasePrivileges(c *gin.Context) {
 func (h *DatabaseHandler) GetDatabaseStats(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var database models.Database
 	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&database).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
@@ -196,14 +206,14 @@ func (h *DatabaseHandler) GetDatabaseStats(c *gin.Context) {
 	}
 
 	stats := map[string]interface{}{
-		"database_id":   id,
-		"name":          database.Name,
-		"type":          database.Type,
-		"size":          "25.6 MB",
-		"tables":        15,
-		"records":       12450,
-		"last_backup":   "2024-01-15T02:00:00Z",
-		"created_at":    database.CreatedAt,
+		"database_id": id,
+		"name":        database.Name,
+		"type":        database.Type,
+		"size":        "25.6 MB",
+		"tables":      15,
+		"records":     12450,
+		"last_backup": "2024-01-15T02:00:00Z",
+		"created_at":  database.CreatedAt,
 		"table_stats": []map[string]interface{}{
 			{"name": "users", "records": 250, "size": "45 KB"},
 			{"name": "posts", "records": 1200, "size": "2.1 MB"},
@@ -223,7 +233,7 @@ func (h *DatabaseHandler) GetDatabaseStats(c *gin.Context) {
 func (h *DatabaseHandler) BackupDatabase(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var database models.Database
 	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&database).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
@@ -231,11 +241,11 @@ func (h *DatabaseHandler) BackupDatabase(c *gin.Context) {
 	}
 
 	backup := map[string]interface{}{
-		"database_id":   id,
-		"backup_file":   database.Name + "_backup_" + "20240115103000.sql",
-		"size":          "25.6 MB",
-		"created_at":    "2024-01-15T10:30:00Z",
-		"download_url":  "/api/user/databases/" + strconv.Itoa(id) + "/backup/download",
+		"database_id":  id,
+		"backup_file":  database.Name + "_backup_" + "20240115103000.sql",
+		"size":         "25.6 MB",
+		"created_at":   "2024-01-15T10:30:00Z",
+		"download_url": "/api/user/databases/" + strconv.Itoa(id) + "/backup/download",
 	}
 
 	c.JSON(http.StatusOK, backup)
@@ -244,7 +254,7 @@ func (h *DatabaseHandler) BackupDatabase(c *gin.Context) {
 func (h *DatabaseHandler) RestoreDatabase(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	file, header, err := c.Request.FormFile("backup_file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get backup file"})
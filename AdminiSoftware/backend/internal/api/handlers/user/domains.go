@@ -1,8 +1,9 @@
-
 package user
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
 	"net/http"
 	"strconv"
 
@@ -11,11 +12,20 @@ import (
 )
 
 type DomainHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	quotas      *services.QuotaService
+	nameservers *services.NameserverService
+	logger      *utils.Logger
 }
 
 func NewDomainHandler(db *gorm.DB) *DomainHandler {
-	return &DomainHandler{db: db}
+	logger := utils.NewLogger()
+	return &DomainHandler{
+		db:          db,
+		quotas:      services.NewQuotaService(db),
+		nameservers: services.NewNameserverService(db, logger),
+		logger:      logger,
+	}
 }
 
 func (h *DomainHandler) GetDomains(c *gin.Context) {
@@ -40,7 +50,13 @@ func (h *DomainHandler) CreateSubdomain(c *gin.Context) {
 	domain.Type = "subdomain"
 	domain.Status = "active"
 
-	if err := h.db.Create(&domain).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaSubdomains, func(tx *gorm.DB) error {
+		return tx.Create(&domain).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subdomain"})
 		return
 	}
@@ -70,17 +86,27 @@ func (h *DomainHandler) CreateAddonDomain(c *gin.Context) {
 	domain.Type = "addon"
 	domain.Status = "active"
 
-	if err := h.db.Create(&domain).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaAddonDomains, func(tx *gorm.DB) error {
+		return tx.Create(&domain).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create addon domain"})
 		return
 	}
+	// The zone gets the nameservers of the account's reseller
+	if err := h.nameservers.ApplyToDomain(&domain); err != nil {
+		h.logger.Error(err.Error())
+	}
 
 	c.JSON(http.StatusCreated, domain)
 }
 
 func (h *DomainHandler) GetRedirects(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	redirects := []map[string]interface{}{
 		{
 			"id":          1,
@@ -99,7 +125,7 @@ func (h *DomainHandler) GetRedirects(c *gin.Context) {
 			"created_at":  "2024-01-14T15:20:00Z",
 		},
 	}
-	
+
 	c.JSON(http.StatusOK, redirects)
 }
 
@@ -126,7 +152,7 @@ func (h *DomainHandler) DeleteRedirect(c *gin.Context) {
 func (h *DomainHandler) GetDNSRecords(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	domain := c.Query("domain")
-	
+
 	var dnsRecords []models.DNSRecord
 	if err := h.db.Joins("JOIN dns_zones ON dns_records.zone_id = dns_zones.id").
 		Where("dns_zones.user_id = ? AND dns_zones.name = ?", userID, domain).
@@ -134,7 +160,7 @@ func (h *DomainHandler) GetDNSRecords(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch DNS records"})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, dnsRecords)
 }
 
@@ -164,7 +190,7 @@ func (h *DomainHandler) CreateDNSRecord(c *gin.Context) {
 func (h *DomainHandler) UpdateDNSRecord(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	var record models.DNSRecord
 	if err := h.db.Joins("JOIN dns_zones ON dns_records.zone_id = dns_zones.id").
 		Where("dns_records.id = ? AND dns_zones.user_id = ?", id, userID).
@@ -189,7 +215,7 @@ func (h *DomainHandler) UpdateDNSRecord(c *gin.Context) {
 func (h *DomainHandler) DeleteDNSRecord(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id, _ := strconv.Atoi(c.Param("id"))
-	
+
 	if err := h.db.Joins("JOIN dns_zones ON dns_records.zone_id = dns_zones.id").
 		Where("dns_records.id = ? AND dns_zones.user_id = ?", id, userID).
 		Delete(&models.DNSRecord{}).Error; err != nil {
@@ -202,7 +228,7 @@ func (h *DomainHandler) DeleteDNSRecord(c *gin.Context) {
 
 func (h *DomainHandler) GetErrorPages(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	errorPages := []map[string]interface{}{
 		{
 			"code":        404,
@@ -223,14 +249,14 @@ func (h *DomainHandler) GetErrorPages(c *gin.Context) {
 			"enabled":     false,
 		},
 	}
-	
+
 	c.JSON(http.StatusOK, errorPages)
 }
 
 func (h *DomainHandler) UpdateErrorPage(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	code := c.Param("code")
-	
+
 	var request struct {
 		CustomPage string `json:"custom_page"`
 		Enabled    bool   `json:"enabled"`
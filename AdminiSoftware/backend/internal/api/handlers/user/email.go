@@ -1,9 +1,10 @@
-
 package user
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/services"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -14,12 +15,16 @@ import (
 type EmailHandler struct {
 	db           *gorm.DB
 	emailService *services.EmailService
+	passwords    *auth.PasswordPolicy
+	quotas       *services.QuotaService
 }
 
 func NewEmailHandler(db *gorm.DB, emailService *services.EmailService) *EmailHandler {
 	return &EmailHandler{
 		db:           db,
 		emailService: emailService,
+		passwords:    auth.NewPasswordPolicy(db),
+		quotas:       services.NewQuotaService(db),
 	}
 }
 
@@ -38,7 +43,7 @@ func (h *EmailHandler) GetEmailAccounts(c *gin.Context) {
 
 func (h *EmailHandler) CreateEmailAccount(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
 		DomainID uint   `json:"domain_id" binding:"required"`
 		Username string `json:"username" binding:"required"`
@@ -51,6 +56,10 @@ func (h *EmailHandler) CreateEmailAccount(c *gin.Context) {
 		return
 	}
 
+	if !h.checkPassword(c, req.Password, auth.PasswordSubject{Kind: auth.PasswordKindEmail, Username: req.Username}) {
+		return
+	}
+
 	email := models.Email{
 		UserID:   userID,
 		DomainID: req.DomainID,
@@ -60,7 +69,13 @@ func (h *EmailHandler) CreateEmailAccount(c *gin.Context) {
 		Status:   "active",
 	}
 
-	if err := h.db.Create(&email).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaEmailAccounts, func(tx *gorm.DB) error {
+		return tx.Create(&email).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create email account"})
 		return
 	}
@@ -90,6 +105,9 @@ func (h *EmailHandler) UpdateEmailAccount(c *gin.Context) {
 	}
 
 	if req.Password != "" {
+		if !h.checkPassword(c, req.Password, auth.PasswordSubject{Kind: auth.PasswordKindEmail}) {
+			return
+		}
 		email.Password = req.Password
 	}
 	if req.Quota > 0 {
@@ -140,7 +158,7 @@ func (h *EmailHandler) GetEmailForwarders(c *gin.Context) {
 
 func (h *EmailHandler) CreateEmailForwarder(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
 		DomainID    uint   `json:"domain_id" binding:"required"`
 		Source      string `json:"source" binding:"required"`
@@ -167,3 +185,23 @@ func (h *EmailHandler) CreateEmailForwarder(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Email forwarder created successfully", "forwarder": forwarder})
 }
+
+// checkPassword applies the password policy and responds when the password
+// is rejected.
+func (h *EmailHandler) checkPassword(c *gin.Context, password string, subject auth.PasswordSubject) bool {
+	err := h.passwords.Validate(password, subject)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": policyErr.Violations,
+		})
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to check the password right now, please try again"})
+	return false
+}
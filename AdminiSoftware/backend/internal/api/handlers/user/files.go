@@ -1,4 +1,3 @@
-
 package user
 
 import (
@@ -21,7 +20,7 @@ func NewFileHandler(db *gorm.DB) *FileHandler {
 func (h *FileHandler) GetFiles(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	path := c.DefaultQuery("path", "/")
-	
+
 	// In a real implementation, you would read from the actual file system
 	files := []map[string]interface{}{
 		{
@@ -57,7 +56,7 @@ func (h *FileHandler) GetFiles(c *gin.Context) {
 			"owner":       "user" + strconv.Itoa(int(userID)),
 		},
 	}
-	
+
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"path":  path,
 		"files": files,
@@ -67,7 +66,7 @@ func (h *FileHandler) GetFiles(c *gin.Context) {
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	path := c.DefaultPostForm("path", "/")
-	
+
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get uploaded file"})
@@ -77,12 +76,12 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 	// In a real implementation, you would save the file to the user's directory
 	savedPath := filepath.Join(path, header.Filename)
-	
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "File uploaded successfully",
-		"path":     savedPath,
-		"size":     header.Size,
-		"user_id":  userID,
+		"message": "File uploaded successfully",
+		"path":    savedPath,
+		"size":    header.Size,
+		"user_id": userID,
 	})
 }
 
@@ -98,7 +97,7 @@ func (h *FileHandler) CreateDirectory(c *gin.Context) {
 	}
 
 	fullPath := filepath.Join(request.Path, request.Name)
-	
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Directory created successfully",
 		"path":    fullPath,
@@ -109,7 +108,7 @@ func (h *FileHandler) CreateDirectory(c *gin.Context) {
 func (h *FileHandler) DeleteFile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	filePath := c.Param("filepath")
-	
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File deleted successfully",
 		"path":    filePath,
@@ -120,7 +119,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 func (h *FileHandler) EditFile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	filePath := c.Param("filepath")
-	
+
 	var request struct {
 		Content string `json:"content"`
 	}
@@ -139,10 +138,10 @@ func (h *FileHandler) EditFile(c *gin.Context) {
 func (h *FileHandler) GetFileContent(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	filePath := c.Param("filepath")
-	
+
 	// In a real implementation, you would read the actual file content
 	content := "<!DOCTYPE html>\n<html>\n<head>\n    <title>Sample Page</title>\n</head>\n<body>\n    <h1>Hello World!</h1>\n</body>\n</html>"
-	
+
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"path":    filePath,
 		"content": content,
@@ -154,9 +153,9 @@ func (h *FileHandler) GetFileContent(c *gin.Context) {
 func (h *FileHandler) CompressFiles(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	var request struct {
-		Files      []string `json:"files"`
-		ArchiveName string  `json:"archive_name"`
-		Format     string  `json:"format"`
+		Files       []string `json:"files"`
+		ArchiveName string   `json:"archive_name"`
+		Format      string   `json:"format"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -195,21 +194,21 @@ func (h *FileHandler) ExtractArchive(c *gin.Context) {
 
 func (h *FileHandler) GetDiskUsage(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	usage := map[string]interface{}{
-		"total_quota":    "10 GB",
-		"used_space":     "3.2 GB",
-		"free_space":     "6.8 GB",
-		"percentage":     32.0,
-		"inode_quota":    100000,
-		"inodes_used":    15420,
-		"inodes_free":    84580,
+		"total_quota":      "10 GB",
+		"used_space":       "3.2 GB",
+		"free_space":       "6.8 GB",
+		"percentage":       32.0,
+		"inode_quota":      100000,
+		"inodes_used":      15420,
+		"inodes_free":      84580,
 		"inode_percentage": 15.42,
 		"breakdown": map[string]interface{}{
-			"web_files":     "2.1 GB",
-			"mail":          "850 MB",
-			"databases":     "230 MB",
-			"logs":          "20 MB",
+			"web_files": "2.1 GB",
+			"mail":      "850 MB",
+			"databases": "230 MB",
+			"logs":      "20 MB",
 		},
 		"largest_files": []map[string]interface{}{
 			{"path": "/public_html/uploads/video.mp4", "size": "245 MB"},
@@ -217,7 +216,7 @@ func (h *FileHandler) GetDiskUsage(c *gin.Context) {
 			{"path": "/mail/user@domain.com/cur", "size": "156 MB"},
 		},
 	}
-	
+
 	c.JSON(http.StatusOK, usage)
 }
 
@@ -1,4 +1,3 @@
-
 package user
 
 import (
@@ -14,12 +13,14 @@ import (
 type UserSSLHandler struct {
 	db         *gorm.DB
 	sslService *services.SSLService
+	quotas     *services.QuotaService
 }
 
 func NewUserSSLHandler(db *gorm.DB, sslService *services.SSLService) *UserSSLHandler {
 	return &UserSSLHandler{
 		db:         db,
 		sslService: sslService,
+		quotas:     services.NewQuotaService(db),
 	}
 }
 
@@ -37,15 +38,15 @@ func (h *UserSSLHandler) GetSSLCertificates(c *gin.Context) {
 
 func (h *UserSSLHandler) GenerateSSLCertificate(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
-		DomainID    uint   `json:"domain_id" binding:"required"`
-		Domain      string `json:"domain" binding:"required"`
-		Type        string `json:"type" binding:"required"`
-		Email       string `json:"email" binding:"required"`
-		Country     string `json:"country"`
-		State       string `json:"state"`
-		City        string `json:"city"`
+		DomainID     uint   `json:"domain_id" binding:"required"`
+		Domain       string `json:"domain" binding:"required"`
+		Type         string `json:"type" binding:"required"`
+		Email        string `json:"email" binding:"required"`
+		Country      string `json:"country"`
+		State        string `json:"state"`
+		City         string `json:"city"`
 		Organization string `json:"organization"`
 	}
 
@@ -71,7 +72,13 @@ func (h *UserSSLHandler) GenerateSSLCertificate(c *gin.Context) {
 		Status:      "active",
 	}
 
-	if err := h.db.Create(&ssl).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaSSLCertificates, func(tx *gorm.DB) error {
+		return tx.Create(&ssl).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save SSL certificate"})
 		return
 	}
@@ -81,7 +88,7 @@ func (h *UserSSLHandler) GenerateSSLCertificate(c *gin.Context) {
 
 func (h *UserSSLHandler) InstallSSLCertificate(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
 		DomainID    uint   `json:"domain_id" binding:"required"`
 		Domain      string `json:"domain" binding:"required"`
@@ -106,7 +113,13 @@ func (h *UserSSLHandler) InstallSSLCertificate(c *gin.Context) {
 		Status:      "active",
 	}
 
-	if err := h.db.Create(&ssl).Error; err != nil {
+	if err := h.quotas.Create(userID, services.QuotaSSLCertificates, func(tx *gorm.DB) error {
+		return tx.Create(&ssl).Error
+	}); err != nil {
+		if status, ok := services.QuotaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to install SSL certificate"})
 		return
 	}
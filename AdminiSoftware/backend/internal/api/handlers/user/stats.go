@@ -1,4 +1,3 @@
-
 package user
 
 import (
@@ -42,13 +41,13 @@ func (h *UserStatsHandler) GetDashboardStats(c *gin.Context) {
 	h.db.First(&user, userID)
 
 	stats := map[string]interface{}{
-		"domains":      domainCount,
-		"emails":       emailCount,
-		"databases":    dbCount,
-		"ssl_certs":    sslCount,
-		"disk_used":    user.DiskUsed,
-		"disk_limit":   user.DiskLimit,
-		"bandwidth_used": user.BandwidthUsed,
+		"domains":         domainCount,
+		"emails":          emailCount,
+		"databases":       dbCount,
+		"ssl_certs":       sslCount,
+		"disk_used":       user.DiskUsed,
+		"disk_limit":      user.DiskLimit,
+		"bandwidth_used":  user.BandwidthUsed,
 		"bandwidth_limit": user.BandwidthLimit,
 	}
 
@@ -71,8 +70,8 @@ func (h *UserStatsHandler) GetDiskUsage(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
 	type DiskUsageBreakdown struct {
-		Category string  `json:"category"`
-		Size     int64   `json:"size"`
+		Category   string  `json:"category"`
+		Size       int64   `json:"size"`
 		Percentage float64 `json:"percentage"`
 	}
 
@@ -89,9 +88,9 @@ func (h *UserStatsHandler) GetDiskUsage(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total_used": user.DiskUsed,
+		"total_used":  user.DiskUsed,
 		"total_limit": user.DiskLimit,
-		"breakdown": breakdown,
+		"breakdown":   breakdown,
 	})
 }
 
@@ -101,7 +100,7 @@ func (h *UserStatsHandler) GetVisitorStats(c *gin.Context) {
 
 	var stats []models.VisitorStat
 	query := h.db.Where("user_id = ?", userID)
-	
+
 	if domainID != "" {
 		query = query.Where("domain_id = ?", domainID)
 	}
@@ -121,7 +120,7 @@ func (h *UserStatsHandler) GetErrorLogs(c *gin.Context) {
 
 	var logs []models.ErrorLog
 	query := h.db.Where("user_id = ?", userID)
-	
+
 	if domainID != "" {
 		query = query.Where("domain_id = ?", domainID)
 	}
@@ -141,7 +140,7 @@ func (h *UserStatsHandler) GetAccessLogs(c *gin.Context) {
 
 	var logs []models.AccessLog
 	query := h.db.Where("user_id = ?", userID)
-	
+
 	if domainID != "" {
 		query = query.Where("domain_id = ?", domainID)
 	}
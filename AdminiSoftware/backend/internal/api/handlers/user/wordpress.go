@@ -1,4 +1,3 @@
-
 package user
 
 import (
@@ -32,18 +31,18 @@ func (h *WordPressHandler) GetWordPressSites(c *gin.Context) {
 
 func (h *WordPressHandler) CreateWordPressSite(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
-		DomainID    uint   `json:"domain_id" binding:"required"`
-		Path        string `json:"path"`
-		SiteTitle   string `json:"site_title" binding:"required"`
-		AdminUser   string `json:"admin_user" binding:"required"`
-		AdminPass   string `json:"admin_pass" binding:"required"`
-		AdminEmail  string `json:"admin_email" binding:"required"`
-		DatabaseID  uint   `json:"database_id" binding:"required"`
-		Version     string `json:"version"`
-		Theme       string `json:"theme"`
-		Plugins     []string `json:"plugins"`
+		DomainID   uint     `json:"domain_id" binding:"required"`
+		Path       string   `json:"path"`
+		SiteTitle  string   `json:"site_title" binding:"required"`
+		AdminUser  string   `json:"admin_user" binding:"required"`
+		AdminPass  string   `json:"admin_pass" binding:"required"`
+		AdminEmail string   `json:"admin_email" binding:"required"`
+		DatabaseID uint     `json:"database_id" binding:"required"`
+		Version    string   `json:"version"`
+		Theme      string   `json:"theme"`
+		Plugins    []string `json:"plugins"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -147,10 +146,10 @@ func (h *WordPressHandler) InstallPlugin(c *gin.Context) {
 	}
 
 	var req struct {
-		Name        string `json:"name" binding:"required"`
-		Version     string `json:"version"`
-		Source      string `json:"source"`
-		AutoActivate bool  `json:"auto_activate"`
+		Name         string `json:"name" binding:"required"`
+		Version      string `json:"version"`
+		Source       string `json:"source"`
+		AutoActivate bool   `json:"auto_activate"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
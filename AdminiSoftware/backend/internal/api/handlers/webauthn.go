@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebAuthnHandler struct {
+	db        *gorm.DB
+	webAuthn  *auth.WebAuthnManager
+	mfaPolicy *auth.MFAPolicy
+	sessions  *auth.SessionManager
+	logger    *utils.Logger
+}
+
+func NewWebAuthnHandler(db *gorm.DB, webAuthn *auth.WebAuthnManager, logger *utils.Logger) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		db:        db,
+		webAuthn:  webAuthn,
+		mfaPolicy: auth.NewMFAPolicy(db),
+		sessions:  auth.NewSessionManager(db),
+		logger:    logger,
+	}
+}
+
+type MFAPolicyRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	credentials, err := h.webAuthn.ListCredentials(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	options, ceremonyID, err := h.webAuthn.BeginRegistration(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"webauthn":    options,
+	})
+}
+
+// FinishRegistration takes the PublicKeyCredential returned by the browser as
+// the request body; the ceremony and credential name come from the query.
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	credential, err := h.webAuthn.FinishRegistration(&user, c.Query("ceremony_id"), c.Query("name"), c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Security key %q registered for user %d", credential.Name, user.ID))
+
+	// A first key enrolled past the MFA policy does not upgrade the session
+	// that enrolled it; the user signs in again with the key
+	if c.GetBool("mfa_enrollment") {
+		if err := h.sessions.RevokeByPublicID(c.GetString("session_id"), "mfa_enrolled"); err != nil {
+			h.logger.Error(fmt.Sprintf("Failed to end session after security key enrolment for user %d: %v", user.ID, err))
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":         "Security key registered, sign in again with it",
+			"credential":      credential,
+			"reauth_required": true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Security key registered",
+		"credential": credential,
+	})
+}
+
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	if h.webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential ID"})
+		return
+	}
+
+	if err := h.webAuthn.DeleteCredential(uint(id), c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Security key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Security key removed"})
+}
+
+func (h *WebAuthnHandler) AdminGetMFAPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"roles": h.mfaPolicy.Roles()})
+}
+
+// AdminUpdateMFAPolicy sets the roles that must sign in with a security key.
+func (h *WebAuthnHandler) AdminUpdateMFAPolicy(c *gin.Context) {
+	var req MFAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, role := range req.Roles {
+		if role != "admin" && role != "reseller" && role != "user" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + role})
+			return
+		}
+	}
+
+	if err := h.mfaPolicy.SetRoles(req.Roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update MFA policy"})
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Phishing-resistant MFA policy set to %v by admin %d", req.Roles, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"roles": req.Roles})
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,7 +25,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := auth.ValidateJWT(tokenString)
+		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -65,9 +65,9 @@ package middleware
 
 import (
 	"AdminiSoftware/internal/auth"
+	"github.com/gin-gonic/gin"
 	"net/http"
 	"strings"
-	"github.com/gin-gonic/gin"
 )
 
 func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
@@ -86,7 +86,7 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := jwtManager.Verify(tokenString)
+		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -94,7 +94,7 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 		}
 
 		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
+		c.Set("username", claims.Username)
 		c.Set("user_role", claims.Role)
 		c.Next()
 	}
@@ -133,13 +133,18 @@ package middleware
 
 import (
 	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
+// AuthMiddleware accepts either a session JWT or an API token as the bearer
+// token.
+func AuthMiddleware(jwtManager *auth.JWTManager, sessions *auth.SessionManager, apiTokens *auth.APITokenManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -155,6 +160,23 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(tokenString, auth.APITokenPrefix) {
+			token, user, err := apiTokens.Authenticate(tokenString, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			c.Set("role", user.Role)
+			c.Set("api_token_id", token.ID)
+			c.Set("api_token_scopes", auth.TokenScopes(token))
+			c.Next()
+			return
+		}
+
 		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -162,9 +184,237 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		if !sessions.IsActive(claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Set("auth_methods", claims.AuthMethods)
+		if claims.IsImpersonation() {
+			c.Set("impersonator_id", claims.ActorID)
+			c.Set("impersonator_username", claims.ActorUsername)
+			c.Set("impersonation_id", claims.ImpersonationID)
+			c.Header("X-Impersonated-By", claims.ActorUsername)
+		}
+		c.Next()
+	}
+}
+
+// AuditImpersonation writes every request made with an impersonation token
+// to the audit log once it has been handled.
+func AuditImpersonation(impersonation *auth.ImpersonationManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		actorID := c.GetUint("impersonator_id")
+		if actorID == 0 {
+			return
+		}
+
+		impersonationID := c.GetUint("impersonation_id")
+		impersonation.Record(&models.AuditLog{
+			ActorID:         actorID,
+			SubjectID:       c.GetUint("user_id"),
+			ImpersonationID: &impersonationID,
+			Method:          c.Request.Method,
+			Path:            c.Request.URL.Path,
+			Status:          c.Writer.Status(),
+			IP:              c.ClientIP(),
+			UserAgent:       c.GetHeader("User-Agent"),
+		})
+	}
+}
+
+// BlockWhileImpersonating keeps support from changing credentials or security
+// settings of the customer they are signed in as.
+func BlockWhileImpersonating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("impersonator_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":         "This action is not available while impersonating a user",
+				"impersonating": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePhishingResistantMFA rejects sessions that were not authenticated
+// with a security key when the MFA policy covers the user's role.
+// API tokens are exempt: they can only be created from a session that
+// already passed this check.
+func RequirePhishingResistantMFA(policy *auth.MFAPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("api_token_id"); isToken || !policy.RequiredFor(c.GetString("role")) {
+			c.Next()
+			return
+		}
+
+		authMethods, _ := c.Get("auth_methods")
+		methods, _ := authMethods.([]string)
+		if !auth.IsPhishingResistant(methods) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                   "Sign in with a security key or passkey to continue",
+				"mfa_enrollment_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// mfaEnrollmentWindow is how recently a session must have signed in to enrol
+// its first security key while the MFA policy still blocks it.
+const mfaEnrollmentWindow = 10 * time.Minute
+
+// AllowMFAEnrollment guards security key registration, which is reachable
+// before RequirePhishingResistantMFA. Sessions the policy would let through
+// pass. Otherwise only a user without any security key may enrol, from a
+// session that signed in within mfaEnrollmentWindow; the handler then signs
+// that session out so the next sign-in uses the new key.
+func AllowMFAEnrollment(policy *auth.MFAPolicy, webAuthn *auth.WebAuthnManager, sessions *auth.SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authMethods, _ := c.Get("auth_methods")
+		methods, _ := authMethods.([]string)
+		if _, isToken := c.Get("api_token_id"); isToken || webAuthn == nil ||
+			!policy.RequiredFor(c.GetString("role")) || auth.IsPhishingResistant(methods) {
+			c.Next()
+			return
+		}
+
+		credentials, err := webAuthn.ListCredentials(c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security keys"})
+			c.Abort()
+			return
+		}
+		if len(credentials) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                   "Sign in with a security key or passkey to register another one",
+				"mfa_enrollment_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		session, err := sessions.Get(c.GetString("session_id"))
+		if err != nil || time.Since(session.CreatedAt) > mfaEnrollmentWindow {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":           "Sign in again to register a security key",
+				"reauth_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("mfa_enrollment", true)
+		c.Next()
+	}
+}
+
+// RequirePasswordChange holds sessions of users whose password is older than
+// the policy allows until they change it. Sessions opened without the local
+// password (passkeys, single sign-on), impersonation and API tokens are
+// exempt.
+func RequirePasswordChange(policy *auth.PasswordPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, isToken := c.Get("api_token_id")
+		authMethods, _ := c.Get("auth_methods")
+		methods, _ := authMethods.([]string)
+		if isToken || c.GetUint("impersonator_id") != 0 || !utils.Contains(methods, auth.AuthMethodPassword) {
+			c.Next()
+			return
+		}
+
+		if policy.PasswordExpiredFor(c.GetUint("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                    "Your password has expired and must be changed",
+				"password_change_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAPITokenScope limits requests made with an API token to the resources
+// its scopes cover. The scope is derived from the route: the group under
+// /api/admin, /api/reseller or /api/panel names the resource, and GET or HEAD
+// needs read access while other methods need write access. Everything else,
+// including account and token management, is closed to API tokens, as are
+// routes wrapped in BlockAPITokens whatever their group.
+func RequireAPITokenScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, isToken := c.Get("api_token_scopes")
+		if !isToken {
+			c.Next()
+			return
+		}
+		scopes, _ := value.([]string)
+
+		segments := strings.Split(strings.Trim(c.FullPath(), "/"), "/")
+		if len(segments) < 3 || (segments[1] != "admin" && segments[1] != "reseller" && segments[1] != "panel") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API token"})
+			c.Abort()
+			return
+		}
+
+		action := "write"
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			action = "read"
+		}
+		required := segments[2] + ":" + action
+
+		if auth.ValidateScope(required) != nil || !auth.ScopeGranted(scopes, required) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "API token is missing the required scope",
+				"required_scope": required,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAPIToken closes an endpoint to sessions, for APIs meant for other
+// systems.
+func RequireAPIToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("api_token_id"); !isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires an API token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BlockAPITokens closes an endpoint to API tokens whatever their scopes, for
+// actions that hand out credentials or take them away: account archives,
+// impersonation and second-factor resets.
+func BlockAPITokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("api_token_id"); isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API token"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -191,7 +441,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
-func OptionalAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
+func OptionalAuth(jwtManager *auth.JWTManager, sessions *auth.SessionManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -206,10 +456,11 @@ func OptionalAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 		}
 
 		claims, err := jwtManager.ValidateToken(tokenString)
-		if err == nil {
+		if err == nil && sessions.IsActive(claims.SessionID) {
 			c.Set("user_id", claims.UserID)
 			c.Set("username", claims.Username)
 			c.Set("role", claims.Role)
+			c.Set("session_id", claims.SessionID)
 		}
 
 		c.Next()
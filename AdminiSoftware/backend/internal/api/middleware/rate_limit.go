@@ -105,7 +105,6 @@ func GeneralRateLimit() gin.HandlerFunc {
 package middleware
 
 import (
-	"AdminiSoftware/internal/utils"
 	"context"
 	"fmt"
 	"net/http"
@@ -135,7 +134,7 @@ func (rl *RateLimiter) Middleware(requests int, window time.Duration) gin.Handle
 			return
 		}
 
-		ip := utils.GetClientIP(c.Request.RemoteAddr, c.GetHeader("X-Forwarded-For"), c.GetHeader("X-Real-IP"))
+		ip := c.ClientIP()
 		key := fmt.Sprintf("rate_limit:%s", ip)
 
 		ctx := context.Background()
@@ -1,9 +1,9 @@
-
 package middleware
 
 import (
+	"AdminiSoftware/internal/auth"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,25 +31,128 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
-// CheckPermission middleware for granular permissions
+// LoadPermissions resolves the authenticated user's grants once per request
+// for CheckPermission and CheckScopedPermission.
+func LoadPermissions(resolver *auth.PermissionResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grants, err := resolver.Resolve(c.GetUint("user_id"), c.GetString("role"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_permissions", grants)
+		c.Next()
+	}
+}
+
+// CheckPermission requires the permission to be granted without a reseller
+// restriction.
 func CheckPermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		permissions, exists := c.Get("user_permissions")
-		if !exists {
+		grants, ok := userGrants(c)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User permissions not found"})
 			c.Abort()
 			return
 		}
 
-		userPermissions := permissions.([]string)
-		for _, userPerm := range userPermissions {
-			if userPerm == permission || strings.HasSuffix(userPerm, "*") {
-				c.Next()
+		if !grants.Allows(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "Permission denied",
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CheckScopedPermission also accepts a permission granted over a reseller's
+// accounts and records that reseller as "reseller_id" for the handler. Users
+// scoped to several resellers pick one with the X-Reseller-ID header.
+func CheckScopedPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grants, ok := userGrants(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User permissions not found"})
+			c.Abort()
+			return
+		}
+
+		if grants.Allows(permission) {
+			if header := c.GetHeader("X-Reseller-ID"); header != "" {
+				id, err := strconv.Atoi(header)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid X-Reseller-ID header"})
+					c.Abort()
+					return
+				}
+				c.Set("reseller_id", uint(id))
+			}
+			c.Next()
+			return
+		}
+
+		scopes := grants.ResellerScopes(permission)
+		if len(scopes) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "Permission denied",
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		resellerID := scopes[0]
+		if header := c.GetHeader("X-Reseller-ID"); header != "" {
+			id, err := strconv.Atoi(header)
+			if err != nil || !containsUint(scopes, uint(id)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied for this reseller"})
+				c.Abort()
 				return
 			}
+			resellerID = uint(id)
+		} else if len(scopes) > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Select a reseller with the X-Reseller-ID header",
+				"resellers": scopes,
+			})
+			c.Abort()
+			return
 		}
 
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
-		c.Abort()
+		c.Set("reseller_id", resellerID)
+		c.Next()
+	}
+}
+
+// ResellerID is the reseller whose accounts a reseller route acts on: the one
+// chosen by CheckScopedPermission, or the caller themselves.
+func ResellerID(c *gin.Context) uint {
+	if id, ok := c.Get("reseller_id"); ok {
+		return id.(uint)
+	}
+	return c.GetUint("user_id")
+}
+
+func userGrants(c *gin.Context) (*auth.Grants, bool) {
+	value, exists := c.Get("user_permissions")
+	if !exists {
+		return nil, false
+	}
+	grants, ok := value.(*auth.Grants)
+	return grants, ok
+}
+
+func containsUint(values []uint, value uint) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
@@ -1,11 +1,17 @@
-
 package api
 
 import (
 	"AdminiSoftware/internal/api/handlers"
+	"AdminiSoftware/internal/api/handlers/admin"
+	"AdminiSoftware/internal/api/handlers/reseller"
+	"AdminiSoftware/internal/api/handlers/user"
 	"AdminiSoftware/internal/api/middleware"
 	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/services"
 	"AdminiSoftware/internal/utils"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,9 +22,23 @@ import (
 func SetupRouter(db *gorm.DB, redis *redis.Client, logger *utils.Logger) *gin.Engine {
 	router := gin.New()
 
+	// Forwarded client addresses are only believed from the reverse proxies
+	// listed in TRUSTED_PROXIES; everything else sees the peer address
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		logger.Error(fmt.Sprintf("Invalid TRUSTED_PROXIES, trusting no proxies: %v", err))
+		router.SetTrustedProxies(nil)
+	}
+
 	// Initialize managers
-	jwtManager := auth.NewJWTManager("your-secret-key-change-this")
-	bruteForce := auth.NewBruteForceProtection(redis)
+	keyRing := auth.NewKeyRing(db, logger)
+	jwtManager := auth.NewJWTManager(keyRing)
+	sessions := auth.NewSessionManager(db)
+	apiTokens := auth.NewAPITokenManager(db)
+	permissions := auth.NewPermissionResolver(db)
+	mfaPolicy := auth.NewMFAPolicy(db)
+	passwordPolicy := auth.NewPasswordPolicy(db)
+	bruteForce := auth.NewBruteForceProtection(db, redis)
+	impersonation := auth.NewImpersonationManager(db, jwtManager)
 	rateLimiter := middleware.NewRateLimiter(redis)
 
 	// Global middleware
@@ -28,76 +48,428 @@ func SetupRouter(db *gorm.DB, redis *redis.Client, logger *utils.Logger) *gin.En
 	router.Use(middleware.ErrorLogger(logger))
 	router.Use(gin.Recovery())
 
+	// Passkeys stay disabled when the relying party is misconfigured
+	webAuthn, err := auth.NewWebAuthnManager(db)
+	if err != nil {
+		logger.Error("WebAuthn disabled: " + err.Error())
+	}
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, jwtManager, bruteForce, logger)
+	authHandler := handlers.NewAuthHandler(db, jwtManager, bruteForce, webAuthn, logger)
+	sessionHandler := handlers.NewSessionHandler(db, logger)
+	webAuthnHandler := handlers.NewWebAuthnHandler(db, webAuthn, logger)
+	oidcProviderHandler := handlers.NewOIDCProviderHandler(db, logger)
+	ldapDirectoryHandler := handlers.NewLDAPDirectoryHandler(db, logger)
+	apiTokenHandler := handlers.NewAPITokenHandler(db, logger)
+	roleHandler := handlers.NewRoleHandler(db, logger)
+	impersonationHandler := handlers.NewImpersonationHandler(db, jwtManager, logger)
+	passwordPolicyHandler := handlers.NewPasswordPolicyHandler(db, logger)
+	lockoutHandler := handlers.NewLockoutHandler(db, bruteForce, logger)
+	signingKeyHandler := handlers.NewSigningKeyHandler(db, keyRing, logger)
+	emailTemplateHandler := handlers.NewEmailTemplateHandler(db, logger)
+	mailQueueHandler := handlers.NewMailQueueHandler(db, logger)
+	twoFactorHandler := handlers.NewTwoFactorHandler(db, logger)
+	quotaHandler := handlers.NewQuotaHandler(db, logger)
+	packageChangeHandler := handlers.NewPackageChangeHandler(db, logger)
+	resellerPoolHandler := handlers.NewResellerPoolHandler(db, logger)
+	accountLifecycleHandler := handlers.NewAccountLifecycleHandler(db, logger)
+	bulkJobHandler := handlers.NewBulkJobHandler(db, logger)
+	accountRenameHandler := handlers.NewAccountRenameHandler(db, logger)
+	provisioningHandler := handlers.NewProvisioningHandler(db, logger)
+	billingHandler := handlers.NewBillingHandler(db, logger)
+	resellerHostingHandler := handlers.NewResellerHostingHandler(db, logger)
+
+	// Account, hosting and package handlers
+	accountHandler := admin.NewAccountHandler(services.NewAccountService(db, logger), logger)
+	archiveHandler := admin.NewArchiveHandler(db, logger)
+	packageHandler := admin.NewPackageHandler(db)
+	dnsHandler := admin.NewDNSHandler(db)
+	sslHandler := admin.NewSSLHandler(db)
+	resellerAccountHandler := reseller.NewResellerAccountHandler(db, logger)
+	resellerPackageHandler := reseller.NewResellerPackageHandler(db)
+	domainHandler := user.NewDomainHandler(db)
+	emailHandler := user.NewEmailHandler(db, services.NewEmailService(db, logger))
+	databaseHandler := user.NewDatabaseHandler(db)
+	fileHandler := user.NewFileHandler(db)
+	appsHandler := user.NewAppsHandler(db)
+	wordPressHandler := user.NewWordPressHandler(db)
+	userSSLHandler := user.NewUserSSLHandler(db, services.NewSSLService(db, logger))
+	backupHandler := user.NewBackupHandler(db, logger)
+	statsHandler := user.NewUserStatsHandler(db)
+
+	// Published for services that verify the panel's access tokens
+	router.GET("/.well-known/jwks.json", signingKeyHandler.JWKS)
+
+	// Branding for the hostname the panel is opened on, before sign-in
+	router.GET("/api/branding", resellerHostingHandler.Branding)
+
+	// Opened by browsers, which cannot send the Authorization header on a
+	// WebSocket; authorized by a ticket from /progress/ticket instead
+	router.GET("/api/panel/backups/:id/progress/ws", rateLimiter.APIRateLimit(), backupHandler.StreamProgress)
 
 	// Public routes
-	auth := router.Group("/api/auth")
-	auth.Use(rateLimiter.AuthRateLimit())
+	authGroup := router.Group("/api/auth")
+	authGroup.Use(rateLimiter.AuthRateLimit())
 	{
-		auth.POST("/login", authHandler.Login)
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/forgot-password", authHandler.ForgotPassword)
-		auth.POST("/reset-password", authHandler.ResetPassword)
-		auth.POST("/verify-2fa", authHandler.Verify2FA)
+		authGroup.POST("/login", authHandler.Login)
+		authGroup.POST("/register", authHandler.Register)
+		authGroup.POST("/forgot-password", authHandler.ForgotPassword)
+		authGroup.POST("/reset-password", authHandler.ResetPassword)
+		authGroup.POST("/verify-2fa", authHandler.Verify2FA)
+		authGroup.POST("/refresh", authHandler.RefreshToken)
+		authGroup.POST("/webauthn/login/begin", authHandler.BeginPasskeyLogin)
+		authGroup.POST("/webauthn/login/finish", authHandler.FinishPasskeyLogin)
+		authGroup.GET("/oidc/providers", authHandler.ListOIDCProviders)
+		authGroup.POST("/oidc/:id/begin", authHandler.BeginOIDCLogin)
+		authGroup.POST("/oidc/callback", authHandler.FinishOIDCLogin)
+		authGroup.POST("/sso", authHandler.FinishSSOLogin)
 	}
 
 	// Protected routes
 	api := router.Group("/api")
 	api.Use(rateLimiter.APIRateLimit())
-	api.Use(middleware.AuthMiddleware(jwtManager))
+	api.Use(middleware.AuthMiddleware(jwtManager, sessions, apiTokens))
+	api.Use(middleware.RequireAPITokenScope())
+	api.Use(middleware.AuditImpersonation(impersonation))
+
+	// Permissions are resolved once per request; every route below declares
+	// the one it needs.
+	api.Use(middleware.LoadPermissions(permissions))
+
+	// Registered before the MFA policy check so users can enrol a security key
+	enrollment := middleware.AllowMFAEnrollment(mfaPolicy, webAuthn, sessions)
+	api.POST("/auth/logout", authHandler.Logout)
+	api.POST("/auth/impersonation/end", impersonationHandler.EndImpersonation)
+	api.GET("/user/webauthn/credentials", middleware.CheckPermission("profile:manage"), webAuthnHandler.ListCredentials)
+	api.POST("/user/webauthn/register/begin", middleware.CheckPermission("profile:manage"), middleware.BlockWhileImpersonating(), enrollment, webAuthnHandler.BeginRegistration)
+	api.POST("/user/webauthn/register/finish", middleware.CheckPermission("profile:manage"), middleware.BlockWhileImpersonating(), enrollment, webAuthnHandler.FinishRegistration)
+
+	api.Use(middleware.RequirePhishingResistantMFA(mfaPolicy))
+
+	// Registered before the password age check so an expired password can be
+	// replaced
+	api.GET("/user/password-policy", middleware.CheckPermission("profile:manage"), passwordPolicyHandler.GetPolicy)
+	api.POST("/user/change-password", middleware.CheckPermission("profile:manage"), middleware.BlockWhileImpersonating(), authHandler.ChangePassword)
+
+	api.Use(middleware.RequirePasswordChange(passwordPolicy))
 	{
 		// User routes
 		user := api.Group("/user")
+		user.Use(middleware.CheckPermission("profile:manage"))
 		{
 			user.GET("/profile", authHandler.GetProfile)
 			user.PUT("/profile", authHandler.UpdateProfile)
-			user.POST("/change-password", authHandler.ChangePassword)
-			user.POST("/enable-2fa", authHandler.Enable2FA)
-			user.POST("/disable-2fa", authHandler.Disable2FA)
+			user.POST("/enable-2fa", middleware.BlockWhileImpersonating(), authHandler.Enable2FA)
+			user.POST("/confirm-2fa", middleware.BlockWhileImpersonating(), authHandler.Confirm2FA)
+			user.POST("/disable-2fa", middleware.BlockWhileImpersonating(), authHandler.Disable2FA)
+			user.GET("/2fa/backup-codes", twoFactorHandler.BackupCodeStatus)
+			user.POST("/2fa/backup-codes", middleware.BlockWhileImpersonating(), twoFactorHandler.RegenerateBackupCodes)
+			user.GET("/2fa/trusted-devices", twoFactorHandler.ListTrustedDevices)
+			user.DELETE("/2fa/trusted-devices", twoFactorHandler.RevokeTrustedDevices)
+			user.DELETE("/2fa/trusted-devices/:id", twoFactorHandler.RevokeTrustedDevice)
+			user.GET("/quota", quotaHandler.GetUsage)
+			user.GET("/statements", billingHandler.MyStatements)
+			user.GET("/statements/:id", billingHandler.MyStatement)
+			user.GET("/nameservers", resellerHostingHandler.MyNameservers)
+
+			// Session management
+			user.GET("/sessions", sessionHandler.ListSessions)
+			user.DELETE("/sessions", middleware.BlockWhileImpersonating(), sessionHandler.RevokeOtherSessions)
+			user.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+
+			// Security keys and passkeys
+			user.DELETE("/webauthn/credentials/:id", middleware.BlockWhileImpersonating(), webAuthnHandler.DeleteCredential)
+
+			// Single sign-on identities are linked by their owner
+			user.POST("/oidc/:id/link", middleware.BlockWhileImpersonating(), authHandler.LinkOIDCIdentity)
+			user.POST("/ldap/:id/link", middleware.BlockWhileImpersonating(), authHandler.LinkLDAPIdentity)
+
+			// API tokens for automation
+			user.GET("/api-tokens", apiTokenHandler.ListTokens)
+			user.POST("/api-tokens", middleware.BlockWhileImpersonating(), apiTokenHandler.CreateToken)
+			user.DELETE("/api-tokens/:id", apiTokenHandler.RevokeToken)
+
+			// Effective permissions, for hiding what the user cannot do
+			user.GET("/permissions", roleHandler.ListPermissions)
 		}
 
 		// Admin routes
 		admin := api.Group("/admin")
-		admin.Use(middleware.RequireRole("admin"))
 		{
 			// Account management
 			accounts := admin.Group("/accounts")
 			{
-				accounts.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List accounts"}) })
-				accounts.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create account"}) })
-				accounts.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update account"}) })
-				accounts.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete account"}) })
+				accounts.GET("/", middleware.CheckPermission("accounts:read"), accountHandler.GetAccounts)
+				accounts.POST("/", middleware.CheckPermission("accounts:create"), accountHandler.CreateAccount)
+				accounts.PUT("/:id", middleware.CheckPermission("accounts:update"), accountHandler.UpdateAccount)
+				accounts.DELETE("/:id", middleware.CheckPermission("accounts:delete"), accountHandler.DeleteAccount)
+				accounts.POST("/:id/suspend", middleware.CheckPermission("accounts:update"), accountHandler.SuspendAccount)
+				accounts.POST("/:id/unsuspend", middleware.CheckPermission("accounts:update"), accountHandler.UnsuspendAccount)
+				accounts.GET("/:id/export", middleware.BlockAPITokens(), middleware.CheckPermission("accounts:export"), archiveHandler.ExportAccount)
+				accounts.POST("/import", middleware.BlockAPITokens(), middleware.CheckPermission("accounts:import"), archiveHandler.ImportAccount)
+				accounts.POST("/:id/impersonate", middleware.BlockAPITokens(), middleware.CheckPermission("accounts:impersonate"), middleware.BlockWhileImpersonating(), impersonationHandler.StartImpersonation)
+				accounts.POST("/:id/reset-2fa", middleware.BlockAPITokens(), middleware.CheckPermission("security:manage"), middleware.BlockWhileImpersonating(), twoFactorHandler.AdminReset2FA)
+				accounts.GET("/:id/quota", middleware.CheckPermission("accounts:read"), quotaHandler.AccountUsage)
+				accounts.GET("/:id/package-change", middleware.CheckPermission("accounts:read"), packageChangeHandler.PreviewChange)
+				accounts.PUT("/:id/package", middleware.CheckPermission("accounts:update"), packageChangeHandler.ChangePackage)
+				accounts.GET("/:id/package-history", middleware.CheckPermission("accounts:read"), packageChangeHandler.PackageHistory)
+				accounts.PUT("/:id/status", middleware.CheckPermission("accounts:update"), accountLifecycleHandler.Transition)
+				accounts.GET("/:id/status-history", middleware.CheckPermission("accounts:read"), accountLifecycleHandler.History)
+				accounts.POST("/:id/rename", middleware.CheckPermission("accounts:update"), accountRenameHandler.Rename)
+				accounts.GET("/:id/renames", middleware.CheckPermission("accounts:read"), accountRenameHandler.History)
+				accounts.POST("/:id/renames/:rename_id/resume", middleware.CheckPermission("accounts:update"), accountRenameHandler.Resume)
+				accounts.POST("/:id/renames/:rename_id/rollback", middleware.CheckPermission("accounts:update"), accountRenameHandler.Rollback)
+				accounts.GET("/:id/meter", middleware.CheckPermission("billing:read"), billingHandler.AccountMeter)
+			}
+
+			// Bulk operations run as jobs with a result per account
+			bulkJobs := admin.Group("/bulk-jobs")
+			{
+				bulkJobs.GET("/", middleware.CheckPermission("accounts:read"), bulkJobHandler.ListJobs)
+				bulkJobs.GET("/:id", middleware.CheckPermission("accounts:read"), bulkJobHandler.GetJob)
+				bulkJobs.POST("/:id/cancel", middleware.CheckPermission("accounts:update"), bulkJobHandler.CancelJob)
+				bulkJobs.POST("/create", middleware.CheckPermission("accounts:create"), bulkJobHandler.Start(services.BulkCreate, "accounts:create"))
+				bulkJobs.POST("/suspend", middleware.CheckPermission("accounts:update"), bulkJobHandler.Start(services.BulkSuspend, "accounts:update"))
+				bulkJobs.POST("/unsuspend", middleware.CheckPermission("accounts:update"), bulkJobHandler.Start(services.BulkUnsuspend, "accounts:update"))
+				bulkJobs.POST("/change-package", middleware.CheckPermission("accounts:update"), bulkJobHandler.Start(services.BulkChangePackage, "accounts:update"))
+				bulkJobs.POST("/reset-password", middleware.CheckPermission("accounts:update"), bulkJobHandler.Start(services.BulkResetPassword, "accounts:update"))
+				bulkJobs.POST("/delete", middleware.CheckPermission("accounts:delete"), bulkJobHandler.Start(services.BulkDelete, "accounts:delete"))
+			}
+
+			// Provisioning API for billing systems, keyed by their service IDs
+			provisioning := admin.Group("/provisioning")
+			provisioning.Use(middleware.RequireAPIToken(), middleware.CheckPermission("accounts:provision"))
+			{
+				provisioning.POST("/services", provisioningHandler.CreateService)
+				provisioning.GET("/services/:service_id", provisioningHandler.GetService)
+				provisioning.POST("/services/:service_id/suspend", provisioningHandler.SuspendService)
+				provisioning.POST("/services/:service_id/unsuspend", provisioningHandler.UnsuspendService)
+				provisioning.POST("/services/:service_id/terminate", provisioningHandler.TerminateService)
+				provisioning.POST("/services/:service_id/change-package", provisioningHandler.ChangePackage)
+				provisioning.POST("/services/:service_id/change-password", provisioningHandler.ChangePassword)
+				provisioning.POST("/services/:service_id/login", provisioningHandler.LoginLink)
+				provisioning.GET("/services/:service_id/usage", provisioningHandler.ServiceUsage)
+				provisioning.GET("/usage", provisioningHandler.Usage)
+			}
+
+			// Monthly statements priced from metered usage
+			billing := admin.Group("/billing")
+			{
+				billing.GET("/statements", middleware.CheckPermission("billing:read"), billingHandler.ListStatements)
+				billing.GET("/statements/:id", middleware.CheckPermission("billing:read"), billingHandler.GetStatement)
+				billing.POST("/statements/generate", middleware.CheckPermission("billing:manage"), billingHandler.GenerateStatements)
+				billing.GET("/export", middleware.CheckPermission("billing:manage"), billingHandler.Export)
 			}
 
 			// Package management
 			packages := admin.Group("/packages")
 			{
-				packages.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List packages"}) })
-				packages.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create package"}) })
-				packages.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update package"}) })
-				packages.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete package"}) })
+				packages.GET("/", middleware.CheckPermission("packages:read"), packageHandler.GetPackages)
+				packages.POST("/", middleware.CheckPermission("packages:write"), packageHandler.CreatePackage)
+				packages.PUT("/:id", middleware.CheckPermission("packages:write"), packageHandler.UpdatePackage)
+				packages.DELETE("/:id", middleware.CheckPermission("packages:write"), packageHandler.DeletePackage)
+				packages.GET("/features", middleware.CheckPermission("packages:read"), packageHandler.GetFeatures)
+			}
+
+			// DNS zones of every account
+			dns := admin.Group("/dns")
+			{
+				dns.GET("/", middleware.CheckPermission("dns:manage"), dnsHandler.GetDNSZones)
+				dns.POST("/", middleware.CheckPermission("dns:manage"), dnsHandler.CreateDNSZone)
+				dns.PUT("/:id", middleware.CheckPermission("dns:manage"), dnsHandler.UpdateDNSZone)
+				dns.DELETE("/:id", middleware.CheckPermission("dns:manage"), dnsHandler.DeleteDNSZone)
+				dns.GET("/:zone_id/records", middleware.CheckPermission("dns:manage"), dnsHandler.GetDNSRecords)
+				dns.POST("/:zone_id/records", middleware.CheckPermission("dns:manage"), dnsHandler.CreateDNSRecord)
+			}
+
+			// Certificates of every account
+			ssl := admin.Group("/ssl")
+			{
+				ssl.GET("/", middleware.CheckPermission("ssl:manage"), sslHandler.GetSSLCertificates)
+				ssl.POST("/", middleware.CheckPermission("ssl:manage"), sslHandler.CreateSSLCertificate)
+				ssl.PUT("/:id", middleware.CheckPermission("ssl:manage"), sslHandler.UpdateSSLCertificate)
+				ssl.DELETE("/:id", middleware.CheckPermission("ssl:manage"), sslHandler.DeleteSSLCertificate)
+				ssl.POST("/:id/install", middleware.CheckPermission("ssl:manage"), sslHandler.InstallSSLCertificate)
+				ssl.POST("/letsencrypt", middleware.CheckPermission("ssl:manage"), sslHandler.GenerateLetsEncryptSSL)
 			}
 
+			// Reseller allocations
+			admin.GET("/resellers/allocations", middleware.CheckPermission("resellers:manage"), resellerPoolHandler.Report)
+			admin.GET("/resellers/:id/allocation", middleware.CheckPermission("resellers:manage"), resellerPoolHandler.GetAllocation)
+			admin.PUT("/resellers/:id/allocation", middleware.CheckPermission("resellers:manage"), resellerPoolHandler.UpdateAllocation)
+
 			// System management
 			system := admin.Group("/system")
 			{
-				system.GET("/stats", func(c *gin.Context) { c.JSON(200, gin.H{"message": "System stats"}) })
-				system.GET("/services", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List services"}) })
-				system.POST("/services/:name/restart", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Restart service"}) })
+				system.GET("/stats", middleware.CheckPermission("system:read"), func(c *gin.Context) { c.JSON(200, gin.H{"message": "System stats"}) })
+				system.GET("/services", middleware.CheckPermission("system:read"), func(c *gin.Context) { c.JSON(200, gin.H{"message": "List services"}) })
+				system.POST("/services/:name/restart", middleware.CheckPermission("system:services"), func(c *gin.Context) { c.JSON(200, gin.H{"message": "Restart service"}) })
 			}
+
+			// Session management
+			admin.GET("/sessions", middleware.CheckPermission("sessions:manage"), sessionHandler.AdminListSessions)
+			admin.DELETE("/sessions/:id", middleware.CheckPermission("sessions:manage"), sessionHandler.AdminRevokeSession)
+			admin.DELETE("/users/:id/sessions", middleware.CheckPermission("sessions:manage"), sessionHandler.AdminRevokeUserSessions)
+			admin.GET("/api-tokens", middleware.CheckPermission("sessions:manage"), apiTokenHandler.AdminListTokens)
+			admin.DELETE("/api-tokens/:id", middleware.CheckPermission("sessions:manage"), apiTokenHandler.AdminRevokeToken)
+
+			// Impersonation audit trail
+			admin.GET("/impersonations", middleware.CheckPermission("audit:read"), impersonationHandler.ListImpersonations)
+			admin.GET("/audit-log", middleware.CheckPermission("audit:read"), impersonationHandler.ListAuditLog)
+
+			// Security policy
+			admin.GET("/security/mfa-policy", middleware.CheckPermission("security:manage"), webAuthnHandler.AdminGetMFAPolicy)
+			admin.PUT("/security/mfa-policy", middleware.CheckPermission("security:manage"), webAuthnHandler.AdminUpdateMFAPolicy)
+			admin.GET("/security/password-policy", middleware.CheckPermission("security:manage"), passwordPolicyHandler.GetPolicy)
+			admin.PUT("/security/password-policy", middleware.CheckPermission("security:manage"), passwordPolicyHandler.UpdatePolicy)
+			admin.GET("/security/lockouts", middleware.CheckPermission("security:manage"), lockoutHandler.ListLockouts)
+			admin.POST("/security/lockouts/release", middleware.CheckPermission("security:manage"), lockoutHandler.ReleaseLockout)
+			admin.GET("/security/signing-keys", middleware.CheckPermission("security:manage"), signingKeyHandler.ListKeys)
+			admin.POST("/security/signing-keys/rotate", middleware.CheckPermission("security:manage"), middleware.BlockWhileImpersonating(), signingKeyHandler.RotateKey)
+
+			// Outgoing mail and the templates customers receive
+			admin.GET("/mail-queue", middleware.CheckPermission("system:read"), mailQueueHandler.ListMail)
+			admin.POST("/mail-queue/:id/retry", middleware.CheckPermission("system:services"), mailQueueHandler.RetryMail)
+			admin.GET("/email-templates", middleware.CheckPermission("branding:manage"), emailTemplateHandler.ListTemplates)
+			admin.PUT("/email-templates/:name", middleware.CheckPermission("branding:manage"), emailTemplateHandler.UpdateTemplate)
+			admin.DELETE("/email-templates/:name", middleware.CheckPermission("branding:manage"), emailTemplateHandler.ResetTemplate)
+			admin.GET("/panel-hostnames", middleware.CheckPermission("branding:manage"), resellerHostingHandler.ListPanelHostnames)
+
+			// Single sign-on providers
+			admin.GET("/oidc/providers", middleware.CheckPermission("sso:manage"), oidcProviderHandler.ListProviders)
+			admin.POST("/oidc/providers", middleware.CheckPermission("sso:manage"), oidcProviderHandler.CreateProvider)
+			admin.PUT("/oidc/providers/:id", middleware.CheckPermission("sso:manage"), oidcProviderHandler.UpdateProvider)
+			admin.DELETE("/oidc/providers/:id", middleware.CheckPermission("sso:manage"), oidcProviderHandler.DeleteProvider)
+			admin.GET("/ldap/directories", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.ListDirectories)
+			admin.POST("/ldap/directories", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.CreateDirectory)
+			admin.PUT("/ldap/directories/:id", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.UpdateDirectory)
+			admin.DELETE("/ldap/directories/:id", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.DeleteDirectory)
+			admin.POST("/ldap/directories/:id/test", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.TestDirectory)
+			admin.POST("/ldap/directories/:id/sync", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.SyncDirectory)
+			admin.GET("/ldap/directories/:id/identities", middleware.CheckPermission("sso:manage"), ldapDirectoryHandler.ListIdentities)
+
+			// Roles and permissions
+			admin.GET("/permissions", middleware.CheckPermission("roles:manage"), roleHandler.ListPermissions)
+			admin.GET("/roles", middleware.CheckPermission("roles:manage"), roleHandler.ListRoles)
+			admin.POST("/roles", middleware.CheckPermission("roles:manage"), roleHandler.CreateRole)
+			admin.PUT("/roles/:id", middleware.CheckPermission("roles:manage"), roleHandler.UpdateRole)
+			admin.DELETE("/roles/:id", middleware.CheckPermission("roles:manage"), roleHandler.DeleteRole)
+			admin.GET("/role-assignments", middleware.CheckPermission("roles:manage"), roleHandler.ListAssignments)
+			admin.POST("/role-assignments", middleware.CheckPermission("roles:manage"), roleHandler.AssignRole)
+			admin.DELETE("/role-assignments/:id", middleware.CheckPermission("roles:manage"), roleHandler.UnassignRole)
 		}
 
-		// Reseller routes
+		// Reseller routes act on the accounts of the reseller the permission
+		// is scoped to
 		reseller := api.Group("/reseller")
-		reseller.Use(middleware.RequireRole("reseller", "admin"))
 		{
 			// Reseller account management
 			accounts := reseller.Group("/accounts")
 			{
-				accounts.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List reseller accounts"}) })
-				accounts.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create reseller account"}) })
+				accounts.GET("/", middleware.CheckScopedPermission("accounts:read"), resellerAccountHandler.GetAccounts)
+				accounts.POST("/", middleware.CheckScopedPermission("accounts:create"), resellerAccountHandler.CreateAccount)
+				accounts.PUT("/:id", middleware.CheckScopedPermission("accounts:update"), resellerAccountHandler.UpdateAccount)
+				accounts.POST("/:id/suspend", middleware.CheckScopedPermission("accounts:update"), resellerAccountHandler.SuspendAccount)
+				accounts.DELETE("/:id", middleware.CheckScopedPermission("accounts:delete"), resellerAccountHandler.DeleteAccount)
+				accounts.POST("/:id/impersonate", middleware.BlockAPITokens(), middleware.CheckScopedPermission("accounts:impersonate"), middleware.BlockWhileImpersonating(), impersonationHandler.StartImpersonation)
+				accounts.GET("/:id/quota", middleware.CheckScopedPermission("accounts:read"), quotaHandler.AccountUsage)
+				accounts.GET("/:id/package-change", middleware.CheckScopedPermission("accounts:read"), packageChangeHandler.PreviewChange)
+				accounts.PUT("/:id/package", middleware.CheckScopedPermission("accounts:update"), packageChangeHandler.ChangePackage)
+				accounts.GET("/:id/package-history", middleware.CheckScopedPermission("accounts:read"), packageChangeHandler.PackageHistory)
+				accounts.PUT("/:id/status", middleware.CheckScopedPermission("accounts:update"), accountLifecycleHandler.Transition)
+				accounts.GET("/:id/status-history", middleware.CheckScopedPermission("accounts:read"), accountLifecycleHandler.History)
+				accounts.POST("/:id/rename", middleware.CheckScopedPermission("accounts:update"), accountRenameHandler.Rename)
+				accounts.GET("/:id/renames", middleware.CheckScopedPermission("accounts:read"), accountRenameHandler.History)
+				accounts.POST("/:id/renames/:rename_id/resume", middleware.CheckScopedPermission("accounts:update"), accountRenameHandler.Resume)
+				accounts.POST("/:id/renames/:rename_id/rollback", middleware.CheckScopedPermission("accounts:update"), accountRenameHandler.Rollback)
+				accounts.GET("/:id/meter", middleware.CheckScopedPermission("billing:read"), billingHandler.AccountMeter)
 			}
+
+			// Bulk operations run as jobs with a result per account
+			bulkJobs := reseller.Group("/bulk-jobs")
+			{
+				bulkJobs.GET("/", middleware.CheckScopedPermission("accounts:read"), bulkJobHandler.ListJobs)
+				bulkJobs.GET("/:id", middleware.CheckScopedPermission("accounts:read"), bulkJobHandler.GetJob)
+				bulkJobs.POST("/:id/cancel", middleware.CheckScopedPermission("accounts:update"), bulkJobHandler.CancelJob)
+				bulkJobs.POST("/create", middleware.CheckScopedPermission("accounts:create"), bulkJobHandler.Start(services.BulkCreate, "accounts:create"))
+				bulkJobs.POST("/suspend", middleware.CheckScopedPermission("accounts:update"), bulkJobHandler.Start(services.BulkSuspend, "accounts:update"))
+				bulkJobs.POST("/unsuspend", middleware.CheckScopedPermission("accounts:update"), bulkJobHandler.Start(services.BulkUnsuspend, "accounts:update"))
+				bulkJobs.POST("/change-package", middleware.CheckScopedPermission("accounts:update"), bulkJobHandler.Start(services.BulkChangePackage, "accounts:update"))
+				bulkJobs.POST("/reset-password", middleware.CheckScopedPermission("accounts:update"), bulkJobHandler.Start(services.BulkResetPassword, "accounts:update"))
+				bulkJobs.POST("/delete", middleware.CheckScopedPermission("accounts:delete"), bulkJobHandler.Start(services.BulkDelete, "accounts:delete"))
+			}
+
+			// Provisioning API for billing systems, keyed by their service IDs
+			provisioning := reseller.Group("/provisioning")
+			provisioning.Use(middleware.RequireAPIToken(), middleware.CheckScopedPermission("accounts:provision"))
+			{
+				provisioning.POST("/services", provisioningHandler.CreateService)
+				provisioning.GET("/services/:service_id", provisioningHandler.GetService)
+				provisioning.POST("/services/:service_id/suspend", provisioningHandler.SuspendService)
+				provisioning.POST("/services/:service_id/unsuspend", provisioningHandler.UnsuspendService)
+				provisioning.POST("/services/:service_id/terminate", provisioningHandler.TerminateService)
+				provisioning.POST("/services/:service_id/change-package", provisioningHandler.ChangePackage)
+				provisioning.POST("/services/:service_id/change-password", provisioningHandler.ChangePassword)
+				provisioning.POST("/services/:service_id/login", provisioningHandler.LoginLink)
+				provisioning.GET("/services/:service_id/usage", provisioningHandler.ServiceUsage)
+				provisioning.GET("/usage", provisioningHandler.Usage)
+			}
+
+			// Statements of the reseller and of its customers
+			billing := reseller.Group("/billing")
+			{
+				billing.GET("/statements", middleware.CheckScopedPermission("billing:read"), billingHandler.ListStatements)
+				billing.GET("/statements/:id", middleware.CheckScopedPermission("billing:read"), billingHandler.GetStatement)
+			}
+
+			// Packages the reseller offers, within its pool
+			packages := reseller.Group("/packages")
+			{
+				packages.GET("/", middleware.CheckScopedPermission("packages:read"), resellerPackageHandler.GetPackages)
+				packages.POST("/", middleware.CheckScopedPermission("packages:write"), resellerPackageHandler.CreatePackage)
+				packages.PUT("/:id", middleware.CheckScopedPermission("packages:write"), resellerPackageHandler.UpdatePackage)
+				packages.DELETE("/:id", middleware.CheckScopedPermission("packages:write"), resellerPackageHandler.DeletePackage)
+			}
+
+			// What the reseller may share out among its customers
+			reseller.GET("/allocation", middleware.CheckScopedPermission("accounts:read"), resellerPoolHandler.MyAllocation)
+
+			// Single sign-on for the reseller's customers
+			reseller.GET("/oidc/providers", middleware.CheckScopedPermission("sso:manage"), oidcProviderHandler.ListProviders)
+			reseller.POST("/oidc/providers", middleware.CheckScopedPermission("sso:manage"), oidcProviderHandler.CreateProvider)
+			reseller.PUT("/oidc/providers/:id", middleware.CheckScopedPermission("sso:manage"), oidcProviderHandler.UpdateProvider)
+			reseller.DELETE("/oidc/providers/:id", middleware.CheckScopedPermission("sso:manage"), oidcProviderHandler.DeleteProvider)
+			reseller.GET("/ldap/directories", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.ListDirectories)
+			reseller.POST("/ldap/directories", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.CreateDirectory)
+			reseller.PUT("/ldap/directories/:id", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.UpdateDirectory)
+			reseller.DELETE("/ldap/directories/:id", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.DeleteDirectory)
+			reseller.POST("/ldap/directories/:id/test", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.TestDirectory)
+			reseller.POST("/ldap/directories/:id/sync", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.SyncDirectory)
+			reseller.GET("/ldap/directories/:id/identities", middleware.CheckScopedPermission("sso:manage"), ldapDirectoryHandler.ListIdentities)
+
+			// Roles for the reseller's own staff
+			reseller.GET("/roles", middleware.CheckScopedPermission("roles:manage"), roleHandler.ListRoles)
+			reseller.POST("/roles", middleware.CheckScopedPermission("roles:manage"), roleHandler.CreateRole)
+			reseller.PUT("/roles/:id", middleware.CheckScopedPermission("roles:manage"), roleHandler.UpdateRole)
+			reseller.DELETE("/roles/:id", middleware.CheckScopedPermission("roles:manage"), roleHandler.DeleteRole)
+			reseller.GET("/role-assignments", middleware.CheckScopedPermission("roles:manage"), roleHandler.ListAssignments)
+			reseller.POST("/role-assignments", middleware.CheckScopedPermission("roles:manage"), roleHandler.AssignRole)
+			reseller.DELETE("/role-assignments/:id", middleware.CheckScopedPermission("roles:manage"), roleHandler.UnassignRole)
+
+			// Emails sent to the reseller's customers
+			reseller.GET("/email-templates", middleware.CheckScopedPermission("branding:manage"), emailTemplateHandler.ListTemplates)
+			reseller.PUT("/email-templates/:name", middleware.CheckScopedPermission("branding:manage"), emailTemplateHandler.UpdateTemplate)
+			reseller.DELETE("/email-templates/:name", middleware.CheckScopedPermission("branding:manage"), emailTemplateHandler.ResetTemplate)
+
+			// Private nameservers and the panel under the reseller's hostname
+			reseller.GET("/nameservers", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.ListNameservers)
+			reseller.PUT("/nameservers", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.SetNameservers)
+			reseller.GET("/nameservers/glue", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.Glue)
+			reseller.POST("/nameservers/apply", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.ApplyNameservers)
+			reseller.GET("/panel-hostname", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.GetPanelHostname)
+			reseller.PUT("/panel-hostname", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.SetPanelHostname)
+			reseller.POST("/panel-hostname/retry", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.RetryPanelHostname)
+			reseller.DELETE("/panel-hostname", middleware.CheckScopedPermission("branding:manage"), resellerHostingHandler.RemovePanelHostname)
 		}
 
 		// User panel routes
@@ -106,70 +478,118 @@ func SetupRouter(db *gorm.DB, redis *redis.Client, logger *utils.Logger) *gin.En
 			// Domain management
 			domains := panel.Group("/domains")
 			{
-				domains.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List domains"}) })
-				domains.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create domain"}) })
-				domains.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update domain"}) })
-				domains.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete domain"}) })
+				domains.GET("/", middleware.CheckPermission("domains:read"), domainHandler.GetDomains)
+				domains.GET("/subdomains", middleware.CheckPermission("domains:read"), domainHandler.GetSubdomains)
+				domains.POST("/subdomains", middleware.CheckPermission("domains:write"), domainHandler.CreateSubdomain)
+				domains.POST("/addon", middleware.CheckPermission("domains:write"), domainHandler.CreateAddonDomain)
+				domains.GET("/redirects", middleware.CheckPermission("domains:read"), domainHandler.GetRedirects)
+				domains.POST("/redirects", middleware.CheckPermission("domains:write"), domainHandler.CreateRedirect)
+				domains.DELETE("/redirects/:id", middleware.CheckPermission("domains:write"), domainHandler.DeleteRedirect)
+				domains.GET("/error-pages", middleware.CheckPermission("domains:read"), domainHandler.GetErrorPages)
+				domains.PUT("/error-pages/:code", middleware.CheckPermission("domains:write"), domainHandler.UpdateErrorPage)
+			}
+
+			// DNS records of the user's domains
+			dns := panel.Group("/dns")
+			{
+				dns.GET("/", middleware.CheckPermission("dns:read"), domainHandler.GetDNSRecords)
+				dns.POST("/", middleware.CheckPermission("dns:write"), domainHandler.CreateDNSRecord)
+				dns.PUT("/:id", middleware.CheckPermission("dns:write"), domainHandler.UpdateDNSRecord)
+				dns.DELETE("/:id", middleware.CheckPermission("dns:write"), domainHandler.DeleteDNSRecord)
 			}
 
 			// File management
 			files := panel.Group("/files")
 			{
-				files.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List files"}) })
-				files.POST("/upload", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Upload file"}) })
-				files.DELETE("/:path", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete file"}) })
+				files.GET("/", middleware.CheckPermission("files:read"), fileHandler.GetFiles)
+				files.GET("/disk-usage", middleware.CheckPermission("files:read"), fileHandler.GetDiskUsage)
+				files.GET("/content/*filepath", middleware.CheckPermission("files:read"), fileHandler.GetFileContent)
+				files.POST("/upload", middleware.CheckPermission("files:write"), fileHandler.UploadFile)
+				files.POST("/directory", middleware.CheckPermission("files:write"), fileHandler.CreateDirectory)
+				files.POST("/compress", middleware.CheckPermission("files:write"), fileHandler.CompressFiles)
+				files.POST("/extract", middleware.CheckPermission("files:write"), fileHandler.ExtractArchive)
+				files.POST("/permissions", middleware.CheckPermission("files:write"), fileHandler.SetPermissions)
+				files.PUT("/content/*filepath", middleware.CheckPermission("files:write"), fileHandler.EditFile)
+				files.DELETE("/content/*filepath", middleware.CheckPermission("files:write"), fileHandler.DeleteFile)
 			}
 
 			// Email management
 			emails := panel.Group("/emails")
 			{
-				emails.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List emails"}) })
-				emails.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create email"}) })
-				emails.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update email"}) })
-				emails.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete email"}) })
+				emails.GET("/domains/:domain_id", middleware.CheckPermission("emails:read"), emailHandler.GetEmailAccounts)
+				emails.POST("/", middleware.CheckPermission("emails:write"), emailHandler.CreateEmailAccount)
+				emails.PUT("/:id", middleware.CheckPermission("emails:write"), emailHandler.UpdateEmailAccount)
+				emails.DELETE("/:id", middleware.CheckPermission("emails:write"), emailHandler.DeleteEmailAccount)
+				emails.GET("/domains/:domain_id/forwarders", middleware.CheckPermission("emails:read"), emailHandler.GetEmailForwarders)
+				emails.POST("/forwarders", middleware.CheckPermission("emails:write"), emailHandler.CreateEmailForwarder)
 			}
 
 			// Database management
 			databases := panel.Group("/databases")
 			{
-				databases.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List databases"}) })
-				databases.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create database"}) })
-				databases.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update database"}) })
-				databases.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete database"}) })
+				databases.GET("/", middleware.CheckPermission("databases:read"), databaseHandler.GetDatabases)
+				databases.POST("/", middleware.CheckPermission("databases:write"), databaseHandler.CreateDatabase)
+				databases.DELETE("/:id", middleware.CheckPermission("databases:write"), databaseHandler.DeleteDatabase)
+				databases.GET("/:id/stats", middleware.CheckPermission("databases:read"), databaseHandler.GetDatabaseStats)
+				databases.POST("/:id/backup", middleware.CheckPermission("databases:write"), databaseHandler.BackupDatabase)
+				databases.POST("/:id/restore", middleware.CheckPermission("databases:write"), databaseHandler.RestoreDatabase)
+				databases.GET("/users", middleware.CheckPermission("databases:read"), databaseHandler.GetDatabaseUsers)
+				databases.POST("/users", middleware.CheckPermission("databases:write"), databaseHandler.CreateDatabaseUser)
+				databases.PUT("/users/:id", middleware.CheckPermission("databases:write"), databaseHandler.UpdateDatabaseUser)
+				databases.DELETE("/users/:id", middleware.CheckPermission("databases:write"), databaseHandler.DeleteDatabaseUser)
+				databases.GET("/privileges", middleware.CheckPermission("databases:read"), databaseHandler.GetDatabasePrivileges)
+				databases.PUT("/users/:id/privileges", middleware.CheckPermission("databases:write"), databaseHandler.UpdateDatabasePrivileges)
 			}
 
 			// Application management
 			apps := panel.Group("/applications")
 			{
-				apps.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List applications"}) })
-				apps.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Install application"}) })
-				apps.PUT("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Update application"}) })
-				apps.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Uninstall application"}) })
+				apps.GET("/", middleware.CheckPermission("applications:read"), appsHandler.GetApplications)
+				apps.GET("/available", middleware.CheckPermission("applications:read"), appsHandler.GetAvailableApplications)
+				apps.POST("/", middleware.CheckPermission("applications:write"), appsHandler.InstallApplication)
+				apps.PUT("/:id", middleware.CheckPermission("applications:write"), appsHandler.UpdateApplication)
+				apps.DELETE("/:id", middleware.CheckPermission("applications:write"), appsHandler.UninstallApplication)
+				apps.GET("/wordpress", middleware.CheckPermission("applications:read"), wordPressHandler.GetWordPressSites)
+				apps.POST("/wordpress", middleware.CheckPermission("applications:write"), wordPressHandler.CreateWordPressSite)
+				apps.PUT("/wordpress/:id", middleware.CheckPermission("applications:write"), wordPressHandler.UpdateWordPress)
+				apps.GET("/wordpress/:id/plugins", middleware.CheckPermission("applications:read"), wordPressHandler.GetWordPressPlugins)
+				apps.POST("/wordpress/:id/plugins", middleware.CheckPermission("applications:write"), wordPressHandler.InstallPlugin)
+				apps.GET("/wordpress/:id/themes", middleware.CheckPermission("applications:read"), wordPressHandler.GetWordPressThemes)
+				apps.POST("/wordpress/:id/themes/:theme_id", middleware.CheckPermission("applications:write"), wordPressHandler.ActivateTheme)
 			}
 
 			// SSL management
 			ssl := panel.Group("/ssl")
 			{
-				ssl.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List SSL certificates"}) })
-				ssl.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Install SSL certificate"}) })
-				ssl.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Remove SSL certificate"}) })
+				ssl.GET("/", middleware.CheckPermission("ssl:read"), userSSLHandler.GetSSLCertificates)
+				ssl.POST("/generate", middleware.CheckPermission("ssl:write"), userSSLHandler.GenerateSSLCertificate)
+				ssl.POST("/install", middleware.CheckPermission("ssl:write"), userSSLHandler.InstallSSLCertificate)
+				ssl.POST("/:id/renew", middleware.CheckPermission("ssl:write"), userSSLHandler.RenewSSLCertificate)
+				ssl.DELETE("/:id", middleware.CheckPermission("ssl:write"), userSSLHandler.DeleteSSLCertificate)
 			}
 
 			// Backup management
 			backups := panel.Group("/backups")
 			{
-				backups.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "List backups"}) })
-				backups.POST("/", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Create backup"}) })
-				backups.POST("/:id/restore", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Restore backup"}) })
-				backups.DELETE("/:id", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Delete backup"}) })
+				backups.GET("/", middleware.CheckPermission("backups:read"), backupHandler.GetBackups)
+				backups.POST("/", middleware.CheckPermission("backups:write"), backupHandler.CreateBackup)
+				backups.POST("/:id/restore", middleware.CheckPermission("backups:restore"), backupHandler.RestoreBackup)
+				backups.DELETE("/:id", middleware.CheckPermission("backups:write"), backupHandler.DeleteBackup)
+				backups.GET("/:id/progress", middleware.CheckPermission("backups:read"), backupHandler.GetProgress)
+				backups.POST("/:id/progress/ticket", middleware.CheckPermission("backups:read"), backupHandler.ProgressTicket)
+				backups.POST("/:id/cancel", middleware.CheckPermission("backups:write"), backupHandler.CancelJob)
 			}
 
 			// Statistics
 			stats := panel.Group("/stats")
 			{
-				stats.GET("/usage", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Usage statistics"}) })
-				stats.GET("/bandwidth", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Bandwidth statistics"}) })
-				stats.GET("/visitors", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Visitor statistics"}) })
+				stats.GET("/dashboard", middleware.CheckPermission("stats:read"), statsHandler.GetDashboardStats)
+				stats.GET("/bandwidth", middleware.CheckPermission("stats:read"), statsHandler.GetBandwidthUsage)
+				stats.GET("/disk-usage", middleware.CheckPermission("stats:read"), statsHandler.GetDiskUsage)
+				stats.GET("/visitors", middleware.CheckPermission("stats:read"), statsHandler.GetVisitorStats)
+				stats.GET("/error-logs", middleware.CheckPermission("stats:read"), statsHandler.GetErrorLogs)
+				stats.GET("/access-logs", middleware.CheckPermission("stats:read"), statsHandler.GetAccessLogs)
+				stats.GET("/resources", middleware.CheckPermission("stats:read"), statsHandler.GetResourceUsage)
 			}
 		}
 	}
@@ -185,125 +605,15 @@ func SetupRouter(db *gorm.DB, redis *redis.Client, logger *utils.Logger) *gin.En
 
 	return router
 }
-package api
 
-import (
-	"AdminiSoftware/internal/api/handlers"
-	"AdminiSoftware/internal/api/handlers/admin"
-	"AdminiSoftware/internal/api/handlers/reseller"
-	"AdminiSoftware/internal/api/handlers/user"
-	"AdminiSoftware/internal/api/middleware"
-	"AdminiSoftware/internal/utils"
-
-	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
-	"gorm.io/gorm"
-)
-
-func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
-	// Initialize logger
-	logger := utils.NewLogger()
-	
-	// Middleware
-	r.Use(middleware.CORS())
-	r.Use(middleware.Logging(logger))
-	r.Use(middleware.RateLimit(redis))
-	
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
-	
-	// API routes
-	api := r.Group("/api/v1")
-	
-	// Auth routes (public)
-	authHandler := handlers.NewAuthHandler(db, redis, logger)
-	api.POST("/login", authHandler.Login)
-	api.POST("/register", authHandler.Register)
-	api.POST("/forgot-password", authHandler.ForgotPassword)
-	api.POST("/reset-password", authHandler.ResetPassword)
-	
-	// Protected routes
-	protected := api.Group("/")
-	protected.Use(middleware.JWTAuth(db, redis))
-	
-	// Admin routes
-	adminGroup := protected.Group("/admin")
-	adminGroup.Use(middleware.RequireRole("admin"))
-	{
-		accountHandler := admin.NewAccountHandler(db, logger)
-		adminGroup.GET("/accounts", accountHandler.ListAccounts)
-		adminGroup.POST("/accounts", accountHandler.CreateAccount)
-		adminGroup.PUT("/accounts/:id", accountHandler.UpdateAccount)
-		adminGroup.DELETE("/accounts/:id", accountHandler.DeleteAccount)
-		
-		dnsHandler := admin.NewDNSHandler(db, logger)
-		adminGroup.GET("/dns", dnsHandler.ListZones)
-		adminGroup.POST("/dns", dnsHandler.CreateZone)
-		adminGroup.PUT("/dns/:id", dnsHandler.UpdateZone)
-		adminGroup.DELETE("/dns/:id", dnsHandler.DeleteZone)
-		
-		sslHandler := admin.NewSSLHandler(db, logger)
-		adminGroup.GET("/ssl", sslHandler.ListCertificates)
-		adminGroup.POST("/ssl", sslHandler.CreateCertificate)
-		adminGroup.DELETE("/ssl/:id", sslHandler.DeleteCertificate)
-	}
-	
-	// Reseller routes
-	resellerGroup := protected.Group("/reseller")
-	resellerGroup.Use(middleware.RequireRole("reseller", "admin"))
-	{
-		accountHandler := reseller.NewAccountHandler(db, logger)
-		resellerGroup.GET("/accounts", accountHandler.ListAccounts)
-		resellerGroup.POST("/accounts", accountHandler.CreateAccount)
-		resellerGroup.PUT("/accounts/:id", accountHandler.UpdateAccount)
-		
-		packageHandler := reseller.NewPackageHandler(db, logger)
-		resellerGroup.GET("/packages", packageHandler.ListPackages)
-		resellerGroup.POST("/packages", packageHandler.CreatePackage)
-		resellerGroup.PUT("/packages/:id", packageHandler.UpdatePackage)
-		resellerGroup.DELETE("/packages/:id", packageHandler.DeletePackage)
-	}
-	
-	// User routes
-	userGroup := protected.Group("/user")
-	{
-		domainHandler := user.NewDomainHandler(db, logger)
-		userGroup.GET("/domains", domainHandler.ListDomains)
-		userGroup.POST("/domains", domainHandler.AddDomain)
-		userGroup.DELETE("/domains/:id", domainHandler.DeleteDomain)
-		
-		emailHandler := user.NewEmailHandler(db, logger)
-		userGroup.GET("/emails", emailHandler.ListEmails)
-		userGroup.POST("/emails", emailHandler.CreateEmail)
-		userGroup.DELETE("/emails/:id", emailHandler.DeleteEmail)
-		
-		dbHandler := user.NewDatabaseHandler(db, logger)
-		userGroup.GET("/databases", dbHandler.ListDatabases)
-		userGroup.POST("/databases", dbHandler.CreateDatabase)
-		userGroup.DELETE("/databases/:id", dbHandler.DeleteDatabase)
-		
-		fileHandler := user.NewFileHandler(db, logger)
-		userGroup.GET("/files", fileHandler.ListFiles)
-		userGroup.POST("/files", fileHandler.UploadFile)
-		userGroup.DELETE("/files/:id", fileHandler.DeleteFile)
-		
-		appHandler := user.NewAppHandler(db, logger)
-		userGroup.GET("/apps", appHandler.ListApps)
-		userGroup.POST("/apps", appHandler.InstallApp)
-		userGroup.DELETE("/apps/:id", appHandler.UninstallApp)
-		
-		sslHandler := user.NewSSLHandler(db, logger)
-		userGroup.GET("/ssl", sslHandler.ListCertificates)
-		userGroup.POST("/ssl", sslHandler.RequestCertificate)
-		
-		statsHandler := user.NewStatsHandler(db, logger)
-		userGroup.GET("/stats", statsHandler.GetStats)
-		
-		wpHandler := user.NewWordPressHandler(db, logger)
-		userGroup.GET("/wordpress", wpHandler.ListSites)
-		userGroup.POST("/wordpress", wpHandler.CreateSite)
-		userGroup.PUT("/wordpress/:id", wpHandler.UpdateSite)
+// trustedProxies reads the comma separated addresses and CIDR ranges of the
+// reverse proxies in front of the panel.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
 	}
+	return proxies
 }
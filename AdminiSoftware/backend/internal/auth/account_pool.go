@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AccountPool admits new customer accounts of a reseller within its
+// allocation. Identity providers that provision accounts on first sign-in
+// check it inside their transaction before creating a reseller's customer.
+// The services package implements it; this package cannot import it.
+type AccountPool interface {
+	CheckNewAccount(tx *gorm.DB, resellerID uint) error
+}
+
+// AccountStatus moves accounts through the account lifecycle, so that a
+// suspension also turns off the account's mail, sites and sessions. Identity
+// providers that suspend or reactivate their users go through it; the
+// services package implements it.
+type AccountStatus interface {
+	Transition(userID uint, to, reason string, actorID uint) (*models.AccountTransition, error)
+}
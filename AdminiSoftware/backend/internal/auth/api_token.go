@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix starts every API token so the middleware can tell them apart
+// from JWTs and secret scanners can recognise leaked ones.
+const APITokenPrefix = "adm_"
+
+// apiTokenTouchInterval limits how often last-used details are written back.
+const apiTokenTouchInterval = time.Minute
+
+// APITokenResources are the API areas a token scope can name; each matches the
+// route group of the same name under /api/admin, /api/reseller or /api/panel.
+// A scope is "<resource>:read", "<resource>:write" or "*" for everything.
+var APITokenResources = []string{
+	"accounts", "packages", "system", "domains", "dns", "files", "emails",
+	"databases", "applications", "ssl", "backups", "stats",
+	"provisioning", "billing",
+}
+
+var (
+	ErrAPITokenInvalid   = errors.New("invalid API token")
+	ErrAPITokenExpired   = errors.New("API token has expired")
+	ErrAPITokenIPDenied  = errors.New("API token is not allowed from this address")
+	ErrAPITokenNotFound  = errors.New("API token not found")
+	ErrAPITokenUserState = errors.New("API token owner is not active")
+)
+
+type APITokenManager struct {
+	db *gorm.DB
+}
+
+func NewAPITokenManager(db *gorm.DB) *APITokenManager {
+	return &APITokenManager{db: db}
+}
+
+// Create issues a token and returns it together with the plaintext, which is
+// not stored and cannot be shown again.
+func (m *APITokenManager) Create(userID uint, name string, scopes, allowedIPs []string, expiresAt *time.Time) (*models.APIToken, string, error) {
+	for _, scope := range scopes {
+		if err := ValidateScope(scope); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, entry := range allowedIPs {
+		if !validIPEntry(entry) {
+			return nil, "", fmt.Errorf("invalid IP or CIDR: %s", entry)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, "", errors.New("expiry must be in the future")
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := APITokenPrefix + secret
+
+	token := &models.APIToken{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     plaintext[:len(APITokenPrefix)+8],
+		TokenHash:  hashSecret(plaintext),
+		Scopes:     strings.Join(scopes, ","),
+		AllowedIPs: strings.Join(allowedIPs, ","),
+		ExpiresAt:  expiresAt,
+	}
+	if err := m.db.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, plaintext, nil
+}
+
+// Authenticate resolves a presented token to its owner, enforcing expiry and
+// the IP allowlist, and records when and where it was last used.
+func (m *APITokenManager) Authenticate(plaintext, clientIP string) (*models.APIToken, *models.User, error) {
+	if !strings.HasPrefix(plaintext, APITokenPrefix) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+
+	var token models.APIToken
+	if err := m.db.Preload("User").Where("token_hash = ? AND revoked_at IS NULL", hashSecret(plaintext)).First(&token).Error; err != nil {
+		return nil, nil, ErrAPITokenInvalid
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, nil, ErrAPITokenExpired
+	}
+	if !ipAllowed(token.AllowedIPs, clientIP) {
+		return nil, nil, ErrAPITokenIPDenied
+	}
+	if token.User == nil || token.User.Status != "active" {
+		return nil, nil, ErrAPITokenUserState
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval || token.LastUsedIP != clientIP {
+		m.db.Model(&models.APIToken{}).Where("id = ?", token.ID).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		})
+		token.LastUsedAt = &now
+		token.LastUsedIP = clientIP
+	}
+
+	return &token, token.User, nil
+}
+
+// List returns the live tokens of a user, or of every user when userID is 0.
+func (m *APITokenManager) List(userID uint) ([]models.APIToken, error) {
+	query := m.db.Preload("User").Where("revoked_at IS NULL")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var tokens []models.APIToken
+	if err := query.Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke disables a token. A non-zero userID restricts it to that user's tokens.
+func (m *APITokenManager) Revoke(tokenID, userID uint) error {
+	query := m.db.Model(&models.APIToken{}).Where("id = ? AND revoked_at IS NULL", tokenID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	result := query.Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// ValidateScope checks that a scope names a known resource and action.
+func ValidateScope(scope string) error {
+	if scope == "*" {
+		return nil
+	}
+
+	resource, action, ok := strings.Cut(scope, ":")
+	if !ok || (action != "read" && action != "write") {
+		return fmt.Errorf("invalid scope %q: expected <resource>:read or <resource>:write", scope)
+	}
+	for _, known := range APITokenResources {
+		if resource == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid scope %q: unknown resource %s", scope, resource)
+}
+
+// ScopeGranted reports whether the token scopes cover the required one. Write
+// access to a resource implies read access.
+func ScopeGranted(scopes []string, required string) bool {
+	resource, action, _ := strings.Cut(required, ":")
+	for _, scope := range scopes {
+		if scope == "*" || scope == required {
+			return true
+		}
+		if action == "read" && scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenScopes splits the stored scope list.
+func TokenScopes(token *models.APIToken) []string {
+	if token.Scopes == "" {
+		return nil
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+func validIPEntry(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
+
+func ipAllowed(allowlist, clientIP string) bool {
+	if strings.TrimSpace(allowlist) == "" {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScope(t *testing.T) {
+	for _, scope := range []string{"*", "accounts:read", "dns:write", "billing:read"} {
+		assert.NoError(t, ValidateScope(scope), scope)
+	}
+	for _, scope := range []string{"accounts", "accounts:delete", "cron:read", "unknown:write"} {
+		assert.Error(t, ValidateScope(scope), scope)
+	}
+}
+
+func TestScopeGranted(t *testing.T) {
+	scopes := []string{"domains:write", "stats:read"}
+	assert.True(t, ScopeGranted(scopes, "domains:read"), "write implies read")
+	assert.True(t, ScopeGranted(scopes, "domains:write"))
+	assert.True(t, ScopeGranted(scopes, "stats:read"))
+	assert.False(t, ScopeGranted(scopes, "stats:write"))
+	assert.False(t, ScopeGranted(scopes, "accounts:read"))
+	assert.True(t, ScopeGranted([]string{"*"}, "accounts:write"))
+}
+
+func TestIPAllowed(t *testing.T) {
+	assert.True(t, ipAllowed("", "203.0.113.9"), "an empty allowlist allows every address")
+	assert.True(t, ipAllowed("198.51.100.0/24, 203.0.113.9", "203.0.113.9"))
+	assert.True(t, ipAllowed("198.51.100.0/24", "198.51.100.77"))
+	assert.False(t, ipAllowed("198.51.100.0/24", "203.0.113.9"))
+	assert.False(t, ipAllowed("198.51.100.0/24", "not-an-ip"))
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachCorpus answers k-anonymity range queries: given the first five hex
+// characters of an uppercase SHA-1 hash it returns the remaining 35
+// characters of every breached hash with that prefix and how often each was
+// seen.
+type BreachCorpus interface {
+	Range(prefix string) (map[string]int, error)
+}
+
+// FileBreachCorpus reads a local copy of the Pwned Passwords corpus in either
+// of the layouts the official downloader produces:
+//
+//   - a directory with one file per prefix (00000, 00000.txt, ...) holding
+//     "SUFFIX:COUNT" lines, or
+//   - a single file of "HASH:COUNT" lines sorted by hash, which is binary
+//     searched so only the lines for the prefix are read.
+type FileBreachCorpus struct {
+	path string
+}
+
+func NewFileBreachCorpus(path string) *FileBreachCorpus {
+	return &FileBreachCorpus{path: path}
+}
+
+func (c *FileBreachCorpus) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != 5 {
+		return nil, fmt.Errorf("invalid hash prefix %q", prefix)
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %v", err)
+	}
+	if info.IsDir() {
+		return c.rangeFile(prefix)
+	}
+	return c.searchFile(prefix, info.Size())
+}
+
+func (c *FileBreachCorpus) rangeFile(prefix string) (map[string]int, error) {
+	suffixes := make(map[string]int)
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		file, err := os.Open(filepath.Join(c.path, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open breach corpus range %s: %v", prefix, err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if suffix, count, ok := parseBreachLine(scanner.Text()); ok {
+				suffixes[suffix] = count
+			}
+		}
+		return suffixes, scanner.Err()
+	}
+	return suffixes, nil
+}
+
+func (c *FileBreachCorpus) searchFile(prefix string, size int64) (map[string]int, error) {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %v", err)
+	}
+	defer file.Close()
+
+	// Find the smallest offset whose next full line sorts at or after the
+	// prefix; every matching line follows it.
+	low, high := int64(0), size
+	for low < high {
+		mid := low + (high-low)/2
+		line, err := lineAt(file, mid)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF || hashPrefix(line) >= prefix {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	reader, err := readerAt(file, low)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := make(map[string]int)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			linePrefix := hashPrefix(line)
+			if linePrefix > prefix {
+				break
+			}
+			if linePrefix == prefix {
+				if suffix, count, ok := parseBreachLine(line[5:]); ok {
+					suffixes[suffix] = count
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return suffixes, nil
+}
+
+// readerAt returns a reader positioned at the first line starting at or after
+// offset.
+func readerAt(file *os.File, offset int64) (*bufio.Reader, error) {
+	start := offset
+	if start > 0 {
+		start--
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	if offset > 0 {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return reader, err
+		}
+	}
+	return reader, nil
+}
+
+func lineAt(file *os.File, offset int64) (string, error) {
+	reader, err := readerAt(file, offset)
+	if err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if line == "" && err == nil {
+		err = io.EOF
+	}
+	if line != "" && err == io.EOF {
+		err = nil
+	}
+	return line, err
+}
+
+func hashPrefix(line string) string {
+	if len(line) < 5 {
+		return strings.ToUpper(line)
+	}
+	return strings.ToUpper(line[:5])
+}
+
+func parseBreachLine(line string) (string, int, bool) {
+	suffix, countText, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok || len(suffix) != 35 {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToUpper(suffix), count, true
+}
@@ -1,190 +1,373 @@
-
 package auth
 
 import (
-	"net"
-	"sync"
+	"AdminiSoftware/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
-type BruteForceProtection struct {
-	attempts map[string]*AttemptInfo
-	mutex    sync.RWMutex
-	config   BruteForceConfig
-}
+// Authentication sources that report to brute-force protection. The panel
+// reports its own logins; the others are fed by the auth log watchers.
+const (
+	SourcePanel = "panel"
+	SourceMail  = "mail"
+	SourceFTP   = "ftp"
+	SourceSSH   = "ssh"
+)
 
-type AttemptInfo struct {
-	Count      int
-	LastAttempt time.Time
-	BlockedUntil time.Time
-}
+// Lockout scopes. An IP is locked across every source; usernames are
+// counted per source since "admin" on SSH and in the panel are different
+// accounts.
+const (
+	LockScopeIP   = "ip"
+	LockScopeUser = "user"
+	LockScopePair = "pair"
+)
 
+// Lockout event actions published to every node.
+const (
+	LockoutLocked   = "locked"
+	LockoutReleased = "released"
+)
+
+const bruteForceChannel = "bf:events"
+
+// BruteForceConfig sets the limits. Failures are counted over Window; an IP,
+// a username or an IP and username pair reaching its limit is locked out.
+// Each further lockout within StrikeWindow doubles the previous one up to
+// MaxLockout. Before the limits are reached, failures beyond DelayAfter make
+// the next attempt wait, doubling from BaseDelay up to MaxDelay.
 type BruteForceConfig struct {
-	MaxAttempts   int
-	WindowMinutes int
-	BlockMinutes  int
+	Window       time.Duration
+	IPLimit      int64
+	UserLimit    int64
+	PairLimit    int64
+	DelayAfter   int64
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	StrikeWindow time.Duration
+	// KnownIPTTL is how long an IP that signed in successfully stays exempt
+	// from lockouts of that username, so an attacker cannot lock the owner
+	// out of their own account.
+	KnownIPTTL time.Duration
 }
 
-func NewBruteForceProtection() *BruteForceProtection {
-	return &BruteForceProtection{
-		attempts: make(map[string]*AttemptInfo),
-		config: BruteForceConfig{
-			MaxAttempts:   5,
-			WindowMinutes: 15,
-			BlockMinutes:  30,
-		},
-	}
-}
-
-func (bfp *BruteForceProtection) IsBlocked(ip string) bool {
-	bfp.mutex.RLock()
-	defer bfp.mutex.RUnlock()
-	
-	info, exists := bfp.attempts[ip]
-	if !exists {
-		return false
-	}
-	
-	return time.Now().Before(info.BlockedUntil)
-}
-
-func (bfp *BruteForceProtection) RecordAttempt(ip string, successful bool) {
-	bfp.mutex.Lock()
-	defer bfp.mutex.Unlock()
-	
-	now := time.Now()
-	
-	if successful {
-		delete(bfp.attempts, ip)
-		return
-	}
-	
-	info, exists := bfp.attempts[ip]
-	if !exists {
-		info = &AttemptInfo{}
-		bfp.attempts[ip] = info
-	}
-	
-	windowStart := now.Add(-time.Duration(bfp.config.WindowMinutes) * time.Minute)
-	if info.LastAttempt.Before(windowStart) {
-		info.Count = 0
-	}
-	
-	info.Count++
-	info.LastAttempt = now
-	
-	if info.Count >= bfp.config.MaxAttempts {
-		info.BlockedUntil = now.Add(time.Duration(bfp.config.BlockMinutes) * time.Minute)
-	}
+var DefaultBruteForceConfig = BruteForceConfig{
+	Window:       15 * time.Minute,
+	IPLimit:      20,
+	UserLimit:    10,
+	PairLimit:    5,
+	DelayAfter:   3,
+	BaseDelay:    time.Second,
+	MaxDelay:     30 * time.Second,
+	BaseLockout:  15 * time.Minute,
+	MaxLockout:   24 * time.Hour,
+	StrikeWindow: 24 * time.Hour,
+	KnownIPTTL:   30 * 24 * time.Hour,
 }
 
-func (bfp *BruteForceProtection) GetClientIP(remoteAddr string) string {
-	ip, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		return remoteAddr
-	}
-	return ip
+// Lockout describes an active lockout.
+type Lockout struct {
+	Scope    string    `json:"scope"`
+	Source   string    `json:"source,omitempty"`
+	Username string    `json:"username,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	Failures int64     `json:"failures"`
+	Strikes  int64     `json:"strikes"`
+	Until    time.Time `json:"until"`
 }
-package auth
 
-import (
-	"context"
-	"fmt"
-	"strconv"
-	"time"
+// LockoutEvent is published to every node when a lockout starts or is
+// released, so each can update its firewall.
+type LockoutEvent struct {
+	Action  string  `json:"action"`
+	Lockout Lockout `json:"lockout"`
+}
 
-	"github.com/go-redis/redis/v8"
-)
+// BruteForceDecision tells the caller whether an attempt may proceed.
+type BruteForceDecision struct {
+	Blocked    bool
+	RetryAfter time.Duration
+}
 
+// BruteForceProtection tracks failed logins per IP, per username and per IP
+// and username. With Redis the state is shared by every node of a cluster;
+// without it each node keeps its own in memory.
 type BruteForceProtection struct {
-	redis   *redis.Client
-	enabled bool
+	db     *gorm.DB
+	store  bruteForceStore
+	config BruteForceConfig
 }
 
-func NewBruteForceProtection(redis *redis.Client) *BruteForceProtection {
+// localBruteForceStore is shared by every BruteForceProtection of a process
+// running without Redis, so the log watchers and the API see the same state.
+var localBruteForceStore = newMemoryBruteForceStore()
+
+func NewBruteForceProtection(db *gorm.DB, redis *redis.Client) *BruteForceProtection {
+	var store bruteForceStore = localBruteForceStore
+	if redis != nil {
+		store = newRedisBruteForceStore(redis)
+	}
 	return &BruteForceProtection{
-		redis:   redis,
-		enabled: redis != nil,
+		db:     db,
+		store:  store,
+		config: DefaultBruteForceConfig,
 	}
 }
 
-func (bf *BruteForceProtection) IsBlocked(ip string) bool {
-	if !bf.enabled {
-		return false
+// Check reports whether an attempt from ip for username may proceed. The
+// username may be empty when it is not known yet, as for passkey logins.
+func (bf *BruteForceProtection) Check(source, ip, username string) BruteForceDecision {
+	ctx := context.Background()
+	username = normalizeLogin(username)
+
+	keys := []string{lockKey(LockScopeIP, source, ip, username)}
+	if username != "" {
+		keys = append(keys,
+			lockKey(LockScopePair, source, ip, username),
+			delayKey(LockScopePair, source, ip, username),
+		)
+		if !bf.known(ctx, source, ip, username) {
+			keys = append(keys,
+				lockKey(LockScopeUser, source, ip, username),
+				delayKey(LockScopeUser, source, ip, username),
+			)
+		}
+	}
+
+	var decision BruteForceDecision
+	for _, key := range keys {
+		_, ttl, err := bf.store.get(ctx, key)
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		decision.Blocked = true
+		if ttl > decision.RetryAfter {
+			decision.RetryAfter = ttl
+		}
 	}
+	return decision
+}
 
+// RecordFailure counts a failed attempt and returns the resulting decision
+// for the next attempt.
+func (bf *BruteForceProtection) RecordFailure(source, ip, username string) BruteForceDecision {
 	ctx := context.Background()
-	key := fmt.Sprintf("bf:ip:%s", ip)
-	
-	attempts, err := bf.redis.Get(ctx, key).Int()
-	if err != nil {
-		return false
+	username = normalizeLogin(username)
+
+	limits := map[string]int64{LockScopeIP: bf.config.IPLimit}
+	if username != "" {
+		limits[LockScopeUser] = bf.config.UserLimit
+		limits[LockScopePair] = bf.config.PairLimit
 	}
 
-	return attempts >= 5
+	for scope, limit := range limits {
+		failures, err := bf.store.incr(ctx, failKey(scope, source, ip, username), bf.config.Window)
+		if err != nil {
+			continue
+		}
+
+		if failures >= limit {
+			bf.lock(ctx, scope, source, ip, username, failures)
+			continue
+		}
+
+		// Only targeted guessing is slowed down; an IP is just counted
+		if scope != LockScopeIP && failures > bf.config.DelayAfter {
+			delay := bf.config.BaseDelay << uint(failures-bf.config.DelayAfter-1)
+			if delay <= 0 || delay > bf.config.MaxDelay {
+				delay = bf.config.MaxDelay
+			}
+			bf.store.set(ctx, delayKey(scope, source, ip, username), "1", delay)
+		}
+	}
+
+	return bf.Check(source, ip, username)
 }
 
-func (bf *BruteForceProtection) RecordAttempt(ip string, success bool) error {
-	if !bf.enabled {
-		return nil
+// RecordSuccess clears the failures of a login that succeeded and remembers
+// the IP as one the owner uses. A login may be known by several names (a
+// username and an email address); each is cleared. The IP count is kept so
+// an attacker cannot reset it with an account of their own.
+func (bf *BruteForceProtection) RecordSuccess(source, ip string, logins ...string) {
+	ctx := context.Background()
+	for _, login := range logins {
+		username := normalizeLogin(login)
+		if username == "" {
+			continue
+		}
+		bf.store.del(ctx,
+			failKey(LockScopePair, source, ip, username),
+			delayKey(LockScopePair, source, ip, username),
+			failKey(LockScopeUser, source, ip, username),
+			delayKey(LockScopeUser, source, ip, username),
+		)
+		bf.store.set(ctx, knownKey(source, ip, username), "1", bf.config.KnownIPTTL)
 	}
+}
 
+// Lockouts lists the active lockouts.
+func (bf *BruteForceProtection) Lockouts() ([]Lockout, error) {
 	ctx := context.Background()
-	key := fmt.Sprintf("bf:ip:%s", ip)
+	keys, err := bf.store.scan(ctx, "bf:lock:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockouts: %v", err)
+	}
 
-	if success {
-		// Clear failed attempts on successful login
-		return bf.redis.Del(ctx, key).Err()
+	lockouts := make([]Lockout, 0, len(keys))
+	for _, key := range keys {
+		value, ttl, err := bf.store.get(ctx, key)
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		var lockout Lockout
+		if err := json.Unmarshal([]byte(value), &lockout); err != nil {
+			continue
+		}
+		lockouts = append(lockouts, lockout)
 	}
+	return lockouts, nil
+}
+
+// Release lifts a lockout early and forgets the failures and strikes that
+// led to it.
+func (bf *BruteForceProtection) Release(scope, source, ip, username string) error {
+	ctx := context.Background()
+	username = normalizeLogin(username)
 
-	// Increment failed attempts
-	pipe := bf.redis.Pipeline()
-	pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, 15*time.Minute)
-	_, err := pipe.Exec(ctx)
+	if err := bf.store.del(ctx,
+		lockKey(scope, source, ip, username),
+		failKey(scope, source, ip, username),
+		delayKey(scope, source, ip, username),
+		strikeKey(scope, source, ip, username),
+	); err != nil {
+		return fmt.Errorf("failed to release lockout: %v", err)
+	}
 
-	return err
+	bf.publish(ctx, LockoutEvent{
+		Action:  LockoutReleased,
+		Lockout: Lockout{Scope: scope, Source: source, IP: ip, Username: username},
+	})
+	return nil
 }
 
-func (bf *BruteForceProtection) GetAttempts(ip string) int {
-	if !bf.enabled {
-		return 0
-	}
+// Subscribe calls handle for every lockout started or released on any node
+// until ctx is cancelled.
+func (bf *BruteForceProtection) Subscribe(ctx context.Context, handle func(LockoutEvent)) {
+	bf.store.subscribe(ctx, bruteForceChannel, func(message string) {
+		var event LockoutEvent
+		if err := json.Unmarshal([]byte(message), &event); err == nil {
+			handle(event)
+		}
+	})
+}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("bf:ip:%s", ip)
-	
-	attempts, err := bf.redis.Get(ctx, key).Int()
+func (bf *BruteForceProtection) lock(ctx context.Context, scope, source, ip, username string, failures int64) {
+	strikes, err := bf.store.incr(ctx, strikeKey(scope, source, ip, username), bf.config.StrikeWindow)
 	if err != nil {
-		return 0
+		strikes = 1
 	}
 
-	return attempts
-}
+	duration := bf.config.BaseLockout << uint(strikes-1)
+	if duration <= 0 || duration > bf.config.MaxLockout {
+		duration = bf.config.MaxLockout
+	}
 
-func (bf *BruteForceProtection) GetTimeUntilUnblock(ip string) time.Duration {
-	if !bf.enabled {
-		return 0
+	lockout := Lockout{
+		Scope:    scope,
+		Failures: failures,
+		Strikes:  strikes,
+		Until:    time.Now().Add(duration),
+	}
+	switch scope {
+	case LockScopeIP:
+		lockout.IP = ip
+	case LockScopeUser:
+		lockout.Source, lockout.Username = source, username
+	default:
+		lockout.Source, lockout.Username, lockout.IP = source, username, ip
 	}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("bf:ip:%s", ip)
-	
-	ttl, err := bf.redis.TTL(ctx, key).Result()
+	value, _ := json.Marshal(lockout)
+	bf.store.set(ctx, lockKey(scope, source, ip, username), string(value), duration)
+	bf.store.del(ctx, failKey(scope, source, ip, username))
+	bf.publish(ctx, LockoutEvent{Action: LockoutLocked, Lockout: lockout})
+
+	if bf.db != nil {
+		bf.db.Create(&models.SecurityEvent{
+			Type:        "brute_force_lockout",
+			Severity:    "medium",
+			Source:      ip,
+			Description: describeLockout(lockout, duration),
+		})
+	}
+}
+
+func (bf *BruteForceProtection) known(ctx context.Context, source, ip, username string) bool {
+	_, ttl, err := bf.store.get(ctx, knownKey(source, ip, username))
+	return err == nil && ttl > 0
+}
+
+func (bf *BruteForceProtection) publish(ctx context.Context, event LockoutEvent) {
+	message, err := json.Marshal(event)
 	if err != nil {
-		return 0
+		return
 	}
+	bf.store.publish(ctx, bruteForceChannel, string(message))
+}
 
-	return ttl
+func describeLockout(lockout Lockout, duration time.Duration) string {
+	switch lockout.Scope {
+	case LockScopeIP:
+		return fmt.Sprintf("IP %s locked out for %s after %d failed logins", lockout.IP, duration, lockout.Failures)
+	case LockScopeUser:
+		return fmt.Sprintf("%s user %s locked out for %s after %d failed logins", lockout.Source, lockout.Username, duration, lockout.Failures)
+	default:
+		return fmt.Sprintf("%s user %s locked out from %s for %s after %d failed logins", lockout.Source, lockout.Username, lockout.IP, duration, lockout.Failures)
+	}
 }
 
-func (bf *BruteForceProtection) UnblockIP(ip string) error {
-	if !bf.enabled {
-		return nil
+func normalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// scopeKey identifies what a scope counts: the IP alone, the username within
+// a source, or both.
+func scopeKey(scope, source, ip, username string) string {
+	switch scope {
+	case LockScopeIP:
+		return "ip:" + ip
+	case LockScopeUser:
+		return "user:" + source + ":" + username
+	default:
+		return "pair:" + source + ":" + ip + ":" + username
 	}
+}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("bf:ip:%s", ip)
-	
-	return bf.redis.Del(ctx, key).Err()
+func failKey(scope, source, ip, username string) string {
+	return "bf:fail:" + scopeKey(scope, source, ip, username)
+}
+
+func lockKey(scope, source, ip, username string) string {
+	return "bf:lock:" + scopeKey(scope, source, ip, username)
+}
+
+func delayKey(scope, source, ip, username string) string {
+	return "bf:delay:" + scopeKey(scope, source, ip, username)
+}
+
+func strikeKey(scope, source, ip, username string) string {
+	return "bf:strikes:" + scopeKey(scope, source, ip, username)
+}
+
+func knownKey(source, ip, username string) string {
+	return "bf:known:" + source + ":" + ip + ":" + username
 }
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// bruteForceStore holds counters and lockouts. Every key expires; get
+// returns a zero TTL for a missing key.
+type bruteForceStore interface {
+	incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	set(ctx context.Context, key, value string, ttl time.Duration) error
+	get(ctx context.Context, key string) (string, time.Duration, error)
+	del(ctx context.Context, keys ...string) error
+	scan(ctx context.Context, prefix string) ([]string, error)
+	publish(ctx context.Context, channel, message string) error
+	subscribe(ctx context.Context, channel string, handle func(string))
+}
+
+// incrWithTTL starts the expiry with the first increment so a counter
+// covers a fixed window, atomically even across nodes.
+var incrWithTTL = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+type redisBruteForceStore struct {
+	redis *redis.Client
+}
+
+func newRedisBruteForceStore(client *redis.Client) *redisBruteForceStore {
+	return &redisBruteForceStore{redis: client}
+}
+
+func (s *redisBruteForceStore) incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrWithTTL.Run(ctx, s.redis, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *redisBruteForceStore) set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.redis.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisBruteForceStore) get(ctx context.Context, key string) (string, time.Duration, error) {
+	pipe := s.redis.Pipeline()
+	value := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+	if value.Err() == redis.Nil {
+		return "", 0, nil
+	}
+	return value.Val(), ttl.Val(), nil
+}
+
+func (s *redisBruteForceStore) del(ctx context.Context, keys ...string) error {
+	return s.redis.Del(ctx, keys...).Err()
+}
+
+func (s *redisBruteForceStore) scan(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := s.redis.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func (s *redisBruteForceStore) publish(ctx context.Context, channel, message string) error {
+	return s.redis.Publish(ctx, channel, message).Err()
+}
+
+func (s *redisBruteForceStore) subscribe(ctx context.Context, channel string, handle func(string)) {
+	sub := s.redis.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			handle(message.Payload)
+		}
+	}
+}
+
+// memoryBruteForceStore keeps state for a single node when Redis is not
+// configured.
+type memoryBruteForceStore struct {
+	mutex       sync.Mutex
+	entries     map[string]*memoryEntry
+	subscribers map[string][]func(string)
+	sweptAt     time.Time
+}
+
+type memoryEntry struct {
+	value   string
+	count   int64
+	expires time.Time
+}
+
+func newMemoryBruteForceStore() *memoryBruteForceStore {
+	return &memoryBruteForceStore{
+		entries:     make(map[string]*memoryEntry),
+		subscribers: make(map[string][]func(string)),
+	}
+}
+
+func (s *memoryBruteForceStore) incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Entries from IPs that never return are only dropped here
+	if time.Since(s.sweptAt) > time.Minute {
+		for existing := range s.entries {
+			s.live(existing)
+		}
+		s.sweptAt = time.Now()
+	}
+
+	entry := s.live(key)
+	if entry == nil {
+		entry = &memoryEntry{expires: time.Now().Add(ttl)}
+		s.entries[key] = entry
+	}
+	entry.count++
+	return entry.count, nil
+}
+
+func (s *memoryBruteForceStore) set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[key] = &memoryEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryBruteForceStore) get(ctx context.Context, key string) (string, time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := s.live(key)
+	if entry == nil {
+		return "", 0, nil
+	}
+	return entry.value, time.Until(entry.expires), nil
+}
+
+func (s *memoryBruteForceStore) del(ctx context.Context, keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *memoryBruteForceStore) scan(ctx context.Context, prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) && s.live(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryBruteForceStore) publish(ctx context.Context, channel, message string) error {
+	s.mutex.Lock()
+	handlers := append([]func(string){}, s.subscribers[channel]...)
+	s.mutex.Unlock()
+
+	for _, handle := range handlers {
+		handle(message)
+	}
+	return nil
+}
+
+func (s *memoryBruteForceStore) subscribe(ctx context.Context, channel string, handle func(string)) {
+	s.mutex.Lock()
+	s.subscribers[channel] = append(s.subscribers[channel], handle)
+	s.mutex.Unlock()
+
+	<-ctx.Done()
+}
+
+// live returns the entry for key, dropping it if it has expired. The caller
+// holds the mutex.
+func (s *memoryBruteForceStore) live(key string) *memoryEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
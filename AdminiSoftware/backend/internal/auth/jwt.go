@@ -1,192 +1,111 @@
-
 package auth
 
 import (
+	"AdminiSoftware/internal/models"
 	"errors"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your-jwt-secret-key") // Should be from config
-
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func GenerateJWT(userID uint, role string) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-func ValidateJWT(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, errors.New("invalid token")
-}
+	UserID      uint     `json:"user_id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	SessionID   string   `json:"sid"`
+	AuthMethods []string `json:"amr,omitempty"`
 
-func GenerateRefreshToken(userID uint) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+	// Set on impersonation tokens: the staff member acting as UserID.
+	ActorID         uint   `json:"act_id,omitempty"`
+	ActorUsername   string `json:"act_username,omitempty"`
+	ImpersonationID uint   `json:"imp_id,omitempty"`
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	jwt.RegisteredClaims
 }
 
-func ValidateRefreshToken(tokenString string) (uint, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return 0, err
-	}
-
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, nil
-	}
-
-	return 0, errors.New("invalid refresh token")
+// IsImpersonation reports whether the token was minted for impersonation.
+func (c *Claims) IsImpersonation() bool {
+	return c.ActorID != 0
 }
-package auth
-
-import (
-	"time"
-	"github.com/golang-jwt/jwt/v5"
-	"fmt"
-)
 
+// JWTManager signs access tokens with the key ring's active key and names
+// it in the kid header, so anyone holding the published JWKS can verify
+// them. The issuer is JWT_ISSUER, normally the panel's URL.
 type JWTManager struct {
-	secretKey string
-	tokenDuration time.Duration
+	keys   *KeyRing
+	issuer string
 }
 
-type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
-	return &JWTManager{
-		secretKey: secretKey,
-		tokenDuration: tokenDuration,
+func NewJWTManager(keys *KeyRing) *JWTManager {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "adminisoftware"
 	}
+	return &JWTManager{keys: keys, issuer: issuer}
+}
+
+// GenerateToken issues a short-lived access token bound to a session so it
+// stops working as soon as the session is revoked.
+func (j *JWTManager) GenerateToken(userID uint, username, role string, session *models.Session) (string, error) {
+	return j.sign(&Claims{
+		UserID:      userID,
+		Username:    username,
+		Role:        role,
+		SessionID:   session.PublicID,
+		AuthMethods: SessionAuthMethods(session),
+	})
 }
 
-func (manager *JWTManager) Generate(userID uint, email, role string) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(manager.tokenDuration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(manager.secretKey))
+// GenerateImpersonationToken issues an access token for subject that records
+// the actor. It is bound to its own session and cannot be refreshed.
+func (j *JWTManager) GenerateImpersonationToken(subject, actor *models.User, session *models.Session, impersonationID uint) (string, error) {
+	return j.sign(&Claims{
+		UserID:          subject.ID,
+		Username:        subject.Username,
+		Role:            subject.Role,
+		SessionID:       session.PublicID,
+		AuthMethods:     SessionAuthMethods(session),
+		ActorID:         actor.ID,
+		ActorUsername:   actor.Username,
+		ImpersonationID: impersonationID,
+	})
 }
 
-func (manager *JWTManager) Verify(accessToken string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(
-		accessToken,
-		&Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
-			if !ok {
-				return nil, fmt.Errorf("unexpected token signing method")
-			}
-			return []byte(manager.secretKey), nil
-		},
-	)
-
+func (j *JWTManager) sign(claims *Claims) (string, error) {
+	key, err := j.keys.SigningKey()
 	if err != nil {
-		return nil, fmt.Errorf("invalid token: %w", err)
+		return "", err
 	}
 
-	claims, ok := token.Claims.(*Claims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    j.issuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenDuration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
 	}
 
-	return claims, nil
-}
-package auth
-
-import (
-	"errors"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-type JWTManager struct {
-	secretKey string
-}
-
-func NewJWTManager(secretKey string) *JWTManager {
-	return &JWTManager{secretKey: secretKey}
-}
-
-func (j *JWTManager) GenerateToken(userID uint, username, role string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secretKey))
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
 
 func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no key ID")
+		}
+		key, err := j.keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The key decides the algorithm, never the token
+		if token.Method.Alg() != key.algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(j.secretKey), nil
-	})
+		return key.public, nil
+	}, jwt.WithValidMethods([]string{SigningAlgEdDSA, SigningAlgRS256}), jwt.WithIssuer(j.issuer))
 
 	if err != nil {
 		return nil, err
@@ -198,12 +117,3 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
-
-func (j *JWTManager) RefreshToken(tokenString string) (string, error) {
-	claims, err := j.ValidateToken(tokenString)
-	if err != nil {
-		return "", err
-	}
-
-	return j.GenerateToken(claims.UserID, claims.Username, claims.Role)
-}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTKeyRing(t *testing.T) {
+	db := testutil.DB(t, &models.SigningKey{})
+
+	keys := NewKeyRing(db, utils.NewLogger())
+	manager := NewJWTManager(keys)
+	session := &models.Session{PublicID: testutil.UniqueName("session"), AuthMethods: AuthMethodPassword}
+
+	token, err := manager.GenerateToken(7, "jane", "user", session)
+	require.NoError(t, err)
+	claims, err := manager.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+	assert.Equal(t, session.PublicID, claims.SessionID)
+	assert.Equal(t, []string{AuthMethodPassword}, claims.AuthMethods)
+
+	// Tokens the ring did not sign are refused, whatever key ID they name
+	signer, err := keys.SigningKey()
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           1,
+		Role:             "admin",
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: manager.issuer, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	forged.Header["kid"] = signer.kid
+	forgedToken, err := forged.SignedString([]byte("your-jwt-secret-key"))
+	require.NoError(t, err)
+	_, err = manager.ValidateToken(forgedToken)
+	assert.Error(t, err)
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, &Claims{UserID: 1, Role: "admin"})
+	unsigned.Header["kid"] = signer.kid
+	unsignedToken, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = manager.ValidateToken(unsignedToken)
+	assert.Error(t, err)
+
+	// A rotation keeps the replaced key verifying; revoking it does not
+	require.NoError(t, keys.Rotate(true, false))
+	_, err = manager.ValidateToken(token)
+	assert.NoError(t, err, "the replaced key verifies during its grace period")
+
+	require.NoError(t, keys.Rotate(true, true))
+	_, err = manager.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+}
@@ -0,0 +1,449 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Signing algorithms the key ring can generate keys for.
+const (
+	SigningAlgEdDSA = "EdDSA"
+	SigningAlgRS256 = "RS256"
+)
+
+// Signing key states, see models.SigningKey.
+const (
+	SigningKeyNext     = "next"
+	SigningKeyActive   = "active"
+	SigningKeyRetiring = "retiring"
+)
+
+const (
+	// keyRingRefresh is how often a node reloads the ring to pick up
+	// rotations made by other nodes.
+	keyRingRefresh = time.Minute
+	// keyRingMissReload limits reloads caused by tokens with unknown key IDs.
+	keyRingMissReload = 5 * time.Second
+	rsaKeyBits        = 2048
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// KeyRingConfig controls key generation and rotation. It is read from
+// JWT_SIGNING_ALGORITHM, JWT_KEY_ROTATION_INTERVAL and JWT_KEY_GRACE_PERIOD.
+type KeyRingConfig struct {
+	Algorithm        string
+	RotationInterval time.Duration
+	// GracePeriod keeps a replaced key published so tokens it signed stay
+	// valid; it is never shorter than an access token's lifetime.
+	GracePeriod time.Duration
+}
+
+func keyRingConfigFromEnv() KeyRingConfig {
+	config := KeyRingConfig{
+		Algorithm:        SigningAlgEdDSA,
+		RotationInterval: 30 * 24 * time.Hour,
+		GracePeriod:      time.Hour,
+	}
+	if os.Getenv("JWT_SIGNING_ALGORITHM") == SigningAlgRS256 {
+		config.Algorithm = SigningAlgRS256
+	}
+	if interval, err := time.ParseDuration(os.Getenv("JWT_KEY_ROTATION_INTERVAL")); err == nil && interval > 0 {
+		config.RotationInterval = interval
+	}
+	if grace, err := time.ParseDuration(os.Getenv("JWT_KEY_GRACE_PERIOD")); err == nil && grace > 0 {
+		config.GracePeriod = grace
+	}
+	if config.GracePeriod < AccessTokenDuration {
+		config.GracePeriod = AccessTokenDuration
+	}
+	return config
+}
+
+// ringKey is a parsed signing key.
+type ringKey struct {
+	kid         string
+	algorithm   string
+	status      string
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatedAt time.Time
+}
+
+func (k *ringKey) method() jwt.SigningMethod {
+	if k.algorithm == SigningAlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// KeyRing holds the asymmetric keys panel tokens are signed with. Keys live
+// in the database so every node signs with the same key and sees rotations;
+// each node caches them and reloads every minute.
+type KeyRing struct {
+	db       *gorm.DB
+	config   KeyRingConfig
+	logger   *utils.Logger
+	mutex    sync.RWMutex
+	keys     map[string]*ringKey
+	signer   *ringKey
+	loadedAt time.Time
+}
+
+func NewKeyRing(db *gorm.DB, logger *utils.Logger) *KeyRing {
+	return &KeyRing{
+		db:     db,
+		config: keyRingConfigFromEnv(),
+		logger: logger,
+		keys:   make(map[string]*ringKey),
+	}
+}
+
+// SigningKey returns the key new tokens are signed with. The first keys
+// are generated on a fresh install.
+func (k *KeyRing) SigningKey() (*ringKey, error) {
+	k.mutex.RLock()
+	signer, loadedAt := k.signer, k.loadedAt
+	k.mutex.RUnlock()
+	if signer != nil && time.Since(loadedAt) < keyRingRefresh {
+		return signer, nil
+	}
+
+	// A node that cannot reach the database keeps signing with the key it has
+	if err := k.load(); err != nil {
+		if signer != nil {
+			return signer, nil
+		}
+		return nil, err
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if k.signer == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return k.signer, nil
+}
+
+// VerificationKey returns the published key with the given ID. An unknown ID
+// reloads the ring once, since another node may just have rotated.
+func (k *KeyRing) VerificationKey(kid string) (*ringKey, error) {
+	k.mutex.RLock()
+	key, ok := k.keys[kid]
+	loadedAt := k.loadedAt
+	k.mutex.RUnlock()
+
+	stale := time.Since(loadedAt) >= keyRingRefresh
+	if ok && !stale {
+		return key, nil
+	}
+	if !ok && !stale && time.Since(loadedAt) < keyRingMissReload {
+		return nil, ErrUnknownSigningKey
+	}
+
+	if err := k.load(); err != nil {
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// Keys lists the keys in the ring, newest first.
+func (k *KeyRing) Keys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := k.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %v", err)
+	}
+	return keys, nil
+}
+
+// JWKS returns the published keys as a JSON Web Key Set.
+func (k *KeyRing) JWKS() (map[string]interface{}, error) {
+	if _, err := k.SigningKey(); err != nil {
+		return nil, err
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	published := make([]*ringKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		published = append(published, key)
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].kid < published[j].kid })
+
+	jwks := make([]map[string]string, 0, len(published))
+	for _, key := range published {
+		jwk := map[string]string{
+			"kid": key.kid,
+			"alg": key.algorithm,
+			"use": "sig",
+		}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return map[string]interface{}{"keys": jwks}, nil
+}
+
+// Rotate activates the pre-published next key and generates a new next key.
+// Unless forced it only rotates once the active key is RotationInterval
+// old. The replaced key keeps verifying for the grace period, or stops at
+// once with revokePrevious, which signs everyone out of their current
+// access token after a key compromise.
+func (k *KeyRing) Rotate(force, revokePrevious bool) error {
+	rotated := false
+	err := k.db.Transaction(func(tx *gorm.DB) error {
+		var active []models.SigningKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ?", SigningKeyActive).Order("activated_at DESC").Find(&active).Error; err != nil {
+			return err
+		}
+		if !force && len(active) > 0 && active[0].ActivatedAt != nil &&
+			time.Since(*active[0].ActivatedAt) < k.config.RotationInterval {
+			return nil
+		}
+
+		// A next key left over from a different algorithm is replaced
+		var next models.SigningKey
+		err := tx.Where("status = ? AND algorithm = ?", SigningKeyNext, k.config.Algorithm).Order("created_at").First(&next).Error
+		if err != nil {
+			if next, err = k.generate(SigningKeyNext); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("status = ? AND id <> ?", SigningKeyNext, next.ID).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		next.Status = SigningKeyActive
+		next.ActivatedAt = &now
+		if err := tx.Save(&next).Error; err != nil {
+			return err
+		}
+
+		for _, previous := range active {
+			if revokePrevious {
+				if err := tx.Delete(&previous).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			retireAt := now.Add(k.config.GracePeriod)
+			if err := tx.Model(&previous).Updates(map[string]interface{}{
+				"status":    SigningKeyRetiring,
+				"retire_at": retireAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if revokePrevious {
+			if err := tx.Where("status = ?", SigningKeyRetiring).Delete(&models.SigningKey{}).Error; err != nil {
+				return err
+			}
+		}
+
+		upcoming, err := k.generate(SigningKeyNext)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&upcoming).Error; err != nil {
+			return err
+		}
+
+		rotated = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rotate signing keys: %v", err)
+	}
+
+	if rotated {
+		k.logger.Info(fmt.Sprintf("JWT signing key rotated (revoke previous: %t)", revokePrevious))
+		return k.load()
+	}
+	return nil
+}
+
+// StartRotation rotates the signing key when it is due and deletes keys past
+// their grace period.
+func (k *KeyRing) StartRotation(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !cluster.Leader(k.db, "signing-key-rotation", 2*interval) {
+				continue
+			}
+			if err := k.Rotate(false, false); err != nil {
+				k.logger.Error(err.Error())
+			}
+			if err := k.db.Where("status = ? AND retire_at < ?", SigningKeyRetiring, time.Now()).
+				Delete(&models.SigningKey{}).Error; err != nil {
+				k.logger.Error(fmt.Sprintf("Failed to delete retired signing keys: %v", err))
+			}
+		}
+	}
+}
+
+// load reads the ring from the database, generating the first keys when it
+// is empty.
+func (k *KeyRing) load() error {
+	var stored []models.SigningKey
+	if err := k.db.Order("activated_at DESC").Find(&stored).Error; err != nil {
+		return fmt.Errorf("failed to load signing keys: %v", err)
+	}
+
+	hasActive := false
+	for _, key := range stored {
+		if key.Status == SigningKeyActive {
+			hasActive = true
+			break
+		}
+	}
+	if !hasActive {
+		return k.Rotate(true, false)
+	}
+
+	keys := make(map[string]*ringKey, len(stored))
+	var signer *ringKey
+	for _, key := range stored {
+		if key.Status == SigningKeyRetiring && key.RetireAt != nil && time.Now().After(*key.RetireAt) {
+			continue
+		}
+
+		parsed, err := parseSigningKey(&key)
+		if err != nil {
+			k.logger.Error(fmt.Sprintf("Skipping signing key %s: %v", key.KID, err))
+			continue
+		}
+		keys[parsed.kid] = parsed
+
+		// Two nodes bootstrapping at once can leave two active keys; the
+		// newest signs and both verify
+		if parsed.status == SigningKeyActive && (signer == nil || parsed.activatedAt.After(signer.activatedAt)) {
+			signer = parsed
+		}
+	}
+
+	k.mutex.Lock()
+	k.keys, k.signer, k.loadedAt = keys, signer, time.Now()
+	k.mutex.Unlock()
+	return nil
+}
+
+func (k *KeyRing) generate(status string) (models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch k.config.Algorithm {
+	case SigningAlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("failed to encode signing key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("failed to encode signing key: %v", err)
+	}
+
+	kid, err := randomHex(8)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		KID:        kid,
+		Algorithm:  k.config.Algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		Status:     status,
+	}, nil
+}
+
+func parseSigningKey(key *models.SigningKey) (*ringKey, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	switch private.(type) {
+	case ed25519.PrivateKey:
+		if key.Algorithm != SigningAlgEdDSA {
+			return nil, errors.New("key does not match its algorithm")
+		}
+	case *rsa.PrivateKey:
+		if key.Algorithm != SigningAlgRS256 {
+			return nil, errors.New("key does not match its algorithm")
+		}
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+
+	ring := &ringKey{
+		kid:       key.KID,
+		algorithm: key.Algorithm,
+		status:    key.Status,
+		private:   private,
+		public:    private.Public(),
+	}
+	if key.ActivatedAt != nil {
+		ring.activatedAt = *key.ActivatedAt
+	}
+	return ring, nil
+}
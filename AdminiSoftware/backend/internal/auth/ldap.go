@@ -0,0 +1,705 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+const ldapTimeout = 10 * time.Second
+
+var (
+	ErrLDAPAccessDenied      = errors.New("directory groups do not grant access")
+	ErrLDAPNoAccount         = errors.New("no account is linked to this directory user")
+	ErrLDAPDirectoryNotFound = errors.New("directory not found")
+	ErrLDAPIdentityLinked    = errors.New("directory user is already linked to another account")
+)
+
+// LDAPManager authenticates panel logins against LDAP directories, either by
+// binding directly with a DN template or by searching for the user with a
+// service account and binding as the entry found. Directory groups map to
+// local roles the same way OIDC groups do.
+type LDAPManager struct {
+	db     *gorm.DB
+	pool   AccountPool
+	status AccountStatus
+	logger *utils.Logger
+}
+
+func NewLDAPManager(db *gorm.DB, logger *utils.Logger) *LDAPManager {
+	return &LDAPManager{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// SetAccountPool sets the pool that accounts provisioned for a reseller's
+// directory must fit in. Without one such directories cannot provision.
+func (m *LDAPManager) SetAccountPool(pool AccountPool) {
+	m.pool = pool
+}
+
+// SetAccountStatus sets the lifecycle that suspends and reactivates directory
+// users. Without one the sync leaves account status alone.
+func (m *LDAPManager) SetAccountStatus(status AccountStatus) {
+	m.status = status
+}
+
+// LDAPSyncResult summarises one directory sync.
+type LDAPSyncResult struct {
+	Checked     int `json:"checked"`
+	Updated     int `json:"updated"`
+	Suspended   int `json:"suspended"`
+	Reactivated int `json:"reactivated"`
+}
+
+// ldapEntry is the part of a directory user the panel cares about.
+type ldapEntry struct {
+	DN        string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+}
+
+func (m *LDAPManager) Name() string {
+	return "ldap"
+}
+
+// Authenticate tries every enabled directory in turn. An empty password is
+// rejected up front since most servers treat it as an anonymous bind that
+// always succeeds.
+func (m *LDAPManager) Authenticate(ctx context.Context, login, password string) (*models.User, error) {
+	login = strings.TrimSpace(login)
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var directories []models.LDAPDirectory
+	if err := m.db.Where("enabled = ?", true).Order("id").Find(&directories).Error; err != nil {
+		return nil, fmt.Errorf("failed to load directories: %v", err)
+	}
+
+	var failure error
+	for i := range directories {
+		directory := &directories[i]
+		if !m.inScope(directory, login) {
+			continue
+		}
+
+		entry, err := m.bindUser(directory, login, password)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidCredentials) && failure == nil {
+				failure = fmt.Errorf("directory %q: %v", directory.Name, err)
+			}
+			continue
+		}
+
+		role, err := MapLDAPRole(directory, entry.Groups)
+		if err != nil {
+			return nil, err
+		}
+		return m.resolveUser(directory, strings.ToLower(login), entry, role)
+	}
+
+	if failure != nil {
+		return nil, failure
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Test connects with the service account and reads the base DN so admins can
+// check a configuration before saving it.
+func (m *LDAPManager) Test(directory *models.LDAPDirectory) error {
+	conn, err := m.connect(directory)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := m.serviceBind(conn, directory); err != nil {
+		return err
+	}
+
+	_, err = conn.Search(ldap.NewSearchRequest(
+		directory.BaseDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(ldapTimeout.Seconds()), false,
+		"(objectClass=*)", []string{"dn"}, nil,
+	))
+	if err != nil {
+		return fmt.Errorf("failed to read base DN %s: %v", directory.BaseDN, err)
+	}
+	return nil
+}
+
+// inScope keeps reseller directories from ever seeing the password of an
+// account that belongs to someone else.
+func (m *LDAPManager) inScope(directory *models.LDAPDirectory, login string) bool {
+	if directory.ResellerID == nil {
+		return true
+	}
+
+	var user models.User
+	err := m.db.Where("LOWER(username) = ? OR LOWER(email) = ?", strings.ToLower(login), strings.ToLower(login)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	return err == nil && user.ResellerID != nil && *user.ResellerID == *directory.ResellerID
+}
+
+// MapLDAPRole picks the local role for a set of directory groups. Directories
+// owned by a reseller can only grant the user role.
+func MapLDAPRole(directory *models.LDAPDirectory, groups []string) (string, error) {
+	role, ok := mapGroupRole(directory.AdminGroups, directory.ResellerGroups, directory.UserGroups, directory.DefaultRole, groups)
+	if !ok {
+		return "", ErrLDAPAccessDenied
+	}
+	if directory.ResellerID != nil {
+		role = "user"
+	}
+	return role, nil
+}
+
+// Sync looks up every linked user in the directory. Users that are gone, or
+// no longer in a group granting access, are suspended and signed out; users
+// the sync suspended are reactivated when they return. Any lookup error aborts
+// the run before anyone is suspended.
+func (m *LDAPManager) Sync(directory *models.LDAPDirectory) (*LDAPSyncResult, error) {
+	result, err := m.sync(directory)
+
+	now := time.Now()
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	m.db.Model(directory).Updates(map[string]interface{}{
+		"last_sync_at":    now,
+		"last_sync_error": message,
+	})
+	return result, err
+}
+
+// SyncAll syncs every enabled directory that has sync turned on.
+func (m *LDAPManager) SyncAll() {
+	var directories []models.LDAPDirectory
+	if err := m.db.Where("enabled = ? AND sync_enabled = ?", true, true).Find(&directories).Error; err != nil {
+		m.logger.Error(fmt.Sprintf("Failed to load directories for sync: %v", err))
+		return
+	}
+
+	for i := range directories {
+		result, err := m.Sync(&directories[i])
+		if err != nil {
+			m.logger.Error(fmt.Sprintf("LDAP sync of %q failed: %v", directories[i].Name, err))
+			continue
+		}
+		m.logger.Info(fmt.Sprintf("LDAP sync of %q: %d checked, %d updated, %d suspended, %d reactivated",
+			directories[i].Name, result.Checked, result.Updated, result.Suspended, result.Reactivated))
+	}
+}
+
+// StartSync runs SyncAll on a fixed schedule.
+func (m *LDAPManager) StartSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !cluster.Leader(m.db, "ldap-sync", 2*interval) {
+				continue
+			}
+			m.SyncAll()
+		}
+	}
+}
+
+func (m *LDAPManager) sync(directory *models.LDAPDirectory) (*LDAPSyncResult, error) {
+	var identities []models.LDAPIdentity
+	if err := m.db.Preload("User").Where("directory_id = ?", directory.ID).Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to load linked users: %v", err)
+	}
+	result := &LDAPSyncResult{}
+	if len(identities) == 0 {
+		return result, nil
+	}
+
+	conn, err := m.connect(directory)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.serviceBind(conn, directory); err != nil {
+		return nil, err
+	}
+
+	// Look everyone up before changing anything so a failing directory
+	// cannot suspend half the accounts.
+	entries := make([]*ldapEntry, len(identities))
+	missing := 0
+	for i := range identities {
+		entry, err := m.findUser(conn, directory, identities[i].Username)
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			return nil, fmt.Errorf("failed to look up %s: %v", identities[i].Username, err)
+		}
+		if entry != nil {
+			if entry.Groups, err = m.userGroups(conn, directory, entry.DN, entry.Groups); err != nil {
+				return nil, err
+			}
+		} else {
+			missing++
+		}
+		entries[i] = entry
+	}
+	if missing == len(identities) && missing > 1 {
+		return nil, fmt.Errorf("directory returned none of the %d linked users; refusing to suspend them all", missing)
+	}
+
+	now := time.Now()
+	for i := range identities {
+		identity := &identities[i]
+		user := &identity.User
+		entry := entries[i]
+		result.Checked++
+
+		role := ""
+		if entry != nil {
+			role, err = MapLDAPRole(directory, entry.Groups)
+		}
+		if entry == nil || err != nil {
+			if user.Status == "active" && m.suspend(directory, identity, user) {
+				result.Suspended++
+			}
+			continue
+		}
+
+		if identity.SuspendedBySync && user.Status == "suspended" {
+			if err := m.setStatus(identity, user, "active", fmt.Sprintf("Restored to directory %q", directory.Name)); err != nil {
+				m.logger.Error(fmt.Sprintf("Failed to reactivate user %d returned to directory %q: %v", user.ID, directory.Name, err))
+			} else {
+				result.Reactivated++
+			}
+		}
+
+		updates := map[string]interface{}{}
+		if identity.Provisioned && user.Role != role {
+			updates["role"] = role
+		}
+		if entry.Email != "" && entry.Email != user.Email {
+			updates["email"] = entry.Email
+		}
+		if len(updates) > 0 {
+			if err := m.db.Model(user).Updates(updates).Error; err != nil {
+				m.logger.Error(fmt.Sprintf("Failed to update user %d from directory %q: %v", user.ID, directory.Name, err))
+				continue
+			}
+			result.Updated++
+		}
+
+		m.db.Model(identity).Updates(map[string]interface{}{
+			"dn":                entry.DN,
+			"suspended_by_sync": identity.SuspendedBySync && user.Status == "suspended",
+			"last_sync_at":      now,
+		})
+	}
+
+	return result, nil
+}
+
+// suspend suspends a user the directory no longer grants access and reports
+// whether it did.
+func (m *LDAPManager) suspend(directory *models.LDAPDirectory, identity *models.LDAPIdentity, user *models.User) bool {
+	reason := fmt.Sprintf("Removed from directory %q", directory.Name)
+	if err := m.setStatus(identity, user, "suspended", reason); err != nil {
+		m.logger.Error(fmt.Sprintf("Failed to suspend user %d removed from directory %q: %v", user.ID, directory.Name, err))
+		return false
+	}
+
+	m.db.Create(&models.SecurityEvent{
+		Type:        "ldap_user_suspended",
+		Severity:    "warning",
+		Source:      directory.Name,
+		Description: fmt.Sprintf("%s was suspended because directory %q no longer grants access", user.Username, directory.Name),
+		UserID:      &user.ID,
+	})
+	m.logger.Info(fmt.Sprintf("Suspended %s: removed from directory %q", user.Username, directory.Name))
+	return true
+}
+
+// setStatus moves a directory user's account through the lifecycle, which
+// also signs it out and turns its services off or back on, and records
+// whether the sync is the reason it is suspended.
+func (m *LDAPManager) setStatus(identity *models.LDAPIdentity, user *models.User, to, reason string) error {
+	if m.status == nil {
+		return errors.New("no account lifecycle is configured")
+	}
+	if _, err := m.status.Transition(user.ID, to, reason, 0); err != nil {
+		return err
+	}
+	user.Status = to
+	identity.SuspendedBySync = to == "suspended"
+	return m.db.Model(identity).Updates(map[string]interface{}{
+		"suspended_by_sync": identity.SuspendedBySync,
+		"last_sync_at":      time.Now(),
+	}).Error
+}
+
+// bindUser verifies the password and returns the user's entry with groups.
+func (m *LDAPManager) bindUser(directory *models.LDAPDirectory, login, password string) (*ldapEntry, error) {
+	conn, err := m.connect(directory)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var entry *ldapEntry
+	if directory.UserDNTemplate != "" {
+		dn := strings.ReplaceAll(directory.UserDNTemplate, "%s", ldap.EscapeDN(login))
+		if err := conn.Bind(dn, password); err != nil {
+			return nil, bindError(err)
+		}
+		if entry, err = m.readEntry(conn, directory, dn); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := m.serviceBind(conn, directory); err != nil {
+			return nil, err
+		}
+		if entry, err = m.findUser(conn, directory, login); err != nil {
+			return nil, err
+		}
+		if err := conn.Bind(entry.DN, password); err != nil {
+			return nil, bindError(err)
+		}
+		// Read groups with the service account, which users often cannot.
+		if err := m.serviceBind(conn, directory); err != nil {
+			return nil, err
+		}
+	}
+
+	if entry.Groups, err = m.userGroups(conn, directory, entry.DN, entry.Groups); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// findUser searches for exactly one entry matching the login. It returns
+// ErrInvalidCredentials when there is none so callers can tell a missing user
+// from a failing directory.
+func (m *LDAPManager) findUser(conn *ldap.Conn, directory *models.LDAPDirectory, login string) (*ldapEntry, error) {
+	filter := strings.ReplaceAll(directory.UserFilter, "%s", ldap.EscapeFilter(login))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		directory.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter, m.attributes(directory), nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user search failed: %v", err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return m.toEntry(directory, result.Entries[0]), nil
+	default:
+		return nil, fmt.Errorf("user filter matched more than one entry for %s", login)
+	}
+}
+
+func (m *LDAPManager) readEntry(conn *ldap.Conn, directory *models.LDAPDirectory, dn string) (*ldapEntry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(ldapTimeout.Seconds()), false,
+		"(objectClass=*)", m.attributes(directory), nil,
+	))
+	if err != nil || len(result.Entries) == 0 {
+		return nil, fmt.Errorf("failed to read %s: %v", dn, err)
+	}
+	return m.toEntry(directory, result.Entries[0]), nil
+}
+
+// userGroups returns the groups of an entry: the values of GroupAttribute
+// already read, or a search under GroupBaseDN for directories without a
+// memberOf overlay. Each group is listed by DN and by CN so either can be
+// configured.
+func (m *LDAPManager) userGroups(conn *ldap.Conn, directory *models.LDAPDirectory, dn string, memberOf []string) ([]string, error) {
+	groupDNs := memberOf
+	if directory.GroupBaseDN != "" {
+		filter := strings.ReplaceAll(directory.GroupFilter, "%s", ldap.EscapeFilter(dn))
+		result, err := conn.Search(ldap.NewSearchRequest(
+			directory.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+			filter, []string{"dn"}, nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("group search failed: %v", err)
+		}
+		groupDNs = nil
+		for _, group := range result.Entries {
+			groupDNs = append(groupDNs, group.DN)
+		}
+	}
+
+	var groups []string
+	for _, groupDN := range groupDNs {
+		groups = append(groups, groupDN)
+		if parsed, err := ldap.ParseDN(groupDN); err == nil && len(parsed.RDNs) > 0 {
+			for _, attribute := range parsed.RDNs[0].Attributes {
+				if strings.EqualFold(attribute.Type, "cn") {
+					groups = append(groups, attribute.Value)
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+func (m *LDAPManager) attributes(directory *models.LDAPDirectory) []string {
+	attributes := []string{directory.EmailAttribute, directory.FirstNameAttribute, directory.LastNameAttribute}
+	if directory.GroupBaseDN == "" && directory.GroupAttribute != "" {
+		attributes = append(attributes, directory.GroupAttribute)
+	}
+	return attributes
+}
+
+func (m *LDAPManager) toEntry(directory *models.LDAPDirectory, entry *ldap.Entry) *ldapEntry {
+	result := &ldapEntry{
+		DN:        entry.DN,
+		Email:     entry.GetAttributeValue(directory.EmailAttribute),
+		FirstName: entry.GetAttributeValue(directory.FirstNameAttribute),
+		LastName:  entry.GetAttributeValue(directory.LastNameAttribute),
+	}
+	if directory.GroupBaseDN == "" && directory.GroupAttribute != "" {
+		result.Groups = entry.GetAttributeValues(directory.GroupAttribute)
+	}
+	return result
+}
+
+// connect dials the directory, upgrading plain connections with StartTLS when
+// configured.
+func (m *LDAPManager) connect(directory *models.LDAPDirectory) (*ldap.Conn, error) {
+	parsed, err := url.Parse(directory.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory URL: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         parsed.Hostname(),
+		InsecureSkipVerify: directory.InsecureSkipVerify,
+	}
+
+	conn, err := ldap.DialURL(directory.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", directory.URL, err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if directory.StartTLS && parsed.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (m *LDAPManager) serviceBind(conn *ldap.Conn, directory *models.LDAPDirectory) error {
+	var err error
+	if directory.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(directory.BindDN, directory.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("service account bind failed: %v", err)
+	}
+	return nil
+}
+
+func bindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	return fmt.Errorf("bind failed: %v", err)
+}
+
+// resolveUser finds the account linked to a directory user, or provisions a
+// new one when the directory allows it. Existing local accounts are never
+// matched by username; their owners link them with Link. Email and names
+// follow the directory on every login, the role only for accounts the
+// directory provisioned.
+func (m *LDAPManager) resolveUser(directory *models.LDAPDirectory, username string, entry *ldapEntry, role string) (*models.User, error) {
+	now := time.Now()
+
+	var user models.User
+	var identity models.LDAPIdentity
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("directory_id = ? AND username = ?", directory.ID, username).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return ErrLDAPNoAccount
+			}
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !directory.AutoProvision {
+				return ErrLDAPNoAccount
+			}
+			if err := m.provision(tx, directory, username, entry, role, &user); err != nil {
+				return err
+			}
+			identity = models.LDAPIdentity{
+				UserID:      user.ID,
+				DirectoryID: directory.ID,
+				Username:    username,
+				Provisioned: true,
+			}
+		} else {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if identity.Provisioned {
+			updates["role"] = role
+		}
+		if entry.Email != "" {
+			updates["email"] = entry.Email
+		}
+		if entry.FirstName != "" {
+			updates["first_name"] = entry.FirstName
+		}
+		if entry.LastName != "" {
+			updates["last_name"] = entry.LastName
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update account: %v", err)
+			}
+		}
+
+		identity.DN = entry.DN
+		identity.SuspendedBySync = identity.SuspendedBySync && user.Status == "suspended"
+		identity.LastLoginAt = &now
+		if err := tx.Save(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link directory user: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.SuspendedBySync {
+		reason := fmt.Sprintf("Signed in through directory %q", directory.Name)
+		if err := m.setStatus(&identity, &user, "active", reason); err != nil {
+			return nil, fmt.Errorf("failed to reactivate account: %v", err)
+		}
+	}
+	return &user, nil
+}
+
+// Link attaches a directory user to an existing account once the owner,
+// signed in to it, proves the directory password. A reseller's directory only
+// links that reseller's customers. Linked accounts keep their role; the
+// directory only decides whether they may still sign in through it.
+func (m *LDAPManager) Link(directoryID uint, user *models.User, login, password string) error {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if login == "" || password == "" {
+		return ErrInvalidCredentials
+	}
+
+	var directory models.LDAPDirectory
+	if err := m.db.Where("id = ? AND enabled = ?", directoryID, true).First(&directory).Error; err != nil {
+		return ErrLDAPDirectoryNotFound
+	}
+	if directory.ResellerID != nil && (user.Role != "user" || user.ResellerID == nil || *user.ResellerID != *directory.ResellerID) {
+		return ErrLDAPDirectoryNotFound
+	}
+
+	entry, err := m.bindUser(&directory, login, password)
+	if err != nil {
+		return err
+	}
+	if _, err := MapLDAPRole(&directory, entry.Groups); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.LDAPIdentity
+		err := tx.Where("directory_id = ? AND username = ?", directory.ID, login).First(&identity).Error
+		if err == nil && identity.UserID != user.ID {
+			return ErrLDAPIdentityLinked
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		identity.UserID = user.ID
+		identity.DirectoryID = directory.ID
+		identity.Username = login
+		identity.DN = entry.DN
+		identity.LastLoginAt = &now
+		if err := tx.Save(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link directory user: %v", err)
+		}
+		return nil
+	})
+}
+
+func (m *LDAPManager) provision(tx *gorm.DB, directory *models.LDAPDirectory, username string, entry *ldapEntry, role string, user *models.User) error {
+	if entry.Email == "" {
+		return fmt.Errorf("directory entry %s has no %s attribute", entry.DN, directory.EmailAttribute)
+	}
+
+	var taken int64
+	tx.Unscoped().Model(&models.User{}).Where("LOWER(username) = ? OR LOWER(email) = ?", username, strings.ToLower(entry.Email)).Count(&taken)
+	if taken > 0 {
+		return fmt.Errorf("username %s or email %s already belongs to another account", username, entry.Email)
+	}
+
+	// Directory accounts get a random password nobody knows; the local
+	// provider never checks it while the directory is enabled.
+	// A reseller's directory creates the reseller's customers, which must
+	// fit its pool like any other
+	if directory.ResellerID != nil {
+		if m.pool == nil {
+			return errors.New("reseller account pool is not configured")
+		}
+		if err := m.pool.CheckNewAccount(tx, *directory.ResellerID); err != nil {
+			return err
+		}
+	}
+
+	password, err := utils.HashPassword(utils.GenerateRandomString(48))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	*user = models.User{
+		Username:   username,
+		Email:      entry.Email,
+		Password:   password,
+		Role:       role,
+		Status:     "active",
+		FirstName:  entry.FirstName,
+		LastName:   entry.LastName,
+		ResellerID: directory.ResellerID,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to provision account: %v", err)
+	}
+	return nil
+}
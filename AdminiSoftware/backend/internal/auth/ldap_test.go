@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMapLDAPRole(t *testing.T) {
+	directory := &models.LDAPDirectory{AdminGroups: "ops", ResellerGroups: "partners", DefaultRole: "user"}
+
+	role, err := MapLDAPRole(directory, []string{"cn=ops,ou=groups,dc=example,dc=org", "ops"})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", role)
+
+	resellerID := uint(7)
+	directory.ResellerID = &resellerID
+	role, err = MapLDAPRole(directory, []string{"ops"})
+	require.NoError(t, err)
+	assert.Equal(t, "user", role, "a reseller's directory never grants more than user")
+
+	directory.UserGroups = "staff"
+	_, err = MapLDAPRole(directory, []string{"guests"})
+	assert.ErrorIs(t, err, ErrLDAPAccessDenied)
+}
+
+// testDirectory points a directory at the OpenLDAP server named by
+// LDAP_TEST_URL, skipping the test when it is not set, and adds a user with
+// the given password under the base DN. LDAP_TEST_BIND_DN,
+// LDAP_TEST_BIND_PASSWORD and LDAP_TEST_BASE_DN default to those of the
+// osixia/openldap image. The returned function removes the user.
+func testDirectory(t *testing.T, username, password string) (*models.LDAPDirectory, func()) {
+	t.Helper()
+	serverURL := os.Getenv("LDAP_TEST_URL")
+	if serverURL == "" {
+		t.Skip("LDAP_TEST_URL is not set")
+	}
+
+	directory := &models.LDAPDirectory{
+		Name:               username,
+		URL:                serverURL,
+		BindDN:             envOr("LDAP_TEST_BIND_DN", "cn=admin,dc=example,dc=org"),
+		BindPassword:       envOr("LDAP_TEST_BIND_PASSWORD", "admin"),
+		BaseDN:             envOr("LDAP_TEST_BASE_DN", "dc=example,dc=org"),
+		UserFilter:         "(uid=%s)",
+		EmailAttribute:     "mail",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		DefaultRole:        "user",
+		Enabled:            true,
+	}
+
+	conn, err := ldap.DialURL(serverURL)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.Bind(directory.BindDN, directory.BindPassword))
+
+	dn := "uid=" + ldap.EscapeDN(username) + "," + directory.BaseDN
+	add := ldap.NewAddRequest(dn, nil)
+	add.Attribute("objectClass", []string{"inetOrgPerson"})
+	add.Attribute("uid", []string{username})
+	add.Attribute("cn", []string{"Jane Doe"})
+	add.Attribute("givenName", []string{"Jane"})
+	add.Attribute("sn", []string{"Doe"})
+	add.Attribute("mail", []string{username + "@example.com"})
+	add.Attribute("userPassword", []string{password})
+	require.NoError(t, conn.Add(add))
+
+	return directory, func() {
+		conn, err := ldap.DialURL(serverURL)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if conn.Bind(directory.BindDN, directory.BindPassword) == nil {
+			conn.Del(ldap.NewDelRequest(dn, nil))
+		}
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func TestLDAPBind(t *testing.T) {
+	name := testutil.UniqueName("ldap")
+	directory, remove := testDirectory(t, name, "s3cret-pass")
+	defer remove()
+
+	manager := NewLDAPManager(nil, nil)
+	require.NoError(t, manager.Test(directory))
+
+	entry, err := manager.bindUser(directory, name, "s3cret-pass")
+	require.NoError(t, err)
+	assert.Equal(t, name+"@example.com", entry.Email)
+	assert.Equal(t, "Jane", entry.FirstName)
+
+	_, err = manager.bindUser(directory, name, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = manager.bindUser(directory, name+"-missing", "s3cret-pass")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+// recordingStatus stands in for the account lifecycle.
+type recordingStatus struct {
+	db          *gorm.DB
+	transitions []string
+}
+
+func (s *recordingStatus) Transition(userID uint, to, reason string, actorID uint) (*models.AccountTransition, error) {
+	s.transitions = append(s.transitions, to)
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("status", to).Error; err != nil {
+		return nil, err
+	}
+	return &models.AccountTransition{UserID: userID, To: to, Reason: reason, ActorID: actorID}, nil
+}
+
+func TestLDAPLoginRequiresExplicitLink(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.LDAPDirectory{}, &models.LDAPIdentity{}, &models.SecurityEvent{})
+
+	name := testutil.UniqueName("ldap")
+	directory, remove := testDirectory(t, name, "s3cret-pass")
+	directory.AutoProvision = true
+	require.NoError(t, db.Create(directory).Error)
+	admin := &models.User{Username: name, Email: name + "@panel.example.com", Password: "x", Role: "admin", Status: "active"}
+	require.NoError(t, db.Create(admin).Error)
+	defer func() {
+		remove()
+		db.Where("directory_id = ?", directory.ID).Delete(&models.LDAPIdentity{})
+		db.Where("user_id = ?", admin.ID).Delete(&models.SecurityEvent{})
+		db.Unscoped().Delete(directory)
+		db.Unscoped().Delete(admin)
+	}()
+
+	manager := NewLDAPManager(db, utils.NewLogger())
+	status := &recordingStatus{db: db}
+	manager.SetAccountStatus(status)
+	ctx := context.Background()
+
+	// The username matches the admin, but nothing links them
+	_, err := manager.Authenticate(ctx, name, "s3cret-pass")
+	assert.Error(t, err)
+	var linked int64
+	db.Model(&models.LDAPIdentity{}).Where("directory_id = ?", directory.ID).Count(&linked)
+	assert.Zero(t, linked)
+
+	// The admin links the directory user while signed in and keeps its role
+	assert.ErrorIs(t, manager.Link(directory.ID, admin, name, "wrong"), ErrInvalidCredentials)
+	require.NoError(t, manager.Link(directory.ID, admin, name, "s3cret-pass"))
+
+	user, err := manager.Authenticate(ctx, name, "s3cret-pass")
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, user.ID)
+	assert.Equal(t, "admin", user.Role, "a linked account keeps its local role")
+
+	// Removed from the directory, the account is suspended through the
+	// lifecycle, and reactivated when it signs in again after returning
+	remove()
+	result, err := manager.Sync(directory)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Suspended)
+	assert.Equal(t, []string{"suspended"}, status.transitions)
+
+	_, remove = testDirectory(t, name, "s3cret-pass")
+	user, err = manager.Authenticate(ctx, name, "s3cret-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "active", user.Status)
+	assert.Equal(t, []string{"suspended", "active"}, status.transitions)
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MFAPolicySetting is the System setting listing the roles that must sign in
+// with a phishing-resistant factor (a WebAuthn credential).
+const MFAPolicySetting = "security.phishing_resistant_mfa_roles"
+
+type MFAPolicy struct {
+	db *gorm.DB
+}
+
+func NewMFAPolicy(db *gorm.DB) *MFAPolicy {
+	return &MFAPolicy{db: db}
+}
+
+// Roles returns the roles the policy currently applies to.
+func (p *MFAPolicy) Roles() []string {
+	var setting models.System
+	if err := p.db.Where("setting = ?", MFAPolicySetting).First(&setting).Error; err != nil {
+		return nil
+	}
+
+	var roles []string
+	for _, role := range strings.Split(setting.Value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// RequiredFor reports whether users with the role need a WebAuthn credential.
+func (p *MFAPolicy) RequiredFor(role string) bool {
+	for _, r := range p.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRoles replaces the list of roles the policy applies to.
+func (p *MFAPolicy) SetRoles(roles []string) error {
+	setting := models.System{
+		Setting:     MFAPolicySetting,
+		Value:       strings.Join(roles, ","),
+		Description: "Roles that must sign in with a security key or passkey",
+		Category:    "security",
+	}
+
+	var existing models.System
+	if err := p.db.Where("setting = ?", MFAPolicySetting).First(&existing).Error; err == nil {
+		return p.db.Model(&existing).Update("value", setting.Value).Error
+	}
+	return p.db.Create(&setting).Error
+}
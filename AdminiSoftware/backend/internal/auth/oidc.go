@@ -0,0 +1,528 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// AuthMethodFederated marks sessions opened through an external identity
+// provider. It is not one of the RFC 8176 values; the IdP's own methods are
+// not trusted for local MFA policy.
+const AuthMethodFederated = "fed"
+
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcFetchTimeout bounds requests to providers configured by resellers.
+const oidcFetchTimeout = 15 * time.Second
+
+var (
+	ErrOIDCProviderNotFound = errors.New("identity provider not found")
+	ErrOIDCStateInvalid     = errors.New("login state is invalid or expired")
+	ErrOIDCAccessDenied     = errors.New("identity provider groups do not grant access")
+	ErrOIDCNoAccount        = errors.New("no account is linked to this identity")
+	ErrOIDCIdentityLinked   = errors.New("identity is already linked to another account")
+)
+
+// OIDCManager signs users in through OpenID Connect providers using the
+// authorization code flow with PKCE. ID tokens are verified against the
+// provider's published JWKS. Providers configured by resellers are only
+// reached at public addresses.
+type OIDCManager struct {
+	db           *gorm.DB
+	redirectURL  string
+	pool         AccountPool
+	publicClient *http.Client
+
+	mu        sync.Mutex
+	discovery map[string]*oidc.Provider
+}
+
+// NewOIDCManager reads the callback URL registered with every provider from
+// OIDC_REDIRECT_URL.
+func NewOIDCManager(db *gorm.DB) *OIDCManager {
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:3000/auth/oidc/callback"
+	}
+
+	return &OIDCManager{
+		db:           db,
+		redirectURL:  redirectURL,
+		publicClient: utils.PublicHTTPClient(oidcFetchTimeout),
+		discovery:    make(map[string]*oidc.Provider),
+	}
+}
+
+// SetAccountPool sets the pool that accounts provisioned for a reseller's
+// provider must fit in. Without one such providers cannot provision.
+func (m *OIDCManager) SetAccountPool(pool AccountPool) {
+	m.pool = pool
+}
+
+// Discover fetches (and caches) the provider metadata for an issuer. A
+// restricted issuer, one configured by a reseller, is fetched, and later
+// verified and redeemed against, only at public addresses.
+func (m *OIDCManager) Discover(ctx context.Context, issuer string, restricted bool) (*oidc.Provider, error) {
+	key := issuer
+	if restricted {
+		key = "restricted " + issuer
+	}
+
+	m.mu.Lock()
+	provider, ok := m.discovery[key]
+	m.mu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	// The provider keeps the context's client for fetching its keys
+	provider, err := oidc.NewProvider(m.clientContext(ctx, restricted), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %s: %v", issuer, err)
+	}
+
+	m.mu.Lock()
+	m.discovery[key] = provider
+	m.mu.Unlock()
+	return provider, nil
+}
+
+// clientContext carries the HTTP client for requests to a provider.
+func (m *OIDCManager) clientContext(ctx context.Context, restricted bool) context.Context {
+	if !restricted {
+		return ctx
+	}
+	return oidc.ClientContext(ctx, m.publicClient)
+}
+
+// ListProviders returns the enabled providers offered on a login page: the
+// global ones plus, when resellerID is set, that reseller's own.
+func (m *OIDCManager) ListProviders(resellerID *uint) ([]models.OIDCProvider, error) {
+	query := m.db.Where("enabled = ?", true)
+	if resellerID != nil {
+		query = query.Where("reseller_id IS NULL OR reseller_id = ?", *resellerID)
+	} else {
+		query = query.Where("reseller_id IS NULL")
+	}
+
+	var providers []models.OIDCProvider
+	if err := query.Order("name").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// Begin starts an authorization request and returns the URL to send the
+// browser to.
+func (m *OIDCManager) Begin(ctx context.Context, providerID uint) (string, error) {
+	var config models.OIDCProvider
+	if err := m.db.Where("id = ? AND enabled = ?", providerID, true).First(&config).Error; err != nil {
+		return "", ErrOIDCProviderNotFound
+	}
+	return m.begin(ctx, &config, nil)
+}
+
+// BeginLink starts an authorization request that links the identity to the
+// signed-in user instead of signing in. A reseller's provider only links
+// that reseller's customers.
+func (m *OIDCManager) BeginLink(ctx context.Context, providerID uint, user *models.User) (string, error) {
+	var config models.OIDCProvider
+	if err := m.db.Where("id = ? AND enabled = ?", providerID, true).First(&config).Error; err != nil {
+		return "", ErrOIDCProviderNotFound
+	}
+	if config.ResellerID != nil && (user.Role != "user" || user.ResellerID == nil || *user.ResellerID != *config.ResellerID) {
+		return "", ErrOIDCProviderNotFound
+	}
+	return m.begin(ctx, &config, &user.ID)
+}
+
+func (m *OIDCManager) begin(ctx context.Context, config *models.OIDCProvider, linkUserID *uint) (string, error) {
+	oauth, _, err := m.clientFor(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := m.db.Create(&models.OIDCLoginState{
+		State:        state,
+		ProviderID:   config.ID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURI:  m.redirectURL,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcLoginTimeout),
+	}).Error; err != nil {
+		return "", err
+	}
+
+	return oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Complete exchanges the authorization code, verifies the ID token and returns
+// the local user it maps to: the linked account, the signed-in user that
+// started a link, or an account provisioned for the identity.
+func (m *OIDCManager) Complete(ctx context.Context, state, code string) (*models.User, error) {
+	login, err := m.takeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.OIDCProvider
+	if err := m.db.Where("id = ? AND enabled = ?", login.ProviderID, true).First(&config).Error; err != nil {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	oauth, verifier, err := m.clientFor(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+	oauth.RedirectURL = login.RedirectURI
+
+	token, err := oauth.Exchange(m.clientContext(ctx, config.ResellerID != nil), code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %v", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, errors.New("id_token nonce does not match the login request")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %v", err)
+	}
+
+	role, err := MapOIDCRole(&config, claimStrings(claims[config.GroupsClaim]))
+	if err != nil {
+		return nil, err
+	}
+
+	if login.LinkUserID != nil {
+		return m.link(&config, idToken.Subject, claims, *login.LinkUserID)
+	}
+	return m.resolveUser(&config, idToken.Subject, claims, role)
+}
+
+// MapOIDCRole picks the local role for a set of IdP groups. Admin groups win
+// over reseller groups, which win over user groups. When no user groups are
+// configured every authenticated identity gets the default role. Providers
+// owned by a reseller can only grant the user role.
+func MapOIDCRole(config *models.OIDCProvider, groups []string) (string, error) {
+	role, ok := mapGroupRole(config.AdminGroups, config.ResellerGroups, config.UserGroups, config.DefaultRole, groups)
+	if !ok {
+		return "", ErrOIDCAccessDenied
+	}
+	if config.ResellerID != nil {
+		role = "user"
+	}
+	return role, nil
+}
+
+// mapGroupRole applies the admin, reseller, user precedence shared by
+// federated and directory logins. It reports false when user groups are
+// configured and none of them match.
+func mapGroupRole(adminGroups, resellerGroups, userGroups, defaultRole string, groups []string) (string, bool) {
+	switch {
+	case matchesGroup(adminGroups, groups):
+		return "admin", true
+	case matchesGroup(resellerGroups, groups):
+		return "reseller", true
+	case matchesGroup(userGroups, groups):
+		return "user", true
+	case strings.TrimSpace(userGroups) == "":
+		if defaultRole == "" {
+			return "user", true
+		}
+		return defaultRole, true
+	default:
+		return "", false
+	}
+}
+
+// resolveUser finds the account for an identity: the account linked to it,
+// or a new account when the provider allows just-in-time provisioning.
+// Existing accounts are never matched by email; their owners link them while
+// signed in. The mapped role is applied on every login to provisioned
+// accounts so group changes at the IdP take effect.
+func (m *OIDCManager) resolveUser(config *models.OIDCProvider, subject string, claims map[string]interface{}, role string) (*models.User, error) {
+	email, _ := claims["email"].(string)
+	now := time.Now()
+
+	var user models.User
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.OIDCIdentity
+		err := tx.Where("provider_id = ? AND subject = ?", config.ID, subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return ErrOIDCNoAccount
+			}
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !config.AutoProvision {
+				return ErrOIDCNoAccount
+			}
+			if err := m.provision(tx, config, claims, email, role, &user); err != nil {
+				return err
+			}
+
+			identity = models.OIDCIdentity{
+				UserID:      user.ID,
+				ProviderID:  config.ID,
+				Subject:     subject,
+				Provisioned: true,
+			}
+		} else {
+			return err
+		}
+
+		identity.Email = email
+		identity.LastLoginAt = &now
+		if err := tx.Save(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link identity: %v", err)
+		}
+
+		if identity.Provisioned && user.Role != role {
+			user.Role = role
+			if err := tx.Model(&user).Update("role", role).Error; err != nil {
+				return fmt.Errorf("failed to update role: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// link attaches the identity to the user that started the link. The user
+// keeps its local role.
+func (m *OIDCManager) link(config *models.OIDCProvider, subject string, claims map[string]interface{}, userID uint) (*models.User, error) {
+	email, _ := claims["email"].(string)
+	now := time.Now()
+
+	var user models.User
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return ErrOIDCNoAccount
+		}
+
+		var identity models.OIDCIdentity
+		err := tx.Where("provider_id = ? AND subject = ?", config.ID, subject).First(&identity).Error
+		if err == nil && identity.UserID != userID {
+			return ErrOIDCIdentityLinked
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		identity.UserID = userID
+		identity.ProviderID = config.ID
+		identity.Subject = subject
+		identity.Email = email
+		identity.LastLoginAt = &now
+		if err := tx.Save(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link identity: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (m *OIDCManager) provision(tx *gorm.DB, config *models.OIDCProvider, claims map[string]interface{}, email, role string, user *models.User) error {
+	if email == "" {
+		return errors.New("identity provider did not release an email address")
+	}
+
+	var taken int64
+	tx.Model(&models.User{}).Where("LOWER(email) = ?", strings.ToLower(email)).Count(&taken)
+	if taken > 0 {
+		return fmt.Errorf("email %s already belongs to another account", email)
+	}
+
+	// A reseller's provider creates the reseller's customers, which must fit
+	// its pool like any other
+	if config.ResellerID != nil {
+		if m.pool == nil {
+			return errors.New("reseller account pool is not configured")
+		}
+		if err := m.pool.CheckNewAccount(tx, *config.ResellerID); err != nil {
+			return err
+		}
+	}
+
+	username, err := m.uniqueUsername(tx, claims, email)
+	if err != nil {
+		return err
+	}
+
+	// Federated accounts get a random password nobody knows; they sign in
+	// through the IdP until a password is set.
+	password, err := utils.HashPassword(utils.GenerateRandomString(48))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	firstName, _ := claims["given_name"].(string)
+	lastName, _ := claims["family_name"].(string)
+
+	*user = models.User{
+		Username:   username,
+		Email:      email,
+		Password:   password,
+		Role:       role,
+		Status:     "active",
+		FirstName:  firstName,
+		LastName:   lastName,
+		ResellerID: config.ResellerID,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to provision account: %v", err)
+	}
+	return nil
+}
+
+var usernameSanitizer = regexp.MustCompile(`[^a-z0-9_]+`)
+
+func (m *OIDCManager) uniqueUsername(tx *gorm.DB, claims map[string]interface{}, email string) (string, error) {
+	base, _ := claims["preferred_username"].(string)
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = usernameSanitizer.ReplaceAllString(strings.ToLower(base), "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 24 {
+		base = base[:24]
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		var count int64
+		tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a free username for %s", base)
+}
+
+func (m *OIDCManager) clientFor(ctx context.Context, config *models.OIDCProvider) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	provider, err := m.Discover(ctx, config.Issuer, config.ResellerID != nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := strings.Fields(config.Scopes)
+	if !utils.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	oauth := &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  m.redirectURL,
+		Scopes:       scopes,
+	}
+	verifier := provider.Verifier(&oidc.Config{ClientID: config.ClientID})
+	return oauth, verifier, nil
+}
+
+// takeState consumes a login state so an authorization response can only be
+// redeemed once.
+func (m *OIDCManager) takeState(state string) (*models.OIDCLoginState, error) {
+	if state == "" {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	var login models.OIDCLoginState
+	if err := m.db.Where("state = ?", state).First(&login).Error; err != nil {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	result := m.db.Where("id = ?", login.ID).Delete(&models.OIDCLoginState{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, ErrOIDCStateInvalid
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	m.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+	return &login, nil
+}
+
+func matchesGroup(configured string, groups []string) bool {
+	for _, want := range strings.Split(configured, ",") {
+		want = strings.TrimSpace(want)
+		if want == "" {
+			continue
+		}
+		for _, group := range groups {
+			if strings.EqualFold(group, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimStrings accepts a claim encoded either as a single string or as a list.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// RedirectURL is the callback every provider must have registered.
+func (m *OIDCManager) RedirectURL() string {
+	return m.redirectURL
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"AdminiSoftware/internal/auth/oidctest"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapOIDCRole(t *testing.T) {
+	config := &models.OIDCProvider{AdminGroups: "ops", ResellerGroups: "partners", UserGroups: "staff", DefaultRole: "user"}
+
+	role, err := MapOIDCRole(config, []string{"staff", "ops"})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", role)
+
+	role, err = MapOIDCRole(config, []string{"Partners"})
+	require.NoError(t, err)
+	assert.Equal(t, "reseller", role)
+
+	_, err = MapOIDCRole(config, []string{"guests"})
+	assert.ErrorIs(t, err, ErrOIDCAccessDenied)
+
+	resellerID := uint(7)
+	config.ResellerID = &resellerID
+	role, err = MapOIDCRole(config, []string{"ops"})
+	require.NoError(t, err)
+	assert.Equal(t, "user", role, "a reseller's provider never grants more than user")
+}
+
+func TestOIDCDiscoverRestricted(t *testing.T) {
+	_, server, err := oidctest.NewServer("panel", oidctest.Identity{Subject: "s1", Email: "a@example.com"})
+	require.NoError(t, err)
+	defer server.Close()
+
+	manager := NewOIDCManager(nil)
+	_, err = manager.Discover(context.Background(), server.URL, false)
+	assert.NoError(t, err, "administrators may use internal issuers")
+
+	_, err = manager.Discover(context.Background(), server.URL, true)
+	assert.ErrorContains(t, err, utils.ErrNonPublicAddress.Error(), "a reseller's issuer must be public")
+}
+
+func TestOIDCLoginRequiresExplicitLink(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.OIDCProvider{}, &models.OIDCIdentity{}, &models.OIDCLoginState{})
+
+	name := testutil.UniqueName("oidc")
+	email := name + "@example.com"
+	idp, server, err := oidctest.NewServer("panel", oidctest.Identity{Subject: name, Email: email, Name: "Jane Doe"})
+	require.NoError(t, err)
+	defer server.Close()
+
+	admin := &models.User{Username: name, Email: email, Password: "x", Role: "admin", Status: "active"}
+	require.NoError(t, db.Create(admin).Error)
+	provider := &models.OIDCProvider{Name: name, Issuer: idp.Issuer, ClientID: "panel", DefaultRole: "user", Enabled: true}
+	require.NoError(t, db.Create(provider).Error)
+	defer func() {
+		db.Where("provider_id = ?", provider.ID).Delete(&models.OIDCIdentity{})
+		db.Unscoped().Delete(provider)
+		db.Unscoped().Delete(admin)
+	}()
+
+	manager := NewOIDCManager(db)
+	ctx := context.Background()
+
+	// The verified email matches the admin, but nothing links them
+	authURL, err := manager.Begin(ctx, provider.ID)
+	require.NoError(t, err)
+	state, code := authorize(t, authURL)
+	_, err = manager.Complete(ctx, state, code)
+	assert.ErrorIs(t, err, ErrOIDCNoAccount)
+
+	// The admin links the identity while signed in and keeps its role
+	authURL, err = manager.BeginLink(ctx, provider.ID, admin)
+	require.NoError(t, err)
+	state, code = authorize(t, authURL)
+	user, err := manager.Complete(ctx, state, code)
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, user.ID)
+
+	authURL, err = manager.Begin(ctx, provider.ID)
+	require.NoError(t, err)
+	state, code = authorize(t, authURL)
+	user, err = manager.Complete(ctx, state, code)
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, user.ID)
+	assert.Equal(t, "admin", user.Role, "a linked account keeps its local role")
+
+	// The state is single use
+	_, err = manager.Complete(ctx, state, code)
+	assert.ErrorIs(t, err, ErrOIDCStateInvalid)
+}
+
+// authorize follows the authorization URL to the mock IdP and returns the
+// state and code it redirects back with.
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query().Get("state"), location.Query().Get("code")
+}
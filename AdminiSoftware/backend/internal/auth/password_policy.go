@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordPolicySetting is the System setting holding the policy as JSON.
+const PasswordPolicySetting = "security.password_policy"
+
+// Kinds of password the policy applies to; they also key the history.
+const (
+	PasswordKindPanel    = "panel"
+	PasswordKindEmail    = "email"
+	PasswordKindDatabase = "database"
+)
+
+// maxPasswordHistory bounds how many old hashes are compared, since every
+// comparison is a full bcrypt run.
+const maxPasswordHistory = 24
+
+// PasswordPolicyConfig is the configurable password policy. It applies to
+// panel, email and database passwords alike.
+type PasswordPolicyConfig struct {
+	utils.PasswordRules
+	HistoryCount    int  `json:"history_count"`    // previous passwords that cannot be reused, 0 disables
+	MaxAgeDays      int  `json:"max_age_days"`     // panel passwords must be changed after this many days, 0 disables
+	DictionaryCheck bool `json:"dictionary_check"` // reject common words and the account's own name
+	BreachCheck     bool `json:"breach_check"`     // reject passwords found in the breached-password corpus
+	BreachThreshold int  `json:"breach_threshold"` // times a password must appear in the corpus to be rejected
+}
+
+// DefaultPasswordPolicy applies until an administrator saves a policy.
+var DefaultPasswordPolicy = PasswordPolicyConfig{
+	PasswordRules:   utils.DefaultPasswordRules,
+	HistoryCount:    5,
+	DictionaryCheck: true,
+	BreachCheck:     true,
+	BreachThreshold: 1,
+}
+
+// PasswordSubject identifies whose password is being set. OwnerID is zero
+// while the account does not exist yet, which skips the history check.
+type PasswordSubject struct {
+	Kind     string
+	OwnerID  uint
+	Username string
+	Email    string
+}
+
+// PasswordPolicyError lists every rule a candidate password breaks.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+// PasswordPolicy checks candidate passwords and tracks password history and
+// age. The breached-password corpus is read from PASSWORD_BREACH_CORPUS and
+// extra dictionary words from PASSWORD_DICTIONARY, one per line.
+type PasswordPolicy struct {
+	db     *gorm.DB
+	corpus BreachCorpus
+}
+
+func NewPasswordPolicy(db *gorm.DB) *PasswordPolicy {
+	policy := &PasswordPolicy{db: db}
+	if path := os.Getenv("PASSWORD_BREACH_CORPUS"); path != "" {
+		policy.corpus = NewFileBreachCorpus(path)
+	}
+	return policy
+}
+
+// Config returns the saved policy, or the default when none is saved.
+func (p *PasswordPolicy) Config() PasswordPolicyConfig {
+	config := DefaultPasswordPolicy
+
+	var setting models.System
+	if err := p.db.Where("setting = ?", PasswordPolicySetting).First(&setting).Error; err != nil {
+		return config
+	}
+	if err := json.Unmarshal([]byte(setting.Value), &config); err != nil {
+		return DefaultPasswordPolicy
+	}
+	return config
+}
+
+// SetConfig validates and saves the policy.
+func (p *PasswordPolicy) SetConfig(config PasswordPolicyConfig) error {
+	switch {
+	case config.MinLength < 6:
+		return errors.New("minimum length must be at least 6")
+	case config.MaxLength < config.MinLength || config.MaxLength > 72:
+		return errors.New("maximum length must be between the minimum length and 72")
+	case config.HistoryCount < 0 || config.HistoryCount > maxPasswordHistory:
+		return fmt.Errorf("history count must be between 0 and %d", maxPasswordHistory)
+	case config.MaxAgeDays < 0:
+		return errors.New("maximum age must not be negative")
+	}
+	if config.BreachThreshold < 1 {
+		config.BreachThreshold = 1
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var existing models.System
+	if err := p.db.Where("setting = ?", PasswordPolicySetting).First(&existing).Error; err == nil {
+		return p.db.Model(&existing).Update("value", string(value)).Error
+	}
+	return p.db.Create(&models.System{
+		Setting:     PasswordPolicySetting,
+		Value:       string(value),
+		Description: "Password policy for panel, email and database passwords",
+		Category:    "security",
+	}).Error
+}
+
+// BreachCheckAvailable reports whether a breached-password corpus is configured.
+func (p *PasswordPolicy) BreachCheckAvailable() bool {
+	return p.corpus != nil
+}
+
+// Validate checks a candidate password against the whole policy. It returns a
+// *PasswordPolicyError listing the violations, or another error when the
+// history or breach corpus cannot be read.
+func (p *PasswordPolicy) Validate(password string, subject PasswordSubject) error {
+	config := p.Config()
+	violations := config.Violations(password)
+
+	if config.DictionaryCheck {
+		if reason := dictionaryViolation(password, subject); reason != "" {
+			violations = append(violations, reason)
+		}
+	}
+
+	if config.HistoryCount > 0 && subject.OwnerID != 0 {
+		reused, err := p.reused(password, subject, config.HistoryCount)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, fmt.Sprintf("password must not match any of the last %d passwords", config.HistoryCount))
+		}
+	}
+
+	if config.BreachCheck && p.corpus != nil {
+		count, err := BreachCount(p.corpus, password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %v", err)
+		}
+		if count >= config.BreachThreshold {
+			violations = append(violations, "password has appeared in a data breach and must not be used")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Record stores the hash of a newly set password and trims the history to
+// what the policy compares against.
+func (p *PasswordPolicy) Record(subject PasswordSubject, hash string) error {
+	if subject.OwnerID == 0 {
+		return nil
+	}
+
+	if err := p.db.Create(&models.PasswordHistory{
+		OwnerKind: subject.Kind,
+		OwnerID:   subject.OwnerID,
+		Hash:      hash,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record password history: %v", err)
+	}
+
+	keep := p.Config().HistoryCount
+	var stale []uint
+	p.db.Model(&models.PasswordHistory{}).
+		Where("owner_kind = ? AND owner_id = ?", subject.Kind, subject.OwnerID).
+		Order("created_at DESC, id DESC").Offset(keep).Pluck("id", &stale)
+	if len(stale) > 0 {
+		p.db.Where("id IN ?", stale).Delete(&models.PasswordHistory{})
+	}
+	return nil
+}
+
+// PasswordExpired reports whether a panel user must change their password
+// before continuing. Users whose password lives in an LDAP directory are
+// exempt; the directory enforces its own age.
+func (p *PasswordPolicy) PasswordExpired(user *models.User) bool {
+	config := p.Config()
+	if config.MaxAgeDays <= 0 {
+		return false
+	}
+
+	changed := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changed = *user.PasswordChangedAt
+	}
+	if time.Since(changed) < time.Duration(config.MaxAgeDays)*24*time.Hour {
+		return false
+	}
+	return !directoryManaged(p.db, user.ID)
+}
+
+// PasswordExpiredFor is PasswordExpired for a user ID.
+func (p *PasswordPolicy) PasswordExpiredFor(userID uint) bool {
+	if p.Config().MaxAgeDays <= 0 {
+		return false
+	}
+
+	var user models.User
+	if err := p.db.First(&user, userID).Error; err != nil {
+		return false
+	}
+	return p.PasswordExpired(&user)
+}
+
+// DirectoryManaged reports whether the user signs in with an LDAP password
+// rather than the local one.
+func (p *PasswordPolicy) DirectoryManaged(userID uint) bool {
+	return directoryManaged(p.db, userID)
+}
+
+func (p *PasswordPolicy) reused(password string, subject PasswordSubject, count int) (bool, error) {
+	var history []models.PasswordHistory
+	if err := p.db.Where("owner_kind = ? AND owner_id = ?", subject.Kind, subject.OwnerID).
+		Order("created_at DESC, id DESC").Limit(count).Find(&history).Error; err != nil {
+		return false, fmt.Errorf("failed to load password history: %v", err)
+	}
+
+	for _, entry := range history {
+		if utils.CheckPasswordHash(password, entry.Hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// commonPasswords seeds the dictionary check; PASSWORD_DICTIONARY adds to it.
+var commonPasswords = []string{
+	"password", "passw0rd", "qwerty", "qwertyuiop", "asdfgh", "zxcvbn", "letmein",
+	"welcome", "admin", "administrator", "root", "login", "master", "secret",
+	"dragon", "monkey", "football", "baseball", "iloveyou", "sunshine", "princess",
+	"shadow", "superman", "trustno1", "abc123", "123456", "12345678", "changeme",
+	"default", "hosting", "cpanel", "webmail", "server", "database", "mysql",
+}
+
+var (
+	dictionaryOnce  sync.Once
+	dictionaryWords map[string]bool
+)
+
+func dictionary() map[string]bool {
+	dictionaryOnce.Do(func() {
+		dictionaryWords = make(map[string]bool)
+		for _, word := range commonPasswords {
+			dictionaryWords[word] = true
+		}
+
+		path := os.Getenv("PASSWORD_DICTIONARY")
+		if path == "" {
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if word := strings.ToLower(strings.TrimSpace(scanner.Text())); word != "" {
+				dictionaryWords[word] = true
+			}
+		}
+	})
+	return dictionaryWords
+}
+
+// dictionaryViolation rejects dictionary words, including the common pattern
+// of a word followed by digits and symbols ("Password1!"), and passwords
+// built around the account's own name.
+func dictionaryViolation(password string, subject PasswordSubject) string {
+	lower := strings.ToLower(password)
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+	base = strings.TrimLeftFunc(base, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+
+	words := dictionary()
+	if words[lower] || words[base] {
+		return "password is a common word or password"
+	}
+
+	names := []string{strings.ToLower(subject.Username)}
+	if local, _, ok := strings.Cut(strings.ToLower(subject.Email), "@"); ok {
+		names = append(names, local)
+	}
+	for _, name := range names {
+		if len(name) >= 3 && strings.Contains(lower, name) {
+			return "password must not contain the account name"
+		}
+	}
+	return ""
+}
+
+// BreachCount returns how often a password appears in the corpus. Only the
+// first five characters of its SHA-1 hash are used to query the corpus, so
+// a remote implementation never learns the password.
+func BreachCount(corpus BreachCorpus, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := corpus.Range(hash[:5])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[hash[5:]], nil
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	// maxPasswordResetsPerHour stops the reset form from being used to flood
+	// someone's inbox.
+	maxPasswordResetsPerHour = 3
+)
+
+var (
+	ErrInvalidResetToken = errors.New("password reset link is invalid or has expired")
+	ErrResetRateLimited  = errors.New("too many password resets requested")
+	ErrResetNotPermitted = errors.New("password of this account cannot be reset")
+)
+
+// PasswordResetManager issues and redeems password reset tokens. A token is
+// 32 random bytes of which only the hash is stored; it expires after
+// PASSWORD_RESET_TTL, works once, and stops working when the password is
+// changed by any other means.
+type PasswordResetManager struct {
+	db        *gorm.DB
+	passwords *PasswordPolicy
+	ttl       time.Duration
+}
+
+func NewPasswordResetManager(db *gorm.DB) *PasswordResetManager {
+	ttl, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = defaultPasswordResetTTL
+	}
+	return &PasswordResetManager{
+		db:        db,
+		passwords: NewPasswordPolicy(db),
+		ttl:       ttl,
+	}
+}
+
+// TTL is how long an issued token stays valid.
+func (m *PasswordResetManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// Issue creates a reset token for the user, replacing any still outstanding.
+// Accounts that are not active or whose password lives in a directory get
+// ErrResetNotPermitted.
+func (m *PasswordResetManager) Issue(user *models.User, clientIP string) (string, error) {
+	if user.Status != "active" || m.passwords.DirectoryManaged(user.ID) {
+		return "", ErrResetNotPermitted
+	}
+
+	var recent int64
+	if err := m.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		return "", fmt.Errorf("failed to count password resets: %v", err)
+	}
+	if recent >= maxPasswordResetsPerHour {
+		return "", ErrResetRateLimited
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %v", err)
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := m.invalidate(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashSecret(token),
+			RequestIP: clientIP,
+			ExpiresAt: time.Now().Add(m.ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store reset token: %v", err)
+	}
+	return token, nil
+}
+
+// Lookup returns the user a token resets without using it up, so the new
+// password can be checked against the policy first.
+func (m *PasswordResetManager) Lookup(token string) (*models.User, error) {
+	var reset models.PasswordResetToken
+	if err := m.db.Where("token_hash = ?", hashSecret(token)).First(&reset).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	return m.validate(m.db, &reset)
+}
+
+// Redeem uses up the token and calls apply to set the new password, both in
+// one transaction so that a token can only ever set one password. The user's
+// trusted devices are revoked with it, so the next sign-in asks for a
+// one-time code again.
+func (m *PasswordResetManager) Redeem(token string, apply func(tx *gorm.DB, user *models.User) error) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashSecret(token)).First(&reset).Error; err != nil {
+			return ErrInvalidResetToken
+		}
+
+		user, err := m.validate(tx, &reset)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&reset).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := apply(tx, user); err != nil {
+			return err
+		}
+		// Whoever held the old password may also hold a trusted device
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TrustedDevice{}).Error; err != nil {
+			return err
+		}
+		return m.invalidate(tx, user.ID)
+	})
+}
+
+// Invalidate voids the user's outstanding tokens, as when the password is
+// changed.
+func (m *PasswordResetManager) Invalidate(userID uint) error {
+	if err := m.invalidate(m.db, userID); err != nil {
+		return fmt.Errorf("failed to invalidate reset tokens: %v", err)
+	}
+	return nil
+}
+
+// StartCleanup deletes tokens a day after they expire; they are kept that
+// long for the per-hour request limit and for investigating abuse.
+func (m *PasswordResetManager) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !cluster.Leader(m.db, "password-reset-cleanup", 2*interval) {
+			continue
+		}
+		m.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.PasswordResetToken{})
+	}
+}
+
+func (m *PasswordResetManager) validate(tx *gorm.DB, reset *models.PasswordResetToken) (*models.User, error) {
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return nil, ErrInvalidResetToken
+	}
+
+	var user models.User
+	if err := tx.First(&user, reset.UserID).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	if user.Status != "active" {
+		return nil, ErrInvalidResetToken
+	}
+	// Changing the password by any other means voids the link
+	if user.PasswordChangedAt != nil && user.PasswordChangedAt.After(reset.CreatedAt) {
+		return nil, ErrInvalidResetToken
+	}
+	return &user, nil
+}
+
+func (m *PasswordResetManager) invalidate(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
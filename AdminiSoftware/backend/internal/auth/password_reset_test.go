@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPasswordReset(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.PasswordResetToken{}, &models.TrustedDevice{},
+		&models.LDAPDirectory{}, &models.LDAPIdentity{}, &models.System{})
+
+	name := testutil.UniqueName("reset")
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: "active"}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{})
+		db.Where("user_id = ?", user.ID).Delete(&models.TrustedDevice{})
+		db.Unscoped().Delete(user)
+	}()
+
+	resets := NewPasswordResetManager(db)
+	twoFactor := NewTwoFactorManager(db)
+	if twoFactor.TrustDays() > 0 {
+		_, _, err := twoFactor.TrustDevice(user.ID, "laptop", "192.0.2.1")
+		require.NoError(t, err)
+	}
+
+	first, err := resets.Issue(user, "192.0.2.1")
+	require.NoError(t, err)
+	second, err := resets.Issue(user, "192.0.2.1")
+	require.NoError(t, err)
+
+	// Issuing a token voids the one before it
+	_, err = resets.Lookup(first)
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+	found, err := resets.Lookup(second)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	setPassword := func(tx *gorm.DB, user *models.User) error {
+		return tx.Model(user).Update("password_changed_at", time.Now()).Error
+	}
+	require.NoError(t, resets.Redeem(second, setPassword))
+	assert.ErrorIs(t, resets.Redeem(second, setPassword), ErrInvalidResetToken, "a token works once")
+
+	var devices int64
+	db.Model(&models.TrustedDevice{}).Where("user_id = ?", user.ID).Count(&devices)
+	assert.Zero(t, devices, "a reset forgets the trusted devices")
+
+	// The per-hour limit counts every token issued
+	_, err = resets.Issue(user, "192.0.2.1")
+	require.NoError(t, err)
+	_, err = resets.Issue(user, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrResetRateLimited)
+
+	db.Model(user).Update("status", "suspended")
+	user.Status = "suspended"
+	_, err = resets.Issue(user, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrResetNotPermitted)
+}
+
+func TestTwoFactorDisableAudited(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.TwoFactorBackupCode{}, &models.TrustedDevice{}, &models.AuditLog{})
+
+	name := testutil.UniqueName("twofactor")
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: "active",
+		TwoFactorEnabled: true, TwoFactorSecret: "secret"}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("subject_id = ?", user.ID).Delete(&models.AuditLog{})
+		db.Unscoped().Delete(user)
+	}()
+
+	require.NoError(t, NewTwoFactorManager(db).DisableAudited(user.ID, &models.AuditLog{
+		ActorID:   1,
+		SubjectID: user.ID,
+		Action:    "two_factor_reset",
+	}))
+
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, user.ID).Error)
+	assert.False(t, reloaded.TwoFactorEnabled)
+	assert.Empty(t, reloaded.TwoFactorSecret)
+
+	var audited int64
+	db.Model(&models.AuditLog{}).Where("subject_id = ? AND action = ?", user.ID, "two_factor_reset").Count(&audited)
+	assert.Equal(t, int64(1), audited)
+}
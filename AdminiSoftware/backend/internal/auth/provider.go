@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned by a provider that does not know the
+// login or rejected the password, so the next provider can be tried.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// AuthProvider checks a username and password and returns the local user
+// they belong to.
+type AuthProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, login, password string) (*models.User, error)
+}
+
+// Authenticator tries its providers in order and returns the first match.
+type Authenticator struct {
+	providers []AuthProvider
+}
+
+func NewAuthenticator(providers ...AuthProvider) *Authenticator {
+	return &Authenticator{providers: providers}
+}
+
+// Authenticate returns the user and the name of the provider that accepted
+// the password. When every provider rejects the login the error is
+// ErrInvalidCredentials, wrapped with the first provider failure (such as an
+// unreachable directory) for logging.
+func (a *Authenticator) Authenticate(ctx context.Context, login, password string) (*models.User, string, error) {
+	var failure error
+	for _, provider := range a.providers {
+		user, err := provider.Authenticate(ctx, login, password)
+		if err == nil {
+			return user, provider.Name(), nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) && failure == nil {
+			failure = fmt.Errorf("%s: %v", provider.Name(), err)
+		}
+	}
+
+	if failure != nil {
+		return nil, "", fmt.Errorf("%w (%v)", ErrInvalidCredentials, failure)
+	}
+	return nil, "", ErrInvalidCredentials
+}
+
+// LocalProvider checks the password hash stored with the user. Accounts
+// linked to an enabled directory are left to that directory so a stale local
+// password cannot outlive the directory account.
+type LocalProvider struct {
+	db *gorm.DB
+}
+
+func NewLocalProvider(db *gorm.DB) *LocalProvider {
+	return &LocalProvider{db: db}
+}
+
+func (p *LocalProvider) Name() string {
+	return "local"
+}
+
+func (p *LocalProvider) Authenticate(ctx context.Context, login, password string) (*models.User, error) {
+	var user models.User
+	if err := p.db.Where("username = ? OR email = ?", login, login).First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if directoryManaged(p.db, user.ID) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// directoryManaged reports whether the user is linked to an enabled LDAP
+// directory, which then owns their password.
+func directoryManaged(db *gorm.DB, userID uint) bool {
+	var linked int64
+	db.Model(&models.LDAPIdentity{}).
+		Joins("JOIN ldap_directories ON ldap_directories.id = ldap_identities.directory_id").
+		Where("ldap_identities.user_id = ? AND ldap_directories.enabled = ? AND ldap_directories.deleted_at IS NULL", userID, true).
+		Count(&linked)
+	return linked > 0
+}
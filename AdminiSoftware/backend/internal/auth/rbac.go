@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Permission names one API action as "<resource>:<action>". Grants may use
+// "*" for everything or "<resource>:*" for every action on a resource.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions is the catalog every route declares its requirement from.
+var Permissions = []Permission{
+	{"profile:manage", "Manage own profile, password, two-factor, sessions and API tokens"},
+	{"accounts:read", "View hosting accounts"},
+	{"accounts:create", "Create hosting accounts"},
+	{"accounts:update", "Modify hosting accounts"},
+	{"accounts:delete", "Delete hosting accounts"},
+	{"accounts:export", "Export account archives"},
+	{"accounts:import", "Import account archives"},
+	{"accounts:impersonate", "Sign in as a customer for support"},
+	{"accounts:provision", "Provision accounts from a billing system through the provisioning API"},
+	{"packages:read", "View hosting packages"},
+	{"packages:write", "Create, modify and delete hosting packages"},
+	{"resellers:manage", "Set reseller resource allocations and view their usage"},
+	{"system:read", "View server statistics and services"},
+	{"system:services", "Restart server services"},
+	{"sessions:manage", "View and revoke other users' sessions and API tokens"},
+	{"security:manage", "Change security policies"},
+	{"sso:manage", "Manage single sign-on providers and LDAP directories"},
+	{"roles:manage", "Manage roles and role assignments"},
+	{"branding:manage", "Manage branding and customer email templates"},
+	{"billing:read", "View metered usage and billing statements"},
+	{"billing:manage", "Generate statements and export them to accounting"},
+	{"audit:read", "View the audit log of impersonations and account security actions"},
+	{"domains:read", "View domains"},
+	{"domains:write", "Add, modify and remove domains"},
+	{"dns:read", "View DNS zones"},
+	{"dns:write", "Modify DNS zones"},
+	{"dns:manage", "Manage every DNS zone on the server"},
+	{"files:read", "Browse files"},
+	{"files:write", "Upload and delete files"},
+	{"emails:read", "View email accounts"},
+	{"emails:write", "Manage email accounts"},
+	{"databases:read", "View databases"},
+	{"databases:write", "Manage databases"},
+	{"applications:read", "View installed applications"},
+	{"applications:write", "Install, update and remove applications"},
+	{"ssl:read", "View SSL certificates"},
+	{"ssl:write", "Install and remove SSL certificates"},
+	{"ssl:manage", "Manage every SSL certificate on the server"},
+	{"backups:read", "View backups and their progress"},
+	{"backups:write", "Create, cancel and delete backups"},
+	{"backups:restore", "Restore backups"},
+	{"stats:read", "View usage statistics"},
+}
+
+// userPermissions is what every account holds over its own hosting. DNS and
+// SSL are listed action by action: their manage permissions cover every
+// account's zones and certificates.
+var userPermissions = []string{
+	"profile:manage",
+	"domains:*", "dns:read", "dns:write", "files:*", "emails:*", "databases:*",
+	"applications:*", "ssl:read", "ssl:write", "backups:*", "stats:read",
+}
+
+// resellerPermissions is what a reseller holds over its customers' accounts.
+var resellerPermissions = []string{
+	"accounts:read", "accounts:create", "accounts:update", "accounts:delete",
+	"accounts:impersonate", "accounts:provision", "packages:*", "sso:manage", "roles:manage",
+	"branding:manage", "billing:read",
+}
+
+// Grants are the effective permissions of a user. Global permissions apply
+// everywhere; scoped ones only to the accounts of the keyed reseller.
+type Grants struct {
+	Global []string
+	Scoped map[uint][]string
+}
+
+// Allows reports whether the permission is granted without restriction.
+func (g *Grants) Allows(permission string) bool {
+	return HasPermission(g.Global, permission)
+}
+
+// ResellerScopes returns the resellers whose accounts the permission is
+// granted over, in ascending order.
+func (g *Grants) ResellerScopes(permission string) []uint {
+	var ids []uint
+	for resellerID, permissions := range g.Scoped {
+		if HasPermission(permissions, permission) {
+			ids = append(ids, resellerID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// All returns every permission held, global or scoped, without duplicates.
+func (g *Grants) All() []string {
+	seen := make(map[string]bool)
+	var all []string
+	add := func(permissions []string) {
+		for _, p := range permissions {
+			if !seen[p] {
+				seen[p] = true
+				all = append(all, p)
+			}
+		}
+	}
+	add(g.Global)
+	for _, permissions := range g.Scoped {
+		add(permissions)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// PermissionResolver computes grants from a user's built-in role and the
+// custom roles assigned to them.
+type PermissionResolver struct {
+	db *gorm.DB
+}
+
+func NewPermissionResolver(db *gorm.DB) *PermissionResolver {
+	return &PermissionResolver{db: db}
+}
+
+func (r *PermissionResolver) Resolve(userID uint, role string) (*Grants, error) {
+	grants := &Grants{Scoped: make(map[uint][]string)}
+
+	switch role {
+	case "admin":
+		grants.Global = []string{"*"}
+	case "reseller":
+		grants.Global = append(grants.Global, userPermissions...)
+		grants.Scoped[userID] = append(grants.Scoped[userID], resellerPermissions...)
+	default:
+		grants.Global = append(grants.Global, userPermissions...)
+	}
+
+	var assignments []models.RoleAssignment
+	if err := r.db.Preload("Role").Where("user_id = ?", userID).Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load role assignments: %v", err)
+	}
+
+	for _, assignment := range assignments {
+		if assignment.Role == nil {
+			continue
+		}
+		permissions := RolePermissions(assignment.Role)
+		if assignment.ResellerID == nil {
+			grants.Global = append(grants.Global, permissions...)
+		} else {
+			grants.Scoped[*assignment.ResellerID] = append(grants.Scoped[*assignment.ResellerID], permissions...)
+		}
+	}
+
+	return grants, nil
+}
+
+// BuiltInPermissions lists the permissions of a built-in role for display.
+func BuiltInPermissions(role string) []string {
+	switch role {
+	case "admin":
+		return []string{"*"}
+	case "reseller":
+		return append(append([]string{}, userPermissions...), resellerPermissions...)
+	default:
+		return append([]string{}, userPermissions...)
+	}
+}
+
+// RolePermissions splits the stored permission list of a role.
+func RolePermissions(role *models.Role) []string {
+	var permissions []string
+	for _, p := range strings.Split(role.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// ValidatePermission accepts catalog names, "*" and "<resource>:*" wildcards.
+func ValidatePermission(permission string) error {
+	if permission == "*" {
+		return nil
+	}
+
+	resource, action, ok := strings.Cut(permission, ":")
+	if !ok {
+		return fmt.Errorf("invalid permission %q", permission)
+	}
+	for _, p := range Permissions {
+		if p.Name == permission || (action == "*" && strings.HasPrefix(p.Name, resource+":")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown permission %q", permission)
+}
+
+// HasPermission reports whether the granted list covers the permission.
+func HasPermission(granted []string, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, g := range granted {
+		if g == "*" || g == permission || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversAll reports whether every permission in requested is covered by granted,
+// used to stop resellers handing out more than they hold.
+func CoversAll(granted, requested []string) bool {
+	for _, p := range requested {
+		if p == "*" {
+			if !HasPermission(granted, "*") {
+				return false
+			}
+			continue
+		}
+
+		resource, action, _ := strings.Cut(p, ":")
+		if action != "*" {
+			if !HasPermission(granted, p) {
+				return false
+			}
+			continue
+		}
+		for _, known := range Permissions {
+			if strings.HasPrefix(known.Name, resource+":") && !HasPermission(granted, known.Name) {
+				return false
+			}
+		}
+	}
+	return true
+}
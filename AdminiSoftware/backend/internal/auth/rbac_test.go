@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltInPermissions(t *testing.T) {
+	user := BuiltInPermissions("user")
+	assert.True(t, HasPermission(user, "dns:write"))
+	assert.True(t, HasPermission(user, "ssl:read"))
+	assert.False(t, HasPermission(user, "dns:manage"), "users only manage their own zones")
+	assert.False(t, HasPermission(user, "ssl:manage"), "users only manage their own certificates")
+	assert.False(t, HasPermission(user, "accounts:read"))
+
+	reseller := BuiltInPermissions("reseller")
+	assert.True(t, HasPermission(reseller, "accounts:create"))
+	assert.False(t, HasPermission(reseller, "dns:manage"))
+	assert.False(t, HasPermission(reseller, "accounts:export"))
+
+	admin := BuiltInPermissions("admin")
+	assert.True(t, HasPermission(admin, "dns:manage"))
+	assert.True(t, HasPermission(admin, "ssl:manage"))
+}
+
+func TestHasPermissionWildcards(t *testing.T) {
+	assert.True(t, HasPermission([]string{"dns:*"}, "dns:manage"))
+	assert.True(t, HasPermission([]string{"*"}, "roles:manage"))
+	assert.False(t, HasPermission([]string{"dns:*"}, "domains:read"))
+	assert.False(t, HasPermission(nil, "dns:read"))
+}
+
+func TestCoversAll(t *testing.T) {
+	user := BuiltInPermissions("user")
+	assert.True(t, CoversAll(user, []string{"dns:read", "files:*"}))
+	assert.False(t, CoversAll(user, []string{"dns:*"}), "dns:* includes dns:manage")
+	assert.False(t, CoversAll(user, []string{"*"}))
+	assert.True(t, CoversAll([]string{"*"}, []string{"*", "accounts:delete"}))
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenDuration  = 15 * time.Minute
+	RefreshTokenDuration = 7 * 24 * time.Hour
+)
+
+// Authentication method references (RFC 8176) recorded on sessions and
+// carried in the amr claim of access tokens.
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+	AuthMethodWebAuthn = "hwk"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrSessionExpired     = errors.New("session has expired")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// SessionManager keeps the server-side registry of login sessions. Refresh
+// tokens have the form "<session public id>.<secret>" and only a hash of the
+// current secret is stored.
+type SessionManager struct {
+	db *gorm.DB
+}
+
+func NewSessionManager(db *gorm.DB) *SessionManager {
+	return &SessionManager{db: db}
+}
+
+// Create opens a session and returns it together with its first refresh token.
+func (m *SessionManager) Create(userID uint, ip, userAgent, device string, authMethods []string) (*models.Session, string, error) {
+	publicID, err := randomHex(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if device == "" {
+		device = describeDevice(userAgent)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		PublicID:         publicID,
+		UserID:           userID,
+		RefreshTokenHash: hashSecret(secret),
+		Device:           device,
+		IP:               ip,
+		UserAgent:        userAgent,
+		AuthMethods:      strings.Join(authMethods, ","),
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenDuration),
+	}
+	if err := m.db.Create(session).Error; err != nil {
+		return nil, "", err
+	}
+
+	return session, publicID + "." + secret, nil
+}
+
+// Rotate exchanges a refresh token for a new one. Presenting a token that has
+// already been rotated revokes the whole session, since either the client or
+// an attacker is holding a stolen copy.
+func (m *SessionManager) Rotate(refreshToken, ip, userAgent string) (*models.Session, string, error) {
+	publicID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || publicID == "" || secret == "" {
+		return nil, "", ErrSessionNotFound
+	}
+
+	var session models.Session
+	if err := m.db.Where("public_id = ?", publicID).First(&session).Error; err != nil {
+		return nil, "", ErrSessionNotFound
+	}
+
+	if session.RevokedAt != nil {
+		return nil, "", ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		m.revoke(m.db.Where("id = ?", session.ID), "expired")
+		return nil, "", ErrSessionExpired
+	}
+
+	presented := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshTokenHash)) != 1 {
+		m.revoke(m.db.Where("id = ?", session.ID), "refresh_token_reuse")
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	next, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The hash condition makes concurrent refreshes with the same token lose
+	// the race instead of both succeeding.
+	now := time.Now()
+	result := m.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, presented).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": hashSecret(next),
+			"ip":                 ip,
+			"user_agent":         userAgent,
+			"last_used_at":       now,
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		m.revoke(m.db.Where("id = ?", session.ID), "refresh_token_reuse")
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	session.IP = ip
+	session.UserAgent = userAgent
+	session.LastUsedAt = now
+	return &session, publicID + "." + next, nil
+}
+
+// IsActive reports whether access tokens carrying this session ID may be used.
+func (m *SessionManager) IsActive(publicID string) bool {
+	if publicID == "" {
+		return false
+	}
+
+	var count int64
+	m.db.Model(&models.Session{}).
+		Where("public_id = ? AND revoked_at IS NULL AND expires_at > ?", publicID, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// Get returns the session with the given public ID.
+func (m *SessionManager) Get(publicID string) (*models.Session, error) {
+	var session models.Session
+	if err := m.db.Where("public_id = ?", publicID).First(&session).Error; err != nil {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+// List returns the active sessions of a user, or of every user when userID is 0.
+func (m *SessionManager) List(userID uint) ([]models.Session, error) {
+	query := m.db.Preload("User").Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var sessions []models.Session
+	if err := query.Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke ends a single session. A non-zero userID restricts it to that user's sessions.
+func (m *SessionManager) Revoke(sessionID, userID uint, reason string) error {
+	query := m.db.Where("id = ?", sessionID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	affected, err := m.revoke(query, reason)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeByPublicID ends the session an access token belongs to.
+func (m *SessionManager) RevokeByPublicID(publicID, reason string) error {
+	_, err := m.revoke(m.db.Where("public_id = ?", publicID), reason)
+	return err
+}
+
+// RevokeAll ends every session of a user except the one with exceptPublicID.
+func (m *SessionManager) RevokeAll(userID uint, exceptPublicID, reason string) (int64, error) {
+	query := m.db.Where("user_id = ?", userID)
+	if exceptPublicID != "" {
+		query = query.Where("public_id <> ?", exceptPublicID)
+	}
+	return m.revoke(query, reason)
+}
+
+func (m *SessionManager) revoke(query *gorm.DB, reason string) (int64, error) {
+	result := query.Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// SessionAuthMethods returns the methods the user authenticated the session with.
+func SessionAuthMethods(session *models.Session) []string {
+	if session.AuthMethods == "" {
+		return nil
+	}
+	return strings.Split(session.AuthMethods, ",")
+}
+
+// IsPhishingResistant reports whether the methods include a WebAuthn assertion.
+func IsPhishingResistant(authMethods []string) bool {
+	for _, method := range authMethods {
+		if method == AuthMethodWebAuthn {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// describeDevice turns a User-Agent into a short label such as "Firefox on Linux".
+func describeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := "Unknown client"
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return browser + " on " + s.name
+		}
+	}
+	return browser
+}
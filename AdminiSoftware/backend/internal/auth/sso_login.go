@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuthMethodSSOLink marks sessions opened with a login link from a billing
+// system.
+const AuthMethodSSOLink = "sso"
+
+const defaultSSOLoginTTL = 2 * time.Minute
+
+var (
+	ErrInvalidSSOToken = errors.New("login link is invalid or has expired")
+	ErrSSOLoginMFA     = errors.New("login links are not available for accounts that use two-factor authentication")
+)
+
+// SSOLoginManager issues the one-time links billing systems use to sign a
+// customer into the panel. The client area asks for a link and sends the
+// browser to it at once, so links expire after SSO_LOGIN_TTL, two minutes
+// by default. A link stands in for the password alone, so accounts with a
+// second factor, or whose role must sign in with a security key, cannot use
+// one.
+type SSOLoginManager struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewSSOLoginManager(db *gorm.DB) *SSOLoginManager {
+	ttl, err := time.ParseDuration(os.Getenv("SSO_LOGIN_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = defaultSSOLoginTTL
+	}
+	return &SSOLoginManager{db: db, ttl: ttl}
+}
+
+// TTL is how long an issued link stays valid.
+func (m *SSOLoginManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// Issue creates a login token for an active account without a second
+// factor.
+func (m *SSOLoginManager) Issue(user *models.User, issuedBy uint, clientIP string) (string, error) {
+	if user.Status != "active" {
+		return "", ErrAPITokenUserState
+	}
+	if m.usesMFA(m.db, user) {
+		return "", ErrSSOLoginMFA
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login token: %v", err)
+	}
+	if err := m.db.Create(&models.SSOLoginToken{
+		UserID:    user.ID,
+		TokenHash: hashSecret(token),
+		IssuedBy:  issuedBy,
+		RequestIP: clientIP,
+		ExpiresAt: time.Now().Add(m.ttl),
+	}).Error; err != nil {
+		return "", fmt.Errorf("failed to store login token: %v", err)
+	}
+	return token, nil
+}
+
+// Redeem uses up the token and returns the account it signs in. A factor
+// enrolled after the link was issued still refuses it.
+func (m *SSOLoginManager) Redeem(token string) (*models.User, error) {
+	var user models.User
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var login models.SSOLoginToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashSecret(token)).First(&login).Error; err != nil {
+			return ErrInvalidSSOToken
+		}
+		if login.UsedAt != nil || time.Now().After(login.ExpiresAt) {
+			return ErrInvalidSSOToken
+		}
+		if err := tx.Model(&login).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&user, login.UserID).Error; err != nil || user.Status != "active" {
+			return ErrInvalidSSOToken
+		}
+		if m.usesMFA(tx, &user) {
+			return ErrSSOLoginMFA
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// usesMFA reports whether the user signs in with a second factor or must
+// enrol a security key.
+func (m *SSOLoginManager) usesMFA(db *gorm.DB, user *models.User) bool {
+	if user.TwoFactorEnabled || NewMFAPolicy(db).RequiredFor(user.Role) {
+		return true
+	}
+	var keys int64
+	db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&keys)
+	return keys > 0
+}
+
+// StartCleanup deletes tokens a day after they expire.
+func (m *SSOLoginManager) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !cluster.Leader(m.db, "sso-login-cleanup", 2*interval) {
+			continue
+		}
+		m.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.SSOLoginToken{})
+	}
+}
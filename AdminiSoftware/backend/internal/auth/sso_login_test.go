@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"testing"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSOLoginRefusesMFA(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.SSOLoginToken{}, &models.WebAuthnCredential{}, &models.System{})
+
+	name := testutil.UniqueName("sso")
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: "active"}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.SSOLoginToken{})
+		db.Where("user_id = ?", user.ID).Delete(&models.WebAuthnCredential{})
+		db.Unscoped().Delete(user)
+	}()
+
+	logins := NewSSOLoginManager(db)
+	token, err := logins.Issue(user, 1, "192.0.2.1")
+	require.NoError(t, err)
+	pending, err := logins.Issue(user, 1, "192.0.2.1")
+	require.NoError(t, err)
+
+	signedIn, err := logins.Redeem(token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+	_, err = logins.Redeem(token)
+	assert.ErrorIs(t, err, ErrInvalidSSOToken, "a link works once")
+
+	// A security key enrolled after the link was issued refuses it
+	require.NoError(t, db.Create(&models.WebAuthnCredential{UserID: user.ID, Name: "key", CredentialID: name}).Error)
+	_, err = logins.Redeem(pending)
+	assert.ErrorIs(t, err, ErrSSOLoginMFA)
+	_, err = logins.Issue(user, 1, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrSSOLoginMFA)
+
+	db.Where("user_id = ?", user.ID).Delete(&models.WebAuthnCredential{})
+	user.TwoFactorEnabled = true
+	_, err = logins.Issue(user, 1, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrSSOLoginMFA)
+}
@@ -90,18 +90,71 @@ func (tfa *TwoFactorAuth) GenerateBackupCodes() []string {
 package auth
 
 import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// AuthMethodTrustedDevice stands in for the one-time code on a device the
+// user trusted after entering one.
+const AuthMethodTrustedDevice = "dev"
+
+const (
+	totpPeriod = 30
+	// totpSkew is how many time-steps either side of now are accepted, for
+	// clock drift
+	totpSkew        = 1
+	backupCodeCount = 10
+
+	// TrustedDeviceCookie holds the signed trusted-device token.
+	TrustedDeviceCookie      = "trusted_device"
+	trustedDeviceKeySetting  = "security.trusted_device_key"
+	defaultTrustedDeviceDays = 30
+)
+
+var (
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
 )
 
-type TwoFactorManager struct{}
+// TwoFactorManager handles TOTP second factors. An accepted code's time-step
+// is recorded so it cannot be replayed, backup codes are stored hashed and
+// work once, and users may trust a device for TRUSTED_DEVICE_DAYS (0 turns
+// this off) so it is not asked for a code.
+type TwoFactorManager struct {
+	db        *gorm.DB
+	trustDays int
 
-func NewTwoFactorManager() *TwoFactorManager {
-	return &TwoFactorManager{}
+	keyMutex sync.Mutex
+	key      []byte
+}
+
+func NewTwoFactorManager(db *gorm.DB) *TwoFactorManager {
+	trustDays := defaultTrustedDeviceDays
+	if value, set := os.LookupEnv("TRUSTED_DEVICE_DAYS"); set {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			trustDays = days
+		}
+	}
+	return &TwoFactorManager{db: db, trustDays: trustDays}
 }
 
 func (tf *TwoFactorManager) GenerateSecret(username string) (string, string, error) {
@@ -117,28 +170,341 @@ func (tf *TwoFactorManager) GenerateSecret(username string) (string, string, err
 	return key.Secret(), key.URL(), nil
 }
 
-func (tf *TwoFactorManager) ValidateCode(secret, code string) bool {
-	return totp.Validate(code, secret)
+// Begin stores a new secret for the user, who confirms it with Confirm
+// before it is required at sign-in.
+func (tf *TwoFactorManager) Begin(user *models.User) (string, string, error) {
+	if user.TwoFactorEnabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	secret, url, err := tf.GenerateSecret(user.Username)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+	if err := tf.db.Model(user).Updates(map[string]interface{}{
+		"two_factor_secret": secret,
+		"totp_last_step":    0,
+	}).Error; err != nil {
+		return "", "", fmt.Errorf("failed to store TOTP secret: %v", err)
+	}
+	return secret, url, nil
 }
 
-func (tf *TwoFactorManager) GenerateBackupCodes() ([]string, error) {
-	codes := make([]string, 10)
-	for i := 0; i < 10; i++ {
+// Confirm enables two-factor authentication once the user proves the
+// authenticator app works, and returns the first backup codes.
+func (tf *TwoFactorManager) Confirm(user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if !tf.VerifyTOTP(user, code) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	if err := tf.db.Model(user).Update("two_factor_enabled", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+	return tf.ReplaceBackupCodes(user.ID)
+}
+
+// Verify accepts a TOTP code or, failing that, an unused backup code.
+func (tf *TwoFactorManager) Verify(user *models.User, code string) bool {
+	if !user.TwoFactorEnabled {
+		return false
+	}
+	return tf.VerifyTOTP(user, code) || tf.VerifyBackupCode(user.ID, code)
+}
+
+// VerifyTOTP accepts a code only for a time-step later than the last one
+// accepted, so a code cannot be used twice, even by concurrent requests.
+func (tf *TwoFactorManager) VerifyTOTP(user *models.User, code string) bool {
+	step, ok := matchTOTPStep(user.TwoFactorSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false
+	}
+
+	result := tf.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// matchTOTPStep returns the time-step the code is valid for.
+func matchTOTPStep(secret, code string, now time.Time) (int64, bool) {
+	if secret == "" || len(code) != 6 {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		step := current + int64(offset)
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ReplaceBackupCodes issues a new set of backup codes, voiding the old ones.
+// The codes are only ever returned here.
+func (tf *TwoFactorManager) ReplaceBackupCodes(userID uint) ([]string, error) {
+	codes := make([]string, backupCodeCount)
+	records := make([]models.TwoFactorBackupCode, backupCodeCount)
+	for i := range codes {
 		code, err := tf.generateRandomCode()
 		if err != nil {
 			return nil, err
 		}
-		codes[i] = code
+		hash, err := utils.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = models.TwoFactorBackupCode{UserID: userID, CodeHash: hash}
+	}
+
+	err := tf.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorBackupCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store backup codes: %v", err)
 	}
 	return codes, nil
 }
 
+// VerifyBackupCode uses up a matching backup code. Dashes, spaces and case
+// are ignored.
+func (tf *TwoFactorManager) VerifyBackupCode(userID uint, code string) bool {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	// A TOTP code is never a backup code; skip the bcrypt comparisons
+	if len(code) != 10 {
+		return false
+	}
+
+	var unused []models.TwoFactorBackupCode
+	if err := tf.db.Where("user_id = ? AND used_at IS NULL", userID).Find(&unused).Error; err != nil {
+		return false
+	}
+	for _, backupCode := range unused {
+		if !utils.CheckPasswordHash(code, backupCode.CodeHash) {
+			continue
+		}
+		result := tf.db.Model(&models.TwoFactorBackupCode{}).
+			Where("id = ? AND used_at IS NULL", backupCode.ID).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return false
+}
+
+// RemainingBackupCodes counts the user's unused backup codes.
+func (tf *TwoFactorManager) RemainingBackupCodes(userID uint) int64 {
+	var count int64
+	tf.db.Model(&models.TwoFactorBackupCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// Disable turns two-factor authentication off and forgets the secret, the
+// backup codes and the trusted devices.
+func (tf *TwoFactorManager) Disable(userID uint) error {
+	return tf.disable(userID, nil)
+}
+
+// DisableAudited disables two-factor authentication for someone else and
+// writes the audit entry in the same transaction, so a reset is never left
+// unrecorded.
+func (tf *TwoFactorManager) DisableAudited(userID uint, entry *models.AuditLog) error {
+	return tf.disable(userID, entry)
+}
+
+func (tf *TwoFactorManager) disable(userID uint, entry *models.AuditLog) error {
+	err := tf.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_enabled": false,
+			"two_factor_secret":  "",
+			"totp_last_step":     0,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorBackupCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TrustedDevice{}).Error; err != nil {
+			return err
+		}
+		if entry != nil {
+			return tx.Create(entry).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %v", err)
+	}
+	return nil
+}
+
+// TrustDays is how long a trusted device skips the one-time code, 0 when
+// devices cannot be trusted.
+func (tf *TwoFactorManager) TrustDays() int {
+	return tf.trustDays
+}
+
+// TrustDevice remembers the device the user just signed in on and returns
+// the cookie value that identifies it.
+func (tf *TwoFactorManager) TrustDevice(userID uint, name, clientIP string) (string, time.Time, error) {
+	if tf.trustDays == 0 {
+		return "", time.Time{}, errors.New("trusted devices are disabled")
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(name) > 500 {
+		name = name[:500]
+	}
+
+	device := models.TrustedDevice{
+		UserID:     userID,
+		SecretHash: hashSecret(secret),
+		Name:       name,
+		IP:         clientIP,
+		ExpiresAt:  time.Now().AddDate(0, 0, tf.trustDays),
+	}
+	if err := tf.db.Create(&device).Error; err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to trust device: %v", err)
+	}
+
+	payload := strconv.FormatUint(uint64(device.ID), 10) + "." + secret
+	signature, err := tf.sign(payload)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return payload + "." + signature, device.ExpiresAt, nil
+}
+
+// IsTrustedDevice reports whether the cookie names an unexpired device the
+// user trusted.
+func (tf *TwoFactorManager) IsTrustedDevice(userID uint, cookie string) bool {
+	if tf.trustDays == 0 || cookie == "" {
+		return false
+	}
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	// A forged or tampered cookie is rejected without a database lookup
+	expected, err := tf.sign(parts[0] + "." + parts[1])
+	if err != nil || !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return false
+	}
+
+	var device models.TrustedDevice
+	if err := tf.db.Where("id = ? AND user_id = ? AND expires_at > ?", parts[0], userID, time.Now()).
+		First(&device).Error; err != nil {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(device.SecretHash), []byte(hashSecret(parts[1]))) != 1 {
+		return false
+	}
+
+	tf.db.Model(&device).Update("last_used_at", time.Now())
+	return true
+}
+
+// TrustedDevices lists the user's unexpired trusted devices.
+func (tf *TwoFactorManager) TrustedDevices(userID uint) ([]models.TrustedDevice, error) {
+	var devices []models.TrustedDevice
+	if err := tf.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load trusted devices: %v", err)
+	}
+	return devices, nil
+}
+
+// RevokeTrustedDevices forgets the user's trusted devices, or only the one
+// with deviceID when it is not zero.
+func (tf *TwoFactorManager) RevokeTrustedDevices(userID, deviceID uint) (int64, error) {
+	query := tf.db.Where("user_id = ?", userID)
+	if deviceID != 0 {
+		query = query.Where("id = ?", deviceID)
+	}
+	result := query.Delete(&models.TrustedDevice{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke trusted devices: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// sign returns the HMAC of a trusted-device cookie. The key is generated on
+// first use and kept in the database so every node shares it.
+func (tf *TwoFactorManager) sign(payload string) (string, error) {
+	key, err := tf.signingKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (tf *TwoFactorManager) signingKey() ([]byte, error) {
+	tf.keyMutex.Lock()
+	defer tf.keyMutex.Unlock()
+	if tf.key != nil {
+		return tf.key, nil
+	}
+
+	var setting models.System
+	if err := tf.db.Where("setting = ?", trustedDeviceKeySetting).First(&setting).Error; err != nil {
+		generated, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		setting = models.System{
+			Setting:     trustedDeviceKeySetting,
+			Value:       generated,
+			Description: "Key signing trusted-device cookies",
+			Category:    "security",
+		}
+		// Another node may have created the key first; use whichever won
+		if err := tf.db.Create(&setting).Error; err != nil {
+			if err := tf.db.Where("setting = ?", trustedDeviceKeySetting).First(&setting).Error; err != nil {
+				return nil, fmt.Errorf("failed to load trusted device key: %v", err)
+			}
+		}
+	}
+
+	key, err := hex.DecodeString(setting.Value)
+	if err != nil || len(key) < 32 {
+		return nil, errors.New("trusted device key is malformed")
+	}
+	tf.key = key
+	return key, nil
+}
+
+// generateRandomCode returns ten base32 characters, 50 random bits.
 func (tf *TwoFactorManager) generateRandomCode() (string, error) {
-	bytes := make([]byte, 5)
+	bytes := make([]byte, 7)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
-	return base32.StdEncoding.EncodeToString(bytes)[:8], nil
+	return base32.StdEncoding.EncodeToString(bytes)[:10], nil
 }
 
 func (tf *TwoFactorManager) GenerateQRCode(secret, username string) (string, error) {
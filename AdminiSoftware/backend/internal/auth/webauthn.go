@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"AdminiSoftware/internal/models"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+// WebAuthn ceremony types stored with each challenge.
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+	CeremonyMFA          = "mfa"
+)
+
+const webAuthnCeremonyTimeout = 5 * time.Minute
+
+var (
+	ErrCeremonyNotFound   = errors.New("webauthn ceremony not found or expired")
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrCredentialCloned   = errors.New("authenticator sign counter went backwards; the credential may be cloned")
+)
+
+// WebAuthnManager runs registration and assertion ceremonies for security keys
+// and passkeys. Challenges are kept in the database so any instance can finish
+// a ceremony started by another.
+type WebAuthnManager struct {
+	db       *gorm.DB
+	webAuthn *webauthn.WebAuthn
+}
+
+// NewWebAuthnManager reads the relying party from WEBAUTHN_RP_ID,
+// WEBAUTHN_RP_NAME and the comma separated WEBAUTHN_RP_ORIGINS.
+func NewWebAuthnManager(db *gorm.DB) (*WebAuthnManager, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = "AdminiSoftware"
+	}
+	origins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	if origins[0] == "" {
+		origins = []string{"https://" + rpID}
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn configuration: %v", err)
+	}
+
+	return &WebAuthnManager{db: db, webAuthn: w}, nil
+}
+
+// webAuthnUser adapts a User and its stored credentials to the library interface.
+type webAuthnUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	name := strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+	if name == "" {
+		return u.user.Username
+	}
+	return name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func userHandle(userID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(userID), 10))
+}
+
+// HasCredentials reports whether the user can complete a WebAuthn assertion.
+func (m *WebAuthnManager) HasCredentials(userID uint) bool {
+	if m == nil {
+		return false
+	}
+
+	var count int64
+	m.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count)
+	return count > 0
+}
+
+// ListCredentials returns the security keys and passkeys registered by a user.
+func (m *WebAuthnManager) ListCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := m.db.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// DeleteCredential removes one of the user's credentials.
+func (m *WebAuthnManager) DeleteCredential(id, userID uint) error {
+	result := m.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// BeginRegistration starts adding a new credential; existing ones are excluded
+// so the same authenticator is not registered twice.
+func (m *WebAuthnManager) BeginRegistration(user *models.User) (*protocol.CredentialCreation, string, error) {
+	waUser, err := m.loadUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waUser.credentials))
+	for _, credential := range waUser.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := m.webAuthn.BeginRegistration(waUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyID, err := m.saveCeremony(CeremonyRegistration, &user.ID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return options, ceremonyID, nil
+}
+
+// FinishRegistration verifies the attestation and stores the new credential.
+func (m *WebAuthnManager) FinishRegistration(user *models.User, ceremonyID, name string, r *http.Request) (*models.WebAuthnCredential, error) {
+	session, err := m.takeCeremony(ceremonyID, CeremonyRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	waUser, err := m.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := m.webAuthn.FinishRegistration(waUser, *session, r)
+	if err != nil {
+		return nil, fmt.Errorf("registration failed: %v", err)
+	}
+
+	if name == "" {
+		name = "Security key"
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	stored := &models.WebAuthnCredential{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          hex.EncodeToString(credential.Authenticator.AAGUID),
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := m.db.Create(stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to save credential: %v", err)
+	}
+
+	return stored, nil
+}
+
+// BeginMFA starts an assertion restricted to the credentials of a user who has
+// already presented their password.
+func (m *WebAuthnManager) BeginMFA(user *models.User) (*protocol.CredentialAssertion, string, error) {
+	waUser, err := m.loadUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	options, session, err := m.webAuthn.BeginLogin(waUser)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyID, err := m.saveCeremony(CeremonyMFA, &user.ID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return options, ceremonyID, nil
+}
+
+// BeginLogin starts a passwordless login with a discoverable credential.
+func (m *WebAuthnManager) BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	options, session, err := m.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyID, err := m.saveCeremony(CeremonyLogin, nil, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return options, ceremonyID, nil
+}
+
+// FinishLogin verifies an assertion for either kind of login ceremony and
+// returns the authenticated user together with the ceremony type.
+func (m *WebAuthnManager) FinishLogin(ceremonyID string, r *http.Request) (*models.User, string, error) {
+	var challenge models.WebAuthnChallenge
+	if err := m.db.Where("ceremony_id = ?", ceremonyID).First(&challenge).Error; err != nil {
+		return nil, "", ErrCeremonyNotFound
+	}
+
+	session, err := m.takeCeremony(ceremonyID, challenge.Type, challenge.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var user *models.User
+	var credential *webauthn.Credential
+
+	switch challenge.Type {
+	case CeremonyMFA:
+		user = &models.User{}
+		if err := m.db.First(user, *challenge.UserID).Error; err != nil {
+			return nil, "", err
+		}
+		waUser, err := m.loadUser(user)
+		if err != nil {
+			return nil, "", err
+		}
+		if credential, err = m.webAuthn.FinishLogin(waUser, *session, r); err != nil {
+			return nil, "", fmt.Errorf("assertion failed: %v", err)
+		}
+
+	case CeremonyLogin:
+		handler := func(rawID, handle []byte) (webauthn.User, error) {
+			userID, err := strconv.ParseUint(string(handle), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			user = &models.User{}
+			if err := m.db.First(user, uint(userID)).Error; err != nil {
+				return nil, err
+			}
+			return m.loadUser(user)
+		}
+		if credential, err = m.webAuthn.FinishDiscoverableLogin(handler, *session, r); err != nil {
+			return nil, "", fmt.Errorf("assertion failed: %v", err)
+		}
+
+	default:
+		return nil, "", ErrCeremonyNotFound
+	}
+
+	if err := m.recordAssertion(user.ID, credential); err != nil {
+		return nil, "", err
+	}
+	return user, challenge.Type, nil
+}
+
+// recordAssertion stores the new sign counter. A counter that did not advance
+// marks the credential and fails the login.
+func (m *WebAuthnManager) recordAssertion(userID uint, credential *webauthn.Credential) error {
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+
+	if credential.Authenticator.CloneWarning {
+		m.db.Model(&models.WebAuthnCredential{}).
+			Where("user_id = ? AND credential_id = ?", userID, credentialID).
+			Update("clone_warning", true)
+		return ErrCredentialCloned
+	}
+
+	now := time.Now()
+	return m.db.Model(&models.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", userID, credentialID).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": now,
+		}).Error
+}
+
+func (m *WebAuthnManager) loadUser(user *models.User) (*webAuthnUser, error) {
+	var stored []models.WebAuthnCredential
+	if err := m.db.Where("user_id = ?", user.ID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	waUser := &webAuthnUser{user: user}
+	for _, s := range stored {
+		id, err := base64.RawURLEncoding.DecodeString(s.CredentialID)
+		if err != nil {
+			continue
+		}
+		aaguid, _ := hex.DecodeString(s.AAGUID)
+
+		var transports []protocol.AuthenticatorTransport
+		if s.Transports != "" {
+			for _, transport := range strings.Split(s.Transports, ",") {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		waUser.credentials = append(waUser.credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       s.PublicKey,
+			AttestationType: s.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: s.BackupEligible,
+				BackupState:    s.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       aaguid,
+				SignCount:    s.SignCount,
+				CloneWarning: s.CloneWarning,
+			},
+		})
+	}
+	return waUser, nil
+}
+
+func (m *WebAuthnManager) saveCeremony(ceremonyType string, userID *uint, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	ceremonyID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := &models.WebAuthnChallenge{
+		CeremonyID:  ceremonyID,
+		UserID:      userID,
+		Type:        ceremonyType,
+		SessionData: string(data),
+		ExpiresAt:   time.Now().Add(webAuthnCeremonyTimeout),
+	}
+	if err := m.db.Create(challenge).Error; err != nil {
+		return "", err
+	}
+
+	// Abandoned ceremonies are cleaned up opportunistically
+	m.db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnChallenge{})
+
+	return ceremonyID, nil
+}
+
+// takeCeremony loads and deletes a challenge so each one can be answered once.
+func (m *WebAuthnManager) takeCeremony(ceremonyID, ceremonyType string, userID *uint) (*webauthn.SessionData, error) {
+	query := m.db.Where("ceremony_id = ? AND type = ? AND expires_at > ?", ceremonyID, ceremonyType, time.Now())
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var challenge models.WebAuthnChallenge
+	if err := query.First(&challenge).Error; err != nil {
+		return nil, ErrCeremonyNotFound
+	}
+	if result := m.db.Delete(&challenge); result.Error != nil || result.RowsAffected == 0 {
+		return nil, ErrCeremonyNotFound
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(challenge.SessionData), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
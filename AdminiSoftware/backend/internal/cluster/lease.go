@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	nodeID     string
+	nodeIDOnce sync.Once
+)
+
+// NodeID identifies this process among the panel's nodes: NODE_ID when set,
+// otherwise the hostname.
+func NodeID() string {
+	nodeIDOnce.Do(func() {
+		nodeID = os.Getenv("NODE_ID")
+		if nodeID == "" {
+			nodeID, _ = os.Hostname()
+		}
+		if nodeID == "" {
+			nodeID = "localhost"
+		}
+	})
+	return nodeID
+}
+
+// Leader reports whether this node runs the named task now. It takes the
+// task's lease when it is free or has expired and renews it when this node
+// already holds it, so a task whose leader dies moves to another node once
+// ttl has passed. Tasks call it on every tick with a ttl longer than their
+// interval.
+func Leader(db *gorm.DB, name string, ttl time.Duration) bool {
+	now := time.Now()
+	result := db.Exec(`INSERT INTO task_leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE task_leases.holder = excluded.holder OR task_leases.expires_at < ?`,
+		name, NodeID(), now.Add(ttl), now)
+	return result.Error == nil && result.RowsAffected == 1
+}
@@ -68,6 +68,52 @@ func InitDatabase(cfg *Config) (*gorm.DB, error) {
 		&models.Stats{},
 		&models.System{},
 		&models.Application{},
+		&models.Alert{},
+		&models.CronJob{},
+		&models.DomainRedirect{},
+		&models.DNSZone{},
+		&models.EmailForwarder{},
+		&models.EmailFilter{},
+		&models.DatabaseUser{},
+		&models.AppVariable{},
+		&models.WordPressInstall{},
+		&models.Session{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.OIDCProvider{},
+		&models.OIDCIdentity{},
+		&models.OIDCLoginState{},
+		&models.APIToken{},
+		&models.Role{},
+		&models.RoleAssignment{},
+		&models.Impersonation{},
+		&models.AuditLog{},
+		&models.LDAPDirectory{},
+		&models.LDAPIdentity{},
+		&models.PasswordHistory{},
+		&models.SigningKey{},
+		&models.PasswordResetToken{},
+		&models.OutboundMail{},
+		&models.EmailTemplate{},
+		&models.Branding{},
+		&models.TwoFactorBackupCode{},
+		&models.TrustedDevice{},
+		&models.PackageChange{},
+		&models.ResellerAllocation{},
+		&models.AccountTransition{},
+		&models.BulkJob{},
+		&models.BulkJobItem{},
+		&models.AccountRename{},
+		&models.AccountRenameStep{},
+		&models.ProvisionedService{},
+		&models.SSOLoginToken{},
+		&models.OverageTier{},
+		&models.MeterReading{},
+		&models.Statement{},
+		&models.StatementLine{},
+		&models.PrivateNameserver{},
+		&models.PanelHostname{},
+		&models.TaskLease{},
 	)
 	if err != nil {
 		return nil, err
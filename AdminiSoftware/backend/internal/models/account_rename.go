@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// AccountRename changes an account's username, primary domain or both. It
+// is applied in steps, each recorded as it completes, so a rename that was
+// interrupted can be resumed and one that failed can be rolled back.
+type AccountRename struct {
+	ID          uint                `json:"id" gorm:"primarykey"`
+	UserID      uint                `json:"user_id" gorm:"index"`
+	OldUsername string              `json:"old_username" gorm:"size:255"`
+	NewUsername string              `json:"new_username" gorm:"size:255"`
+	OldDomain   string              `json:"old_domain" gorm:"size:255"`
+	NewDomain   string              `json:"new_domain" gorm:"size:255"`
+	Status      string              `json:"status" gorm:"size:20;index"` // running, completed, failed, interrupted, rolled_back
+	Error       string              `json:"error,omitempty" gorm:"type:text"`
+	ActorID     uint                `json:"actor_id"`
+	Node        string              `json:"node" gorm:"size:255"` // the panel node working on the rename
+	HeartbeatAt *time.Time          `json:"heartbeat_at"`         // touched by that node while it works
+	Steps       []AccountRenameStep `json:"steps,omitempty" gorm:"foreignKey:RenameID"`
+	StartedAt   *time.Time          `json:"started_at"`
+	FinishedAt  *time.Time          `json:"finished_at"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// AccountRenameStep is one part of a rename, such as the mail addresses or
+// the DNS records. State holds what the step needs to undo itself.
+type AccountRenameStep struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	RenameID   uint       `json:"rename_id" gorm:"index"`
+	Position   int        `json:"position"`
+	Name       string     `json:"name" gorm:"size:50"`
+	Status     string     `json:"status" gorm:"size:20"` // pending, done, failed, reverted
+	Output     string     `json:"output" gorm:"type:text"`
+	State      string     `json:"-" gorm:"type:text"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
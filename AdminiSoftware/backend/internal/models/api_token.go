@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// APIToken lets scripts call the API as a user without their password. Only
+// a hash of the token is stored; the plaintext is shown once at creation.
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	User       *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name       string     `json:"name" gorm:"size:100"`
+	Prefix     string     `json:"prefix" gorm:"size:16"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Scopes     string     `json:"scopes" gorm:"type:text"`      // comma separated, e.g. "dns:write,accounts:read"
+	AllowedIPs string     `json:"allowed_ips" gorm:"type:text"` // comma separated IPs or CIDRs, empty allows any
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"size:45"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// Impersonation records a staff member signing in as a customer.
+type Impersonation struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	ActorID   uint       `json:"actor_id" gorm:"index"`
+	Actor     *User      `json:"actor,omitempty" gorm:"foreignKey:ActorID"`
+	SubjectID uint       `json:"subject_id" gorm:"index"`
+	Subject   *User      `json:"subject,omitempty" gorm:"foreignKey:SubjectID"`
+	SessionID string     `json:"-" gorm:"size:64;index"`
+	Reason    string     `json:"reason" gorm:"size:500"`
+	IP        string     `json:"ip" gorm:"size:45"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AuditLog is one API request made on behalf of another user, or a
+// sensitive action staff took on a user's account such as resetting its
+// two-factor authentication. Action is empty for impersonated requests.
+type AuditLog struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	ActorID         uint      `json:"actor_id" gorm:"index"`
+	SubjectID       uint      `json:"subject_id" gorm:"index"`
+	ImpersonationID *uint     `json:"impersonation_id" gorm:"index"`
+	Action          string    `json:"action" gorm:"size:50;index"`
+	Details         string    `json:"details" gorm:"type:text"`
+	Method          string    `json:"method" gorm:"size:10"`
+	Path            string    `json:"path" gorm:"size:500"`
+	Status          int       `json:"status"`
+	IP              string    `json:"ip" gorm:"size:45"`
+	UserAgent       string    `json:"user_agent" gorm:"size:500"`
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+}
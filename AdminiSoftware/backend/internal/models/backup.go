@@ -52,18 +52,28 @@ type Backup struct {
 	ID          uint           `json:"id" gorm:"primarykey"`
 	UserID      uint           `json:"user_id"`
 	User        User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name        string         `json:"name" gorm:"size:100"`
 	Type        string         `json:"type" gorm:"size:20"` // full, partial, database, files
-	Status      string         `json:"status" gorm:"size:20;default:pending"`
+	Status      string         `json:"status" gorm:"size:20;default:pending"` // pending, creating, completed, failed, corrupt
 	Path        string         `json:"path" gorm:"size:500"`
+	Node        string         `json:"node" gorm:"size:255;index"` // the panel node holding the archive
 	SizeMB      int64          `json:"size_mb" gorm:"default:0"`
 	Description string         `json:"description" gorm:"type:text"`
 	Progress    int            `json:"progress" gorm:"default:0"`
 	ErrorLog    string         `json:"error_log" gorm:"type:text"`
+	VerifiedAt  *time.Time     `json:"verified_at"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// CreateBackupRequest is the body of a panel backup request.
+type CreateBackupRequest struct {
+	Name        string `json:"name" binding:"required,max=100,excludesall=/\\"`
+	Description string `json:"description"`
+	Type        string `json:"type" binding:"required,oneof=full database files"`
+}
+
 type BackupSchedule struct {
 	ID        uint           `json:"id" gorm:"primarykey"`
 	UserID    uint           `json:"user_id"`
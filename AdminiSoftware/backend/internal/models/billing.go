@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// OverageTier prices usage beyond a package's disk or bandwidth limit. Tiers
+// of a resource apply in order of UpToGB, each to the overage up to its
+// bound; the tier without a bound takes the rest. Wholesale tiers price the
+// reseller's statement, the others the customer's.
+type OverageTier struct {
+	ID         uint    `json:"id" gorm:"primarykey"`
+	PackageID  uint    `json:"package_id" gorm:"index"`
+	Resource   string  `json:"resource" gorm:"size:20"` // disk, bandwidth
+	UpToGB     float64 `json:"up_to_gb"`                // overage this tier covers up to, 0 for no bound
+	PricePerGB float64 `json:"price_per_gb"`
+	Wholesale  bool    `json:"wholesale" gorm:"default:false"`
+}
+
+// MeterReading is one day of an account's billable usage: the package it
+// was on, its disk use and what it transferred that day.
+type MeterReading struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex:idx_meter_reading_day"`
+	Date        time.Time `json:"date" gorm:"type:date;uniqueIndex:idx_meter_reading_day;index"`
+	ResellerID  *uint     `json:"reseller_id" gorm:"index"`
+	PackageID   *uint     `json:"package_id"`
+	Status      string    `json:"status" gorm:"size:20"`
+	DiskMB      int64     `json:"disk_mb"`
+	BandwidthMB int64     `json:"bandwidth_mb"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Statement is a month of metered usage priced for a customer, by the
+// reseller or administrators it belongs to, or for a reseller, covering all
+// of its customers. A statement has one currency; customers on packages
+// priced in several get one statement for each.
+type Statement struct {
+	ID          uint            `json:"id" gorm:"primarykey"`
+	Number      string          `json:"number" gorm:"size:50;uniqueIndex"`
+	Kind        string          `json:"kind" gorm:"size:20;uniqueIndex:idx_statement_owner"`  // customer, reseller
+	OwnerID     uint            `json:"owner_id" gorm:"uniqueIndex:idx_statement_owner"`      // the customer or reseller billed
+	IssuerID    uint            `json:"issuer_id" gorm:"index"`                               // reseller of the customer, 0 for administrators
+	Period      string          `json:"period" gorm:"size:7;uniqueIndex:idx_statement_owner"` // YYYY-MM
+	Currency    string          `json:"currency" gorm:"size:3;uniqueIndex:idx_statement_owner"`
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	Total       float64         `json:"total"`
+	Lines       []StatementLine `json:"lines,omitempty" gorm:"foreignKey:StatementID"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// StatementLine is one charge: days on a package, or disk or bandwidth
+// overage. Usernames and package names are copied so statements stay as
+// issued.
+type StatementLine struct {
+	ID          uint    `json:"id" gorm:"primarykey"`
+	StatementID uint    `json:"statement_id" gorm:"index"`
+	UserID      uint    `json:"user_id"`
+	Username    string  `json:"username" gorm:"size:255"`
+	Type        string  `json:"type" gorm:"size:30"` // package, disk_overage, bandwidth_overage
+	PackageID   *uint   `json:"package_id"`
+	Description string  `json:"description" gorm:"size:500"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit" gorm:"size:10"` // days, GB
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// BulkJob is an operation on many accounts run in the background, such as
+// suspending or moving a reseller's customers. ResellerID limits the job to
+// one reseller's accounts; it is nil for jobs started by administrators.
+type BulkJob struct {
+	ID              uint          `json:"id" gorm:"primarykey"`
+	Operation       string        `json:"operation" gorm:"size:30"`
+	Status          string        `json:"status" gorm:"size:20;index"` // queued, running, completed, cancelled, failed
+	DryRun          bool          `json:"dry_run"`
+	Concurrency     int           `json:"concurrency"`
+	ResellerID      *uint         `json:"reseller_id" gorm:"index"`
+	CreatedBy       uint          `json:"created_by" gorm:"index"`
+	Node            string        `json:"node" gorm:"size:255;index"` // the panel node running the job
+	HeartbeatAt     *time.Time    `json:"heartbeat_at"`               // touched by that node while the job runs
+	CancelRequested bool          `json:"cancel_requested"`
+	PackageID       *uint         `json:"package_id"`
+	Force           bool          `json:"force"`
+	Reason          string        `json:"reason" gorm:"size:500"`
+	Total           int           `json:"total"`
+	Succeeded       int           `json:"succeeded"`
+	Failed          int           `json:"failed"`
+	Skipped         int           `json:"skipped"`
+	Error           string        `json:"error,omitempty" gorm:"type:text"`
+	StartedAt       *time.Time    `json:"started_at"`
+	FinishedAt      *time.Time    `json:"finished_at"`
+	Items           []BulkJobItem `json:"items,omitempty" gorm:"foreignKey:JobID"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// BulkJobItem is the result of a bulk job for one account, or one row of an
+// account import. Passwords from imports are never stored.
+type BulkJobItem struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	JobID     uint      `json:"job_id" gorm:"index"`
+	Position  int       `json:"position"`
+	UserID    *uint     `json:"user_id"`
+	Target    string    `json:"target" gorm:"size:255"` // username
+	Status    string    `json:"status" gorm:"size:20"`  // pending, succeeded, failed, skipped
+	Message   string    `json:"message" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
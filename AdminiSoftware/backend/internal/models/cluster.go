@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// TaskLease names the node running a background task that must run on one
+// node at a time. The holder renews it while it runs the task; once it
+// expires another node takes the task over.
+type TaskLease struct {
+	Name      string    `json:"name" gorm:"size:100;primarykey"`
+	Holder    string    `json:"holder" gorm:"size:255;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+}
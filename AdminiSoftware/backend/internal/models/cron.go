@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CronJob struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	UserID    uint           `json:"user_id"`
+	User      User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Command   string         `json:"command" gorm:"type:text"`
+	Schedule  string         `json:"schedule" gorm:"size:100"` // standard five-field cron expression
+	Email     string         `json:"email" gorm:"size:255"`
+	Enabled   bool           `json:"enabled" gorm:"default:true"`
+	LastRun   *time.Time     `json:"last_run"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LDAPDirectory is an LDAP server panel logins are checked against. A
+// directory with a ResellerID only serves that reseller's customers.
+type LDAPDirectory struct {
+	ID                 uint           `json:"id" gorm:"primarykey"`
+	Name               string         `json:"name" gorm:"size:100"`
+	ResellerID         *uint          `json:"reseller_id" gorm:"index"`
+	URL                string         `json:"url" gorm:"size:500"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool           `json:"start_tls"`
+	InsecureSkipVerify bool           `json:"insecure_skip_verify"`
+	BindDN             string         `json:"bind_dn" gorm:"size:500"` // service account, empty binds anonymously
+	BindPassword       string         `json:"-" gorm:"size:500"`
+	BaseDN             string         `json:"base_dn" gorm:"size:500"`
+	UserFilter         string         `json:"user_filter" gorm:"size:500;default:(uid=%s)"`
+	UserDNTemplate     string         `json:"user_dn_template" gorm:"size:500"` // set to bind directly, e.g. uid=%s,ou=people,dc=example,dc=org
+	EmailAttribute     string         `json:"email_attribute" gorm:"size:100;default:mail"`
+	FirstNameAttribute string         `json:"first_name_attribute" gorm:"size:100;default:givenName"`
+	LastNameAttribute  string         `json:"last_name_attribute" gorm:"size:100;default:sn"`
+	GroupAttribute     string         `json:"group_attribute" gorm:"size:100;default:memberOf"`
+	GroupBaseDN        string         `json:"group_base_dn" gorm:"size:500"` // set to search groups instead of reading GroupAttribute
+	GroupFilter        string         `json:"group_filter" gorm:"size:500;default:(|(member=%s)(uniqueMember=%s))"`
+	AdminGroups        string         `json:"admin_groups" gorm:"type:text"`    // comma separated DNs or CNs
+	ResellerGroups     string         `json:"reseller_groups" gorm:"type:text"` // comma separated DNs or CNs
+	UserGroups         string         `json:"user_groups" gorm:"type:text"`     // comma separated, empty allows everyone
+	DefaultRole        string         `json:"default_role" gorm:"size:20;default:user"`
+	AutoProvision      bool           `json:"auto_provision"`
+	SyncEnabled        bool           `json:"sync_enabled"`
+	Enabled            bool           `json:"enabled"`
+	LastSyncAt         *time.Time     `json:"last_sync_at"`
+	LastSyncError      string         `json:"last_sync_error" gorm:"type:text"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// LDAPIdentity links a directory account to a local user. SuspendedBySync
+// records that the sync, not an administrator, suspended the user so it can
+// lift the suspension when the account reappears. Provisioned accounts were
+// created by the directory and take their role from its groups; accounts
+// their owners linked keep the role they have.
+type LDAPIdentity struct {
+	ID              uint          `json:"id" gorm:"primarykey"`
+	UserID          uint          `json:"user_id" gorm:"index"`
+	User            User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	DirectoryID     uint          `json:"directory_id" gorm:"uniqueIndex:idx_ldap_username"`
+	Directory       LDAPDirectory `json:"directory,omitempty" gorm:"foreignKey:DirectoryID"`
+	Username        string        `json:"username" gorm:"uniqueIndex:idx_ldap_username;size:255"`
+	DN              string        `json:"dn" gorm:"size:500"`
+	SuspendedBySync bool          `json:"suspended_by_sync"`
+	Provisioned     bool          `json:"provisioned"`
+	LastLoginAt     *time.Time    `json:"last_login_at"`
+	LastSyncAt      *time.Time    `json:"last_sync_at"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboundMail is a message in the persistent delivery queue. Failed
+// deliveries are retried with backoff until the queue gives up on them.
+// Bodies are dropped once the message is sent, or once ExpiresAt passes for
+// messages carrying a link that stops working then.
+type OutboundMail struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	Sender        string     `json:"sender" gorm:"size:255"`
+	Recipient     string     `json:"recipient" gorm:"size:255;index"`
+	Subject       string     `json:"subject" gorm:"size:255"`
+	TextBody      string     `json:"-" gorm:"type:text"`
+	HTMLBody      string     `json:"-" gorm:"type:text"`
+	Template      string     `json:"template" gorm:"size:50"`
+	Status        string     `json:"status" gorm:"size:20;index"` // queued, sending, sent, failed
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastError     string     `json:"last_error" gorm:"type:text"`
+	SentAt        *time.Time `json:"sent_at"`
+	ExpiresAt     *time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// EmailTemplate overrides a built-in email. Templates without a ResellerID
+// apply to every customer not covered by a reseller's own template.
+type EmailTemplate struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ResellerID *uint     `json:"reseller_id" gorm:"uniqueIndex:idx_email_template"`
+	Name       string    `json:"name" gorm:"size:50;uniqueIndex:idx_email_template"`
+	Subject    string    `json:"subject" gorm:"size:255"`
+	TextBody   string    `json:"text_body" gorm:"type:text"`
+	HTMLBody   string    `json:"html_body" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCProvider is an external identity provider users can sign in with. A
+// provider with a ResellerID only serves that reseller's customers.
+type OIDCProvider struct {
+	ID             uint           `json:"id" gorm:"primarykey"`
+	Name           string         `json:"name" gorm:"size:100"`
+	ResellerID     *uint          `json:"reseller_id" gorm:"index"`
+	Issuer         string         `json:"issuer" gorm:"size:500"`
+	ClientID       string         `json:"client_id" gorm:"size:255"`
+	ClientSecret   string         `json:"-" gorm:"size:500"`
+	Scopes         string         `json:"scopes" gorm:"size:255;default:openid profile email"`
+	GroupsClaim    string         `json:"groups_claim" gorm:"size:100;default:groups"`
+	AdminGroups    string         `json:"admin_groups" gorm:"type:text"`    // comma separated
+	ResellerGroups string         `json:"reseller_groups" gorm:"type:text"` // comma separated
+	UserGroups     string         `json:"user_groups" gorm:"type:text"`     // comma separated, empty allows everyone
+	DefaultRole    string         `json:"default_role" gorm:"size:20;default:user"`
+	AutoProvision  bool           `json:"auto_provision"`
+	Enabled        bool           `json:"enabled"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OIDCIdentity links a provider subject to a local user, either one the
+// provider provisioned or one whose owner linked it while signed in.
+// Provisioned accounts take their role from the provider's groups.
+type OIDCIdentity struct {
+	ID          uint         `json:"id" gorm:"primarykey"`
+	UserID      uint         `json:"user_id" gorm:"index"`
+	User        User         `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	ProviderID  uint         `json:"provider_id" gorm:"uniqueIndex:idx_oidc_subject"`
+	Provider    OIDCProvider `json:"provider,omitempty" gorm:"foreignKey:ProviderID"`
+	Subject     string       `json:"subject" gorm:"uniqueIndex:idx_oidc_subject;size:255"`
+	Email       string       `json:"email" gorm:"size:255"`
+	Provisioned bool         `json:"provisioned"`
+	LastLoginAt *time.Time   `json:"last_login_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// OIDCLoginState carries the PKCE verifier and nonce of an authorization
+// request until the browser returns with the code.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	State        string    `json:"state" gorm:"uniqueIndex;size:64"`
+	ProviderID   uint      `json:"provider_id"`
+	Nonce        string    `json:"-" gorm:"size:64"`
+	CodeVerifier string    `json:"-" gorm:"size:128"`
+	RedirectURI  string    `json:"redirect_uri" gorm:"size:500"`
+	LinkUserID   *uint     `json:"link_user_id"` // set when a signed-in user links the identity
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
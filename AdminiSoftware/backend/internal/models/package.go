@@ -50,6 +50,7 @@ import (
 	"gorm.io/gorm"
 )
 
+// Package limits resource counts per account; a limit of 0 means unlimited.
 type Package struct {
 	ID                uint           `json:"id" gorm:"primarykey"`
 	Name              string         `json:"name" gorm:"uniqueIndex;size:255"`
@@ -65,10 +66,40 @@ type Package struct {
 	CGIAccess         bool           `json:"cgi_access" gorm:"default:false"`
 	SSHAccess         bool           `json:"ssh_access" gorm:"default:false"`
 	SSLSupport        bool           `json:"ssl_support" gorm:"default:true"`
+	SSLCertificates   int            `json:"ssl_certificates" gorm:"default:0"`
+	LVESpeed          int            `json:"lve_speed" gorm:"default:0"`        // percent of one core
+	LVEMemoryMB       int            `json:"lve_memory_mb" gorm:"default:0"`    // physical memory
+	LVEIOKB           int            `json:"lve_io_kb" gorm:"default:0"`        // KB/s
+	LVEEntryProcesses int            `json:"lve_entry_processes" gorm:"default:0"`
+	PHPVersion        string         `json:"php_version" gorm:"size:10"` // empty keeps the server default
+	PHPMemoryLimitMB  int            `json:"php_memory_limit_mb" gorm:"default:0"`
 	Features          string         `json:"features" gorm:"type:text"`
+	Price             float64        `json:"price" gorm:"default:0"`           // per billing cycle
+	WholesalePrice    float64        `json:"wholesale_price" gorm:"default:0"` // per billing cycle, what administrators charge the reseller
+	Currency          string         `json:"currency" gorm:"size:3;default:USD"`
+	BillingCycle      string         `json:"billing_cycle" gorm:"size:20;default:monthly"` // monthly, quarterly, yearly
+	OverageTiers      []OverageTier  `json:"overage_tiers,omitempty" gorm:"foreignKey:PackageID"`
 	Status            string         `json:"status" gorm:"size:20;default:active"`
+	ResellerID        *uint          `json:"reseller_id" gorm:"index"` // nil for the administrator's packages
 	Users             []User         `json:"users,omitempty" gorm:"foreignKey:PackageID"`
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 }
+
+// PackageChange records an account moving between packages, for billing.
+// Package names are copied so the history survives packages being deleted.
+type PackageChange struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	UserID          uint      `json:"user_id" gorm:"index"`
+	FromPackageID   *uint     `json:"from_package_id"`
+	FromPackageName string    `json:"from_package_name" gorm:"size:255"`
+	ToPackageID     uint      `json:"to_package_id"`
+	ToPackageName   string    `json:"to_package_name" gorm:"size:255"`
+	Direction       string    `json:"direction" gorm:"size:20"` // upgrade, downgrade, lateral
+	ChangedBy       uint      `json:"changed_by"`               // 0 when changed by the system
+	Forced          bool      `json:"forced"`                   // applied although usage exceeded the new limits
+	Reason          string    `json:"reason" gorm:"type:text"`
+	Warnings        string    `json:"warnings" gorm:"type:text"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory keeps hashes of previous passwords so they cannot be
+// reused. OwnerKind is "panel", "email" or "database" and OwnerID the ID of
+// the user, mailbox or database.
+type PasswordHistory struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OwnerKind string    `json:"owner_kind" gorm:"size:20;index:idx_password_history_owner"`
+	OwnerID   uint      `json:"owner_id" gorm:"index:idx_password_history_owner"`
+	Hash      string    `json:"-" gorm:"size:255"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PasswordResetToken is a single-use link for resetting a forgotten
+// password. Only the SHA-256 of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex"`
+	RequestIP string     `json:"request_ip" gorm:"size:45"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// ProvisionedService links a service in a billing system to the account it
+// was provisioned as. Billing modules address accounts by their service ID,
+// so a request repeated after a timeout finds the account it already made.
+// Service IDs are unique per reseller; ResellerID is 0 for services
+// provisioned by administrators.
+type ProvisionedService struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	ResellerID   uint       `json:"reseller_id" gorm:"uniqueIndex:idx_provisioned_service"`
+	ServiceID    string     `json:"service_id" gorm:"size:100;uniqueIndex:idx_provisioned_service"`
+	UserID       *uint      `json:"user_id" gorm:"uniqueIndex"` // nil while the account is being created
+	User         *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	LastAction   string     `json:"last_action" gorm:"size:30"`
+	LastActionAt *time.Time `json:"last_action_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// SSOLoginToken signs a customer into the panel from their billing client
+// area. It is valid once and for a short time; only its hash is stored.
+type SSOLoginToken struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex"`
+	IssuedBy  uint       `json:"issued_by"` // the API token that asked for it
+	RequestIP string     `json:"request_ip" gorm:"size:45"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
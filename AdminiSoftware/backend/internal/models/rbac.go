@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Role is a named set of permissions. Roles without a ResellerID are defined
+// by admins; resellers can define their own from the permissions they hold.
+type Role struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	Name        string         `json:"name" gorm:"size:100;uniqueIndex:idx_role_name"`
+	ResellerID  *uint          `json:"reseller_id" gorm:"uniqueIndex:idx_role_name"`
+	Description string         `json:"description" gorm:"size:255"`
+	Permissions string         `json:"permissions" gorm:"type:text"` // comma separated, e.g. "dns:read,dns:write"
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// RoleAssignment grants a role to a user. With a ResellerID the permissions
+// only apply to that reseller's accounts.
+type RoleAssignment struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"user_id" gorm:"index"`
+	User       *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	RoleID     uint      `json:"role_id" gorm:"index"`
+	Role       *Role     `json:"role,omitempty" gorm:"foreignKey:RoleID"`
+	ResellerID *uint     `json:"reseller_id" gorm:"index"`
+	GrantedBy  uint      `json:"granted_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
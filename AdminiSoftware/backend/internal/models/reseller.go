@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ResellerAllocation is the pool of resources a reseller shares out among
+// its customers. Limits of 0 are unlimited. Unless overselling is allowed,
+// the packages of the reseller's accounts must fit in the pool together.
+type ResellerAllocation struct {
+	ID               uint      `json:"id" gorm:"primarykey"`
+	ResellerID       uint      `json:"reseller_id" gorm:"uniqueIndex"`
+	MaxAccounts      int       `json:"max_accounts" gorm:"default:0"`
+	DiskMB           int       `json:"disk_mb" gorm:"default:0"`
+	BandwidthMB      int       `json:"bandwidth_mb" gorm:"default:0"`
+	AllowOverselling bool      `json:"allow_overselling" gorm:"default:false"`
+	Packages         []Package `json:"packages" gorm:"many2many:reseller_allowed_packages"` // administrator packages it may assign; empty allows all
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// PrivateNameserver is a nameserver host a reseller gives its customers in
+// place of the server's own, such as ns1.reseller.tld. The customers'
+// zones carry the reseller's nameservers as their NS records.
+type PrivateNameserver struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ResellerID uint      `json:"reseller_id" gorm:"index"`
+	Position   int       `json:"position"` // order of the NS records, from 1
+	Hostname   string    `json:"hostname" gorm:"size:253;uniqueIndex"`
+	IPv4       string    `json:"ipv4" gorm:"size:15"`
+	IPv6       string    `json:"ipv6" gorm:"size:45"`
+	Verified   bool      `json:"verified"` // its domain is hosted by the reseller or a customer
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PanelHostname is the address a reseller's customers reach the panel at.
+// It is served with its own certificate and the reseller's branding.
+type PanelHostname struct {
+	ID                   uint       `json:"id" gorm:"primarykey"`
+	ResellerID           uint       `json:"reseller_id" gorm:"uniqueIndex"`
+	Hostname             string     `json:"hostname" gorm:"size:253;uniqueIndex"`
+	Status               string     `json:"status" gorm:"size:20;default:pending"` // pending, active, failed
+	LastError            string     `json:"last_error" gorm:"size:1000"`
+	CertificatePath      string     `json:"certificate_path" gorm:"size:500"`
+	KeyPath              string     `json:"-" gorm:"size:500"`
+	CertificateExpiresAt *time.Time `json:"certificate_expires_at"`
+	CheckedAt            *time.Time `json:"checked_at"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one login of a user on a device. Every refresh token issued for
+// it belongs to the same family; only the latest one is accepted.
+type Session struct {
+	ID               uint       `json:"id" gorm:"primarykey"`
+	PublicID         string     `json:"-" gorm:"uniqueIndex;size:64"`
+	UserID           uint       `json:"user_id" gorm:"index"`
+	User             *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	RefreshTokenHash string     `json:"-" gorm:"size:64"`
+	Device           string     `json:"device" gorm:"size:255"`
+	IP               string     `json:"ip" gorm:"size:45"`
+	UserAgent        string     `json:"user_agent" gorm:"size:500"`
+	AuthMethods      string     `json:"auth_methods" gorm:"size:100"` // comma separated RFC 8176 values
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	RevokedReason    string     `json:"revoked_reason,omitempty" gorm:"size:100"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
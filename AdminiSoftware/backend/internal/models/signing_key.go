@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a key pair in the JWT key ring. A "next" key is published
+// before it signs so verifiers caching the JWKS learn it in advance, the
+// newest "active" key signs, and a "retiring" key is still published until
+// RetireAt so tokens it signed stay valid. Retired keys are deleted.
+type SigningKey struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	KID         string     `json:"kid" gorm:"size:64;uniqueIndex;not null"`
+	Algorithm   string     `json:"algorithm" gorm:"size:10;not null"`
+	PrivateKey  string     `json:"-" gorm:"type:text;not null"` // PKCS #8 PEM
+	PublicKey   string     `json:"public_key" gorm:"type:text;not null"`
+	Status      string     `json:"status" gorm:"size:20;index;not null"`
+	ActivatedAt *time.Time `json:"activated_at"`
+	RetireAt    *time.Time `json:"retire_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
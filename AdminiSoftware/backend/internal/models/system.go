@@ -103,3 +103,32 @@ type SecurityEvent struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+type Alert struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Type      string    `json:"type" gorm:"size:50"`
+	Severity  string    `json:"severity" gorm:"size:20"` // info, warning, critical
+	Message   string    `json:"message" gorm:"type:text"`
+	IsRead    bool      `json:"is_read" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Branding is how a reseller presents the panel, and the emails it sends,
+// to the reseller's customers. UserID is the reseller.
+type Branding struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	UserID        uint           `json:"user_id" gorm:"uniqueIndex"`
+	LogoURL       string         `json:"logo_url" gorm:"size:500"`
+	CompanyName   string         `json:"company_name" gorm:"size:255"`
+	SupportURL    string         `json:"support_url" gorm:"size:500"`
+	TermsURL      string         `json:"terms_url" gorm:"size:500"`
+	ThemeColor    string         `json:"theme_color" gorm:"size:20"`
+	CustomCSS     string         `json:"custom_css" gorm:"type:text"`
+	ShowPoweredBy bool           `json:"show_powered_by" gorm:"default:true"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// TwoFactorBackupCode is a single-use recovery code for a user whose
+// authenticator app is unavailable. Only a bcrypt hash is stored.
+type TwoFactorBackupCode struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"size:255"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TrustedDevice is a browser on which the user skips the one-time code
+// until ExpiresAt. The browser holds a signed cookie naming the device and
+// carrying a secret of which only the hash is stored.
+type TrustedDevice struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	SecretHash string     `json:"-" gorm:"size:64"`
+	Name       string     `json:"name" gorm:"size:500"` // user agent when trusted
+	IP         string     `json:"ip" gorm:"size:45"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
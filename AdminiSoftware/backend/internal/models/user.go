@@ -55,7 +55,10 @@ type User struct {
 	Email            string         `json:"email" gorm:"uniqueIndex;size:255"`
 	Password         string         `json:"-" gorm:"size:255"`
 	Role             string         `json:"role" gorm:"size:20;default:user"`
-	Status           string         `json:"status" gorm:"size:20;default:active"`
+	Status           string         `json:"status" gorm:"size:20;default:active"` // pending, active, suspended, terminated, purged
+	StatusReason     string         `json:"status_reason" gorm:"size:500"`
+	StatusChangedAt  *time.Time     `json:"status_changed_at"`
+	PurgeAfter       *time.Time     `json:"purge_after" gorm:"index"` // terminated accounts are purged once this passes
 	FirstName        string         `json:"first_name" gorm:"size:100"`
 	LastName         string         `json:"last_name" gorm:"size:100"`
 	ContactEmail     string         `json:"contact_email" gorm:"size:255"`
@@ -63,9 +66,12 @@ type User struct {
 	Language         string         `json:"language" gorm:"size:10;default:en"`
 	TwoFactorEnabled bool           `json:"two_factor_enabled" gorm:"default:false"`
 	TwoFactorSecret  string         `json:"-" gorm:"size:255"`
+	TOTPLastStep     int64          `json:"-" gorm:"default:0"` // last accepted time-step, so a code works once
 	LastLogin        *time.Time     `json:"last_login"`
+	PasswordChangedAt *time.Time    `json:"password_changed_at"`
 	PackageID        *uint          `json:"package_id"`
 	Package          *Package       `json:"package,omitempty" gorm:"foreignKey:PackageID"`
+	ResellerID       *uint          `json:"reseller_id" gorm:"index"`
 	Domains          []Domain       `json:"domains,omitempty" gorm:"foreignKey:UserID"`
 	Databases        []Database     `json:"databases,omitempty" gorm:"foreignKey:UserID"`
 	Emails           []Email        `json:"emails,omitempty" gorm:"foreignKey:UserID"`
@@ -85,3 +91,16 @@ type LoginAttempt struct {
 	UserAgent string    `json:"user_agent" gorm:"size:500"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// AccountTransition records a move of an account between lifecycle states.
+// Warnings lists side effects that could not be applied to the server.
+type AccountTransition struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	From      string    `json:"from" gorm:"size:20"`
+	To        string    `json:"to" gorm:"size:20"`
+	Reason    string    `json:"reason" gorm:"size:500"`
+	ActorID   uint      `json:"actor_id"` // 0 for the system
+	Warnings  string    `json:"warnings" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential is a security key or passkey registered by a user.
+type WebAuthnCredential struct {
+	ID              uint           `json:"id" gorm:"primarykey"`
+	UserID          uint           `json:"user_id" gorm:"index"`
+	User            User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name            string         `json:"name" gorm:"size:100"`
+	CredentialID    string         `json:"-" gorm:"uniqueIndex;size:512"` // base64url
+	PublicKey       []byte         `json:"-"`
+	AttestationType string         `json:"attestation_type" gorm:"size:50"`
+	Transports      string         `json:"transports" gorm:"size:255"`
+	AAGUID          string         `json:"aaguid" gorm:"size:64"`
+	SignCount       uint32         `json:"sign_count"`
+	CloneWarning    bool           `json:"clone_warning" gorm:"default:false"`
+	BackupEligible  bool           `json:"backup_eligible"`
+	BackupState     bool           `json:"backup_state"`
+	LastUsedAt      *time.Time     `json:"last_used_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WebAuthnChallenge holds the server side of a registration or login ceremony
+// until the browser answers it.
+type WebAuthnChallenge struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CeremonyID  string    `json:"ceremony_id" gorm:"uniqueIndex;size:64"`
+	UserID      *uint     `json:"user_id"`
+	Type        string    `json:"type" gorm:"size:20"` // registration, login, mfa
+	SessionData string    `json:"-" gorm:"type:text"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,1162 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AccountArchiveFormat  = "adminisoftware-account"
+	AccountArchiveVersion = 1
+
+	accountArchiveDir   = "account"
+	accountArchiveFile  = "account.json"
+	accountManifestType = "account"
+)
+
+// AccountArchive is the portable description of an account. Records refer to
+// each other by name rather than ID so they can be recreated on another server.
+type AccountArchive struct {
+	Format       string                `json:"format"`
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exported_at"`
+	SourceHost   string                `json:"source_host"`
+	User         ArchivedUser          `json:"user"`
+	Package      *ArchivedPackage      `json:"package,omitempty"`
+	Domains      []ArchivedDomain      `json:"domains"`
+	Emails       []ArchivedEmail       `json:"emails"`
+	Databases    []ArchivedDatabase    `json:"databases"`
+	Certificates []ArchivedSSL         `json:"certificates"`
+	CronJobs     []ArchivedCronJob     `json:"cron_jobs"`
+	Applications []ArchivedApplication `json:"applications"`
+}
+
+// ArchivedUser describes the account's login. Role is informational: imports
+// always create a user account, and Reseller names the owning reseller by
+// username.
+type ArchivedUser struct {
+	ID               uint                    `json:"id"`
+	Username         string                  `json:"username"`
+	Email            string                  `json:"email"`
+	PasswordHash     string                  `json:"password_hash"`
+	Role             string                  `json:"role"`
+	Reseller         string                  `json:"reseller,omitempty"`
+	Status           string                  `json:"status"`
+	FirstName        string                  `json:"first_name"`
+	LastName         string                  `json:"last_name"`
+	ContactEmail     string                  `json:"contact_email"`
+	Theme            string                  `json:"theme"`
+	Language         string                  `json:"language"`
+	TwoFactorEnabled bool                    `json:"two_factor_enabled"`
+	TwoFactorSecret  string                  `json:"two_factor_secret"`
+	BackupCodes      []ArchivedBackupCode    `json:"backup_codes"`
+	TrustedDevices   []ArchivedTrustedDevice `json:"trusted_devices"`
+	CreatedAt        time.Time               `json:"created_at"`
+}
+
+type ArchivedBackupCode struct {
+	CodeHash  string     `json:"code_hash"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ArchivedTrustedDevice struct {
+	SecretHash string     `json:"secret_hash"`
+	Name       string     `json:"name"`
+	IP         string     `json:"ip"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ArchivedPackage struct {
+	Name          string `json:"name"`
+	DiskQuotaMB   int    `json:"disk_quota_mb"`
+	BandwidthMB   int    `json:"bandwidth_mb"`
+	EmailAccounts int    `json:"email_accounts"`
+	Databases     int    `json:"databases"`
+	SubDomains    int    `json:"sub_domains"`
+	ParkedDomains int    `json:"parked_domains"`
+	AddonDomains  int    `json:"addon_domains"`
+	FTPAccounts   int    `json:"ftp_accounts"`
+	CronJobs      int    `json:"cron_jobs"`
+	CGIAccess     bool   `json:"cgi_access"`
+	SSHAccess     bool   `json:"ssh_access"`
+	SSLSupport    bool   `json:"ssl_support"`
+	Features      string `json:"features"`
+}
+
+type ArchivedDomain struct {
+	Name         string             `json:"name"`
+	Type         string             `json:"type"` // primary, addon, subdomain, parked
+	Status       string             `json:"status"`
+	DocumentRoot string             `json:"document_root"`
+	SSLEnabled   bool               `json:"ssl_enabled"`
+	Redirects    []ArchivedRedirect `json:"redirects"`
+	Zone         *ArchivedDNSZone   `json:"zone,omitempty"`
+	DNSRecords   []ArchivedDNS      `json:"dns_records"`
+}
+
+type ArchivedRedirect struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+type ArchivedDNSZone struct {
+	Serial  string `json:"serial"`
+	Refresh int    `json:"refresh"`
+	Retry   int    `json:"retry"`
+	Expire  int    `json:"expire"`
+	Minimum int    `json:"minimum"`
+}
+
+type ArchivedDNS struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority"`
+	Status   string `json:"status"`
+}
+
+type ArchivedEmail struct {
+	Email        string              `json:"email"`
+	Domain       string              `json:"domain"`
+	PasswordHash string              `json:"password_hash"`
+	QuotaMB      int                 `json:"quota_mb"`
+	UsedMB       int                 `json:"used_mb"`
+	Status       string              `json:"status"`
+	Forwarders   []ArchivedForwarder `json:"forwarders"`
+	Filters      []ArchivedFilter    `json:"filters"`
+}
+
+type ArchivedForwarder struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Status      string `json:"status"`
+}
+
+type ArchivedFilter struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	Action    string `json:"action"`
+	Status    string `json:"status"`
+}
+
+type ArchivedDatabase struct {
+	Name         string                 `json:"name"`
+	Type         string                 `json:"type"`
+	Host         string                 `json:"host"`
+	Port         int                    `json:"port"`
+	Username     string                 `json:"username"`
+	PasswordHash string                 `json:"password_hash"`
+	Size         int64                  `json:"size"`
+	MaxSize      int64                  `json:"max_size"`
+	Status       string                 `json:"status"`
+	Users        []ArchivedDatabaseUser `json:"users"`
+}
+
+type ArchivedDatabaseUser struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Host         string `json:"host"`
+	Privileges   string `json:"privileges"`
+}
+
+type ArchivedSSL struct {
+	Domain      string     `json:"domain"`
+	Type        string     `json:"type"`
+	Certificate string     `json:"certificate"`
+	PrivateKey  string     `json:"private_key"`
+	Chain       string     `json:"chain"`
+	Status      string     `json:"status"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	AutoRenew   bool       `json:"auto_renew"`
+}
+
+type ArchivedCronJob struct {
+	Command  string     `json:"command"`
+	Schedule string     `json:"schedule"`
+	Email    string     `json:"email"`
+	Enabled  bool       `json:"enabled"`
+	LastRun  *time.Time `json:"last_run"`
+}
+
+type ArchivedApplication struct {
+	Domain    string                `json:"domain"`
+	Name      string                `json:"name"`
+	Type      string                `json:"type"`
+	Version   string                `json:"version"`
+	Path      string                `json:"path"`
+	URL       string                `json:"url"`
+	Status    string                `json:"status"`
+	Config    string                `json:"config"`
+	Variables []ArchivedAppVariable `json:"variables"`
+	WordPress *ArchivedWordPress    `json:"wordpress,omitempty"`
+}
+
+type ArchivedAppVariable struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	IsSecret bool   `json:"is_secret"`
+}
+
+type ArchivedWordPress struct {
+	AdminUser  string `json:"admin_user"`
+	AdminEmail string `json:"admin_email"`
+	SiteTitle  string `json:"site_title"`
+	Plugins    string `json:"plugins"`
+	Themes     string `json:"themes"`
+}
+
+type AccountArchiveService struct {
+	db      *gorm.DB
+	logger  *utils.Logger
+	backups *BackupService
+}
+
+func NewAccountArchiveService(db *gorm.DB, logger *utils.Logger) *AccountArchiveService {
+	return &AccountArchiveService{
+		db:      db,
+		logger:  logger,
+		backups: NewBackupService(db, logger),
+	}
+}
+
+// ExportAccount writes a portable archive of the account to archivePath. The
+// layout matches full backups with an extra account/account.json member.
+func (s *AccountArchiveService) ExportAccount(userID uint, archivePath string) error {
+	archive, err := s.buildArchive(userID)
+	if err != nil {
+		return err
+	}
+
+	stagingDir, err := os.MkdirTemp(filepath.Dir(archivePath), ".export_")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	accountDir := filepath.Join(stagingDir, accountArchiveDir)
+	if err := os.MkdirAll(accountDir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(accountDir, accountArchiveFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write account description: %v", err)
+	}
+
+	job := newBackupJob(context.Background(), 0, userID, "export")
+	defer job.cancel()
+
+	if err := s.backups.dumpUserDatabases(job, userID, stagingDir); err != nil {
+		return err
+	}
+
+	sources := []archiveSource{
+		{prefix: accountArchiveDir, dir: accountDir},
+		{prefix: backupDatabasesDir, dir: filepath.Join(stagingDir, backupDatabasesDir)},
+	}
+	homeDir := accountHomeDir(userID)
+	if _, err := os.Stat(homeDir); err == nil {
+		sources = append(sources, archiveSource{prefix: backupHomeDir, dir: homeDir})
+	}
+
+	manifest := &BackupManifest{
+		SchemaVersion: backupManifestVersion,
+		UserID:        userID,
+		Type:          accountManifestType,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if err := s.backups.writeArchive(job, archivePath, sources, manifest); err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+
+	s.logger.Info(fmt.Sprintf("Exported account %s (%d) to %s", archive.User.Username, userID, archivePath))
+	return nil
+}
+
+func (s *AccountArchiveService) buildArchive(userID uint) (*AccountArchive, error) {
+	var user models.User
+	if err := s.db.Preload("Package").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	archive := &AccountArchive{
+		Format:     AccountArchiveFormat,
+		Version:    AccountArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		SourceHost: hostname,
+		User: ArchivedUser{
+			ID:               user.ID,
+			Username:         user.Username,
+			Email:            user.Email,
+			PasswordHash:     user.Password,
+			Role:             user.Role,
+			Status:           user.Status,
+			FirstName:        user.FirstName,
+			LastName:         user.LastName,
+			ContactEmail:     user.ContactEmail,
+			Theme:            user.Theme,
+			Language:         user.Language,
+			TwoFactorEnabled: user.TwoFactorEnabled,
+			TwoFactorSecret:  user.TwoFactorSecret,
+			CreatedAt:        user.CreatedAt,
+		},
+	}
+
+	if user.ResellerID != nil {
+		var reseller models.User
+		if err := s.db.Select("username").First(&reseller, *user.ResellerID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load reseller: %v", err)
+		}
+		archive.User.Reseller = reseller.Username
+	}
+
+	var codes []models.TwoFactorBackupCode
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&codes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load backup codes: %v", err)
+	}
+	for _, code := range codes {
+		archive.User.BackupCodes = append(archive.User.BackupCodes, ArchivedBackupCode{
+			CodeHash:  code.CodeHash,
+			UsedAt:    code.UsedAt,
+			CreatedAt: code.CreatedAt,
+		})
+	}
+
+	var devices []models.TrustedDevice
+	if err := s.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("id").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load trusted devices: %v", err)
+	}
+	for _, device := range devices {
+		archive.User.TrustedDevices = append(archive.User.TrustedDevices, ArchivedTrustedDevice{
+			SecretHash: device.SecretHash,
+			Name:       device.Name,
+			IP:         device.IP,
+			ExpiresAt:  device.ExpiresAt,
+			LastUsedAt: device.LastUsedAt,
+			CreatedAt:  device.CreatedAt,
+		})
+	}
+
+	if user.Package != nil {
+		pkg := user.Package
+		archive.Package = &ArchivedPackage{
+			Name:          pkg.Name,
+			DiskQuotaMB:   pkg.DiskQuotaMB,
+			BandwidthMB:   pkg.BandwidthMB,
+			EmailAccounts: pkg.EmailAccounts,
+			Databases:     pkg.Databases,
+			SubDomains:    pkg.SubDomains,
+			ParkedDomains: pkg.ParkedDomains,
+			AddonDomains:  pkg.AddonDomains,
+			FTPAccounts:   pkg.FTPAccounts,
+			CronJobs:      pkg.CronJobs,
+			CGIAccess:     pkg.CGIAccess,
+			SSHAccess:     pkg.SSHAccess,
+			SSLSupport:    pkg.SSLSupport,
+			Features:      pkg.Features,
+		}
+	}
+
+	var domains []models.Domain
+	if err := s.db.Preload("Redirects").Preload("DNSRecords").Where("user_id = ?", userID).
+		Order("id").Find(&domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to load domains: %v", err)
+	}
+
+	domainNames := make(map[uint]string, len(domains))
+	for _, domain := range domains {
+		domainNames[domain.ID] = domain.Name
+
+		entry := ArchivedDomain{
+			Name:         domain.Name,
+			Type:         domain.Type,
+			Status:       domain.Status,
+			DocumentRoot: domain.DocumentRoot,
+			SSLEnabled:   domain.SSLEnabled,
+		}
+		for _, redirect := range domain.Redirects {
+			entry.Redirects = append(entry.Redirects, ArchivedRedirect{
+				Source: redirect.Source,
+				Target: redirect.Target,
+				Type:   redirect.Type,
+			})
+		}
+		for _, record := range domain.DNSRecords {
+			entry.DNSRecords = append(entry.DNSRecords, ArchivedDNS{
+				Name:     record.Name,
+				Type:     record.Type,
+				Value:    record.Value,
+				TTL:      record.TTL,
+				Priority: record.Priority,
+				Status:   record.Status,
+			})
+		}
+
+		var zone models.DNSZone
+		if err := s.db.Where("domain_id = ?", domain.ID).First(&zone).Error; err == nil {
+			entry.Zone = &ArchivedDNSZone{
+				Serial:  zone.Serial,
+				Refresh: zone.Refresh,
+				Retry:   zone.Retry,
+				Expire:  zone.Expire,
+				Minimum: zone.Minimum,
+			}
+		}
+
+		archive.Domains = append(archive.Domains, entry)
+	}
+
+	var emails []models.Email
+	if err := s.db.Preload("Forwarders").Preload("Filters").Where("user_id = ?", userID).
+		Order("id").Find(&emails).Error; err != nil {
+		return nil, fmt.Errorf("failed to load email accounts: %v", err)
+	}
+	for _, email := range emails {
+		entry := ArchivedEmail{
+			Email:        email.Email,
+			Domain:       domainNames[email.DomainID],
+			PasswordHash: email.Password,
+			QuotaMB:      email.QuotaMB,
+			UsedMB:       email.UsedMB,
+			Status:       email.Status,
+		}
+		for _, forwarder := range email.Forwarders {
+			entry.Forwarders = append(entry.Forwarders, ArchivedForwarder{
+				Source:      forwarder.Source,
+				Destination: forwarder.Destination,
+				Status:      forwarder.Status,
+			})
+		}
+		for _, filter := range email.Filters {
+			entry.Filters = append(entry.Filters, ArchivedFilter{
+				Name:      filter.Name,
+				Condition: filter.Condition,
+				Action:    filter.Action,
+				Status:    filter.Status,
+			})
+		}
+		archive.Emails = append(archive.Emails, entry)
+	}
+
+	var databases []models.Database
+	if err := s.db.Preload("Users").Where("user_id = ?", userID).Order("id").Find(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to load databases: %v", err)
+	}
+	for _, database := range databases {
+		entry := ArchivedDatabase{
+			Name:         database.Name,
+			Type:         database.Type,
+			Host:         database.Host,
+			Port:         database.Port,
+			Username:     database.Username,
+			PasswordHash: database.Password,
+			Size:         database.Size,
+			MaxSize:      database.MaxSize,
+			Status:       database.Status,
+		}
+		for _, dbUser := range database.Users {
+			entry.Users = append(entry.Users, ArchivedDatabaseUser{
+				Username:     dbUser.Username,
+				PasswordHash: dbUser.Password,
+				Host:         dbUser.Host,
+				Privileges:   dbUser.Privileges,
+			})
+		}
+		archive.Databases = append(archive.Databases, entry)
+	}
+
+	var certificates []models.SSL
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&certificates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load certificates: %v", err)
+	}
+	for _, certificate := range certificates {
+		archive.Certificates = append(archive.Certificates, ArchivedSSL{
+			Domain:      domainNames[certificate.DomainID],
+			Type:        certificate.Type,
+			Certificate: certificate.Certificate,
+			PrivateKey:  certificate.PrivateKey,
+			Chain:       certificate.Chain,
+			Status:      certificate.Status,
+			ExpiresAt:   certificate.ExpiresAt,
+			AutoRenew:   certificate.AutoRenew,
+		})
+	}
+
+	var cronJobs []models.CronJob
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&cronJobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load cron jobs: %v", err)
+	}
+	for _, cronJob := range cronJobs {
+		archive.CronJobs = append(archive.CronJobs, ArchivedCronJob{
+			Command:  cronJob.Command,
+			Schedule: cronJob.Schedule,
+			Email:    cronJob.Email,
+			Enabled:  cronJob.Enabled,
+			LastRun:  cronJob.LastRun,
+		})
+	}
+
+	var applications []models.Application
+	if err := s.db.Preload("Variables").Where("user_id = ?", userID).Order("id").Find(&applications).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applications: %v", err)
+	}
+	for _, application := range applications {
+		entry := ArchivedApplication{
+			Domain:  domainNames[application.DomainID],
+			Name:    application.Name,
+			Type:    application.Type,
+			Version: application.Version,
+			Path:    application.Path,
+			URL:     application.URL,
+			Status:  application.Status,
+			Config:  application.Config,
+		}
+		for _, variable := range application.Variables {
+			entry.Variables = append(entry.Variables, ArchivedAppVariable{
+				Key:      variable.Key,
+				Value:    variable.Value,
+				IsSecret: variable.IsSecret,
+			})
+		}
+
+		var install models.WordPressInstall
+		if err := s.db.Where("application_id = ?", application.ID).First(&install).Error; err == nil {
+			entry.WordPress = &ArchivedWordPress{
+				AdminUser:  install.AdminUser,
+				AdminEmail: install.AdminEmail,
+				SiteTitle:  install.SiteTitle,
+				Plugins:    install.Plugins,
+				Themes:     install.Themes,
+			}
+		}
+
+		archive.Applications = append(archive.Applications, entry)
+	}
+
+	return archive, nil
+}
+
+// ImportAccount recreates an exported account as a user account, whatever
+// role it had on the source server. resellerID places it under that reseller;
+// when nil, the archived reseller is looked up here by username. Rows are
+// created in a single transaction which is rolled back, and the restored
+// databases dropped, if the files or databases cannot be restored.
+//
+// Archives come from other servers and are not signed by this one, so
+// nothing in them is trusted beyond the account's own data: database grants
+// are rebuilt from the archived users, files are owned by the new account,
+// and the archived status is reached through the account lifecycle, recorded
+// as a change by actorID.
+func (s *AccountArchiveService) ImportAccount(archivePath string, resellerID *uint, actorID uint) (*models.User, error) {
+	manifest, err := s.backups.verifyArchive(archivePath, false)
+	if err != nil {
+		return nil, fmt.Errorf("archive failed verification: %v", err)
+	}
+	if manifest.Type != accountManifestType {
+		return nil, fmt.Errorf("not an account archive: %s", manifest.Type)
+	}
+
+	stagingDir, err := os.MkdirTemp(filepath.Dir(archivePath), ".import_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if output, err := exec.Command("tar", "-xzf", archivePath, "-C", stagingDir,
+		"--no-same-owner", "--no-same-permissions").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to extract archive: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	data, err := os.ReadFile(filepath.Join(stagingDir, accountArchiveDir, accountArchiveFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account description: %v", err)
+	}
+
+	var archive AccountArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("invalid account description: %v", err)
+	}
+	if archive.Format != AccountArchiveFormat {
+		return nil, fmt.Errorf("unknown archive format: %s", archive.Format)
+	}
+	if archive.Version > AccountArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+
+	if resellerID == nil {
+		if resellerID, err = s.findReseller(archive.User.Reseller); err != nil {
+			return nil, err
+		}
+	}
+
+	dumpDir := filepath.Join(stagingDir, backupDatabasesDir)
+	entries, err := readDatabaseIndex(dumpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := importedGrants(&archive, entries); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkConflicts(&archive, entries); err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	var restored []BackupDatabaseEntry
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user, err = s.createAccount(tx, &archive, resellerID); err != nil {
+			return err
+		}
+
+		homeDir := accountHomeDir(user.ID)
+		if err := s.restoreHomeDir(stagingDir, homeDir, user.Username); err != nil {
+			os.RemoveAll(homeDir)
+			return err
+		}
+
+		// checkConflicts made sure none of these existed, so every one
+		// touched here is dropped again if the import does not commit
+		for i := range entries {
+			restored = append(restored, entries[i])
+			if err := s.backups.restoreDatabase(context.Background(), &entries[i], dumpDir); err != nil {
+				os.RemoveAll(homeDir)
+				return fmt.Errorf("failed to restore database %s: %v", entries[i].Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range restored {
+			if dropErr := dropDatabase(&restored[i]); dropErr != nil {
+				s.logger.Error(fmt.Sprintf("Failed to drop database %s after failed import: %v", restored[i].Name, dropErr))
+			}
+		}
+		return nil, err
+	}
+
+	// The archived NS records name the source server's nameservers
+	var domains []models.Domain
+	s.db.Where("user_id = ?", user.ID).Find(&domains)
+	nameservers := NewNameserverService(s.db, s.logger)
+	for i := range domains {
+		if err := nameservers.ApplyToDomain(&domains[i]); err != nil {
+			s.logger.Error(err.Error())
+		}
+	}
+
+	// Accounts are created active; a suspended or terminated one is moved
+	// there so the lifecycle takes down what the state requires
+	switch archive.User.Status {
+	case AccountSuspended, AccountTerminated:
+		reason := fmt.Sprintf("%s on %s when exported", archive.User.Status, archive.SourceHost)
+		if _, err := NewAccountLifecycle(s.db, s.logger).Transition(user.ID, archive.User.Status, reason, actorID); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to restore status %s of imported account %s: %v", archive.User.Status, user.Username, err))
+		} else {
+			user.Status = archive.User.Status
+		}
+	}
+
+	s.logger.Info(fmt.Sprintf("Imported account %s from %s as user %d", user.Username, archive.SourceHost, user.ID))
+	return user, nil
+}
+
+// importedGrants replaces the grants packed with each dump by ones built
+// from the archived database users, so an archive cannot run statements of
+// its own as the database superuser. A PostgreSQL dump must be owned by one
+// of those users.
+func importedGrants(archive *AccountArchive, entries []BackupDatabaseEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+
+		var database *ArchivedDatabase
+		for j := range archive.Databases {
+			if archive.Databases[j].Name == entry.Name && archive.Databases[j].Type == entry.Type {
+				database = &archive.Databases[j]
+				break
+			}
+		}
+		if database == nil {
+			return fmt.Errorf("database %s is not described in the archive", entry.Name)
+		}
+
+		exported := make(map[string]BackupDatabaseUser, len(entry.Grants))
+		for _, grant := range entry.Grants {
+			exported[grant.Username+"@"+grant.Host] = grant
+		}
+
+		owned := false
+		grants := make([]BackupDatabaseUser, 0, len(database.Users))
+		for _, dbUser := range database.Users {
+			grant := BackupDatabaseUser{Username: dbUser.Username, Host: dbUser.Host, Privileges: dbUser.Privileges}
+			source := exported[dbUser.Username+"@"+dbUser.Host]
+
+			switch entry.Type {
+			case "mysql":
+				statements, err := mysqlGrantStatements(entry.Name, dbUser, source.Statements)
+				if err != nil {
+					return fmt.Errorf("database %s: %v", entry.Name, err)
+				}
+				grant.Statements = statements
+			case "postgresql":
+				if _, err := postgresPrivileges(dbUser.Privileges); err != nil {
+					return fmt.Errorf("database %s: %v", entry.Name, err)
+				}
+				grant.PasswordHash = source.PasswordHash
+				if grant.PasswordHash == "" && len(source.Statements) > 0 {
+					if match := legacyRolePassword.FindStringSubmatch(source.Statements[0]); match != nil {
+						grant.PasswordHash = match[1]
+					}
+				}
+			}
+
+			if dbUser.Username == entry.Owner {
+				owned = true
+			}
+			grants = append(grants, grant)
+		}
+
+		if entry.Type == "postgresql" && !owned {
+			return fmt.Errorf("owner %s of database %s is not one of its users", entry.Owner, entry.Name)
+		}
+		entry.Grants = grants
+	}
+	return nil
+}
+
+// mysqlGrantStatements creates the user and grants it the archived
+// privileges on the database alone. The password hash comes from the
+// archived user or the exported CREATE USER statement; a user without a
+// mysql_native_password hash is created locked until its password is reset.
+func mysqlGrantStatements(database string, dbUser ArchivedDatabaseUser, exported []string) ([]string, error) {
+	privileges, err := mysqlPrivileges(dbUser.Privileges)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := mysqlNativePassword.FindString(dbUser.PasswordHash)
+	for _, statement := range exported {
+		if hash == "" && strings.HasPrefix(strings.ToUpper(statement), "CREATE USER") {
+			hash = mysqlNativePassword.FindString(statement)
+		}
+	}
+
+	account := mysqlString(dbUser.Username) + "@" + mysqlString(dbUser.Host)
+	create := "CREATE USER " + account + " ACCOUNT LOCK"
+	if hash != "" {
+		create = "CREATE USER " + account + " IDENTIFIED WITH mysql_native_password AS " + mysqlString(hash)
+	}
+	return []string{
+		create,
+		fmt.Sprintf("GRANT %s ON %s.* TO %s", privileges, mysqlIdent(database), account),
+	}, nil
+}
+
+// findReseller resolves the archived reseller by username. Archives whose
+// reseller does not exist here are imported without one.
+func (s *AccountArchiveService) findReseller(username string) (*uint, error) {
+	if username == "" {
+		return nil, nil
+	}
+	var reseller models.User
+	err := s.db.Where("username = ? AND role = ?", username, "reseller").First(&reseller).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Info(fmt.Sprintf("Reseller %s of imported account not found, importing without one", username))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up reseller: %v", err)
+	}
+	return &reseller.ID, nil
+}
+
+// checkConflicts rejects archives whose unique names are already taken here,
+// either in the panel or on the database servers.
+func (s *AccountArchiveService) checkConflicts(archive *AccountArchive, entries []BackupDatabaseEntry) error {
+	var count int64
+	s.db.Model(&models.User{}).Where("username = ? OR email = ?", archive.User.Username, archive.User.Email).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("user %s already exists", archive.User.Username)
+	}
+
+	for _, domain := range archive.Domains {
+		s.db.Model(&models.Domain{}).Where("name = ?", domain.Name).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("domain %s already exists", domain.Name)
+		}
+	}
+
+	for _, email := range archive.Emails {
+		s.db.Model(&models.Email{}).Where("email = ?", email.Email).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("email account %s already exists", email.Email)
+		}
+	}
+
+	for _, database := range archive.Databases {
+		s.db.Model(&models.Database{}).Where("name = ? AND type = ?", database.Name, database.Type).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("database %s already exists", database.Name)
+		}
+	}
+
+	for i := range entries {
+		exists, err := databaseExists(&entries[i])
+		if err != nil {
+			return fmt.Errorf("failed to check database %s: %v", entries[i].Name, err)
+		}
+		if exists {
+			return fmt.Errorf("database %s or one of its users already exists on the server", entries[i].Name)
+		}
+	}
+
+	return nil
+}
+
+func (s *AccountArchiveService) createAccount(tx *gorm.DB, archive *AccountArchive, resellerID *uint) (*models.User, error) {
+	user := &models.User{
+		Username:         archive.User.Username,
+		Email:            archive.User.Email,
+		Password:         archive.User.PasswordHash,
+		Role:             "user",
+		ResellerID:       resellerID,
+		Status:           AccountActive,
+		FirstName:        archive.User.FirstName,
+		LastName:         archive.User.LastName,
+		ContactEmail:     archive.User.ContactEmail,
+		Theme:            archive.User.Theme,
+		Language:         archive.User.Language,
+		TwoFactorEnabled: archive.User.TwoFactorEnabled,
+		TwoFactorSecret:  archive.User.TwoFactorSecret,
+		CreatedAt:        archive.User.CreatedAt,
+	}
+
+	if archive.Package != nil {
+		pkg, err := s.findOrCreatePackage(tx, archive.Package)
+		if err != nil {
+			return nil, err
+		}
+		user.PackageID = &pkg.ID
+	}
+
+	if err := tx.Create(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	for _, entry := range archive.User.BackupCodes {
+		code := &models.TwoFactorBackupCode{
+			UserID:    user.ID,
+			CodeHash:  entry.CodeHash,
+			UsedAt:    entry.UsedAt,
+			CreatedAt: entry.CreatedAt,
+		}
+		if err := tx.Create(code).Error; err != nil {
+			return nil, fmt.Errorf("failed to create backup code: %v", err)
+		}
+	}
+
+	for _, entry := range archive.User.TrustedDevices {
+		device := &models.TrustedDevice{
+			UserID:     user.ID,
+			SecretHash: entry.SecretHash,
+			Name:       entry.Name,
+			IP:         entry.IP,
+			ExpiresAt:  entry.ExpiresAt,
+			LastUsedAt: entry.LastUsedAt,
+			CreatedAt:  entry.CreatedAt,
+		}
+		if err := tx.Create(device).Error; err != nil {
+			return nil, fmt.Errorf("failed to create trusted device: %v", err)
+		}
+	}
+
+	// Paths recorded on the source server point at the old home directory
+	rewrite := strings.NewReplacer(accountHomeDir(archive.User.ID), accountHomeDir(user.ID))
+
+	domainIDs := make(map[string]uint, len(archive.Domains))
+	for _, entry := range archive.Domains {
+		domain := &models.Domain{
+			UserID:       user.ID,
+			Name:         entry.Name,
+			Type:         entry.Type,
+			Status:       entry.Status,
+			DocumentRoot: rewrite.Replace(entry.DocumentRoot),
+			SSLEnabled:   entry.SSLEnabled,
+		}
+		for _, redirect := range entry.Redirects {
+			domain.Redirects = append(domain.Redirects, models.DomainRedirect{
+				Source: redirect.Source,
+				Target: redirect.Target,
+				Type:   redirect.Type,
+			})
+		}
+		for _, record := range entry.DNSRecords {
+			domain.DNSRecords = append(domain.DNSRecords, models.DNS{
+				Name:     record.Name,
+				Type:     record.Type,
+				Value:    record.Value,
+				TTL:      record.TTL,
+				Priority: record.Priority,
+				Status:   record.Status,
+			})
+		}
+		if err := tx.Create(domain).Error; err != nil {
+			return nil, fmt.Errorf("failed to create domain %s: %v", entry.Name, err)
+		}
+		domainIDs[entry.Name] = domain.ID
+
+		if entry.Zone != nil {
+			zone := &models.DNSZone{
+				DomainID: domain.ID,
+				Serial:   entry.Zone.Serial,
+				Refresh:  entry.Zone.Refresh,
+				Retry:    entry.Zone.Retry,
+				Expire:   entry.Zone.Expire,
+				Minimum:  entry.Zone.Minimum,
+			}
+			if err := tx.Create(zone).Error; err != nil {
+				return nil, fmt.Errorf("failed to create DNS zone for %s: %v", entry.Name, err)
+			}
+		}
+	}
+
+	for _, entry := range archive.Emails {
+		email := &models.Email{
+			UserID:   user.ID,
+			DomainID: domainIDs[entry.Domain],
+			Email:    entry.Email,
+			Password: entry.PasswordHash,
+			QuotaMB:  entry.QuotaMB,
+			UsedMB:   entry.UsedMB,
+			Status:   entry.Status,
+		}
+		for _, forwarder := range entry.Forwarders {
+			email.Forwarders = append(email.Forwarders, models.EmailForwarder{
+				Source:      forwarder.Source,
+				Destination: forwarder.Destination,
+				Status:      forwarder.Status,
+			})
+		}
+		for _, filter := range entry.Filters {
+			email.Filters = append(email.Filters, models.EmailFilter{
+				Name:      filter.Name,
+				Condition: filter.Condition,
+				Action:    filter.Action,
+				Status:    filter.Status,
+			})
+		}
+		if err := tx.Create(email).Error; err != nil {
+			return nil, fmt.Errorf("failed to create email account %s: %v", entry.Email, err)
+		}
+	}
+
+	for _, entry := range archive.Databases {
+		database := &models.Database{
+			UserID:   user.ID,
+			Name:     entry.Name,
+			Type:     entry.Type,
+			Host:     entry.Host,
+			Port:     entry.Port,
+			Username: entry.Username,
+			Password: entry.PasswordHash,
+			Size:     entry.Size,
+			MaxSize:  entry.MaxSize,
+			Status:   entry.Status,
+		}
+		for _, dbUser := range entry.Users {
+			database.Users = append(database.Users, models.DatabaseUser{
+				Username:   dbUser.Username,
+				Password:   dbUser.PasswordHash,
+				Host:       dbUser.Host,
+				Privileges: dbUser.Privileges,
+			})
+		}
+		if err := tx.Create(database).Error; err != nil {
+			return nil, fmt.Errorf("failed to create database %s: %v", entry.Name, err)
+		}
+	}
+
+	for _, entry := range archive.Certificates {
+		certificate := &models.SSL{
+			UserID:      user.ID,
+			DomainID:    domainIDs[entry.Domain],
+			Type:        entry.Type,
+			Certificate: entry.Certificate,
+			PrivateKey:  entry.PrivateKey,
+			Chain:       entry.Chain,
+			Status:      entry.Status,
+			ExpiresAt:   entry.ExpiresAt,
+			AutoRenew:   entry.AutoRenew,
+		}
+		if err := tx.Create(certificate).Error; err != nil {
+			return nil, fmt.Errorf("failed to create certificate for %s: %v", entry.Domain, err)
+		}
+		if !entry.AutoRenew {
+			tx.Model(certificate).Update("auto_renew", false)
+		}
+	}
+
+	for _, entry := range archive.CronJobs {
+		cronJob := &models.CronJob{
+			UserID:   user.ID,
+			Command:  rewrite.Replace(entry.Command),
+			Schedule: entry.Schedule,
+			Email:    entry.Email,
+			Enabled:  entry.Enabled,
+			LastRun:  entry.LastRun,
+		}
+		if err := tx.Create(cronJob).Error; err != nil {
+			return nil, fmt.Errorf("failed to create cron job: %v", err)
+		}
+		// gorm skips false for fields with a default, so write it explicitly
+		if !entry.Enabled {
+			tx.Model(cronJob).Update("enabled", false)
+		}
+	}
+
+	for _, entry := range archive.Applications {
+		application := &models.Application{
+			UserID:   user.ID,
+			DomainID: domainIDs[entry.Domain],
+			Name:     entry.Name,
+			Type:     entry.Type,
+			Version:  entry.Version,
+			Path:     rewrite.Replace(entry.Path),
+			URL:      entry.URL,
+			Status:   entry.Status,
+			Config:   entry.Config,
+		}
+		for _, variable := range entry.Variables {
+			application.Variables = append(application.Variables, models.AppVariable{
+				Key:      variable.Key,
+				Value:    variable.Value,
+				IsSecret: variable.IsSecret,
+			})
+		}
+		if err := tx.Create(application).Error; err != nil {
+			return nil, fmt.Errorf("failed to create application %s: %v", entry.Name, err)
+		}
+
+		if entry.WordPress != nil {
+			install := &models.WordPressInstall{
+				ApplicationID: application.ID,
+				AdminUser:     entry.WordPress.AdminUser,
+				AdminEmail:    entry.WordPress.AdminEmail,
+				SiteTitle:     entry.WordPress.SiteTitle,
+				Plugins:       entry.WordPress.Plugins,
+				Themes:        entry.WordPress.Themes,
+			}
+			if err := tx.Create(install).Error; err != nil {
+				return nil, fmt.Errorf("failed to create WordPress install for %s: %v", entry.Name, err)
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// findOrCreatePackage reuses a local package with the same name so imported
+// accounts keep the limits configured on this server.
+func (s *AccountArchiveService) findOrCreatePackage(tx *gorm.DB, entry *ArchivedPackage) (*models.Package, error) {
+	var pkg models.Package
+	err := tx.Where("name = ?", entry.Name).First(&pkg).Error
+	if err == nil {
+		return &pkg, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to look up package: %v", err)
+	}
+
+	pkg = models.Package{
+		Name:          entry.Name,
+		DiskQuotaMB:   entry.DiskQuotaMB,
+		BandwidthMB:   entry.BandwidthMB,
+		EmailAccounts: entry.EmailAccounts,
+		Databases:     entry.Databases,
+		SubDomains:    entry.SubDomains,
+		ParkedDomains: entry.ParkedDomains,
+		AddonDomains:  entry.AddonDomains,
+		FTPAccounts:   entry.FTPAccounts,
+		CronJobs:      entry.CronJobs,
+		CGIAccess:     entry.CGIAccess,
+		SSHAccess:     entry.SSHAccess,
+		SSLSupport:    entry.SSLSupport,
+		Features:      entry.Features,
+	}
+	if err := tx.Create(&pkg).Error; err != nil {
+		return nil, fmt.Errorf("failed to create package %s: %v", entry.Name, err)
+	}
+	if !entry.SSLSupport {
+		tx.Model(&pkg).Update("ssl_support", false)
+	}
+	return &pkg, nil
+}
+
+// restoreHomeDir copies the archived files into the new home directory
+// without their archived owners or setuid and setgid bits, and hands them to
+// the account's system user when there is one.
+func (s *AccountArchiveService) restoreHomeDir(stagingDir, homeDir, username string) error {
+	source := filepath.Join(stagingDir, backupHomeDir)
+	if _, err := os.Stat(source); os.IsNotExist(err) {
+		return os.MkdirAll(homeDir, 0755)
+	}
+
+	if err := os.MkdirAll(homeDir, 0755); err != nil {
+		return fmt.Errorf("failed to create home directory: %v", err)
+	}
+	if output, err := exec.Command("cp", "-R", "--no-dereference", "--preserve=mode,timestamps,links",
+		source+"/.", homeDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore files: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if exec.Command("id", "-u", username).Run() == nil {
+		if err := runCommand("chown", "-R", "--no-dereference", username+":", homeDir); err != nil {
+			return fmt.Errorf("failed to restore files: %v", err)
+		}
+	}
+	if err := runCommand("chmod", "-R", "ug-s", homeDir); err != nil {
+		return fmt.Errorf("failed to restore files: %v", err)
+	}
+	return nil
+}
+
+// readDatabaseIndex lists the dumps packed into the archive.
+func readDatabaseIndex(dumpDir string) ([]BackupDatabaseEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dumpDir, backupDBIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database index: %v", err)
+	}
+
+	var entries []BackupDatabaseEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid database index: %v", err)
+	}
+	return entries, nil
+}
+
+func accountHomeDir(userID uint) string {
+	return fmt.Sprintf("/home/users/%d", userID)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportedGrants(t *testing.T) {
+	archive := &AccountArchive{Databases: []ArchivedDatabase{
+		{Name: "shop", Type: "mysql", Users: []ArchivedDatabaseUser{
+			{Username: "shop_rw", Host: "localhost", Privileges: "SELECT, INSERT"},
+		}},
+		{Name: "blog", Type: "postgresql", Users: []ArchivedDatabaseUser{
+			{Username: "blog_owner", Host: "localhost"},
+		}},
+	}}
+
+	entries := []BackupDatabaseEntry{
+		{Name: "shop", Type: "mysql", Grants: []BackupDatabaseUser{{
+			Username: "shop_rw",
+			Host:     "localhost",
+			Statements: []string{
+				"CREATE USER `shop_rw`@`localhost` IDENTIFIED WITH 'mysql_native_password' AS '*0123456789ABCDEF0123456789ABCDEF01234567'",
+				"GRANT ALL PRIVILEGES ON *.* TO `shop_rw`@`localhost` WITH GRANT OPTION",
+			},
+		}}},
+		{Name: "blog", Type: "postgresql", Owner: "blog_owner", Grants: []BackupDatabaseUser{
+			{Username: "blog_owner", Host: "localhost", PasswordHash: "SCRAM-SHA-256$4096:abc"},
+		}},
+	}
+	require.NoError(t, importedGrants(archive, entries))
+
+	assert.Equal(t, []string{
+		"CREATE USER 'shop_rw'@'localhost' IDENTIFIED WITH mysql_native_password AS '*0123456789ABCDEF0123456789ABCDEF01234567'",
+		"GRANT SELECT, INSERT ON `shop`.* TO 'shop_rw'@'localhost'",
+	}, entries[0].Grants[0].Statements, "only the password hash is taken from the archived statements")
+	assert.Equal(t, "SCRAM-SHA-256$4096:abc", entries[1].Grants[0].PasswordHash)
+
+	// The superuser cannot be named as the owner of a dump
+	entries[1].Owner = "postgres"
+	assert.Error(t, importedGrants(archive, entries))
+
+	// Nor can a dump the archive does not describe be restored
+	assert.Error(t, importedGrants(archive, []BackupDatabaseEntry{{Name: "other", Type: "mysql"}}))
+
+	// Users without a usable hash are locked until their password is reset
+	statements, err := mysqlGrantStatements("shop", ArchivedDatabaseUser{Username: "u", Host: "%", Privileges: "ALL"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE USER 'u'@'%' ACCOUNT LOCK", statements[0])
+
+	_, err = mysqlGrantStatements("shop", ArchivedDatabaseUser{Username: "u", Host: "%", Privileges: "SUPER"}, nil)
+	assert.Error(t, err)
+}
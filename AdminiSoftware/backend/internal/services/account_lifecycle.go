@@ -0,0 +1,570 @@
+package services
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Account lifecycle states.
+const (
+	AccountPending    = "pending"
+	AccountActive     = "active"
+	AccountSuspended  = "suspended"
+	AccountTerminated = "terminated"
+	AccountPurged     = "purged"
+)
+
+// accountTransitions lists the states each state may move to. Terminated
+// accounts keep their data and can be restored until they are purged.
+var accountTransitions = map[string][]string{
+	AccountPending:    {AccountActive, AccountTerminated},
+	AccountActive:     {AccountSuspended, AccountTerminated},
+	AccountSuspended:  {AccountActive, AccountTerminated},
+	AccountTerminated: {AccountActive, AccountPurged},
+}
+
+// resourceSuspended marks mailboxes and domains turned off by the account's
+// suspension, so reactivation leaves the ones the owner turned off alone.
+const resourceSuspended = "account_suspended"
+
+var ErrAccountNotFound = errors.New("account not found")
+
+// AccountTransitionError is returned for a move the lifecycle does not allow.
+type AccountTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *AccountTransitionError) Error() string {
+	return fmt.Sprintf("account cannot move from %s to %s", e.From, e.To)
+}
+
+// CanTransition reports whether an account may move from one state to another.
+func CanTransition(from, to string) bool {
+	for _, allowed := range accountTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleHook applies one side effect of a transition to the server. An
+// error is recorded as a warning on the transition, which stands.
+type LifecycleHook struct {
+	Name  string
+	Apply func(user *models.User, from, to string) error
+}
+
+// AccountLifecycle moves accounts between states and applies what each
+// state means on the server: suspended and terminated accounts cannot log
+// in to mail or the databases, have no cron jobs and show a suspension page
+// instead of their sites. Terminated accounts are purged once
+// ACCOUNT_PURGE_GRACE has passed.
+//
+// Sites are switched with ACCOUNT_VHOST_SUSPEND_COMMAND and
+// ACCOUNT_VHOST_RESTORE_COMMAND, and removed on purge with
+// ACCOUNT_VHOST_REMOVE_COMMAND; in each, {domain}, {docroot} and {page} are
+// replaced with the domain, its document root and the directory holding the
+// suspension page.
+type AccountLifecycle struct {
+	db             *gorm.DB
+	sessions       *auth.SessionManager
+	databases      *DatabaseService
+	logger         *utils.Logger
+	hooks          []LifecycleHook
+	grace          time.Duration
+	pageDir        string
+	suspendCommand string
+	restoreCommand string
+	removeCommand  string
+}
+
+func NewAccountLifecycle(db *gorm.DB, logger *utils.Logger) *AccountLifecycle {
+	grace, err := time.ParseDuration(os.Getenv("ACCOUNT_PURGE_GRACE"))
+	if err != nil || grace < 0 {
+		grace = 30 * 24 * time.Hour
+	}
+	pageDir := os.Getenv("SUSPENSION_PAGE_DIR")
+	if pageDir == "" {
+		pageDir = "/var/www/suspended"
+	}
+
+	l := &AccountLifecycle{
+		db:             db,
+		sessions:       auth.NewSessionManager(db),
+		databases:      NewDatabaseService(db, logger),
+		logger:         logger,
+		grace:          grace,
+		pageDir:        pageDir,
+		suspendCommand: os.Getenv("ACCOUNT_VHOST_SUSPEND_COMMAND"),
+		restoreCommand: os.Getenv("ACCOUNT_VHOST_RESTORE_COMMAND"),
+		removeCommand:  os.Getenv("ACCOUNT_VHOST_REMOVE_COMMAND"),
+	}
+	l.hooks = []LifecycleHook{
+		{Name: "sessions", Apply: l.applySessions},
+		{Name: "mail", Apply: l.applyMail},
+		{Name: "web", Apply: l.applyWeb},
+		{Name: "databases", Apply: l.applyDatabases},
+		{Name: "cron", Apply: l.applyCron},
+		{Name: "purge", Apply: l.applyPurge},
+	}
+	return l
+}
+
+// NewLDAPManager returns a directory manager that provisions within reseller
+// pools and suspends and reactivates directory users through the lifecycle.
+func NewLDAPManager(db *gorm.DB, logger *utils.Logger) *auth.LDAPManager {
+	manager := auth.NewLDAPManager(db, logger)
+	manager.SetAccountPool(NewResellerPoolService(db))
+	manager.SetAccountStatus(NewAccountLifecycle(db, logger))
+	return manager
+}
+
+// AddHook adds a side effect, run after the built-in ones.
+func (l *AccountLifecycle) AddHook(hook LifecycleHook) {
+	l.hooks = append(l.hooks, hook)
+}
+
+// Transition moves the account to a state and records why and by whom
+// (actorID 0 for the system). The side effects are applied after the move is
+// committed; those that fail are logged and returned as the transition's
+// warnings.
+func (l *AccountLifecycle) Transition(userID uint, to, reason string, actorID uint) (*models.AccountTransition, error) {
+	var user models.User
+	var transition models.AccountTransition
+
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return ErrAccountNotFound
+		}
+
+		from := user.Status
+		if from == "" {
+			from = AccountActive
+		}
+		if !CanTransition(from, to) {
+			return &AccountTransitionError{From: from, To: to}
+		}
+		// Terminated accounts no longer count towards their reseller's pool
+		if from == AccountTerminated && to == AccountActive && user.ResellerID != nil {
+			if err := NewResellerPoolService(tx).CheckRestore(tx, *user.ResellerID, user.PackageID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":            to,
+			"status_reason":     reason,
+			"status_changed_at": now,
+			"purge_after":       nil,
+		}
+		if to == AccountTerminated {
+			updates["purge_after"] = now.Add(l.grace)
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to change account status: %v", err)
+		}
+
+		transition = models.AccountTransition{
+			UserID:  user.ID,
+			From:    from,
+			To:      to,
+			Reason:  reason,
+			ActorID: actorID,
+		}
+		return tx.Create(&transition).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, hook := range l.hooks {
+		if err := hook.Apply(&user, transition.From, to); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", hook.Name, err))
+			l.logger.Error(fmt.Sprintf("Account %s moving to %s: %s: %v", user.Username, to, hook.Name, err))
+		}
+	}
+	if len(warnings) > 0 {
+		transition.Warnings = strings.Join(warnings, "\n")
+		if err := l.db.Model(&transition).Update("warnings", transition.Warnings).Error; err != nil {
+			l.logger.Error(fmt.Sprintf("Failed to record warnings of account transition %d: %v", transition.ID, err))
+		}
+	}
+
+	l.logger.Info(fmt.Sprintf("Account %s moved from %s to %s by user %d", user.Username, transition.From, to, actorID))
+	return &transition, nil
+}
+
+// Remove terminates the account, unless it already is, and purges it at
+// once instead of after the grace period. Deleting an account goes through
+// it, so that its services are taken down before its data is removed.
+func (l *AccountLifecycle) Remove(userID uint, reason string, actorID uint) (*models.AccountTransition, error) {
+	var user models.User
+	if err := l.db.First(&user, userID).Error; err != nil {
+		return nil, ErrAccountNotFound
+	}
+	if user.Status != AccountTerminated {
+		if _, err := l.Transition(userID, AccountTerminated, reason, actorID); err != nil {
+			return nil, err
+		}
+	}
+	return l.Transition(userID, AccountPurged, reason, actorID)
+}
+
+// History returns the account's transitions, newest first.
+func (l *AccountLifecycle) History(userID uint) ([]models.AccountTransition, error) {
+	var transitions []models.AccountTransition
+	if err := l.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&transitions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load account history: %v", err)
+	}
+	return transitions, nil
+}
+
+// PurgeExpired purges terminated accounts whose grace period has passed.
+func (l *AccountLifecycle) PurgeExpired() {
+	var users []models.User
+	if err := l.db.Where("status = ? AND purge_after <= ?", AccountTerminated, time.Now()).Find(&users).Error; err != nil {
+		l.logger.Error(fmt.Sprintf("Failed to load accounts to purge: %v", err))
+		return
+	}
+	for _, user := range users {
+		if _, err := l.Transition(user.ID, AccountPurged, "grace period ended", 0); err != nil {
+			l.logger.Error(fmt.Sprintf("Failed to purge account %s: %v", user.Username, err))
+		}
+	}
+}
+
+// StartPurge purges expired accounts every interval until the process exits.
+func (l *AccountLifecycle) StartPurge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !cluster.Leader(l.db, "account-purge", 2*interval) {
+				continue
+			}
+			l.PurgeExpired()
+		}
+	}
+}
+
+// AccountLifecycleErrorStatus returns the status a handler answers a
+// lifecycle error with.
+func AccountLifecycleErrorStatus(err error) (int, bool) {
+	var invalid *AccountTransitionError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusConflict, true
+	case errors.Is(err, ErrAccountNotFound):
+		return http.StatusNotFound, true
+	}
+	return ResellerPoolErrorStatus(err)
+}
+
+// accountDisabled reports whether an account's services are turned off in a
+// state.
+func accountDisabled(state string) bool {
+	return state == AccountSuspended || state == AccountTerminated
+}
+
+// lifecycleChange tells the hooks whether a transition turns the account's
+// services off or back on. Moves between the disabled states and purges do
+// neither.
+func lifecycleChange(from, to string) (disable, enable bool) {
+	switch {
+	case to == AccountPurged:
+		return false, false
+	case accountDisabled(to) && !accountDisabled(from):
+		return true, false
+	case to == AccountActive && accountDisabled(from):
+		return false, true
+	}
+	return false, false
+}
+
+func (l *AccountLifecycle) applySessions(user *models.User, from, to string) error {
+	if disable, _ := lifecycleChange(from, to); !disable {
+		return nil
+	}
+	_, err := l.sessions.RevokeAll(user.ID, "", "account_"+to)
+	return err
+}
+
+func (l *AccountLifecycle) applyMail(user *models.User, from, to string) error {
+	disable, enable := lifecycleChange(from, to)
+	switch {
+	case disable:
+		return l.db.Model(&models.Email{}).Where("user_id = ? AND status = ?", user.ID, "active").
+			Update("status", resourceSuspended).Error
+	case enable:
+		return l.db.Model(&models.Email{}).Where("user_id = ? AND status = ?", user.ID, resourceSuspended).
+			Update("status", "active").Error
+	}
+	return nil
+}
+
+// applyWeb points the account's sites at its suspension page, and back at
+// their document roots on reactivation.
+func (l *AccountLifecycle) applyWeb(user *models.User, from, to string) error {
+	disable, enable := lifecycleChange(from, to)
+	page := filepath.Join(l.pageDir, user.Username)
+
+	switch {
+	case disable:
+		if err := l.writeSuspensionPage(user, page, to); err != nil {
+			return err
+		}
+		var domains []models.Domain
+		if err := l.db.Where("user_id = ? AND status = ?", user.ID, "active").Find(&domains).Error; err != nil {
+			return fmt.Errorf("failed to load domains: %v", err)
+		}
+		failed := l.runVhostCommand(l.suspendCommand, domains, page)
+		if err := l.db.Model(&models.Domain{}).Where("user_id = ? AND status = ?", user.ID, "active").
+			Update("status", resourceSuspended).Error; err != nil {
+			return fmt.Errorf("failed to suspend domains: %v", err)
+		}
+		return failed
+
+	case enable:
+		var domains []models.Domain
+		if err := l.db.Where("user_id = ? AND status = ?", user.ID, resourceSuspended).Find(&domains).Error; err != nil {
+			return fmt.Errorf("failed to load domains: %v", err)
+		}
+		failed := l.runVhostCommand(l.restoreCommand, domains, page)
+		if err := l.db.Model(&models.Domain{}).Where("user_id = ? AND status = ?", user.ID, resourceSuspended).
+			Update("status", "active").Error; err != nil {
+			return fmt.Errorf("failed to restore domains: %v", err)
+		}
+		if err := os.RemoveAll(page); err != nil {
+			return fmt.Errorf("failed to remove suspension page: %v", err)
+		}
+		return failed
+	}
+	return nil
+}
+
+var suspensionPage = template.Must(template.New("suspended").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Terminated}}Account closed{{else}}Account suspended{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; min-height: 100vh; align-items: center; justify-content: center; background: #f3f4f6; color: #111827; }
+main { max-width: 32rem; padding: 2rem; text-align: center; background: #fff; border-top: 4px solid {{.Brand.ThemeColor}}; border-radius: 0.5rem; }
+a { color: {{.Brand.ThemeColor}}; }
+</style>
+</head>
+<body>
+<main>
+{{if .Brand.LogoURL}}<img src="{{.Brand.LogoURL}}" alt="{{.Brand.CompanyName}}" height="48">{{end}}
+{{if .Terminated}}<h1>This account has been closed</h1>
+<p>The website you are looking for is no longer hosted here.</p>
+{{else}}<h1>This account has been suspended</h1>
+<p>The website you are looking for is temporarily unavailable.</p>
+{{end}}{{if .Brand.SupportURL}}<p>If you are the owner, please <a href="{{.Brand.SupportURL}}">contact {{.Brand.CompanyName}}</a>.</p>{{end}}
+</main>
+</body>
+</html>
+`))
+
+func (l *AccountLifecycle) writeSuspensionPage(user *models.User, dir, state string) error {
+	brand := resellerBranding(l.db, user.ResellerID)
+	if brand.ThemeColor == "" {
+		brand.ThemeColor = defaultBranding.ThemeColor
+	}
+
+	var page bytes.Buffer
+	if err := suspensionPage.Execute(&page, map[string]interface{}{
+		"Brand":      brand,
+		"Terminated": state == AccountTerminated,
+	}); err != nil {
+		return fmt.Errorf("failed to render suspension page: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create suspension page directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), page.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write suspension page: %v", err)
+	}
+	return nil
+}
+
+// runVhostCommand runs a configured web server command once per domain. The
+// command is not run through a shell, so nothing substituted into it is
+// interpreted.
+func (l *AccountLifecycle) runVhostCommand(command string, domains []models.Domain, page string) error {
+	if command == "" {
+		return nil
+	}
+
+	var failures []string
+	for _, domain := range domains {
+		args := strings.Fields(command)
+		for i, arg := range args {
+			arg = strings.ReplaceAll(arg, "{domain}", domain.Name)
+			arg = strings.ReplaceAll(arg, "{docroot}", domain.DocumentRoot)
+			args[i] = strings.ReplaceAll(arg, "{page}", page)
+		}
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v: %s", domain.Name, err, strings.TrimSpace(string(output))))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// applyDatabases locks the account's database users so they cannot log in,
+// and unlocks them on reactivation. The data is left untouched.
+func (l *AccountLifecycle) applyDatabases(user *models.User, from, to string) error {
+	disable, enable := lifecycleChange(from, to)
+	if !disable && !enable {
+		return nil
+	}
+
+	var databases []models.Database
+	if err := l.db.Preload("Users").Where("user_id = ?", user.ID).Find(&databases).Error; err != nil {
+		return fmt.Errorf("failed to load databases: %v", err)
+	}
+
+	var failures []string
+	run := func(name string, args ...string) {
+		if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %s", err, strings.TrimSpace(string(output))))
+		}
+	}
+	for _, database := range databases {
+		switch database.Type {
+		case "mysql":
+			lock := "ACCOUNT LOCK"
+			if enable {
+				lock = "ACCOUNT UNLOCK"
+			}
+			run("mysql", "-u", "root", "-e", fmt.Sprintf("ALTER USER '%s'@'localhost' %s;", database.Username, lock))
+			for _, dbUser := range database.Users {
+				run("mysql", "-u", "root", "-e", fmt.Sprintf("ALTER USER '%s'@'%s' %s;", dbUser.Username, dbUser.Host, lock))
+			}
+		case "postgresql":
+			login := "NOLOGIN"
+			if enable {
+				login = "LOGIN"
+			}
+			run("sudo", "-u", "postgres", "psql", "-c", fmt.Sprintf("ALTER ROLE \"%s\" %s;", database.Username, login))
+			for _, dbUser := range database.Users {
+				run("sudo", "-u", "postgres", "psql", "-c", fmt.Sprintf("ALTER ROLE \"%s\" %s;", dbUser.Username, login))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// applyCron removes the account's crontab while it is disabled and writes
+// its enabled jobs back on reactivation.
+func (l *AccountLifecycle) applyCron(user *models.User, from, to string) error {
+	disable, enable := lifecycleChange(from, to)
+	if _, err := exec.LookPath("crontab"); err != nil || (!disable && !enable) {
+		return nil
+	}
+
+	if disable {
+		return removeCrontab(user.Username)
+	}
+	return installCrontab(l.db, user)
+}
+
+// installCrontab writes the account's enabled cron jobs as its crontab.
+func installCrontab(db *gorm.DB, user *models.User) error {
+	var jobs []models.CronJob
+	if err := db.Where("user_id = ? AND enabled = ?", user.ID, true).Find(&jobs).Error; err != nil {
+		return fmt.Errorf("failed to load cron jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	var crontab strings.Builder
+	for _, job := range jobs {
+		// MAILTO applies to the lines after it, so each job sets its own
+		fmt.Fprintf(&crontab, "MAILTO=%q\n%s %s\n", job.Email, job.Schedule, job.Command)
+	}
+	cmd := exec.Command("crontab", "-u", user.Username, "-")
+	cmd.Stdin = strings.NewReader(crontab.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to install crontab: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func removeCrontab(username string) error {
+	output, err := exec.Command("crontab", "-r", "-u", username).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "no crontab") {
+		return fmt.Errorf("failed to remove crontab: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// applyPurge deletes everything the account owns: its databases, sites,
+// mailboxes, cron jobs, certificates and home directory. The account row is
+// kept, marked purged, for billing history.
+func (l *AccountLifecycle) applyPurge(user *models.User, from, to string) error {
+	if to != AccountPurged {
+		return nil
+	}
+
+	var failures []string
+	fail := func(err error) {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	var databases []models.Database
+	fail(l.db.Where("user_id = ?", user.ID).Find(&databases).Error)
+	for _, database := range databases {
+		fail(l.databases.DeleteDatabase(database.ID, user.ID))
+	}
+
+	var domains []models.Domain
+	fail(l.db.Where("user_id = ?", user.ID).Find(&domains).Error)
+	fail(l.runVhostCommand(l.removeCommand, domains, filepath.Join(l.pageDir, user.Username)))
+
+	if _, err := exec.LookPath("crontab"); err == nil {
+		fail(removeCrontab(user.Username))
+	}
+
+	for _, model := range []interface{}{&models.Email{}, &models.Domain{}, &models.CronJob{}, &models.SSL{}} {
+		fail(l.db.Where("user_id = ?", user.ID).Delete(model).Error)
+	}
+	fail(os.RemoveAll(filepath.Join(l.pageDir, user.Username)))
+	fail(os.RemoveAll(accountHomeDir(user.ID)))
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
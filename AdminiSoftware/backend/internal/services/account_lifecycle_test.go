@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(AccountActive, AccountSuspended))
+	assert.True(t, CanTransition(AccountSuspended, AccountTerminated))
+	assert.True(t, CanTransition(AccountTerminated, AccountActive), "terminated accounts are restored until purged")
+	assert.True(t, CanTransition(AccountTerminated, AccountPurged))
+
+	assert.False(t, CanTransition(AccountActive, AccountPurged), "accounts are terminated before they are purged")
+	assert.False(t, CanTransition(AccountPurged, AccountActive))
+	assert.False(t, CanTransition(AccountPending, AccountSuspended))
+}
+
+func TestLifecycleChange(t *testing.T) {
+	for _, c := range []struct {
+		from, to        string
+		disable, enable bool
+	}{
+		{AccountActive, AccountSuspended, true, false},
+		{AccountActive, AccountTerminated, true, false},
+		{AccountSuspended, AccountTerminated, false, false},
+		{AccountSuspended, AccountActive, false, true},
+		{AccountTerminated, AccountActive, false, true},
+		{AccountTerminated, AccountPurged, false, false},
+		{AccountPending, AccountActive, false, false},
+	} {
+		disable, enable := lifecycleChange(c.from, c.to)
+		assert.Equal(t, c.disable, disable, c.from+" to "+c.to)
+		assert.Equal(t, c.enable, enable, c.from+" to "+c.to)
+	}
+}
+
+func TestAccountLifecycleErrorStatus(t *testing.T) {
+	status, ok := AccountLifecycleErrorStatus(&AccountTransitionError{From: AccountPurged, To: AccountActive})
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, ok = AccountLifecycleErrorStatus(ErrAccountNotFound)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	_, ok = AccountLifecycleErrorStatus(errors.New("connection refused"))
+	assert.False(t, ok)
+}
+
+func TestAccountLifecycleRemove(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.AccountTransition{})
+
+	name := testutil.UniqueName("lifecycle")
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: AccountActive}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.AccountTransition{})
+		db.Unscoped().Delete(user)
+	}()
+
+	// Only the state machine is under test, not the server
+	lifecycle := NewAccountLifecycle(db, utils.NewLogger())
+	lifecycle.hooks = nil
+
+	_, err := lifecycle.Transition(user.ID, AccountPurged, "", 1)
+	var invalid *AccountTransitionError
+	assert.ErrorAs(t, err, &invalid)
+
+	transition, err := lifecycle.Transition(user.ID, AccountSuspended, "unpaid invoice", 1)
+	require.NoError(t, err)
+	assert.Equal(t, AccountActive, transition.From)
+
+	// Deleting terminates first, then purges
+	transition, err = lifecycle.Remove(user.ID, "closed", 1)
+	require.NoError(t, err)
+	assert.Equal(t, AccountTerminated, transition.From)
+	assert.Equal(t, AccountPurged, transition.To)
+
+	history, err := lifecycle.History(user.ID)
+	require.NoError(t, err)
+	var states []string
+	for _, entry := range history {
+		states = append(states, entry.To)
+	}
+	assert.ElementsMatch(t, []string{AccountSuspended, AccountTerminated, AccountPurged}, states)
+
+	_, err = lifecycle.Remove(user.ID, "", 1)
+	assert.ErrorAs(t, err, &invalid, "a purged account cannot be removed again")
+	_, err = lifecycle.Remove(0, "", 1)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,1269 @@
+package services
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rename states.
+const (
+	RenameRunning     = "running"
+	RenameCompleted   = "completed"
+	RenameFailed      = "failed" // a step and its rollback failed; resume or roll back
+	RenameInterrupted = "interrupted"
+	RenameRolledBack  = "rolled_back"
+)
+
+// A node working on a rename touches its heartbeat this often; a running
+// rename whose heartbeat is older than renameStale lost its node.
+const (
+	renameHeartbeat = 15 * time.Second
+	renameStale     = 2 * time.Minute
+)
+
+// Rename step states.
+const (
+	renameStepPending  = "pending"
+	renameStepDone     = "done"
+	renameStepFailed   = "failed"
+	renameStepReverted = "reverted"
+)
+
+// renameStepOrder is the order steps are applied in, and reverted in
+// reverse. The crontab is taken down while the system user still has its
+// old name and put back once everything else is renamed.
+var renameStepOrder = []string{"cron", "username", "domains", "dns", "mail", "databases", "ssl", "vhosts", "crontab"}
+
+var (
+	ErrRenameNotFound      = errors.New("rename not found")
+	ErrRenameNothingToDo   = errors.New("new username and domain are the same as the current ones")
+	ErrRenameInProgress    = errors.New("account has a rename that has not finished")
+	ErrRenameNotResumable  = errors.New("only failed or interrupted renames can be resumed or rolled back")
+	ErrRenameInvalidName   = errors.New("username must start with a letter and have at most 32 lowercase letters, digits, _ or -")
+	ErrRenameInvalidDomain = errors.New("invalid domain name")
+	ErrRenameNoDomain      = errors.New("account has no primary domain to change")
+	ErrUsernameTaken       = errors.New("username already exists")
+	ErrDomainTaken         = errors.New("domain already exists")
+)
+
+// renameContext is what a step works with. Every change a step makes is
+// recorded with set before the next one, so an interrupted step can be
+// resumed without applying a change twice and reverted exactly.
+type renameContext struct {
+	db     *gorm.DB
+	rename *models.AccountRename
+	step   *models.AccountRenameStep
+	user   *models.User
+	state  map[string]string
+}
+
+func (ctx *renameContext) usernameChanged() bool {
+	return ctx.rename.OldUsername != ctx.rename.NewUsername
+}
+
+func (ctx *renameContext) domainChanged() bool {
+	return ctx.rename.OldDomain != ctx.rename.NewDomain
+}
+
+func (ctx *renameContext) done(key string) bool {
+	_, ok := ctx.state[key]
+	return ok
+}
+
+// set records a change and persists it at once.
+func (ctx *renameContext) set(key, value string) error {
+	ctx.state[key] = value
+	data, err := json.Marshal(ctx.state)
+	if err != nil {
+		return err
+	}
+	ctx.step.State = string(data)
+	return ctx.db.Model(ctx.step).Update("state", ctx.step.State).Error
+}
+
+// stepState returns what another step of the same rename recorded.
+func (ctx *renameContext) stepState(name string) map[string]string {
+	for _, step := range ctx.rename.Steps {
+		if step.Name == name {
+			return decodeRenameState(step.State)
+		}
+	}
+	return map[string]string{}
+}
+
+// keys returns the ids recorded under a prefix, such as "domain:".
+func (ctx *renameContext) keys(prefix string) []uint {
+	var ids []uint
+	for key := range ctx.state {
+		if strings.HasPrefix(key, prefix) {
+			if id, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 32); err == nil {
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func decodeRenameState(data string) map[string]string {
+	state := map[string]string{}
+	if data != "" {
+		json.Unmarshal([]byte(data), &state)
+	}
+	return state
+}
+
+type renameStep struct {
+	apply  func(ctx *renameContext) (string, error)
+	revert func(ctx *renameContext) error
+}
+
+// AccountRenameService renames accounts: the username with the system user
+// and its home directory, cron jobs and username-prefixed databases, and the
+// primary domain with its subdomains, DNS records, mail addresses and
+// certificates. The panel's own database names are keyed by account id and
+// stay as they are.
+//
+// Sites are moved with ACCOUNT_VHOST_RENAME_COMMAND, run per domain with
+// {old_domain}, {domain}, {old_user}, {user} and {docroot} substituted.
+type AccountRenameService struct {
+	db            *gorm.DB
+	logger        *utils.Logger
+	pageDir       string
+	renameCommand string
+	steps         map[string]renameStep
+}
+
+func NewAccountRenameService(db *gorm.DB, logger *utils.Logger) *AccountRenameService {
+	s := &AccountRenameService{
+		db:            db,
+		logger:        logger,
+		pageDir:       NewAccountLifecycle(db, logger).pageDir,
+		renameCommand: os.Getenv("ACCOUNT_VHOST_RENAME_COMMAND"),
+	}
+	s.steps = map[string]renameStep{
+		"cron":      {apply: s.applyCron, revert: s.revertCron},
+		"username":  {apply: s.applyUsername, revert: s.revertUsername},
+		"domains":   {apply: s.applyDomains, revert: s.revertDomains},
+		"dns":       {apply: s.applyDNS, revert: s.revertDNS},
+		"mail":      {apply: s.applyMail, revert: s.revertMail},
+		"databases": {apply: s.applyDatabases, revert: s.revertDatabases},
+		"ssl":       {apply: s.applySSL, revert: s.revertSSL},
+		"vhosts":    {apply: s.applyVhosts, revert: s.revertVhosts},
+		"crontab":   {apply: s.applyCrontab, revert: s.revertCrontab},
+	}
+	return s
+}
+
+// Rename changes the account's username and/or primary domain; an empty
+// value keeps the current one. A step that fails rolls back the steps
+// before it. The returned rename tells how it ended; the error is the
+// failure that caused a rollback.
+func (s *AccountRenameService) Rename(userID uint, newUsername, newDomain string, actorID uint) (*models.AccountRename, error) {
+	newUsername = strings.ToLower(strings.TrimSpace(newUsername))
+	newDomain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(newDomain), "."))
+
+	var rename models.AccountRename
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return ErrAccountNotFound
+		}
+
+		var open int64
+		tx.Model(&models.AccountRename{}).
+			Where("user_id = ? AND status IN ?", userID, []string{RenameRunning, RenameFailed, RenameInterrupted}).
+			Count(&open)
+		if open > 0 {
+			return ErrRenameInProgress
+		}
+
+		var primary models.Domain
+		hasPrimary := tx.Where("user_id = ? AND type = ?", userID, "primary").First(&primary).Error == nil
+
+		rename = models.AccountRename{
+			UserID:      userID,
+			OldUsername: user.Username,
+			NewUsername: user.Username,
+			OldDomain:   primary.Name,
+			NewDomain:   primary.Name,
+			Status:      RenameRunning,
+			ActorID:     actorID,
+		}
+		if newUsername != "" && newUsername != user.Username {
+			if err := s.checkUsername(tx, newUsername); err != nil {
+				return err
+			}
+			rename.NewUsername = newUsername
+		}
+		if newDomain != "" && newDomain != primary.Name {
+			if !hasPrimary {
+				return ErrRenameNoDomain
+			}
+			if err := s.checkDomain(tx, userID, newDomain); err != nil {
+				return err
+			}
+			rename.NewDomain = newDomain
+		}
+		if rename.NewUsername == rename.OldUsername && rename.NewDomain == rename.OldDomain {
+			return ErrRenameNothingToDo
+		}
+
+		now := time.Now()
+		rename.StartedAt = &now
+		rename.Node = cluster.NodeID()
+		rename.HeartbeatAt = &now
+		for i, name := range renameStepOrder {
+			rename.Steps = append(rename.Steps, models.AccountRenameStep{
+				Position: i + 1,
+				Name:     name,
+				Status:   renameStepPending,
+			})
+		}
+		return tx.Create(&rename).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("Rename %d of account %d from %s (%s) to %s (%s) started by user %d",
+		rename.ID, userID, rename.OldUsername, rename.OldDomain, rename.NewUsername, rename.NewDomain, actorID))
+	stop := s.heartbeat(rename.ID)
+	defer stop()
+	err = s.run(&rename)
+	return &rename, err
+}
+
+// Resume continues a failed or interrupted rename from the first step that
+// did not complete.
+func (s *AccountRenameService) Resume(renameID, userID uint) (*models.AccountRename, error) {
+	rename, err := s.claim(renameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info(fmt.Sprintf("Rename %d of account %d resumed", rename.ID, userID))
+	stop := s.heartbeat(rename.ID)
+	defer stop()
+	err = s.run(rename)
+	return rename, err
+}
+
+// Rollback undoes what a failed or interrupted rename changed.
+func (s *AccountRenameService) Rollback(renameID, userID uint) (*models.AccountRename, error) {
+	rename, err := s.claim(renameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info(fmt.Sprintf("Rename %d of account %d rolled back on request", rename.ID, userID))
+	stop := s.heartbeat(rename.ID)
+	defer stop()
+	if err := s.rollback(rename, errors.New("rolled back on request")); err != nil && rename.Status == RenameFailed {
+		return rename, err
+	}
+	return rename, nil
+}
+
+// History returns the account's renames with their steps, newest first.
+func (s *AccountRenameService) History(userID uint) ([]models.AccountRename, error) {
+	var renames []models.AccountRename
+	if err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("user_id = ?", userID).Order("created_at DESC").Find(&renames).Error; err != nil {
+		return nil, fmt.Errorf("failed to load renames: %v", err)
+	}
+	return renames, nil
+}
+
+// MarkInterrupted flags the renames this node was working on before it
+// restarted, and those of any node that stopped sending heartbeats, so they
+// can be resumed or rolled back.
+func (s *AccountRenameService) MarkInterrupted() {
+	s.markInterrupted(true)
+}
+
+// StartRecovery flags the renames of nodes that stopped sending heartbeats
+// every interval until the process exits.
+func (s *AccountRenameService) StartRecovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.markInterrupted(false)
+	}
+}
+
+func (s *AccountRenameService) markInterrupted(restarted bool) {
+	stale := s.db.Where("heartbeat_at IS NULL OR heartbeat_at < ?", time.Now().Add(-renameStale))
+	if restarted {
+		stale = stale.Or("node = ?", cluster.NodeID())
+	}
+	result := s.db.Model(&models.AccountRename{}).Where("status = ?", RenameRunning).Where(stale).
+		Update("status", RenameInterrupted)
+	if result.Error != nil {
+		s.logger.Error(fmt.Sprintf("Failed to mark interrupted renames: %v", result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		s.logger.Error(fmt.Sprintf("Marked %d renames interrupted", result.RowsAffected))
+	}
+}
+
+// heartbeat shows the rename is being worked on until the returned function
+// is called.
+func (s *AccountRenameService) heartbeat(renameID uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(renameHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.db.Model(&models.AccountRename{}).Where("id = ?", renameID).Update("heartbeat_at", time.Now())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// AccountRenameErrorStatus returns the status a handler answers a rename
+// error with.
+func AccountRenameErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrRenameNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrDomainTaken),
+		errors.Is(err, ErrRenameInProgress), errors.Is(err, ErrRenameNotResumable):
+		return http.StatusConflict, true
+	case errors.Is(err, ErrRenameNothingToDo), errors.Is(err, ErrRenameInvalidName),
+		errors.Is(err, ErrRenameInvalidDomain), errors.Is(err, ErrRenameNoDomain):
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
+
+func (s *AccountRenameService) checkUsername(tx *gorm.DB, username string) error {
+	if len(username) > 32 || username[0] < 'a' || username[0] > 'z' || !utils.IsValidUsername(username) {
+		return ErrRenameInvalidName
+	}
+	var count int64
+	tx.Model(&models.User{}).Unscoped().Where("username = ?", username).Count(&count)
+	if count > 0 {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+func (s *AccountRenameService) checkDomain(tx *gorm.DB, userID uint, domain string) error {
+	if !utils.IsValidDomain(domain) {
+		return ErrRenameInvalidDomain
+	}
+	// The new domain and any subdomain it brings along must be free
+	var count int64
+	tx.Model(&models.Domain{}).Where("(name = ? OR name LIKE ?) AND user_id <> ?", domain, "%."+domain, userID).Count(&count)
+	if count > 0 {
+		return ErrDomainTaken
+	}
+	tx.Model(&models.Domain{}).Where("name = ? AND user_id = ?", domain, userID).Count(&count)
+	if count > 0 {
+		return ErrDomainTaken
+	}
+	return nil
+}
+
+// claim moves a failed or interrupted rename back to running, so only one
+// request works on it.
+func (s *AccountRenameService) claim(renameID, userID uint) (*models.AccountRename, error) {
+	result := s.db.Model(&models.AccountRename{}).
+		Where("id = ? AND user_id = ? AND status IN ?", renameID, userID, []string{RenameFailed, RenameInterrupted}).
+		Updates(map[string]interface{}{"status": RenameRunning, "node": cluster.NodeID(), "heartbeat_at": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim rename: %v", result.Error)
+	}
+
+	var rename models.AccountRename
+	if err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("user_id = ?", userID).First(&rename, renameID).Error; err != nil {
+		return nil, ErrRenameNotFound
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRenameNotResumable
+	}
+	return &rename, nil
+}
+
+func (s *AccountRenameService) context(rename *models.AccountRename, step *models.AccountRenameStep) (*renameContext, error) {
+	var user models.User
+	if err := s.db.First(&user, rename.UserID).Error; err != nil {
+		return nil, ErrAccountNotFound
+	}
+	return &renameContext{
+		db:     s.db,
+		rename: rename,
+		step:   step,
+		user:   &user,
+		state:  decodeRenameState(step.State),
+	}, nil
+}
+
+func (s *AccountRenameService) run(rename *models.AccountRename) error {
+	for i := range rename.Steps {
+		step := &rename.Steps[i]
+		if step.Status == renameStepDone {
+			continue
+		}
+
+		ctx, err := s.context(rename, step)
+		if err != nil {
+			return s.rollback(rename, err)
+		}
+		now := time.Now()
+		step.StartedAt = &now
+
+		output, err := s.steps[step.Name].apply(ctx)
+		finished := time.Now()
+		step.FinishedAt = &finished
+		step.Output = output
+		step.Status = renameStepDone
+		if err != nil {
+			step.Status = renameStepFailed
+			step.Output = strings.TrimSpace(output + "\n" + err.Error())
+		}
+		if saveErr := s.db.Model(step).Updates(map[string]interface{}{
+			"status":      step.Status,
+			"output":      step.Output,
+			"started_at":  step.StartedAt,
+			"finished_at": step.FinishedAt,
+		}).Error; saveErr != nil {
+			s.logger.Error(fmt.Sprintf("Failed to record step %s of rename %d: %v", step.Name, rename.ID, saveErr))
+		}
+		if err != nil {
+			return s.rollback(rename, fmt.Errorf("%s: %v", step.Name, err))
+		}
+	}
+
+	s.finish(rename, RenameCompleted, "")
+	s.logger.Info(fmt.Sprintf("Rename %d of account %d completed", rename.ID, rename.UserID))
+	return nil
+}
+
+// rollback reverts the steps that ran, including a failed one which may
+// have changed part of what it covers, newest first. If a revert fails the
+// rename is left failed so it can be resumed or rolled back again.
+func (s *AccountRenameService) rollback(rename *models.AccountRename, cause error) error {
+	s.logger.Error(fmt.Sprintf("Rename %d of account %d rolling back: %v", rename.ID, rename.UserID, cause))
+
+	for i := len(rename.Steps) - 1; i >= 0; i-- {
+		step := &rename.Steps[i]
+		if step.Status != renameStepDone && step.Status != renameStepFailed {
+			continue
+		}
+
+		ctx, err := s.context(rename, step)
+		if err == nil {
+			err = s.steps[step.Name].revert(ctx)
+		}
+		if err != nil {
+			message := fmt.Sprintf("%v; rollback of %s failed: %v", cause, step.Name, err)
+			s.finish(rename, RenameFailed, message)
+			s.logger.Error(fmt.Sprintf("Rename %d of account %d: %s", rename.ID, rename.UserID, message))
+			return errors.New(message)
+		}
+
+		// Nothing is applied any more, so a resume starts the step afresh
+		step.Status = renameStepReverted
+		step.State = ""
+		s.db.Model(step).Updates(map[string]interface{}{"status": step.Status, "state": ""})
+	}
+
+	s.finish(rename, RenameRolledBack, cause.Error())
+	return cause
+}
+
+func (s *AccountRenameService) finish(rename *models.AccountRename, status, message string) {
+	now := time.Now()
+	rename.Status = status
+	rename.Error = message
+	rename.FinishedAt = &now
+	if err := s.db.Model(rename).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       message,
+		"finished_at": now,
+	}).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to record the end of rename %d: %v", rename.ID, err))
+	}
+}
+
+// renameHost moves a host name under one domain to another. Names outside
+// the domain, and relative names such as "www" or "@", are not changed.
+func renameHost(host, from, to string) (string, bool) {
+	if from == "" || from == to {
+		return host, false
+	}
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	suffix := strings.TrimPrefix(host, strings.TrimSuffix(host, "."))
+
+	switch {
+	case name == from:
+		return to + suffix, true
+	case strings.HasSuffix(name, "."+from):
+		return strings.TrimSuffix(name, from) + to + suffix, true
+	}
+	return host, false
+}
+
+// renameAddress moves an email address under one domain to another.
+func renameAddress(address, from, to string) (string, bool) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address, false
+	}
+	domain, ok := renameHost(address[at+1:], from, to)
+	if !ok {
+		return address, false
+	}
+	return address[:at+1] + domain, true
+}
+
+func runCommand(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// cron: commands that refer to the old username or domain are rewritten,
+// and the old user's crontab removed while it still exists.
+
+func (s *AccountRenameService) applyCron(ctx *renameContext) (string, error) {
+	var jobs []models.CronJob
+	if err := ctx.db.Where("user_id = ?", ctx.user.ID).Find(&jobs).Error; err != nil {
+		return "", fmt.Errorf("failed to load cron jobs: %v", err)
+	}
+
+	changed := 0
+	for _, job := range jobs {
+		key := fmt.Sprintf("job:%d", job.ID)
+		if ctx.done(key) {
+			continue
+		}
+		command := job.Command
+		if ctx.usernameChanged() {
+			command = strings.ReplaceAll(command, "/home/"+ctx.rename.OldUsername+"/", "/home/"+ctx.rename.NewUsername+"/")
+		}
+		if ctx.domainChanged() && ctx.rename.OldDomain != "" {
+			command = strings.ReplaceAll(command, ctx.rename.OldDomain, ctx.rename.NewDomain)
+		}
+		if command == job.Command {
+			continue
+		}
+		if err := ctx.set(key, job.Command); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&job).Update("command", command).Error; err != nil {
+			return "", fmt.Errorf("failed to update cron job %d: %v", job.ID, err)
+		}
+		changed++
+	}
+
+	if ctx.usernameChanged() && !ctx.done("crontab_removed") {
+		if _, err := exec.LookPath("crontab"); err == nil {
+			if err := removeCrontab(ctx.rename.OldUsername); err != nil {
+				return "", err
+			}
+		}
+		if err := ctx.set("crontab_removed", "true"); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d cron jobs rewritten", changed), nil
+}
+
+func (s *AccountRenameService) revertCron(ctx *renameContext) error {
+	for _, id := range ctx.keys("job:") {
+		if err := ctx.db.Model(&models.CronJob{}).Where("id = ?", id).
+			Update("command", ctx.state[fmt.Sprintf("job:%d", id)]).Error; err != nil {
+			return fmt.Errorf("failed to restore cron job %d: %v", id, err)
+		}
+	}
+	// The username step has been reverted, so this is the old user again
+	if ctx.done("crontab_removed") && !accountDisabled(ctx.user.Status) {
+		if _, err := exec.LookPath("crontab"); err == nil {
+			return installCrontab(ctx.db, ctx.user)
+		}
+	}
+	return nil
+}
+
+// username: the account record, the system user with its group and home
+// directory, and the suspension page of a suspended account.
+
+func (s *AccountRenameService) applyUsername(ctx *renameContext) (string, error) {
+	if !ctx.usernameChanged() {
+		return "username unchanged", nil
+	}
+	if err := s.renameUser(ctx.user.ID, ctx.rename.OldUsername, ctx.rename.NewUsername); err != nil {
+		return "", err
+	}
+	if err := ctx.set("renamed", "true"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s renamed to %s", ctx.rename.OldUsername, ctx.rename.NewUsername), nil
+}
+
+func (s *AccountRenameService) revertUsername(ctx *renameContext) error {
+	// Run even if the step did not finish, as it may have got part way
+	if !ctx.usernameChanged() {
+		return nil
+	}
+	return s.renameUser(ctx.user.ID, ctx.rename.NewUsername, ctx.rename.OldUsername)
+}
+
+// renameUser renames whatever still has the old name, so it can be run
+// again after being interrupted. The system user's home directory moves
+// from /home/<from> to /home/<to> with it, so reverting moves it back.
+func (s *AccountRenameService) renameUser(userID uint, from, to string) error {
+	if err := s.db.Model(&models.User{}).Where("id = ? AND username = ?", userID, from).
+		Update("username", to).Error; err != nil {
+		return fmt.Errorf("failed to rename account: %v", err)
+	}
+
+	if exec.Command("id", "-u", from).Run() == nil {
+		if err := runCommand("usermod", "-d", "/home/"+to, "-m", "-l", to, from); err != nil {
+			return err
+		}
+	}
+	if exec.Command("getent", "group", from).Run() == nil {
+		if err := runCommand("groupmod", "-n", to, from); err != nil {
+			return err
+		}
+	}
+
+	oldPage := filepath.Join(s.pageDir, from)
+	if _, err := os.Stat(oldPage); err == nil {
+		if err := os.Rename(oldPage, filepath.Join(s.pageDir, to)); err != nil {
+			return fmt.Errorf("failed to move suspension page: %v", err)
+		}
+	}
+	return nil
+}
+
+// domains: the primary domain and the subdomains under it.
+
+func (s *AccountRenameService) applyDomains(ctx *renameContext) (string, error) {
+	if !ctx.domainChanged() {
+		return "domain unchanged", nil
+	}
+
+	var domains []models.Domain
+	if err := ctx.db.Where("user_id = ?", ctx.user.ID).Find(&domains).Error; err != nil {
+		return "", fmt.Errorf("failed to load domains: %v", err)
+	}
+
+	changed := 0
+	for _, domain := range domains {
+		key := fmt.Sprintf("domain:%d", domain.ID)
+		if ctx.done(key) {
+			continue
+		}
+		name, ok := renameHost(domain.Name, ctx.rename.OldDomain, ctx.rename.NewDomain)
+		if !ok {
+			continue
+		}
+		if err := ctx.set(key, domain.Name); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&domain).Update("name", name).Error; err != nil {
+			return "", fmt.Errorf("failed to rename domain %s: %v", domain.Name, err)
+		}
+		changed++
+	}
+	return fmt.Sprintf("%d domains renamed", changed), nil
+}
+
+func (s *AccountRenameService) revertDomains(ctx *renameContext) error {
+	for _, id := range ctx.keys("domain:") {
+		if err := ctx.db.Model(&models.Domain{}).Where("id = ?", id).
+			Update("name", ctx.state[fmt.Sprintf("domain:%d", id)]).Error; err != nil {
+			return fmt.Errorf("failed to restore domain %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// dns: record names and host targets under the old domain, with the zone
+// serials raised so secondaries pick up the change.
+
+// dnsHostTargets are the record types whose value is a host name.
+var dnsHostTargets = map[string]bool{"CNAME": true, "MX": true, "NS": true, "SRV": true, "PTR": true}
+
+func (s *AccountRenameService) applyDNS(ctx *renameContext) (string, error) {
+	if !ctx.domainChanged() {
+		return "domain unchanged", nil
+	}
+
+	domainIDs := s.userDomainIDs(ctx)
+	var records []models.DNS
+	if len(domainIDs) > 0 {
+		if err := ctx.db.Where("domain_id IN ?", domainIDs).Find(&records).Error; err != nil {
+			return "", fmt.Errorf("failed to load DNS records: %v", err)
+		}
+	}
+
+	changed := 0
+	for _, record := range records {
+		key := fmt.Sprintf("record:%d", record.ID)
+		if ctx.done(key) {
+			continue
+		}
+		updates := map[string]interface{}{}
+		if name, ok := renameHost(record.Name, ctx.rename.OldDomain, ctx.rename.NewDomain); ok {
+			updates["name"] = name
+		}
+		if dnsHostTargets[strings.ToUpper(record.Type)] {
+			// SRV values carry weight and port before the target
+			fields := strings.Fields(record.Value)
+			if len(fields) > 0 {
+				if target, ok := renameHost(fields[len(fields)-1], ctx.rename.OldDomain, ctx.rename.NewDomain); ok {
+					fields[len(fields)-1] = target
+					updates["value"] = strings.Join(fields, " ")
+				}
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		original, _ := json.Marshal(map[string]string{"name": record.Name, "value": record.Value})
+		if err := ctx.set(key, string(original)); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&record).Updates(updates).Error; err != nil {
+			return "", fmt.Errorf("failed to update DNS record %d: %v", record.ID, err)
+		}
+		changed++
+	}
+
+	if err := bumpZoneSerials(ctx.db, domainIDs); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d DNS records updated", changed), nil
+}
+
+func (s *AccountRenameService) revertDNS(ctx *renameContext) error {
+	for _, id := range ctx.keys("record:") {
+		var original map[string]string
+		if err := json.Unmarshal([]byte(ctx.state[fmt.Sprintf("record:%d", id)]), &original); err != nil {
+			return fmt.Errorf("failed to read DNS record %d: %v", id, err)
+		}
+		if err := ctx.db.Model(&models.DNS{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"name":  original["name"],
+			"value": original["value"],
+		}).Error; err != nil {
+			return fmt.Errorf("failed to restore DNS record %d: %v", id, err)
+		}
+	}
+	return bumpZoneSerials(ctx.db, s.userDomainIDs(ctx))
+}
+
+func (s *AccountRenameService) userDomainIDs(ctx *renameContext) []uint {
+	var ids []uint
+	ctx.db.Model(&models.Domain{}).Where("user_id = ?", ctx.user.ID).Pluck("id", &ids)
+	return ids
+}
+
+// bumpZoneSerials raises each zone's serial to today's date followed by a
+// two digit counter, or by one if it is already past that.
+func bumpZoneSerials(db *gorm.DB, domainIDs []uint) error {
+	if len(domainIDs) == 0 {
+		return nil
+	}
+	var zones []models.DNSZone
+	if err := db.Where("domain_id IN ?", domainIDs).Find(&zones).Error; err != nil {
+		return fmt.Errorf("failed to load DNS zones: %v", err)
+	}
+
+	today, _ := strconv.ParseUint(time.Now().Format("20060102")+"00", 10, 32)
+	for _, zone := range zones {
+		serial, _ := strconv.ParseUint(zone.Serial, 10, 32)
+		next := today
+		if serial >= today {
+			next = serial + 1
+		}
+		if err := db.Model(&zone).Update("serial", strconv.FormatUint(next, 10)).Error; err != nil {
+			return fmt.Errorf("failed to update serial of zone %d: %v", zone.ID, err)
+		}
+	}
+	return nil
+}
+
+// mail: addresses under the old domain and the forwarders to and from them.
+
+func (s *AccountRenameService) applyMail(ctx *renameContext) (string, error) {
+	if !ctx.domainChanged() {
+		return "domain unchanged", nil
+	}
+
+	var emails []models.Email
+	if err := ctx.db.Where("user_id = ?", ctx.user.ID).Find(&emails).Error; err != nil {
+		return "", fmt.Errorf("failed to load email accounts: %v", err)
+	}
+
+	changed := 0
+	emailIDs := make([]uint, 0, len(emails))
+	for _, email := range emails {
+		emailIDs = append(emailIDs, email.ID)
+		key := fmt.Sprintf("email:%d", email.ID)
+		if ctx.done(key) {
+			continue
+		}
+		address, ok := renameAddress(email.Email, ctx.rename.OldDomain, ctx.rename.NewDomain)
+		if !ok {
+			continue
+		}
+		if err := ctx.set(key, email.Email); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&email).Update("email", address).Error; err != nil {
+			return "", fmt.Errorf("failed to rename %s: %v", email.Email, err)
+		}
+		changed++
+	}
+
+	var forwarders []models.EmailForwarder
+	if len(emailIDs) > 0 {
+		if err := ctx.db.Where("email_id IN ?", emailIDs).Find(&forwarders).Error; err != nil {
+			return "", fmt.Errorf("failed to load forwarders: %v", err)
+		}
+	}
+	for _, forwarder := range forwarders {
+		key := fmt.Sprintf("forwarder:%d", forwarder.ID)
+		if ctx.done(key) {
+			continue
+		}
+		source, sourceChanged := renameAddress(forwarder.Source, ctx.rename.OldDomain, ctx.rename.NewDomain)
+		destination, destinationChanged := renameAddress(forwarder.Destination, ctx.rename.OldDomain, ctx.rename.NewDomain)
+		if !sourceChanged && !destinationChanged {
+			continue
+		}
+		original, _ := json.Marshal(map[string]string{"source": forwarder.Source, "destination": forwarder.Destination})
+		if err := ctx.set(key, string(original)); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&forwarder).Updates(map[string]interface{}{
+			"source":      source,
+			"destination": destination,
+		}).Error; err != nil {
+			return "", fmt.Errorf("failed to update forwarder %d: %v", forwarder.ID, err)
+		}
+	}
+	return fmt.Sprintf("%d email accounts renamed", changed), nil
+}
+
+func (s *AccountRenameService) revertMail(ctx *renameContext) error {
+	for _, id := range ctx.keys("email:") {
+		if err := ctx.db.Model(&models.Email{}).Where("id = ?", id).
+			Update("email", ctx.state[fmt.Sprintf("email:%d", id)]).Error; err != nil {
+			return fmt.Errorf("failed to restore email account %d: %v", id, err)
+		}
+	}
+	for _, id := range ctx.keys("forwarder:") {
+		var original map[string]string
+		if err := json.Unmarshal([]byte(ctx.state[fmt.Sprintf("forwarder:%d", id)]), &original); err != nil {
+			return fmt.Errorf("failed to read forwarder %d: %v", id, err)
+		}
+		if err := ctx.db.Model(&models.EmailForwarder{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"source":      original["source"],
+			"destination": original["destination"],
+		}).Error; err != nil {
+			return fmt.Errorf("failed to restore forwarder %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// databases: databases and database users named after the old username,
+// as imported accounts have them. The panel names its own by account id.
+
+func (s *AccountRenameService) applyDatabases(ctx *renameContext) (string, error) {
+	if !ctx.usernameChanged() {
+		return "username unchanged", nil
+	}
+	oldPrefix := ctx.rename.OldUsername + "_"
+	newPrefix := ctx.rename.NewUsername + "_"
+
+	var databases []models.Database
+	if err := ctx.db.Preload("Users").Where("user_id = ?", ctx.user.ID).Find(&databases).Error; err != nil {
+		return "", fmt.Errorf("failed to load databases: %v", err)
+	}
+
+	// Every MySQL database is checked before any is moved, so a refusal
+	// leaves them all untouched
+	for _, database := range databases {
+		if database.Type == "mysql" && strings.HasPrefix(database.Name, oldPrefix) && !ctx.done(fmt.Sprintf("database:%d", database.ID)) {
+			if err := checkMySQLMovable(database.Name); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	changed := 0
+	var notes []string
+	for _, database := range databases {
+		if database.Type != "mysql" && database.Type != "postgresql" {
+			if strings.HasPrefix(database.Name, oldPrefix) {
+				notes = append(notes, fmt.Sprintf("%s database %s left as is", database.Type, database.Name))
+			}
+			continue
+		}
+
+		if name := database.Name; strings.HasPrefix(name, oldPrefix) && !ctx.done(fmt.Sprintf("database:%d", database.ID)) {
+			renamed := newPrefix + strings.TrimPrefix(name, oldPrefix)
+			if err := renamePhysicalDatabase(database.Type, name, renamed); err != nil {
+				return strings.Join(notes, "\n"), err
+			}
+			if err := ctx.set(fmt.Sprintf("database:%d", database.ID), name); err != nil {
+				return "", err
+			}
+			if err := ctx.db.Model(&database).Update("name", renamed).Error; err != nil {
+				return "", fmt.Errorf("failed to rename database %s: %v", name, err)
+			}
+			database.Name = renamed
+			changed++
+		}
+
+		if name := database.Username; strings.HasPrefix(name, oldPrefix) && !ctx.done(fmt.Sprintf("dbuser:%d", database.ID)) {
+			renamed := newPrefix + strings.TrimPrefix(name, oldPrefix)
+			if err := renameDatabaseUser(database.Type, name, renamed, "localhost", database.Name); err != nil {
+				return strings.Join(notes, "\n"), err
+			}
+			if err := ctx.set(fmt.Sprintf("dbuser:%d", database.ID), name); err != nil {
+				return "", err
+			}
+			if err := ctx.db.Model(&database).Update("username", renamed).Error; err != nil {
+				return "", fmt.Errorf("failed to rename database user %s: %v", name, err)
+			}
+			if database.Type == "postgresql" {
+				notes = append(notes, fmt.Sprintf("%s: set the password again if it was stored as MD5", renamed))
+			}
+		}
+
+		for _, dbUser := range database.Users {
+			key := fmt.Sprintf("extrauser:%d", dbUser.ID)
+			if !strings.HasPrefix(dbUser.Username, oldPrefix) || ctx.done(key) {
+				continue
+			}
+			renamed := newPrefix + strings.TrimPrefix(dbUser.Username, oldPrefix)
+			if err := renameDatabaseUser(database.Type, dbUser.Username, renamed, dbUser.Host, database.Name); err != nil {
+				return strings.Join(notes, "\n"), err
+			}
+			if err := ctx.set(key, dbUser.Username); err != nil {
+				return "", err
+			}
+			if err := ctx.db.Model(&dbUser).Update("username", renamed).Error; err != nil {
+				return "", fmt.Errorf("failed to rename database user %s: %v", dbUser.Username, err)
+			}
+		}
+	}
+	return strings.TrimSpace(fmt.Sprintf("%d databases renamed\n%s", changed, strings.Join(notes, "\n"))), nil
+}
+
+func (s *AccountRenameService) revertDatabases(ctx *renameContext) error {
+	for _, id := range ctx.keys("extrauser:") {
+		var dbUser models.DatabaseUser
+		if err := ctx.db.Preload("Database").First(&dbUser, id).Error; err != nil {
+			return fmt.Errorf("failed to load database user %d: %v", id, err)
+		}
+		original := ctx.state[fmt.Sprintf("extrauser:%d", id)]
+		if err := renameDatabaseUser(dbUser.Database.Type, dbUser.Username, original, dbUser.Host, dbUser.Database.Name); err != nil {
+			return err
+		}
+		if err := ctx.db.Model(&dbUser).Update("username", original).Error; err != nil {
+			return fmt.Errorf("failed to restore database user %d: %v", id, err)
+		}
+	}
+
+	for _, id := range ctx.keys("dbuser:") {
+		var database models.Database
+		if err := ctx.db.First(&database, id).Error; err != nil {
+			return fmt.Errorf("failed to load database %d: %v", id, err)
+		}
+		original := ctx.state[fmt.Sprintf("dbuser:%d", id)]
+		if err := renameDatabaseUser(database.Type, database.Username, original, "localhost", database.Name); err != nil {
+			return err
+		}
+		if err := ctx.db.Model(&database).Update("username", original).Error; err != nil {
+			return fmt.Errorf("failed to restore database user of %d: %v", id, err)
+		}
+	}
+
+	for _, id := range ctx.keys("database:") {
+		var database models.Database
+		if err := ctx.db.First(&database, id).Error; err != nil {
+			return fmt.Errorf("failed to load database %d: %v", id, err)
+		}
+		original := ctx.state[fmt.Sprintf("database:%d", id)]
+		if err := renamePhysicalDatabase(database.Type, database.Name, original); err != nil {
+			return err
+		}
+		if err := ctx.db.Model(&database).Update("name", original).Error; err != nil {
+			return fmt.Errorf("failed to restore database %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// renamePhysicalDatabase renames a database on its server. MySQL cannot
+// rename a database, so its tables are moved into a new one and the old one
+// is dropped. Views, routines, triggers and events would be dropped with it,
+// so a database holding any is refused and the step fails.
+func renamePhysicalDatabase(dbType, from, to string) error {
+	switch dbType {
+	case "mysql":
+		if err := checkMySQLMovable(from); err != nil {
+			return err
+		}
+
+		output, err := mysqlQuery(fmt.Sprintf(
+			"SELECT table_name FROM information_schema.tables WHERE table_schema = %s AND table_type = 'BASE TABLE';", mysqlString(from)))
+		if err != nil {
+			return fmt.Errorf("failed to list tables of %s: %v", from, err)
+		}
+		var tables []string
+		if output != "" {
+			tables = strings.Split(output, "\n")
+		}
+		return runCommand("mysql", "-u", "root", "-e", mysqlRenameScript(from, to, tables))
+	case "postgresql":
+		return runCommand("sudo", "-u", "postgres", "psql", "-c",
+			fmt.Sprintf("ALTER DATABASE %s RENAME TO %s;", pgIdent(from), pgIdent(to)))
+	}
+	return fmt.Errorf("unsupported database type: %s", dbType)
+}
+
+// checkMySQLMovable refuses a MySQL database whose tables cannot be moved
+// to a new name without losing its views, routines, triggers or events.
+func checkMySQLMovable(database string) error {
+	counts, err := mysqlQuery(fmt.Sprintf(`SELECT
+		(SELECT COUNT(*) FROM information_schema.views WHERE table_schema = %[1]s),
+		(SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = %[1]s),
+		(SELECT COUNT(*) FROM information_schema.triggers WHERE trigger_schema = %[1]s),
+		(SELECT COUNT(*) FROM information_schema.events WHERE event_schema = %[1]s);`, mysqlString(database)))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", database, err)
+	}
+	return mysqlMovable(database, counts)
+}
+
+// mysqlMovable checks the counts of views, routines, triggers and events of
+// a MySQL database, as returned tab-separated by mysqlQuery.
+func mysqlMovable(database, counts string) error {
+	fields := strings.Fields(counts)
+	if len(fields) != 4 {
+		return fmt.Errorf("failed to inspect %s: unexpected output %q", database, counts)
+	}
+	var found []string
+	for i, kind := range []string{"views", "routines", "triggers", "events"} {
+		if fields[i] != "0" {
+			found = append(found, fields[i]+" "+kind)
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("database %s has %s, which MySQL cannot move to a renamed database; drop or move them out before renaming the account", database, strings.Join(found, ", "))
+	}
+	return nil
+}
+
+// mysqlRenameScript moves the tables of one MySQL database into another
+// and drops the emptied database.
+func mysqlRenameScript(from, to string, tables []string) string {
+	statements := []string{fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s;", mysqlIdent(to))}
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf("RENAME TABLE %s.%s TO %s.%s;",
+			mysqlIdent(from), mysqlIdent(table), mysqlIdent(to), mysqlIdent(table)))
+	}
+	statements = append(statements, fmt.Sprintf("DROP DATABASE %s;", mysqlIdent(from)))
+	return strings.Join(statements, " ")
+}
+
+// renameDatabaseUser renames a database user and, for MySQL, grants it the
+// database under its current name, as grants do not follow a rename.
+// PostgreSQL clears MD5 passwords of renamed roles; SCRAM ones are kept.
+func renameDatabaseUser(dbType, from, to, host, database string) error {
+	switch dbType {
+	case "mysql":
+		return runCommand("mysql", "-u", "root", "-e", fmt.Sprintf(
+			"RENAME USER '%s'@'%s' TO '%s'@'%s'; GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'%s'; FLUSH PRIVILEGES;",
+			from, host, to, host, database, to, host))
+	case "postgresql":
+		return runCommand("sudo", "-u", "postgres", "psql", "-c",
+			fmt.Sprintf("ALTER ROLE \"%s\" RENAME TO \"%s\";", from, to))
+	}
+	return fmt.Errorf("unsupported database type: %s", dbType)
+}
+
+// ssl: certificates that no longer cover their renamed domain are marked
+// for reissue.
+
+func (s *AccountRenameService) applySSL(ctx *renameContext) (string, error) {
+	if !ctx.domainChanged() {
+		return "domain unchanged", nil
+	}
+
+	var certificates []models.SSL
+	if err := ctx.db.Preload("Domain").Where("user_id = ? AND status = ?", ctx.user.ID, "active").
+		Find(&certificates).Error; err != nil {
+		return "", fmt.Errorf("failed to load certificates: %v", err)
+	}
+
+	var reissue []string
+	for _, certificate := range certificates {
+		key := fmt.Sprintf("ssl:%d", certificate.ID)
+		if ctx.done(key) || certificateCovers(certificate.Certificate, certificate.Domain.Name) {
+			continue
+		}
+		if err := ctx.set(key, certificate.Status); err != nil {
+			return "", err
+		}
+		if err := ctx.db.Model(&certificate).Update("status", "reissue_required").Error; err != nil {
+			return "", fmt.Errorf("failed to update certificate %d: %v", certificate.ID, err)
+		}
+		reissue = append(reissue, certificate.Domain.Name)
+	}
+	if len(reissue) == 0 {
+		return "no certificates affected", nil
+	}
+	return "certificates to reissue: " + strings.Join(reissue, ", "), nil
+}
+
+func (s *AccountRenameService) revertSSL(ctx *renameContext) error {
+	for _, id := range ctx.keys("ssl:") {
+		if err := ctx.db.Model(&models.SSL{}).Where("id = ?", id).
+			Update("status", ctx.state[fmt.Sprintf("ssl:%d", id)]).Error; err != nil {
+			return fmt.Errorf("failed to restore certificate %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func certificateCovers(certPEM, host string) bool {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return false
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	return certificate.VerifyHostname(host) == nil
+}
+
+// vhosts: every site moves when its domain or the user serving it changes.
+
+func (s *AccountRenameService) applyVhosts(ctx *renameContext) (string, error) {
+	if s.renameCommand == "" {
+		return "ACCOUNT_VHOST_RENAME_COMMAND not set", nil
+	}
+
+	renamed := ctx.stepState("domains")
+	var domains []models.Domain
+	if err := ctx.db.Where("user_id = ?", ctx.user.ID).Find(&domains).Error; err != nil {
+		return "", fmt.Errorf("failed to load domains: %v", err)
+	}
+
+	moved := 0
+	for _, domain := range domains {
+		key := fmt.Sprintf("vhost:%d", domain.ID)
+		oldName, ok := renamed[fmt.Sprintf("domain:%d", domain.ID)]
+		if !ok {
+			if !ctx.usernameChanged() {
+				continue
+			}
+			oldName = domain.Name
+		}
+		if ctx.done(key) {
+			continue
+		}
+		if err := s.runRenameCommand(oldName, domain.Name, ctx.rename.OldUsername, ctx.rename.NewUsername, domain.DocumentRoot); err != nil {
+			return "", err
+		}
+		if err := ctx.set(key, oldName); err != nil {
+			return "", err
+		}
+		moved++
+	}
+	return fmt.Sprintf("%d sites moved", moved), nil
+}
+
+func (s *AccountRenameService) revertVhosts(ctx *renameContext) error {
+	for _, id := range ctx.keys("vhost:") {
+		var domain models.Domain
+		if err := ctx.db.First(&domain, id).Error; err != nil {
+			return fmt.Errorf("failed to load domain %d: %v", id, err)
+		}
+		if err := s.runRenameCommand(domain.Name, ctx.state[fmt.Sprintf("vhost:%d", id)],
+			ctx.rename.NewUsername, ctx.rename.OldUsername, domain.DocumentRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRenameCommand runs ACCOUNT_VHOST_RENAME_COMMAND without a shell, so
+// nothing substituted into it is interpreted.
+func (s *AccountRenameService) runRenameCommand(oldDomain, domain, oldUser, user, docroot string) error {
+	args := strings.Fields(s.renameCommand)
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{old_domain}", oldDomain)
+		arg = strings.ReplaceAll(arg, "{domain}", domain)
+		arg = strings.ReplaceAll(arg, "{old_user}", oldUser)
+		arg = strings.ReplaceAll(arg, "{user}", user)
+		args[i] = strings.ReplaceAll(arg, "{docroot}", docroot)
+	}
+	return runCommand(args[0], args[1:]...)
+}
+
+// crontab: the rewritten jobs are installed for the renamed user, unless
+// the account is suspended.
+
+func (s *AccountRenameService) applyCrontab(ctx *renameContext) (string, error) {
+	if !ctx.usernameChanged() && len(ctx.stepState("cron")) == 0 {
+		return "cron jobs unchanged", nil
+	}
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return "crontab not installed", nil
+	}
+	if accountDisabled(ctx.user.Status) {
+		return "account is " + ctx.user.Status + ", crontab left off", nil
+	}
+	if err := installCrontab(ctx.db, ctx.user); err != nil {
+		return "", err
+	}
+	if err := ctx.set("installed", "true"); err != nil {
+		return "", err
+	}
+	return "crontab installed for " + ctx.user.Username, nil
+}
+
+func (s *AccountRenameService) revertCrontab(ctx *renameContext) error {
+	if !ctx.done("installed") || !ctx.usernameChanged() {
+		return nil
+	}
+	return removeCrontab(ctx.rename.NewUsername)
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLRenameScript(t *testing.T) {
+	assert.Equal(t,
+		"CREATE DATABASE IF NOT EXISTS `bob_shop`; "+
+			"RENAME TABLE `jane_shop`.`orders` TO `bob_shop`.`orders`; "+
+			"RENAME TABLE `jane_shop`.`odd``name` TO `bob_shop`.`odd``name`; "+
+			"DROP DATABASE `jane_shop`;",
+		mysqlRenameScript("jane_shop", "bob_shop", []string{"orders", "odd`name"}))
+}
+
+func TestMySQLMovable(t *testing.T) {
+	assert.NoError(t, mysqlMovable("jane_shop", "0\t0\t0\t0"))
+
+	err := mysqlMovable("jane_shop", "2\t0\t1\t0")
+	assert.EqualError(t, err, "database jane_shop has 2 views, 1 triggers, which MySQL cannot move to a renamed database; drop or move them out before renaming the account")
+
+	assert.Error(t, mysqlMovable("jane_shop", "ERROR 1045"), "unexpected output is a refusal")
+}
@@ -2,6 +2,7 @@
 package services
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
 	"errors"
@@ -12,14 +13,18 @@ import (
 )
 
 type AccountService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db        *gorm.DB
+	passwords *auth.PasswordPolicy
+	lifecycle *AccountLifecycle
+	logger    *utils.Logger
 }
 
 func NewAccountService(db *gorm.DB, logger *utils.Logger) *AccountService {
 	return &AccountService{
-		db:     db,
-		logger: logger,
+		db:        db,
+		passwords: auth.NewPasswordPolicy(db),
+		lifecycle: NewAccountLifecycle(db, logger),
+		logger:    logger,
 	}
 }
 
@@ -69,6 +74,14 @@ func (s *AccountService) CreateAccount(username, email, password, domain string,
 		return nil, errors.New("package not found")
 	}
 
+	if err := s.passwords.Validate(password, auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		Username: username,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
@@ -92,6 +105,10 @@ func (s *AccountService) CreateAccount(username, email, password, domain string,
 		return nil, err
 	}
 
+	if err := s.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindPanel, OwnerID: user.ID}, hashedPassword); err != nil {
+		s.logger.Error(err.Error())
+	}
+
 	// Create domain entry
 	domainEntry := models.Domain{
 		Name:      domain,
@@ -131,9 +148,6 @@ func (s *AccountService) UpdateAccount(id uint, email string, packageID uint, st
 	if packageID != 0 {
 		user.PackageID = packageID
 	}
-	if status != "" {
-		user.Status = status
-	}
 
 	user.UpdatedAt = time.Now()
 
@@ -141,52 +155,32 @@ func (s *AccountService) UpdateAccount(id uint, email string, packageID uint, st
 		return nil, err
 	}
 
+	// Status changes drive the account's services, so they go through the
+	// lifecycle
+	if status != "" && status != user.Status {
+		if _, err := s.lifecycle.Transition(user.ID, status, "", 0); err != nil {
+			return nil, err
+		}
+		user.Status = status
+	}
+
 	return &user, nil
 }
 
 func (s *AccountService) SuspendAccount(id uint, reason string) error {
-	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return err
-	}
-
-	user.Status = "suspended"
-	user.SuspensionReason = reason
-	user.UpdatedAt = time.Now()
-
-	return s.db.Save(&user).Error
+	_, err := s.lifecycle.Transition(id, AccountSuspended, reason, 0)
+	return err
 }
 
 func (s *AccountService) UnsuspendAccount(id uint) error {
-	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return err
-	}
-
-	user.Status = "active"
-	user.SuspensionReason = ""
-	user.UpdatedAt = time.Now()
-
-	return s.db.Save(&user).Error
+	_, err := s.lifecycle.Transition(id, AccountActive, "", 0)
+	return err
 }
 
+// DeleteAccount terminates the account and purges it through the lifecycle.
 func (s *AccountService) DeleteAccount(id uint) error {
-	// Start transaction
-	tx := s.db.Begin()
-
-	// Delete related domains
-	if err := tx.Where("user_id = ?", id).Delete(&models.Domain{}).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	// Delete user
-	if err := tx.Delete(&models.User{}, id).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	return tx.Commit().Error
+	_, err := s.lifecycle.Remove(id, "", 0)
+	return err
 }
 
 func (s *AccountService) GetAccountStats() (*AccountStats, error) {
@@ -210,17 +204,19 @@ package services
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
 	"fmt"
 	"gorm.io/gorm"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AccountService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	lifecycle *AccountLifecycle
 }
 
 func NewAccountService(db *gorm.DB) *AccountService {
-	return &AccountService{db: db}
+	return &AccountService{db: db, lifecycle: NewAccountLifecycle(db, utils.NewLogger())}
 }
 
 func (s *AccountService) CreateAccount(account *models.User) error {
@@ -250,15 +246,19 @@ func (s *AccountService) UpdateAccount(account *models.User) error {
 }
 
 func (s *AccountService) SuspendAccount(id uint) error {
-	return s.db.Model(&models.User{}).Where("id = ?", id).Update("status", "suspended").Error
+	_, err := s.lifecycle.Transition(id, AccountSuspended, "", 0)
+	return err
 }
 
 func (s *AccountService) UnsuspendAccount(id uint) error {
-	return s.db.Model(&models.User{}).Where("id = ?", id).Update("status", "active").Error
+	_, err := s.lifecycle.Transition(id, AccountActive, "", 0)
+	return err
 }
 
+// DeleteAccount terminates the account and purges it through the lifecycle.
 func (s *AccountService) DeleteAccount(id uint) error {
-	return s.db.Delete(&models.User{}, id).Error
+	_, err := s.lifecycle.Remove(id, "", 0)
+	return err
 }
 
 func (s *AccountService) GetAccountStats(id uint) (map[string]interface{}, error) {
@@ -298,24 +298,187 @@ func (s *AccountService) countUserDatabases(userID uint) int64 {
 package services
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrEmailTaken          = errors.New("email already exists")
+	ErrPasswordNotSettable = errors.New("password of this account is managed by a directory")
+)
+
 type AccountService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db        *gorm.DB
+	passwords *auth.PasswordPolicy
+	resets    *auth.PasswordResetManager
+	sessions  *auth.SessionManager
+	packages  *PackageChangeService
+	pools     *ResellerPoolService
+	lifecycle *AccountLifecycle
+	logger    *utils.Logger
 }
 
 func NewAccountService(db *gorm.DB, logger *utils.Logger) *AccountService {
 	return &AccountService{
-		db:     db,
-		logger: logger,
+		db:        db,
+		passwords: auth.NewPasswordPolicy(db),
+		resets:    auth.NewPasswordResetManager(db),
+		sessions:  auth.NewSessionManager(db),
+		packages:  NewPackageChangeService(db, logger),
+		pools:     NewResellerPoolService(db),
+		lifecycle: NewAccountLifecycle(db, logger),
+		logger:    logger,
+	}
+}
+
+// NewAccount is a customer account created for a reseller, or for the
+// administrators when ResellerID is nil.
+type NewAccount struct {
+	Username   string
+	Email      string
+	Password   string
+	Domain     string
+	PackageID  *uint
+	ResellerID *uint
+}
+
+// Provision creates a customer account with its primary domain. A reseller's
+// account is created within its pool.
+func (s *AccountService) Provision(req NewAccount) (*models.User, error) {
+	if err := s.checkNew(req); err != nil {
+		return nil, err
+	}
+
+	hash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+	now := time.Now()
+	user := &models.User{
+		Username:          req.Username,
+		Email:             req.Email,
+		Password:          hash,
+		PasswordChangedAt: &now,
+		PackageID:         req.PackageID,
+		Role:              "user",
+		Status:            AccountActive,
+	}
+	if req.ResellerID != nil {
+		err = s.pools.CreateAccount(*req.ResellerID, user)
+	} else {
+		err = s.db.Create(user).Error
+	}
+	if err != nil {
+		if _, ok := ResellerPoolErrorStatus(err); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create account: %v", err)
+	}
+
+	if err := s.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindPanel, OwnerID: user.ID}, hash); err != nil {
+		s.logger.Error(err.Error())
+	}
+	if req.Domain != "" {
+		domain := &models.Domain{
+			UserID:       user.ID,
+			Name:         req.Domain,
+			Type:         "primary",
+			DocumentRoot: "/public_html",
+			Status:       "active",
+		}
+		if err := s.db.Create(domain).Error; err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to create domain %s for %s: %v", req.Domain, user.Username, err))
+		} else if err := NewNameserverService(s.db, s.logger).ApplyToDomain(domain); err != nil {
+			s.logger.Error(err.Error())
+		}
+	}
+
+	s.logger.Info(fmt.Sprintf("Account created successfully for user: %s", user.Username))
+	return user, nil
+}
+
+// checkNew refuses a new account whose username, email or domain is taken,
+// whose package is missing or inactive, or whose password breaks the policy.
+func (s *AccountService) checkNew(req NewAccount) error {
+	var count int64
+	s.db.Model(&models.User{}).Unscoped().Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		return ErrUsernameTaken
+	}
+	s.db.Model(&models.User{}).Where("email = ?", req.Email).Count(&count)
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	if req.Domain != "" {
+		s.db.Model(&models.Domain{}).Where("name = ?", req.Domain).Count(&count)
+		if count > 0 {
+			return ErrDomainTaken
+		}
+	}
+	if req.PackageID != nil {
+		var pkg models.Package
+		if err := s.db.First(&pkg, *req.PackageID).Error; err != nil {
+			return ErrPackageNotFound
+		}
+		if pkg.Status != "" && pkg.Status != "active" {
+			return ErrPackageInactive
+		}
+	}
+	return s.passwords.Validate(req.Password, auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		Username: req.Username,
+		Email:    req.Email,
+	})
+}
+
+// SetPassword replaces the account's panel password without the current
+// one, as billing systems and administrators do. Open sessions are signed
+// out and outstanding reset links voided.
+func (s *AccountService) SetPassword(id uint, password string) error {
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		return ErrAccountNotFound
+	}
+	if s.passwords.DirectoryManaged(user.ID) {
+		return ErrPasswordNotSettable
+	}
+
+	subject := auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		OwnerID:  user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if err := s.passwords.Validate(password, subject); err != nil {
+		return err
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"password":            hash,
+		"password_changed_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+	if err := s.passwords.Record(subject, hash); err != nil {
+		s.logger.Error(err.Error())
+	}
+	if err := s.resets.Invalidate(user.ID); err != nil {
+		s.logger.Error(err.Error())
+	}
+	if _, err := s.sessions.RevokeAll(user.ID, "", "password_changed"); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to revoke sessions of user %d after password change: %v", user.ID, err))
 	}
+	return nil
 }
 
 func (s *AccountService) GetAccountsPaginated(page, limit int) ([]models.User, int64, error) {
@@ -347,6 +510,14 @@ func (s *AccountService) CreateAccount(req *models.CreateAccountRequest) (*model
 		return nil, errors.New("email already exists")
 	}
 
+	if err := s.passwords.Validate(req.Password, auth.PasswordSubject{
+		Kind:     auth.PasswordKindPanel,
+		Username: req.Username,
+		Email:    req.Email,
+	}); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -354,23 +525,30 @@ func (s *AccountService) CreateAccount(req *models.CreateAccountRequest) (*model
 	}
 
 	// Create user
+	now := time.Now()
 	user := &models.User{
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: hashedPassword,
-		PackageID:    req.PackageID,
-		Role:         "user",
-		Status:       "active",
+		Username:          req.Username,
+		Email:             req.Email,
+		PasswordHash:      hashedPassword,
+		PasswordChangedAt: &now,
+		PackageID:         req.PackageID,
+		Role:              "user",
+		Status:            "active",
 	}
 
 	if err := s.db.Create(user).Error; err != nil {
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
+	if err := s.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindPanel, OwnerID: user.ID}, hashedPassword); err != nil {
+		s.logger.Error(err.Error())
+	}
+
 	// Create domain
 	domain := &models.Domain{
 		UserID:       user.ID,
-		Domain:       req.Domain,
+		Name:         req.Domain,
+		Type:         "primary",
 		DocumentRoot: "/public_html",
 		Status:       "active",
 	}
@@ -378,6 +556,8 @@ func (s *AccountService) CreateAccount(req *models.CreateAccountRequest) (*model
 	if err := s.db.Create(domain).Error; err != nil {
 		s.logger.Error("Failed to create domain for user: " + err.Error())
 		// Don't fail the account creation for domain creation failure
+	} else if err := NewNameserverService(s.db, s.logger).ApplyToDomain(domain); err != nil {
+		s.logger.Error(err.Error())
 	}
 
 	// Load package information
@@ -389,7 +569,9 @@ func (s *AccountService) CreateAccount(req *models.CreateAccountRequest) (*model
 	return user, nil
 }
 
-func (s *AccountService) UpdateAccount(id uint, req *models.UpdateAccountRequest) (*models.User, error) {
+// UpdateAccount applies the requested changes to the account. A status
+// change is recorded with the reason and the acting user.
+func (s *AccountService) UpdateAccount(id uint, req *models.UpdateAccountRequest, reason string, actorID uint) (*models.User, error) {
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		return nil, errors.New("account not found")
@@ -399,17 +581,27 @@ func (s *AccountService) UpdateAccount(id uint, req *models.UpdateAccountRequest
 	if req.Email != "" {
 		user.Email = req.Email
 	}
-	if req.PackageID != 0 {
-		user.PackageID = req.PackageID
-	}
-	if req.Status != "" {
-		user.Status = req.Status
-	}
 
 	if err := s.db.Save(&user).Error; err != nil {
 		return nil, fmt.Errorf("failed to update account: %v", err)
 	}
 
+	// Status changes drive the account's services, so they go through the
+	// lifecycle
+	if req.Status != "" && req.Status != user.Status {
+		if _, err := s.lifecycle.Transition(user.ID, req.Status, reason, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Package changes are checked against the account's usage and applied
+	// to the server, so they go through the package change workflow
+	if req.PackageID != 0 && (user.PackageID == nil || *user.PackageID != req.PackageID) {
+		if _, err := s.packages.Change(user.ID, req.PackageID, PackageChangeOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
 	// Load package information
 	if err := s.db.Preload("Package").First(&user, user.ID).Error; err != nil {
 		s.logger.Error("Failed to load package info: " + err.Error())
@@ -419,70 +611,25 @@ func (s *AccountService) UpdateAccount(id uint, req *models.UpdateAccountRequest
 	return &user, nil
 }
 
-func (s *AccountService) DeleteAccount(id uint) error {
-	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return errors.New("account not found")
-	}
-
-	// Begin transaction
-	tx := s.db.Begin()
-
-	// Delete related records
-	if err := tx.Where("user_id = ?", id).Delete(&models.Domain{}).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete domains: %v", err)
-	}
-
-	if err := tx.Where("user_id = ?", id).Delete(&models.Database{}).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete databases: %v", err)
-	}
-
-	if err := tx.Where("user_id = ?", id).Delete(&models.Email{}).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete emails: %v", err)
-	}
-
-	// Delete user
-	if err := tx.Delete(&user).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete user: %v", err)
+// DeleteAccount terminates the account and purges it through the
+// lifecycle, which takes its services down and removes its data. The row is
+// kept, marked purged, for billing history.
+func (s *AccountService) DeleteAccount(id uint, reason string, actorID uint) error {
+	if _, err := s.lifecycle.Remove(id, reason, actorID); err != nil {
+		return err
 	}
-
-	tx.Commit()
-	s.logger.Info(fmt.Sprintf("Account deleted successfully for user: %s", user.Username))
+	s.logger.Info(fmt.Sprintf("Account %d deleted", id))
 	return nil
 }
 
-func (s *AccountService) SuspendAccount(id uint) error {
-	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return errors.New("account not found")
-	}
-
-	user.Status = "suspended"
-	if err := s.db.Save(&user).Error; err != nil {
-		return fmt.Errorf("failed to suspend account: %v", err)
-	}
-
-	s.logger.Info(fmt.Sprintf("Account suspended for user: %s", user.Username))
-	return nil
+func (s *AccountService) SuspendAccount(id uint, reason string, actorID uint) error {
+	_, err := s.lifecycle.Transition(id, AccountSuspended, reason, actorID)
+	return err
 }
 
-func (s *AccountService) UnsuspendAccount(id uint) error {
-	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return errors.New("account not found")
-	}
-
-	user.Status = "active"
-	if err := s.db.Save(&user).Error; err != nil {
-		return fmt.Errorf("failed to unsuspend account: %v", err)
-	}
-
-	s.logger.Info(fmt.Sprintf("Account unsuspended for user: %s", user.Username))
-	return nil
+func (s *AccountService) UnsuspendAccount(id uint, reason string, actorID uint) error {
+	_, err := s.lifecycle.Transition(id, AccountActive, reason, actorID)
+	return err
 }
 
 func (s *AccountService) GetAccountByID(id uint) (*models.User, error) {
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/utils"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authLogPattern matches one kind of login line. Patterns capture the
+// client address as "ip" and, when the daemon logs it, the login as "user"
+// and the number of failures the line stands for as "count".
+type authLogPattern struct {
+	success bool
+	re      *regexp.Regexp
+}
+
+const logIP = `(?:::ffff:)?(?P<ip>[0-9a-fA-F:.]+)`
+
+var authLogPatterns = map[string][]authLogPattern{
+	auth.SourceSSH: {
+		{false, regexp.MustCompile(`sshd\[\d+\]: Failed \S+ for (?:invalid user )?(?P<user>\S*) from ` + logIP + ` port`)},
+		{true, regexp.MustCompile(`sshd\[\d+\]: Accepted \S+ for (?P<user>\S+) from ` + logIP + ` port`)},
+	},
+	auth.SourceMail: {
+		// Dovecot logs one line per connection, however many passwords it tried
+		{false, regexp.MustCompile(`-login: .*\(auth failed, (?P<count>\d+) attempts?.*? user=<(?P<user>[^>]*)>.*? rip=` + logIP)},
+		{true, regexp.MustCompile(`-login: Login: user=<(?P<user>[^>]*)>.*? rip=` + logIP)},
+		{false, regexp.MustCompile(`postfix/\S+\[\d+\]: warning: \S*\[` + logIP + `\]: SASL \S+ authentication failed`)},
+	},
+	auth.SourceFTP: {
+		{false, regexp.MustCompile(`\[(?P<user>[^\]]*)\] FAIL LOGIN: Client "` + logIP + `"`)},
+		{true, regexp.MustCompile(`\[(?P<user>[^\]]*)\] OK LOGIN: Client "` + logIP + `"`)},
+		{false, regexp.MustCompile(`\[` + logIP + `\]\) - USER (?P<user>\S+?):? (?:\(Login failed\)|no such user found)`)},
+		{true, regexp.MustCompile(`\[` + logIP + `\]\) - USER (?P<user>\S+): Login successful`)},
+		{false, regexp.MustCompile(`pure-ftpd: \(\?@` + logIP + `\) \[WARNING\] Authentication failed for user \[(?P<user>[^\]]*)\]`)},
+		{true, regexp.MustCompile(`pure-ftpd: \(\?@` + logIP + `\) \[INFO\] (?P<user>\S+) is now logged in`)},
+	},
+}
+
+// maxFailuresPerLine bounds how many failures a single log line can record.
+const maxFailuresPerLine = 10
+
+// authLogEvent is a login parsed from a daemon's log.
+type authLogEvent struct {
+	ip       string
+	username string
+	success  bool
+	count    int
+}
+
+// AuthLogWatcher follows the mail, FTP and SSH daemons' logs and reports
+// their logins to brute-force protection. IP lockouts from any source and
+// any node are applied to the local firewall with BRUTE_FORCE_BLOCK_COMMAND
+// and lifted early with BRUTE_FORCE_UNBLOCK_COMMAND; in both, {ip} and
+// {seconds} are replaced with the address and the remaining lockout.
+// Internal addresses, the TRUSTED_PROXIES and the addresses and networks in
+// BRUTE_FORCE_ALLOWLIST are never firewalled.
+type AuthLogWatcher struct {
+	bruteForce     *auth.BruteForceProtection
+	logger         *utils.Logger
+	logs           map[string][]string
+	exempt         []*net.IPNet
+	blockCommand   string
+	unblockCommand string
+}
+
+func NewAuthLogWatcher(bruteForce *auth.BruteForceProtection, logger *utils.Logger) *AuthLogWatcher {
+	return &AuthLogWatcher{
+		bruteForce: bruteForce,
+		logger:     logger,
+		logs: map[string][]string{
+			auth.SourceSSH:  logPaths("AUTH_LOG_SSH", "/var/log/auth.log,/var/log/secure"),
+			auth.SourceMail: logPaths("AUTH_LOG_MAIL", "/var/log/mail.log,/var/log/maillog"),
+			auth.SourceFTP:  logPaths("AUTH_LOG_FTP", "/var/log/vsftpd.log,/var/log/proftpd/proftpd.log"),
+		},
+		exempt:         addressList(os.Getenv("TRUSTED_PROXIES"), os.Getenv("BRUTE_FORCE_ALLOWLIST")),
+		blockCommand:   os.Getenv("BRUTE_FORCE_BLOCK_COMMAND"),
+		unblockCommand: os.Getenv("BRUTE_FORCE_UNBLOCK_COMMAND"),
+	}
+}
+
+// Start follows every configured log and applies lockouts until the process
+// exits. Logs that do not exist yet are picked up once they appear.
+func (w *AuthLogWatcher) Start() {
+	for source, paths := range w.logs {
+		for _, path := range paths {
+			go w.follow(source, path)
+		}
+	}
+
+	w.bruteForce.Subscribe(context.Background(), w.applyLockout)
+}
+
+func (w *AuthLogWatcher) follow(source, path string) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var tail *logTail
+	// Lines written before the panel started are not replayed
+	atEnd := true
+	for range ticker.C {
+		if tail == nil {
+			tail = openLogTail(path, atEnd)
+			if tail == nil {
+				atEnd = false
+				continue
+			}
+		}
+
+		for _, line := range tail.lines() {
+			if event, ok := parseAuthLogLine(source, line); ok {
+				w.record(source, event)
+			}
+		}
+
+		// After rotation the old file has been drained; the new one is read
+		// from its start
+		if tail.replaced() {
+			tail.close()
+			tail = nil
+			atEnd = false
+		}
+	}
+}
+
+func (w *AuthLogWatcher) record(source string, event authLogEvent) {
+	if event.success {
+		w.bruteForce.RecordSuccess(source, event.ip, event.username)
+		return
+	}
+	for i := 0; i < event.count; i++ {
+		w.bruteForce.RecordFailure(source, event.ip, event.username)
+	}
+}
+
+func (w *AuthLogWatcher) applyLockout(event auth.LockoutEvent) {
+	if event.Lockout.Scope != auth.LockScopeIP || w.exempted(event.Lockout.IP) {
+		return
+	}
+
+	command := w.blockCommand
+	if event.Action == auth.LockoutReleased {
+		command = w.unblockCommand
+	}
+	if command == "" {
+		return
+	}
+
+	seconds := int(time.Until(event.Lockout.Until).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	// The command is not run through a shell, and the address has been
+	// validated, so nothing in it is interpreted
+	args := strings.Fields(command)
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{ip}", event.Lockout.IP)
+		args[i] = strings.ReplaceAll(arg, "{seconds}", strconv.Itoa(seconds))
+	}
+
+	if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		w.logger.Error(fmt.Sprintf("Failed to %s %s in the firewall: %v: %s", event.Action, event.Lockout.IP, err, strings.TrimSpace(string(output))))
+		return
+	}
+	w.logger.Info(fmt.Sprintf("Firewall %s %s", event.Action, event.Lockout.IP))
+}
+
+func parseAuthLogLine(source, line string) (authLogEvent, bool) {
+	for _, pattern := range authLogPatterns[source] {
+		match := pattern.re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		event := authLogEvent{success: pattern.success, count: 1}
+		for i, name := range pattern.re.SubexpNames() {
+			switch name {
+			case "ip":
+				event.ip = match[i]
+			case "user":
+				event.username = match[i]
+			case "count":
+				if count, err := strconv.Atoi(match[i]); err == nil && count > 0 {
+					event.count = count
+				}
+			}
+		}
+		if event.count > maxFailuresPerLine {
+			event.count = maxFailuresPerLine
+		}
+
+		// Local clients such as webmail would otherwise lock out the server
+		if ignoredAddress(event.ip) {
+			return authLogEvent{}, false
+		}
+		return event, true
+	}
+	return authLogEvent{}, false
+}
+
+// ignoredAddress reports whether ip is not a remote address worth counting
+// or blocking: loopback, private, link-local and other internal addresses
+// belong to the server's own clients and neighbours.
+func ignoredAddress(ip string) bool {
+	return !utils.IsPublicIP(net.ParseIP(ip))
+}
+
+// exempted reports whether a lockout of ip must not reach the firewall.
+func (w *AuthLogWatcher) exempted(ip string) bool {
+	if ignoredAddress(ip) {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	for _, network := range w.exempt {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressList parses comma separated addresses and CIDR networks, skipping
+// entries that are neither.
+func addressList(values ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if !strings.Contains(entry, "/") {
+				ip := net.ParseIP(entry)
+				if ip == nil {
+					continue
+				}
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			} else if _, network, err := net.ParseCIDR(entry); err == nil {
+				networks = append(networks, network)
+			}
+		}
+	}
+	return networks
+}
+
+func logPaths(env, defaults string) []string {
+	value, set := os.LookupEnv(env)
+	if !set {
+		value = defaults
+	}
+
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// logTail reads lines appended to a log file, surviving truncation.
+type logTail struct {
+	path    string
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+func openLogTail(path string, atEnd bool) *logTail {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	var offset int64
+	if atEnd {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil
+		}
+	}
+	return &logTail{path: path, file: file, reader: bufio.NewReader(file), offset: offset}
+}
+
+// lines returns the complete lines written since the last call.
+func (t *logTail) lines() []string {
+	// Truncated in place, as logrotate's copytruncate does
+	if info, err := t.file.Stat(); err == nil && info.Size() < t.offset {
+		if _, err := t.file.Seek(0, io.SeekStart); err == nil {
+			t.reader.Reset(t.file)
+			t.offset, t.partial = 0, ""
+		}
+	}
+
+	var lines []string
+	for {
+		chunk, err := t.reader.ReadString('\n')
+		t.offset += int64(len(chunk))
+		if err != nil {
+			// Keep a line still being written for the next call
+			t.partial += chunk
+			return lines
+		}
+		lines = append(lines, strings.TrimRight(t.partial+chunk, "\r\n"))
+		t.partial = ""
+	}
+}
+
+// replaced reports whether the path now names a different file.
+func (t *logTail) replaced() bool {
+	current, err := os.Stat(t.path)
+	if err != nil {
+		return false
+	}
+	opened, err := t.file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(opened, current)
+}
+
+func (t *logTail) close() {
+	t.file.Close()
+}
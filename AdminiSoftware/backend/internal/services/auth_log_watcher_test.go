@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"AdminiSoftware/internal/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthLogLine(t *testing.T) {
+	event, ok := parseAuthLogLine(auth.SourceSSH, "Oct 19 10:00:00 host sshd[123]: Failed password for invalid user admin from 203.0.113.7 port 52311 ssh2")
+	assert.True(t, ok)
+	assert.Equal(t, authLogEvent{ip: "203.0.113.7", username: "admin", count: 1}, event)
+
+	event, ok = parseAuthLogLine(auth.SourceMail, "Oct 19 10:00:00 host dovecot: imap-login: Disconnected (auth failed, 3 attempts in 6 secs): user=<jane@example.com>, method=PLAIN, rip=198.51.100.4, lip=192.0.2.1")
+	assert.True(t, ok)
+	assert.Equal(t, 3, event.count)
+	assert.Equal(t, "198.51.100.4", event.ip)
+
+	// Webmail and other local clients, and neighbours on the private
+	// network, are not counted
+	for _, ip := range []string{"127.0.0.1", "10.0.0.5", "192.168.1.20", "fe80::1"} {
+		_, ok = parseAuthLogLine(auth.SourceSSH, "sshd[1]: Failed password for root from "+ip+" port 22 ssh2")
+		assert.False(t, ok, ip)
+	}
+}
+
+func TestAuthLogWatcherExempted(t *testing.T) {
+	watcher := &AuthLogWatcher{exempt: addressList("203.0.113.10, 2001:db8::/32", "198.51.100.0/24,not-an-address")}
+
+	for _, ip := range []string{"203.0.113.10", "198.51.100.77", "2001:db8::1", "10.1.2.3", "169.254.169.254", "::1", ""} {
+		assert.True(t, watcher.exempted(ip), ip)
+	}
+	for _, ip := range []string{"203.0.113.11", "8.8.8.8", "2606:4700::1111"} {
+		assert.False(t, watcher.exempted(ip), ip)
+	}
+}
@@ -0,0 +1,486 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	backupHomeDir      = "homedir"
+	backupDatabasesDir = "databases"
+	backupPublicDir    = "public_html"
+	backupDBIndexFile  = "databases.json"
+)
+
+// BackupDatabaseEntry describes one logical dump packed into an account backup.
+type BackupDatabaseEntry struct {
+	Name   string               `json:"name"`
+	Type   string               `json:"type"`
+	File   string               `json:"file"`
+	Owner  string               `json:"owner"`
+	Grants []BackupDatabaseUser `json:"grants"`
+}
+
+// BackupDatabaseUser holds what is needed to recreate a DatabaseUser row:
+// the statements MySQL prints for it, or the PostgreSQL role's password
+// hash, from which the role and its grant are rebuilt on restore.
+type BackupDatabaseUser struct {
+	Username     string   `json:"username"`
+	Host         string   `json:"host"`
+	Privileges   string   `json:"privileges"`
+	Statements   []string `json:"statements,omitempty"`
+	PasswordHash string   `json:"password_hash,omitempty"`
+}
+
+// legacyRolePassword reads the password hash out of the CREATE ROLE
+// statement older archives stored for PostgreSQL users.
+var legacyRolePassword = regexp.MustCompile(`(?i)^CREATE ROLE .* LOGIN PASSWORD '(.*)';?$`)
+
+// mysqlNativePassword matches a mysql_native_password hash, alone or inside
+// the CREATE USER statement MySQL prints for the account.
+var mysqlNativePassword = regexp.MustCompile(`\*[0-9A-F]{40}`)
+
+// dumpUserDatabases writes a consistent dump of every database owned by the
+// account into stagingDir/databases together with an index of grants.
+func (s *BackupService) dumpUserDatabases(job *backupJob, userID uint, stagingDir string) error {
+	var databases []models.Database
+	if err := s.db.Preload("Users").Where("user_id = ?", userID).Find(&databases).Error; err != nil {
+		return fmt.Errorf("failed to load databases: %v", err)
+	}
+
+	dumpDir := filepath.Join(stagingDir, backupDatabasesDir)
+	if err := os.MkdirAll(dumpDir, 0700); err != nil {
+		return fmt.Errorf("failed to create dump directory: %v", err)
+	}
+
+	job.setPhase(BackupPhaseDatabases)
+
+	entries := make([]BackupDatabaseEntry, 0, len(databases))
+	for _, database := range databases {
+		job.update(true, func(state *BackupProgressEvent) {
+			state.CurrentDatabase = database.Name
+		})
+
+		entry, err := s.dumpDatabase(job.ctx, &database, dumpDir)
+		if err != nil {
+			return fmt.Errorf("failed to dump database %s: %v", database.Name, err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dumpDir, backupDBIndexFile), data, 0600)
+}
+
+func (s *BackupService) dumpDatabase(ctx context.Context, database *models.Database, dumpDir string) (*BackupDatabaseEntry, error) {
+	entry := &BackupDatabaseEntry{
+		Name:  database.Name,
+		Type:  database.Type,
+		Owner: database.Username,
+	}
+
+	var cmd *exec.Cmd
+	switch database.Type {
+	case "mysql":
+		entry.File = database.Name + ".sql"
+		cmd = exec.CommandContext(ctx, "mysqldump", "-u", "root",
+			"--single-transaction", "--quick", "--routines", "--triggers", "--events",
+			"--databases", database.Name,
+			"--result-file="+filepath.Join(dumpDir, entry.File))
+	case "postgresql":
+		// pg_dump always works from a single snapshot
+		entry.File = database.Name + ".dump"
+		cmd = exec.CommandContext(ctx, "sudo", "-u", "postgres", "pg_dump",
+			"-Fc", "--no-owner", "--no-acl",
+			"-f", filepath.Join(dumpDir, entry.File), database.Name)
+	case "mongodb":
+		entry.File = database.Name + ".archive"
+		cmd = exec.CommandContext(ctx, "mongodump", "--db", database.Name, "--dumpDbUsersAndRoles",
+			"--gzip", "--archive="+filepath.Join(dumpDir, entry.File))
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", database.Type)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	for _, dbUser := range database.Users {
+		grant, err := s.exportGrants(database, &dbUser)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export grants for %s: %v", dbUser.Username, err)
+		}
+		entry.Grants = append(entry.Grants, *grant)
+	}
+
+	return entry, nil
+}
+
+func (s *BackupService) exportGrants(database *models.Database, dbUser *models.DatabaseUser) (*BackupDatabaseUser, error) {
+	grant := &BackupDatabaseUser{
+		Username:   dbUser.Username,
+		Host:       dbUser.Host,
+		Privileges: dbUser.Privileges,
+	}
+
+	switch database.Type {
+	case "mysql":
+		account := mysqlString(dbUser.Username) + "@" + mysqlString(dbUser.Host)
+		for _, query := range []string{"SHOW CREATE USER " + account, "SHOW GRANTS FOR " + account} {
+			output, err := exec.Command("mysql", "-u", "root", "-N", "-B", "-e", query).Output()
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+				if line != "" {
+					grant.Statements = append(grant.Statements, line)
+				}
+			}
+		}
+	case "postgresql":
+		output, err := postgresQuery("SELECT rolpassword FROM pg_authid WHERE rolname = " + pgLiteral(dbUser.Username))
+		if err != nil {
+			return nil, err
+		}
+		grant.PasswordHash = output
+	case "mongodb":
+		// Users and roles travel inside the archive via --dumpDbUsersAndRoles
+	}
+
+	return grant, nil
+}
+
+// restoreUserDatabases recreates the databases and grants packed into a backup.
+func (s *BackupService) restoreUserDatabases(job *backupJob, backup *models.Backup) error {
+	stagingDir, err := os.MkdirTemp(filepath.Dir(backup.Path), ".restore_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := extractArchive(job, backup.Path, stagingDir, backupDatabasesDir); err != nil {
+		return fmt.Errorf("failed to extract database dumps: %v", err)
+	}
+
+	dumpDir := filepath.Join(stagingDir, backupDatabasesDir)
+	data, err := os.ReadFile(filepath.Join(dumpDir, backupDBIndexFile))
+	if err != nil {
+		return fmt.Errorf("failed to read database index: %v", err)
+	}
+
+	var entries []BackupDatabaseEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid database index: %v", err)
+	}
+
+	job.setPhase(BackupPhaseDatabases)
+	for _, entry := range entries {
+		job.update(true, func(state *BackupProgressEvent) {
+			state.CurrentDatabase = entry.Name
+		})
+
+		var database models.Database
+		if err := s.db.Where("user_id = ? AND name = ?", backup.UserID, entry.Name).First(&database).Error; err != nil {
+			return fmt.Errorf("database %s does not belong to user %d", entry.Name, backup.UserID)
+		}
+
+		if err := s.restoreDatabase(job.ctx, &entry, dumpDir); err != nil {
+			return fmt.Errorf("failed to restore database %s: %v", entry.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// extractArchive unpacks members of an archive into dir, counting the
+// archive bytes read towards the job's progress.
+func extractArchive(job *backupJob, archivePath, dir string, args ...string) error {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	cmd := exec.CommandContext(job.ctx, "tar", append([]string{"-xzf", "-", "-C", dir}, args...)...)
+	cmd.Stdin = &progressReader{job: job, reader: archive}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (s *BackupService) restoreDatabase(ctx context.Context, entry *BackupDatabaseEntry, dumpDir string) error {
+	dumpPath := filepath.Join(dumpDir, filepath.Base(entry.File))
+
+	switch entry.Type {
+	case "mysql":
+		dump, err := os.Open(dumpPath)
+		if err != nil {
+			return err
+		}
+		defer dump.Close()
+
+		cmd := exec.CommandContext(ctx, "mysql", "-u", "root")
+		cmd.Stdin = dump
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+
+		for _, grant := range entry.Grants {
+			if err := exec.Command("mysql", "-u", "root", "-e",
+				"DROP USER IF EXISTS "+mysqlString(grant.Username)+"@"+mysqlString(grant.Host)+";").Run(); err != nil {
+				return err
+			}
+			for _, statement := range grant.Statements {
+				if err := exec.Command("mysql", "-u", "root", "-e", statement+";").Run(); err != nil {
+					return fmt.Errorf("failed to apply grant for %s: %v", grant.Username, err)
+				}
+			}
+		}
+		return exec.Command("mysql", "-u", "root", "-e", "FLUSH PRIVILEGES;").Run()
+
+	case "postgresql":
+		for _, grant := range entry.Grants {
+			if err := restorePostgresRole(&grant); err != nil {
+				return fmt.Errorf("failed to restore role %s: %v", grant.Username, err)
+			}
+		}
+
+		exists, err := postgresQuery("SELECT 1 FROM pg_database WHERE datname = " + pgLiteral(entry.Name))
+		if err != nil {
+			return err
+		}
+		if exists == "" {
+			if output, err := exec.Command("sudo", "-u", "postgres", "createdb", "-O", entry.Owner, "--", entry.Name).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to create database: %v: %s", err, strings.TrimSpace(string(output)))
+			}
+		}
+
+		cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", "pg_restore", "--clean", "--if-exists",
+			"--no-owner", "--role="+entry.Owner, "-d", entry.Name, dumpPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+
+		for _, grant := range entry.Grants {
+			privileges, err := postgresPrivileges(grant.Privileges)
+			if err != nil {
+				return fmt.Errorf("failed to apply grant for %s: %v", grant.Username, err)
+			}
+			if _, err := postgresQuery(fmt.Sprintf("GRANT %s ON DATABASE %s TO %s",
+				privileges, pgIdent(entry.Name), pgIdent(grant.Username))); err != nil {
+				return fmt.Errorf("failed to apply grant for %s: %v", grant.Username, err)
+			}
+		}
+		return nil
+
+	case "mongodb":
+		cmd := exec.CommandContext(ctx, "mongorestore", "--drop", "--gzip", "--restoreDbUsersAndRoles",
+			"--nsInclude", entry.Name+".*", "--archive="+dumpPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported database type: %s", entry.Type)
+	}
+}
+
+// databaseExists reports whether the dump's database, or any of the users
+// it grants, already exists on the database server.
+func databaseExists(entry *BackupDatabaseEntry) (bool, error) {
+	switch entry.Type {
+	case "mysql":
+		count, err := mysqlQuery("SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = " + mysqlString(entry.Name))
+		if err != nil || count != "0" {
+			return count != "0", err
+		}
+		for _, grant := range entry.Grants {
+			count, err := mysqlQuery("SELECT COUNT(*) FROM mysql.user WHERE User = " + mysqlString(grant.Username) +
+				" AND Host = " + mysqlString(grant.Host))
+			if err != nil || count != "0" {
+				return count != "0", err
+			}
+		}
+		return false, nil
+
+	case "postgresql":
+		exists, err := postgresQuery("SELECT 1 FROM pg_database WHERE datname = " + pgLiteral(entry.Name))
+		if err != nil || exists != "" {
+			return exists != "", err
+		}
+		for _, grant := range entry.Grants {
+			exists, err := postgresQuery("SELECT 1 FROM pg_roles WHERE rolname = " + pgLiteral(grant.Username))
+			if err != nil || exists != "" {
+				return exists != "", err
+			}
+		}
+		return false, nil
+
+	case "mongodb":
+		name, _ := json.Marshal(entry.Name)
+		output, err := exec.Command("mongosh", "--quiet", "--eval",
+			fmt.Sprintf("db.getMongo().getDBNames().includes(%s)", name)).CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return strings.TrimSpace(string(output)) == "true", nil
+
+	default:
+		return false, fmt.Errorf("unsupported database type: %s", entry.Type)
+	}
+}
+
+// dropDatabase removes a database restored from the dump together with the
+// users it granted. Only used for databases the caller created.
+func dropDatabase(entry *BackupDatabaseEntry) error {
+	switch entry.Type {
+	case "mysql":
+		for _, grant := range entry.Grants {
+			if _, err := mysqlQuery("DROP USER IF EXISTS " + mysqlString(grant.Username) + "@" + mysqlString(grant.Host)); err != nil {
+				return err
+			}
+		}
+		_, err := mysqlQuery("DROP DATABASE IF EXISTS " + mysqlIdent(entry.Name))
+		return err
+
+	case "postgresql":
+		if output, err := exec.Command("sudo", "-u", "postgres", "dropdb", "--if-exists", "--", entry.Name).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		for _, grant := range entry.Grants {
+			if _, err := postgresQuery("DROP ROLE IF EXISTS " + pgIdent(grant.Username)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "mongodb":
+		output, err := exec.Command("mongosh", "--quiet", entry.Name, "--eval", "db.dropAllUsers(); db.dropDatabase()").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported database type: %s", entry.Type)
+	}
+}
+
+// restorePostgresRole creates the user's login role, or resets the password
+// of one that already exists.
+func restorePostgresRole(grant *BackupDatabaseUser) error {
+	hash := grant.PasswordHash
+	if hash == "" && len(grant.Statements) > 0 {
+		if match := legacyRolePassword.FindStringSubmatch(grant.Statements[0]); match != nil {
+			hash = match[1]
+		}
+	}
+
+	exists, err := postgresQuery("SELECT 1 FROM pg_roles WHERE rolname = " + pgLiteral(grant.Username))
+	if err != nil {
+		return err
+	}
+	statement := "CREATE ROLE " + pgIdent(grant.Username) + " LOGIN"
+	if exists != "" {
+		statement = "ALTER ROLE " + pgIdent(grant.Username) + " LOGIN"
+	}
+	if hash != "" {
+		statement += " PASSWORD " + pgLiteral(hash)
+	}
+	_, err = postgresQuery(statement)
+	return err
+}
+
+// postgresQuery runs one statement as the postgres superuser and returns its
+// unaligned output.
+func postgresQuery(statement string) (string, error) {
+	output, err := exec.Command("sudo", "-u", "postgres", "psql", "-v", "ON_ERROR_STOP=1", "-tAc", statement).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// mysqlQuery runs one statement as the MySQL root user and returns its
+// tab-separated output without column names.
+func mysqlQuery(statement string) (string, error) {
+	output, err := exec.Command("mysql", "-u", "root", "-N", "-B", "-e", statement).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// pgIdent quotes a PostgreSQL identifier.
+func pgIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// pgLiteral quotes a PostgreSQL string literal.
+func pgLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// mysqlString quotes a MySQL string, as used for account names.
+func mysqlString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// mysqlIdent quotes a MySQL identifier.
+func mysqlIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// postgresPrivileges maps the stored privilege list onto database-level
+// grants, refusing anything that is not a database privilege.
+func postgresPrivileges(privileges string) (string, error) {
+	if privileges == "" || strings.EqualFold(privileges, "ALL") || strings.EqualFold(privileges, "ALL PRIVILEGES") {
+		return "ALL PRIVILEGES", nil
+	}
+	var granted []string
+	for _, privilege := range strings.Split(privileges, ",") {
+		privilege = strings.ToUpper(strings.TrimSpace(privilege))
+		switch privilege {
+		case "CREATE", "CONNECT", "TEMPORARY", "TEMP":
+			granted = append(granted, privilege)
+		default:
+			return "", fmt.Errorf("invalid database privilege %q", privilege)
+		}
+	}
+	return strings.Join(granted, ", "), nil
+}
+
+// mysqlPrivileges maps the stored privilege list onto database-level
+// grants, refusing anything that is not a database privilege.
+func mysqlPrivileges(privileges string) (string, error) {
+	if privileges == "" || strings.EqualFold(privileges, "ALL") || strings.EqualFold(privileges, "ALL PRIVILEGES") {
+		return "ALL PRIVILEGES", nil
+	}
+	var granted []string
+	for _, privilege := range strings.Split(privileges, ",") {
+		privilege = strings.ToUpper(strings.Join(strings.Fields(privilege), " "))
+		switch privilege {
+		case "SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "INDEX", "ALTER", "REFERENCES",
+			"CREATE TEMPORARY TABLES", "LOCK TABLES", "EXECUTE", "CREATE VIEW", "SHOW VIEW",
+			"CREATE ROUTINE", "ALTER ROUTINE", "EVENT", "TRIGGER":
+			granted = append(granted, privilege)
+		default:
+			return "", fmt.Errorf("invalid database privilege %q", privilege)
+		}
+	}
+	return strings.Join(granted, ", "), nil
+}
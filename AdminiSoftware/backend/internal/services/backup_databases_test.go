@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresPrivileges(t *testing.T) {
+	for input, want := range map[string]string{
+		"":               "ALL PRIVILEGES",
+		"all":            "ALL PRIVILEGES",
+		"connect, temp":  "CONNECT, TEMP",
+		"CREATE,CONNECT": "CREATE, CONNECT",
+	} {
+		got, err := postgresPrivileges(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"SELECT", "CONNECT; DROP ROLE postgres", "ALL TO public"} {
+		_, err := postgresPrivileges(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMySQLPrivileges(t *testing.T) {
+	for input, want := range map[string]string{
+		"":                         "ALL PRIVILEGES",
+		"all privileges":           "ALL PRIVILEGES",
+		"select, insert":           "SELECT, INSERT",
+		"lock  tables,CREATE VIEW": "LOCK TABLES, CREATE VIEW",
+	} {
+		got, err := mysqlPrivileges(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"SUPER", "FILE", "GRANT OPTION", "SELECT ON *.* TO x"} {
+		_, err := mysqlPrivileges(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestPostgresQuoting(t *testing.T) {
+	assert.Equal(t, `"shop"`, pgIdent("shop"))
+	assert.Equal(t, `"a""; DROP DATABASE x; --"`, pgIdent(`a"; DROP DATABASE x; --`))
+	assert.Equal(t, `'it''s'`, pgLiteral("it's"))
+	assert.Equal(t, `'o\'brien\\'`, mysqlString(`o'brien\`))
+}
+
+func TestLegacyRolePassword(t *testing.T) {
+	match := legacyRolePassword.FindStringSubmatch("CREATE ROLE shop LOGIN PASSWORD 'SCRAM-SHA-256$4096:abc';")
+	if assert.NotNil(t, match) {
+		assert.Equal(t, "SCRAM-SHA-256$4096:abc", match[1])
+	}
+}
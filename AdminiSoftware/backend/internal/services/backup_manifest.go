@@ -0,0 +1,450 @@
+package services
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"archive/tar"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	backupManifestFile    = "manifest.json"
+	backupManifestVersion = 1
+
+	// backupSigningKeyMinLength is the shortest BACKUP_SIGNING_KEY accepted;
+	// with a shorter or empty key anyone could forge a manifest.
+	backupSigningKeyMinLength = 32
+)
+
+// ErrBackupNoManifest is returned for archives written before backups
+// carried a manifest; they cannot be verified.
+var ErrBackupNoManifest = errors.New("backup has no manifest")
+
+var ErrBackupSigningKey = fmt.Errorf("BACKUP_SIGNING_KEY must be set to at least %d random characters", backupSigningKeyMinLength)
+
+// CheckBackupSigningKey reports whether BACKUP_SIGNING_KEY can sign backup
+// manifests. The server refuses to start without one.
+func CheckBackupSigningKey() error {
+	return checkBackupSigningKey([]byte(os.Getenv("BACKUP_SIGNING_KEY")))
+}
+
+func checkBackupSigningKey(key []byte) error {
+	if len(key) < backupSigningKeyMinLength || strings.HasPrefix(string(key), "change-this") {
+		return ErrBackupSigningKey
+	}
+	return nil
+}
+
+// BackupManifest is written as the last member of every backup archive and
+// lists each packed file with its size and SHA-256 digest.
+type BackupManifest struct {
+	SchemaVersion int                      `json:"schema_version"`
+	BackupID      uint                     `json:"backup_id"`
+	UserID        uint                     `json:"user_id"`
+	Type          string                   `json:"type"`
+	CreatedAt     time.Time                `json:"created_at"`
+	Files         []BackupManifestFile     `json:"files"`
+	Databases     []BackupManifestDatabase `json:"databases"`
+	Signature     string                   `json:"signature,omitempty"`
+}
+
+type BackupManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type BackupManifestDatabase struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveSource maps a directory on disk onto a top-level prefix in the archive.
+type archiveSource struct {
+	prefix string
+	dir    string
+}
+
+func (s *BackupService) newManifest(backup *models.Backup) *BackupManifest {
+	return &BackupManifest{
+		SchemaVersion: backupManifestVersion,
+		BackupID:      backup.ID,
+		UserID:        backup.UserID,
+		Type:          backup.Type,
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+// writeArchive packs the sources into a gzipped tar, hashing every regular file
+// as it is written, and appends the signed manifest.
+func (s *BackupService) writeArchive(job *backupJob, archivePath string, sources []archiveSource, manifest *BackupManifest) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %v", err)
+	}
+	defer file.Close()
+
+	gzWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	job.setPhase(BackupPhaseArchiving)
+	for _, source := range sources {
+		if err := s.addSourceToArchive(job, tarWriter, source, manifest); err != nil {
+			return err
+		}
+		s.persistProgress(job)
+	}
+
+	if err := s.attachDatabaseChecksums(sources, manifest); err != nil {
+		return err
+	}
+
+	if err := s.signManifest(manifest); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    backupManifestFile,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(data); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (s *BackupService) addSourceToArchive(job *backupJob, tarWriter *tar.Writer, source archiveSource, manifest *BackupManifest) error {
+	return filepath.Walk(source.dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := job.ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source.dir, file)
+		if err != nil {
+			return err
+		}
+		name := path.Join(source.prefix, filepath.ToSlash(rel))
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		} else if !fi.Mode().IsRegular() && !fi.IsDir() {
+			// Sockets, pipes and devices cannot be restored meaningfully
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		hash := sha256.New()
+		written, err := io.Copy(io.MultiWriter(tarWriter, hash, &progressWriter{job: job}), data)
+		if err != nil {
+			return err
+		}
+		job.update(false, func(state *BackupProgressEvent) {
+			state.FilesWritten++
+		})
+
+		manifest.Files = append(manifest.Files, BackupManifestFile{
+			Path:   name,
+			Size:   written,
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	})
+}
+
+// attachDatabaseChecksums copies the digests of the database dumps into the
+// manifest so they can be checked without walking the file list.
+func (s *BackupService) attachDatabaseChecksums(sources []archiveSource, manifest *BackupManifest) error {
+	for _, source := range sources {
+		if source.prefix != backupDatabasesDir {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(source.dir, backupDBIndexFile))
+		if err != nil {
+			return fmt.Errorf("failed to read database index: %v", err)
+		}
+
+		var entries []BackupDatabaseEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("invalid database index: %v", err)
+		}
+
+		checksums := make(map[string]string, len(manifest.Files))
+		for _, f := range manifest.Files {
+			checksums[f.Path] = f.SHA256
+		}
+
+		for _, entry := range entries {
+			archived := path.Join(backupDatabasesDir, entry.File)
+			manifest.Databases = append(manifest.Databases, BackupManifestDatabase{
+				Name:   entry.Name,
+				Type:   entry.Type,
+				File:   archived,
+				SHA256: checksums[archived],
+			})
+		}
+	}
+
+	return nil
+}
+
+func (s *BackupService) manifestSignature(manifest *BackupManifest) (string, error) {
+	if err := checkBackupSigningKey(s.signingKey); err != nil {
+		return "", err
+	}
+
+	unsigned := *manifest
+	unsigned.Signature = ""
+
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (s *BackupService) signManifest(manifest *BackupManifest) error {
+	signature, err := s.manifestSignature(manifest)
+	if err != nil {
+		return err
+	}
+	manifest.Signature = signature
+	return nil
+}
+
+// ValidateBackup re-reads the whole archive and checks every member against
+// the signed manifest.
+func (s *BackupService) ValidateBackup(backup *models.Backup) error {
+	manifest, err := s.verifyArchive(backup.Path, true)
+	if err != nil {
+		return err
+	}
+
+	if manifest.BackupID != backup.ID || manifest.UserID != backup.UserID {
+		return errors.New("manifest does not belong to this backup")
+	}
+
+	return nil
+}
+
+// verifyArchive checks every member of an archive against its manifest. The
+// signature is only meaningful on the server that wrote the archive, so
+// portable archives are checked with requireSignature set to false.
+func (s *BackupService) verifyArchive(archivePath string, requireSignature bool) (*BackupManifest, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open backup file: %v", err)
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip format: %v", err)
+	}
+	defer gzReader.Close()
+
+	var manifest *BackupManifest
+	archived := make(map[string]BackupManifestFile)
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar format: %v", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if header.Name == backupManifestFile {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tarReader).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %v", err)
+			}
+			continue
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", header.Name, err)
+		}
+		archived[header.Name] = BackupManifestFile{
+			Path:   header.Name,
+			Size:   size,
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		}
+	}
+
+	if manifest == nil {
+		return nil, ErrBackupNoManifest
+	}
+
+	if manifest.SchemaVersion > backupManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest schema version %d", manifest.SchemaVersion)
+	}
+
+	if requireSignature {
+		signature, err := s.manifestSignature(manifest)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(signature), []byte(manifest.Signature)) {
+			return nil, errors.New("manifest signature mismatch")
+		}
+	}
+
+	for _, expected := range manifest.Files {
+		actual, ok := archived[expected.Path]
+		if !ok {
+			return nil, fmt.Errorf("missing file %s", expected.Path)
+		}
+		if actual.Size != expected.Size || actual.SHA256 != expected.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", expected.Path)
+		}
+		delete(archived, expected.Path)
+	}
+
+	for name := range archived {
+		return nil, fmt.Errorf("unexpected file %s", name)
+	}
+
+	return manifest, nil
+}
+
+// VerifyBackups checks every completed backup held by this node that has not
+// been verified within the given interval. Backups recorded before the node
+// was tracked are checked by whichever node has the archive on disk, and
+// archives without a manifest are left unverified rather than marked corrupt.
+func (s *BackupService) VerifyBackups(interval time.Duration) {
+	var backups []models.Backup
+	cutoff := time.Now().Add(-interval)
+	if err := s.db.Where("status = ? AND (verified_at IS NULL OR verified_at < ?)", "completed", cutoff).
+		Where("node = ? OR node = '' OR node IS NULL", cluster.NodeID()).
+		Find(&backups).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to load backups for verification: %v", err))
+		return
+	}
+
+	for i := range backups {
+		backup := &backups[i]
+		if backup.Node == "" {
+			if _, err := os.Stat(backup.Path); err != nil {
+				continue
+			}
+		}
+
+		if err := s.ValidateBackup(backup); err != nil {
+			if errors.Is(err, ErrBackupNoManifest) {
+				s.logger.Info(fmt.Sprintf("Backup %d predates manifests and is left unverified", backup.ID))
+				continue
+			}
+			s.markBackupCorrupt(backup, err)
+			continue
+		}
+
+		s.db.Model(backup).Update("verified_at", time.Now())
+	}
+}
+
+// StartVerification re-verifies backup archives at startup and then on a
+// fixed schedule.
+func (s *BackupService) StartVerification(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.VerifyBackups(interval)
+	for {
+		select {
+		case <-ticker.C:
+			s.VerifyBackups(interval)
+		}
+	}
+}
+
+func (s *BackupService) markBackupCorrupt(backup *models.Backup, cause error) {
+	s.db.Model(&models.Backup{}).Where("id = ?", backup.ID).Updates(map[string]interface{}{
+		"status":      "corrupt",
+		"error_log":   cause.Error(),
+		"verified_at": time.Now(),
+	})
+
+	userID := backup.UserID
+	alert := &models.Alert{
+		UserID:   &userID,
+		Type:     "backup_corrupt",
+		Severity: "critical",
+		Message:  fmt.Sprintf("Backup %d failed integrity verification: %v", backup.ID, cause),
+	}
+	if err := s.db.Create(alert).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to alert user %d about corrupt backup %d: %v", userID, backup.ID, err))
+	}
+
+	s.logger.Error(fmt.Sprintf("Backup %d is corrupt: %v", backup.ID, cause))
+}
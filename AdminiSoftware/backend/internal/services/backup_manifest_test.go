@@ -0,0 +1,66 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBackupSigningKey(t *testing.T) {
+	assert.ErrorIs(t, checkBackupSigningKey(nil), ErrBackupSigningKey)
+	assert.ErrorIs(t, checkBackupSigningKey([]byte("short")), ErrBackupSigningKey)
+	assert.ErrorIs(t, checkBackupSigningKey([]byte("change-this-backup-manifest-signing-key")), ErrBackupSigningKey)
+	assert.NoError(t, checkBackupSigningKey([]byte(strings.Repeat("k", backupSigningKeyMinLength))))
+}
+
+func TestManifestSignature(t *testing.T) {
+	manifest := &BackupManifest{SchemaVersion: backupManifestVersion, BackupID: 7, UserID: 3}
+
+	unkeyed := &BackupService{}
+	_, err := unkeyed.manifestSignature(manifest)
+	assert.ErrorIs(t, err, ErrBackupSigningKey, "an empty key must not sign")
+
+	service := &BackupService{signingKey: []byte(strings.Repeat("a", 32))}
+	require.NoError(t, service.signManifest(manifest))
+	signature := manifest.Signature
+
+	// The signature covers the manifest but not itself
+	again, err := service.manifestSignature(manifest)
+	require.NoError(t, err)
+	assert.Equal(t, signature, again)
+
+	other := &BackupService{signingKey: []byte(strings.Repeat("b", 32))}
+	forged, err := other.manifestSignature(manifest)
+	require.NoError(t, err)
+	assert.NotEqual(t, signature, forged)
+
+	manifest.UserID = 4
+	tampered, err := service.manifestSignature(manifest)
+	require.NoError(t, err)
+	assert.NotEqual(t, signature, tampered)
+}
+
+func TestVerifyArchiveWithoutManifest(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	gzWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzWriter)
+	content := []byte("<?php echo 'hi';")
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "public_html/index.php", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err = tarWriter.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzWriter.Close())
+	require.NoError(t, file.Close())
+
+	service := &BackupService{signingKey: []byte(strings.Repeat("a", 32))}
+	_, err = service.verifyArchive(archivePath, true)
+	assert.ErrorIs(t, err, ErrBackupNoManifest, "archives from before manifests are unverified, not corrupt")
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Backup and restore phases reported to progress subscribers.
+const (
+	BackupPhaseScanning   = "scanning"
+	BackupPhaseDatabases  = "databases"
+	BackupPhaseArchiving  = "archiving"
+	BackupPhaseVerifying  = "verifying"
+	BackupPhaseExtracting = "extracting"
+	BackupPhaseCompleted  = "completed"
+	BackupPhaseFailed     = "failed"
+	BackupPhaseCancelled  = "cancelled"
+)
+
+const backupProgressInterval = 500 * time.Millisecond
+
+// backupTicketTTL is how long a progress stream ticket can be redeemed.
+const backupTicketTTL = 30 * time.Second
+
+var (
+	ErrBackupJobNotFound = errors.New("no running job for this backup")
+	ErrBackupJobRunning  = errors.New("a job is already running for this backup")
+	ErrBackupTicket      = errors.New("invalid or expired progress ticket")
+)
+
+// BackupProgressEvent is a snapshot of a running backup or restore job.
+type BackupProgressEvent struct {
+	BackupID        uint      `json:"backup_id"`
+	Operation       string    `json:"operation"` // backup, restore
+	Phase           string    `json:"phase"`
+	FilesScanned    int64     `json:"files_scanned"`
+	FilesWritten    int64     `json:"files_written"`
+	BytesTotal      int64     `json:"bytes_total"`
+	BytesWritten    int64     `json:"bytes_written"`
+	CurrentDatabase string    `json:"current_database,omitempty"`
+	Progress        int       `json:"progress"`
+	ETASeconds      int64     `json:"eta_seconds"`
+	Error           string    `json:"error,omitempty"`
+	Done            bool      `json:"done"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+type backupJob struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	backupID    uint
+	userID      uint
+	operation   string
+	startedAt   time.Time
+	mutex       sync.Mutex
+	state       BackupProgressEvent
+	lastSent    time.Time
+	subscribers map[chan BackupProgressEvent]struct{}
+}
+
+type backupJobRegistry struct {
+	mutex sync.Mutex
+	jobs  map[uint]*backupJob
+}
+
+// backupJobs is shared by every BackupService so handlers can reach jobs
+// started from another request.
+var backupJobs = &backupJobRegistry{jobs: make(map[uint]*backupJob)}
+
+type backupTicket struct {
+	backupID  uint
+	userID    uint
+	expiresAt time.Time
+}
+
+// backupTickets holds the tickets that open progress streams. Like the jobs
+// they are kept in this process, which is the one streaming the progress.
+var backupTickets = struct {
+	mutex   sync.Mutex
+	tickets map[string]backupTicket
+}{tickets: make(map[string]backupTicket)}
+
+func (r *backupJobRegistry) start(backup *models.Backup, operation string) (*backupJob, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.jobs[backup.ID]; exists {
+		return nil, ErrBackupJobRunning
+	}
+
+	job := newBackupJob(context.Background(), backup.ID, backup.UserID, operation)
+	r.jobs[backup.ID] = job
+
+	return job, nil
+}
+
+// newBackupJob creates a job outside the registry, for work such as account
+// exports that has no Backup record.
+func newBackupJob(parent context.Context, backupID, userID uint, operation string) *backupJob {
+	ctx, cancel := context.WithCancel(parent)
+	return &backupJob{
+		ctx:         ctx,
+		cancel:      cancel,
+		backupID:    backupID,
+		userID:      userID,
+		operation:   operation,
+		startedAt:   time.Now(),
+		state:       BackupProgressEvent{BackupID: backupID, Operation: operation},
+		subscribers: make(map[chan BackupProgressEvent]struct{}),
+	}
+}
+
+func (r *backupJobRegistry) get(backupID, userID uint) (*backupJob, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	job, exists := r.jobs[backupID]
+	if !exists || job.userID != userID {
+		return nil, ErrBackupJobNotFound
+	}
+	return job, nil
+}
+
+func (r *backupJobRegistry) remove(job *backupJob) {
+	r.mutex.Lock()
+	delete(r.jobs, job.backupID)
+	r.mutex.Unlock()
+}
+
+// update applies fn to the job state and broadcasts the result. Byte-level
+// updates are throttled; phase changes are always sent.
+func (j *backupJob) update(force bool, fn func(state *BackupProgressEvent)) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	fn(&j.state)
+
+	if !force && time.Since(j.lastSent) < backupProgressInterval {
+		return
+	}
+
+	state := &j.state
+	if state.BytesTotal > 0 {
+		state.Progress = int(state.BytesWritten * 100 / state.BytesTotal)
+		if state.Progress > 100 {
+			state.Progress = 100
+		}
+	}
+	if state.BytesWritten > 0 && state.BytesTotal > state.BytesWritten {
+		elapsed := time.Since(j.startedAt)
+		remaining := time.Duration(float64(elapsed) * float64(state.BytesTotal-state.BytesWritten) / float64(state.BytesWritten))
+		state.ETASeconds = int64(remaining.Seconds())
+	} else {
+		state.ETASeconds = 0
+	}
+	state.Timestamp = time.Now()
+	j.lastSent = state.Timestamp
+
+	for ch := range j.subscribers {
+		select {
+		case ch <- *state:
+		default:
+			// Slow subscribers only miss intermediate snapshots
+		}
+	}
+}
+
+func (j *backupJob) setPhase(phase string) {
+	j.update(true, func(state *BackupProgressEvent) {
+		state.Phase = phase
+		state.CurrentDatabase = ""
+	})
+}
+
+func (j *backupJob) snapshot() BackupProgressEvent {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.state
+}
+
+func (j *backupJob) subscribe() (<-chan BackupProgressEvent, func()) {
+	ch := make(chan BackupProgressEvent, 16)
+
+	j.mutex.Lock()
+	j.subscribers[ch] = struct{}{}
+	ch <- j.state
+	j.mutex.Unlock()
+
+	return ch, func() {
+		j.mutex.Lock()
+		if _, ok := j.subscribers[ch]; ok {
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+		j.mutex.Unlock()
+	}
+}
+
+// finish sends the terminal event and disconnects every subscriber.
+func (j *backupJob) finish(phase string, err error) {
+	j.update(true, func(state *BackupProgressEvent) {
+		state.Phase = phase
+		state.Done = true
+		state.CurrentDatabase = ""
+		if phase == BackupPhaseCompleted {
+			state.BytesWritten = state.BytesTotal
+		}
+		if err != nil {
+			state.Error = err.Error()
+		}
+	})
+
+	j.mutex.Lock()
+	for ch := range j.subscribers {
+		delete(j.subscribers, ch)
+		close(ch)
+	}
+	j.mutex.Unlock()
+
+	j.cancel()
+	backupJobs.remove(j)
+}
+
+// progressReader counts the archive bytes a restore has read, so extracting
+// reports progress like archiving does.
+type progressReader struct {
+	job    *backupJob
+	reader io.Reader
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.job.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	r.job.update(false, func(state *BackupProgressEvent) {
+		state.BytesWritten += int64(n)
+	})
+	return n, err
+}
+
+// progressWriter counts archive bytes and aborts the copy once the job is cancelled.
+type progressWriter struct {
+	job *backupJob
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.job.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.job.update(false, func(state *BackupProgressEvent) {
+		state.BytesWritten += int64(len(p))
+	})
+	return len(p), nil
+}
+
+// scanSources counts the files and bytes that will be archived so progress and
+// ETA can be computed.
+func (s *BackupService) scanSources(job *backupJob, sources []archiveSource) error {
+	job.setPhase(BackupPhaseScanning)
+
+	for _, source := range sources {
+		err := filepath.Walk(source.dir, func(_ string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := job.ctx.Err(); err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() {
+				job.update(false, func(state *BackupProgressEvent) {
+					state.FilesScanned++
+					state.BytesTotal += fi.Size()
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SubscribeProgress streams events for a running job owned by userID. The
+// returned function must be called once the caller stops reading.
+func (s *BackupService) SubscribeProgress(backupID, userID uint) (<-chan BackupProgressEvent, func(), error) {
+	job, err := backupJobs.get(backupID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, unsubscribe := job.subscribe()
+	return ch, unsubscribe, nil
+}
+
+// ProgressTicket issues a single-use ticket that opens the progress stream
+// of a running job owned by userID. Browsers cannot send an Authorization
+// header when opening a WebSocket, so the stream is authorized by the ticket.
+func (s *BackupService) ProgressTicket(backupID, userID uint) (string, time.Time, error) {
+	if _, err := backupJobs.get(backupID, userID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate ticket: %v", err)
+	}
+	ticket := hex.EncodeToString(secret)
+	expiresAt := time.Now().Add(backupTicketTTL)
+
+	backupTickets.mutex.Lock()
+	defer backupTickets.mutex.Unlock()
+	for key, issued := range backupTickets.tickets {
+		if time.Now().After(issued.expiresAt) {
+			delete(backupTickets.tickets, key)
+		}
+	}
+	backupTickets.tickets[ticket] = backupTicket{backupID: backupID, userID: userID, expiresAt: expiresAt}
+
+	return ticket, expiresAt, nil
+}
+
+// RedeemProgressTicket uses up a ticket issued for backupID and returns the
+// user it was issued to.
+func (s *BackupService) RedeemProgressTicket(backupID uint, ticket string) (uint, error) {
+	backupTickets.mutex.Lock()
+	defer backupTickets.mutex.Unlock()
+
+	issued, ok := backupTickets.tickets[ticket]
+	if !ok {
+		return 0, ErrBackupTicket
+	}
+	delete(backupTickets.tickets, ticket)
+	if issued.backupID != backupID || time.Now().After(issued.expiresAt) {
+		return 0, ErrBackupTicket
+	}
+	return issued.userID, nil
+}
+
+// GetProgress returns the latest snapshot of a running job.
+func (s *BackupService) GetProgress(backupID, userID uint) (*BackupProgressEvent, error) {
+	job, err := backupJobs.get(backupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := job.snapshot()
+	return &state, nil
+}
+
+// CancelJob stops a running backup or restore job.
+func (s *BackupService) CancelJob(backupID, userID uint) error {
+	job, err := backupJobs.get(backupID, userID)
+	if err != nil {
+		return err
+	}
+
+	job.cancel()
+	s.logger.Info(fmt.Sprintf("Cancellation requested for %s job of backup %d", job.operation, backupID))
+	return nil
+}
+
+// persistProgress mirrors the job state into the Backup record.
+func (s *BackupService) persistProgress(job *backupJob) {
+	if job.backupID == 0 {
+		// Detached jobs such as account exports have no record to update
+		return
+	}
+
+	state := job.snapshot()
+	s.db.Model(&models.Backup{}).Where("id = ?", job.backupID).Update("progress", state.Progress)
+}
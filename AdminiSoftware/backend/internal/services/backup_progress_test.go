@@ -0,0 +1,62 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTicket(t *testing.T) {
+	service := &BackupService{}
+	job, err := backupJobs.start(&models.Backup{ID: 901, UserID: 12}, "restore")
+	require.NoError(t, err)
+	defer backupJobs.remove(job)
+
+	_, _, err = service.ProgressTicket(901, 13)
+	assert.ErrorIs(t, err, ErrBackupJobNotFound, "only the job's owner gets a ticket")
+
+	ticket, _, err := service.ProgressTicket(901, 12)
+	require.NoError(t, err)
+
+	_, err = service.RedeemProgressTicket(902, ticket)
+	assert.ErrorIs(t, err, ErrBackupTicket, "a ticket opens only its own backup")
+
+	ticket, _, err = service.ProgressTicket(901, 12)
+	require.NoError(t, err)
+	userID, err := service.RedeemProgressTicket(901, ticket)
+	require.NoError(t, err)
+	assert.Equal(t, uint(12), userID)
+
+	_, err = service.RedeemProgressTicket(901, ticket)
+	assert.ErrorIs(t, err, ErrBackupTicket, "a ticket is single use")
+
+	ticket, _, err = service.ProgressTicket(901, 12)
+	require.NoError(t, err)
+	backupTickets.mutex.Lock()
+	expired := backupTickets.tickets[ticket]
+	expired.expiresAt = time.Now().Add(-time.Second)
+	backupTickets.tickets[ticket] = expired
+	backupTickets.mutex.Unlock()
+	_, err = service.RedeemProgressTicket(901, ticket)
+	assert.ErrorIs(t, err, ErrBackupTicket)
+}
+
+func TestProgressReaderCountsBytes(t *testing.T) {
+	job := newBackupJob(context.Background(), 0, 1, "restore")
+	job.state.BytesTotal = 1000
+
+	read, err := io.Copy(io.Discard, &progressReader{job: job, reader: bytes.NewReader(make([]byte, 1000))})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), read)
+	assert.Equal(t, int64(1000), job.snapshot().BytesWritten)
+
+	job.cancel()
+	_, err = (&progressReader{job: job, reader: bytes.NewReader(make([]byte, 10))}).Read(make([]byte, 10))
+	assert.Error(t, err, "a cancelled restore stops reading")
+}
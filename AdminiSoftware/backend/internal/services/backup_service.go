@@ -167,11 +167,13 @@ func (s *BackupService) ValidateBackup(filePath string) error {
 package services
 
 import (
+	"AdminiSoftware/internal/cluster"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"time"
 
@@ -179,14 +181,16 @@ import (
 )
 
 type BackupService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db         *gorm.DB
+	logger     *utils.Logger
+	signingKey []byte
 }
 
 func NewBackupService(db *gorm.DB, logger *utils.Logger) *BackupService {
 	return &BackupService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		logger:     logger,
+		signingKey: []byte(os.Getenv("BACKUP_SIGNING_KEY")),
 	}
 }
 
@@ -197,54 +201,89 @@ func (s *BackupService) CreateBackup(userID uint, req *models.CreateBackupReques
 		Description: req.Description,
 		Type:        req.Type,
 		Status:      "creating",
-		Size:        0,
+		Node:        cluster.NodeID(),
 	}
 
 	if err := s.db.Create(backup).Error; err != nil {
 		return nil, fmt.Errorf("failed to create backup record: %v", err)
 	}
 
+	job, err := backupJobs.start(backup, "backup")
+	if err != nil {
+		return nil, err
+	}
+
 	// Create backup asynchronously
-	go s.performBackup(backup)
+	go s.performBackup(job, backup)
 
 	return backup, nil
 }
 
-func (s *BackupService) performBackup(backup *models.Backup) {
+func (s *BackupService) performBackup(job *backupJob, backup *models.Backup) {
 	backupDir := fmt.Sprintf("/var/backups/users/%d", backup.UserID)
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		s.updateBackupStatus(backup.ID, "failed", 0, err.Error())
+		s.failBackup(job, backup.ID, err)
 		return
 	}
 
 	filename := fmt.Sprintf("%s_%d_%s.tar.gz", backup.Name, backup.UserID, time.Now().Format("20060102_150405"))
 	backupPath := filepath.Join(backupDir, filename)
 
-	var cmd *exec.Cmd
+	// Database dumps are staged next to the archive and packed under databases/
+	stagingDir := filepath.Join(backupDir, fmt.Sprintf(".staging_%d", backup.ID))
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		s.failBackup(job, backup.ID, err)
+		return
+	}
+	defer os.RemoveAll(stagingDir)
+
+	userDir := fmt.Sprintf("/home/users/%d", backup.UserID)
+
+	var sources []archiveSource
 	switch backup.Type {
 	case "full":
-		userDir := fmt.Sprintf("/home/users/%d", backup.UserID)
-		cmd = exec.Command("tar", "-czf", backupPath, "-C", userDir, ".")
+		if err := s.dumpUserDatabases(job, backup.UserID, stagingDir); err != nil {
+			s.failBackup(job, backup.ID, err)
+			return
+		}
+		sources = []archiveSource{
+			{prefix: backupDatabasesDir, dir: filepath.Join(stagingDir, backupDatabasesDir)},
+			{prefix: backupHomeDir, dir: userDir},
+		}
 	case "database":
-		// Backup databases only
-		cmd = exec.Command("sh", "-c", fmt.Sprintf("mysqldump --all-databases > %s", backupPath))
+		// Only the databases owned by this account are dumped
+		if err := s.dumpUserDatabases(job, backup.UserID, stagingDir); err != nil {
+			s.failBackup(job, backup.ID, err)
+			return
+		}
+		sources = []archiveSource{
+			{prefix: backupDatabasesDir, dir: filepath.Join(stagingDir, backupDatabasesDir)},
+		}
 	case "files":
-		userDir := fmt.Sprintf("/home/users/%d/public_html", backup.UserID)
-		cmd = exec.Command("tar", "-czf", backupPath, "-C", userDir, ".")
+		sources = []archiveSource{
+			{prefix: backupPublicDir, dir: filepath.Join(userDir, "public_html")},
+		}
 	default:
-		s.updateBackupStatus(backup.ID, "failed", 0, "Invalid backup type")
+		s.failBackup(job, backup.ID, errors.New("Invalid backup type"))
+		return
+	}
+
+	if err := s.scanSources(job, sources); err != nil {
+		s.failBackup(job, backup.ID, err)
 		return
 	}
 
-	if err := cmd.Run(); err != nil {
-		s.updateBackupStatus(backup.ID, "failed", 0, err.Error())
+	manifest := s.newManifest(backup)
+	if err := s.writeArchive(job, backupPath, sources, manifest); err != nil {
+		os.Remove(backupPath)
+		s.failBackup(job, backup.ID, err)
 		return
 	}
 
 	// Get file size
 	fileInfo, err := os.Stat(backupPath)
 	if err != nil {
-		s.updateBackupStatus(backup.ID, "failed", 0, err.Error())
+		s.failBackup(job, backup.ID, err)
 		return
 	}
 
@@ -252,17 +291,34 @@ func (s *BackupService) performBackup(backup *models.Backup) {
 	s.updateBackupStatus(backup.ID, "completed", fileInfo.Size(), "")
 	
 	// Update path
-	s.db.Model(&models.Backup{}).Where("id = ?", backup.ID).Update("path", backupPath)
+	s.db.Model(&models.Backup{}).Where("id = ?", backup.ID).Updates(map[string]interface{}{
+		"path":     backupPath,
+		"progress": 100,
+	})
+
+	job.finish(BackupPhaseCompleted, nil)
+}
+
+// failBackup records why a backup stopped; cancelled jobs keep a distinct status.
+func (s *BackupService) failBackup(job *backupJob, backupID uint, err error) {
+	if errors.Is(job.ctx.Err(), context.Canceled) {
+		s.updateBackupStatus(backupID, "cancelled", 0, "cancelled by user")
+		job.finish(BackupPhaseCancelled, nil)
+		return
+	}
+
+	s.updateBackupStatus(backupID, "failed", 0, err.Error())
+	job.finish(BackupPhaseFailed, err)
 }
 
 func (s *BackupService) updateBackupStatus(backupID uint, status string, size int64, errorMsg string) {
 	updates := map[string]interface{}{
-		"status": status,
-		"size":   size,
+		"status":  status,
+		"size_mb": size / (1024 * 1024),
 	}
 	
 	if errorMsg != "" {
-		updates["error_message"] = errorMsg
+		updates["error_log"] = errorMsg
 	}
 
 	s.db.Model(&models.Backup{}).Where("id = ?", backupID).Updates(updates)
@@ -326,28 +382,74 @@ func (s *BackupService) RestoreBackup(id uint, userID uint) error {
 		return fmt.Errorf("backup is not completed")
 	}
 
+	job, err := backupJobs.start(&backup, "restore")
+	if err != nil {
+		return err
+	}
+
 	// Create restore process
-	go s.performRestore(&backup)
+	go s.performRestore(job, &backup)
 
 	return nil
 }
 
-func (s *BackupService) performRestore(backup *models.Backup) {
+func (s *BackupService) performRestore(job *backupJob, backup *models.Backup) {
+	job.setPhase(BackupPhaseVerifying)
+	if err := s.ValidateBackup(backup); err != nil {
+		if !errors.Is(err, ErrBackupNoManifest) {
+			s.markBackupCorrupt(backup, err)
+		}
+		s.failRestore(job, backup, fmt.Errorf("backup failed integrity check: %v", err))
+		return
+	}
+
+	// Progress counts the archive bytes read by each pass over the archive:
+	// one for the files, one for the database dumps
+	passes := int64(1)
+	if backup.Type == "full" {
+		passes = 2
+	}
+	if info, err := os.Stat(backup.Path); err == nil {
+		job.update(true, func(state *BackupProgressEvent) {
+			state.BytesTotal = info.Size() * passes
+			state.BytesWritten = 0
+		})
+	}
+
 	userDir := fmt.Sprintf("/home/users/%d", backup.UserID)
-	
-	var cmd *exec.Cmd
+	var err error
 	switch backup.Type {
 	case "full":
-		cmd = exec.Command("tar", "-xzf", backup.Path, "-C", userDir)
+		job.setPhase(BackupPhaseExtracting)
+		err = extractArchive(job, backup.Path, userDir, "--strip-components=1", backupHomeDir)
 	case "files":
-		publicDir := filepath.Join(userDir, "public_html")
-		cmd = exec.Command("tar", "-xzf", backup.Path, "-C", publicDir)
+		job.setPhase(BackupPhaseExtracting)
+		err = extractArchive(job, backup.Path, filepath.Join(userDir, "public_html"), "--strip-components=1", backupPublicDir)
 	}
-
-	if err := cmd.Run(); err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to restore backup %d: %v", backup.ID, err))
+	if err != nil {
+		s.failRestore(job, backup, err)
 		return
 	}
 
+	if backup.Type == "full" || backup.Type == "database" {
+		if err := s.restoreUserDatabases(job, backup); err != nil {
+			s.failRestore(job, backup, fmt.Errorf("failed to restore databases: %v", err))
+			return
+		}
+	}
+
+	job.finish(BackupPhaseCompleted, nil)
 	s.logger.Info(fmt.Sprintf("Backup %d restored successfully for user %d", backup.ID, backup.UserID))
 }
+
+func (s *BackupService) failRestore(job *backupJob, backup *models.Backup, err error) {
+	if errors.Is(job.ctx.Err(), context.Canceled) {
+		job.finish(BackupPhaseCancelled, nil)
+		s.logger.Info(fmt.Sprintf("Restore of backup %d cancelled", backup.ID))
+		return
+	}
+
+	s.db.Model(&models.Backup{}).Where("id = ?", backup.ID).Update("error_log", err.Error())
+	job.finish(BackupPhaseFailed, err)
+	s.logger.Error(fmt.Sprintf("Failed to restore backup %d: %v", backup.ID, err))
+}
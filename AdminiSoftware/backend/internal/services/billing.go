@@ -0,0 +1,692 @@
+package services
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statement kinds.
+const (
+	StatementCustomer = "customer"
+	StatementReseller = "reseller"
+)
+
+// Statement line types.
+const (
+	LinePackage          = "package"
+	LineDiskOverage      = "disk_overage"
+	LineBandwidthOverage = "bandwidth_overage"
+)
+
+// MaxBillingExportRows bounds one page of the accounting export.
+const MaxBillingExportRows = 5000
+
+var (
+	ErrStatementNotFound = errors.New("statement not found")
+	ErrInvalidPeriod     = errors.New("period must be a month that has ended, as YYYY-MM")
+)
+
+// billableStatuses are the account states a day is charged for. Suspended
+// accounts keep their resources, so they are billed; terminated ones are
+// not.
+var billableStatuses = []string{AccountActive, AccountSuspended}
+
+// StatementScope limits statements to what a caller may see. Administrators
+// use the zero value.
+type StatementScope struct {
+	ResellerID *uint // statements issued by or to the reseller
+	CustomerID *uint // the customer's own statements
+}
+
+// BillingExportRow is one statement line as the accounting export feeds
+// it. Rows are ordered by LineID, which a consumer passes back as since to
+// get only what was added.
+type BillingExportRow struct {
+	LineID          uint      `json:"line_id"`
+	StatementNumber string    `json:"statement_number"`
+	StatementKind   string    `json:"statement_kind"`
+	OwnerID         uint      `json:"owner_id"`
+	IssuerID        uint      `json:"issuer_id"`
+	Period          string    `json:"period"`
+	Currency        string    `json:"currency"`
+	UserID          uint      `json:"user_id"`
+	Username        string    `json:"username"`
+	Type            string    `json:"type"`
+	Description     string    `json:"description"`
+	Quantity        float64   `json:"quantity"`
+	Unit            string    `json:"unit"`
+	UnitPrice       float64   `json:"unit_price"`
+	Amount          float64   `json:"amount"`
+	IssuedAt        time.Time `json:"issued_at"`
+}
+
+// BillingService meters billable usage and prices it into monthly
+// statements. Every account is read once a day: the package it is on, its
+// disk use and the day's bandwidth. A month's statements then charge each
+// package for the days the account held it, so package changes are
+// prorated by day, plus disk use over the package limit at its peak and
+// bandwidth over the limit prorated for the days metered, each priced
+// with the package's overage tiers. Customers are charged the package's
+// retail price and tiers; resellers are charged for their customers at the
+// wholesale price and tiers administrators set.
+type BillingService struct {
+	db     *gorm.DB
+	logger *utils.Logger
+}
+
+func NewBillingService(db *gorm.DB, logger *utils.Logger) *BillingService {
+	return &BillingService{db: db, logger: logger}
+}
+
+// Meter records the day's reading of every billable account. Metering a
+// day again updates its readings. A past day keeps the reseller, package
+// and status it was first read with, which are what it is billed for, and
+// only has its usage brought up to date.
+func (s *BillingService) Meter(day time.Time) (int, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	next := day.AddDate(0, 0, 1)
+
+	var users []models.User
+	if err := s.db.Where("role = ? AND status IN ?", "user", billableStatuses).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to load accounts: %v", err)
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	type figure struct {
+		UserID uint
+		Total  int64
+	}
+	var figures []figure
+	if err := s.db.Raw(`SELECT stats.user_id, stats.disk_usage_mb AS total FROM stats
+		WHERE stats.deleted_at IS NULL AND stats.date < ?
+		AND stats.date = (SELECT MAX(latest.date) FROM stats latest
+			WHERE latest.user_id = stats.user_id AND latest.deleted_at IS NULL AND latest.date < ?)`,
+		next, next).Scan(&figures).Error; err != nil {
+		return 0, fmt.Errorf("failed to read disk use: %v", err)
+	}
+	disk := make(map[uint]int64, len(figures))
+	for _, f := range figures {
+		disk[f.UserID] = f.Total
+	}
+
+	figures = nil
+	if err := s.db.Model(&models.Stats{}).
+		Select("user_id, COALESCE(SUM(bandwidth_mb), 0) AS total").
+		Where("date >= ? AND date < ?", day, next).
+		Group("user_id").Scan(&figures).Error; err != nil {
+		return 0, fmt.Errorf("failed to read bandwidth: %v", err)
+	}
+	bandwidth := make(map[uint]int64, len(figures))
+	for _, f := range figures {
+		bandwidth[f.UserID] = f.Total
+	}
+
+	readings := make([]models.MeterReading, 0, len(users))
+	for _, user := range users {
+		readings = append(readings, models.MeterReading{
+			UserID:      user.ID,
+			Date:        day,
+			ResellerID:  user.ResellerID,
+			PackageID:   user.PackageID,
+			Status:      user.Status,
+			DiskMB:      disk[user.ID],
+			BandwidthMB: bandwidth[user.ID],
+		})
+	}
+	columns := []string{"reseller_id", "package_id", "status", "disk_mb", "bandwidth_mb", "updated_at"}
+	now := time.Now().In(day.Location())
+	if day.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, day.Location())) {
+		columns = []string{"disk_mb", "bandwidth_mb", "updated_at"}
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).CreateInBatches(&readings, 500).Error; err != nil {
+		return 0, fmt.Errorf("failed to store meter readings: %v", err)
+	}
+	return len(readings), nil
+}
+
+// StartMetering meters on every tick, reading yesterday again so its
+// bandwidth is complete, and generates last month's statements from the
+// second of the month, once its last day has been read in full. Generate
+// only adds the statements missing, so each tick fills in any an earlier
+// one failed to store.
+func (s *BillingService) StartMetering(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !cluster.Leader(s.db, "billing-metering", 2*interval) {
+			continue
+		}
+		now := time.Now()
+		for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+			if _, err := s.Meter(day); err != nil {
+				s.logger.Error(fmt.Sprintf("Metering %s failed: %v", day.Format("2006-01-02"), err))
+			}
+		}
+
+		if now.Day() < 2 {
+			continue
+		}
+		period := now.AddDate(0, 0, -now.Day()).Format("2006-01")
+		if created, err := s.Generate(period); err != nil {
+			s.logger.Error(fmt.Sprintf("Generating statements for %s failed: %v", period, err))
+		} else if created > 0 {
+			s.logger.Info(fmt.Sprintf("Generated %d statements for %s", created, period))
+		}
+	}
+}
+
+// Generate prices a month's readings into statements for every customer
+// and reseller. Statements that already exist are left as issued, so it
+// can be run again to fill in any that are missing. A statement that
+// cannot be stored does not stop the others; the first error is returned
+// with the number created.
+func (s *BillingService) Generate(period string) (int, error) {
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return 0, err
+	}
+	days := end.AddDate(0, 0, -1).Day()
+
+	var readings []models.MeterReading
+	if err := s.db.Where("date >= ? AND date < ?", start, end).Order("user_id, date").Find(&readings).Error; err != nil {
+		return 0, fmt.Errorf("failed to load meter readings: %v", err)
+	}
+	if len(readings) == 0 {
+		return 0, nil
+	}
+
+	byUser := map[uint][]models.MeterReading{}
+	var userIDs []uint
+	packageIDs := map[uint]bool{}
+	for _, reading := range readings {
+		if _, ok := byUser[reading.UserID]; !ok {
+			userIDs = append(userIDs, reading.UserID)
+		}
+		byUser[reading.UserID] = append(byUser[reading.UserID], reading)
+		if reading.PackageID != nil {
+			packageIDs[*reading.PackageID] = true
+		}
+	}
+
+	packages, err := s.packages(packageIDs)
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	if err := s.db.Unscoped().Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to load accounts: %v", err)
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+
+	type statementKey struct {
+		kind     string
+		owner    uint
+		currency string
+	}
+	statements := map[statementKey]*models.Statement{}
+	var keys []statementKey
+	add := func(key statementKey, issuer uint, lines []models.StatementLine) {
+		statement, ok := statements[key]
+		if !ok {
+			kindCode := "C"
+			if key.kind == StatementReseller {
+				kindCode = "R"
+			}
+			statement = &models.Statement{
+				Number:      fmt.Sprintf("%s-%s%d-%s", strings.ReplaceAll(period, "-", ""), kindCode, key.owner, key.currency),
+				Kind:        key.kind,
+				OwnerID:     key.owner,
+				IssuerID:    issuer,
+				Period:      period,
+				Currency:    key.currency,
+				PeriodStart: start,
+				PeriodEnd:   end.AddDate(0, 0, -1),
+			}
+			statements[key] = statement
+			keys = append(keys, key)
+		}
+		statement.Lines = append(statement.Lines, lines...)
+	}
+
+	for _, userID := range userIDs {
+		userReadings := byUser[userID]
+		// The reseller is the one the account had at the end of the month
+		resellerID := userReadings[len(userReadings)-1].ResellerID
+		var issuer uint
+		if resellerID != nil {
+			issuer = *resellerID
+			for currency, lines := range accountLines(userID, usernames[userID], userReadings, packages, days, true) {
+				add(statementKey{StatementReseller, *resellerID, currency}, 0, lines)
+			}
+		}
+		for currency, lines := range accountLines(userID, usernames[userID], userReadings, packages, days, false) {
+			add(statementKey{StatementCustomer, userID, currency}, issuer, lines)
+		}
+	}
+
+	created := 0
+	var firstErr error
+	for _, key := range keys {
+		stored, err := s.store(statements[key])
+		if err != nil {
+			s.logger.Error(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if stored {
+			created++
+		}
+	}
+	return created, firstErr
+}
+
+// store creates a statement with its lines unless one of the same kind,
+// owner, period and currency exists. stored is false when it did.
+func (s *BillingService) store(statement *models.Statement) (stored bool, err error) {
+	for _, line := range statement.Lines {
+		statement.Total += line.Amount
+	}
+	statement.Total = roundCents(statement.Total)
+
+	lines := statement.Lines
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Lines").Create(statement)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		for i := range lines {
+			lines[i].StatementID = statement.ID
+		}
+		if len(lines) > 0 {
+			if err := tx.CreateInBatches(&lines, 500).Error; err != nil {
+				return err
+			}
+		}
+		stored = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to store statement %s: %v", statement.Number, err)
+	}
+	return stored, nil
+}
+
+// List returns statements the scope covers, newest first, optionally of one
+// period or kind.
+func (s *BillingService) List(scope StatementScope, period, kind string) ([]models.Statement, error) {
+	query := s.scoped(scope)
+	if period != "" {
+		query = query.Where("period = ?", period)
+	}
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var statements []models.Statement
+	if err := query.Order("period DESC, id").Limit(1000).Find(&statements).Error; err != nil {
+		return nil, fmt.Errorf("failed to load statements: %v", err)
+	}
+	return statements, nil
+}
+
+// Get returns a statement with its lines if the scope covers it.
+func (s *BillingService) Get(id uint, scope StatementScope) (*models.Statement, error) {
+	var statement models.Statement
+	if err := s.scoped(scope).Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&statement, id).Error; err != nil {
+		return nil, ErrStatementNotFound
+	}
+	return &statement, nil
+}
+
+// Readings returns an account's meter readings of a month.
+func (s *BillingService) Readings(userID uint, period string) ([]models.MeterReading, error) {
+	start, end, err := parseMonth(period)
+	if err != nil {
+		return nil, err
+	}
+	var readings []models.MeterReading
+	if err := s.db.Where("user_id = ? AND date >= ? AND date < ?", userID, start, end).
+		Order("date").Find(&readings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load meter readings: %v", err)
+	}
+	return readings, nil
+}
+
+// WriteCSV writes a statement's lines as CSV.
+func (s *BillingService) WriteCSV(statement *models.Statement, w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"statement", "period", "account", "type", "description", "quantity", "unit", "unit_price", "amount", "currency"})
+	for _, line := range statement.Lines {
+		out.Write([]string{
+			statement.Number, statement.Period, line.Username, line.Type, line.Description,
+			formatDecimal(line.Quantity), line.Unit, formatDecimal(line.UnitPrice), formatDecimal(line.Amount), statement.Currency,
+		})
+	}
+	out.Write([]string{statement.Number, statement.Period, "", "total", "", "", "", "", formatDecimal(statement.Total), statement.Currency})
+	out.Flush()
+	return out.Error()
+}
+
+// PDF renders a statement with the branding of whoever issued it.
+func (s *BillingService) PDF(statement *models.Statement) []byte {
+	var issuer *uint
+	if statement.IssuerID != 0 {
+		issuer = &statement.IssuerID
+	}
+	brand := resellerBranding(s.db, issuer)
+
+	var owner models.User
+	s.db.Unscoped().First(&owner, statement.OwnerID)
+	billedTo := owner.Username
+	if name := strings.TrimSpace(owner.FirstName + " " + owner.LastName); name != "" {
+		billedTo = name + " (" + owner.Username + ")"
+	}
+	return statementPDF(brand.CompanyName, billedTo, statement)
+}
+
+// Export returns statement lines added after the line since, for
+// accounting systems to poll.
+func (s *BillingService) Export(since uint, limit int) ([]BillingExportRow, error) {
+	if limit <= 0 || limit > MaxBillingExportRows {
+		limit = MaxBillingExportRows
+	}
+
+	var rows []BillingExportRow
+	if err := s.db.Table("statement_lines").
+		Select(`statement_lines.id AS line_id, statements.number AS statement_number, statements.kind AS statement_kind,
+			statements.owner_id, statements.issuer_id, statements.period, statements.currency,
+			statement_lines.user_id, statement_lines.username, statement_lines.type, statement_lines.description,
+			statement_lines.quantity, statement_lines.unit, statement_lines.unit_price, statement_lines.amount,
+			statements.created_at AS issued_at`).
+		Joins("JOIN statements ON statements.id = statement_lines.statement_id").
+		Where("statement_lines.id > ?", since).
+		Order("statement_lines.id").Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to export statement lines: %v", err)
+	}
+	return rows, nil
+}
+
+// WriteExportCSV writes export rows as CSV.
+func (s *BillingService) WriteExportCSV(rows []BillingExportRow, w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"line_id", "statement_number", "statement_kind", "owner_id", "issuer_id", "period", "currency",
+		"user_id", "username", "type", "description", "quantity", "unit", "unit_price", "amount", "issued_at",
+	})
+	for _, row := range rows {
+		out.Write([]string{
+			strconv.FormatUint(uint64(row.LineID), 10), row.StatementNumber, row.StatementKind,
+			strconv.FormatUint(uint64(row.OwnerID), 10), strconv.FormatUint(uint64(row.IssuerID), 10),
+			row.Period, row.Currency, strconv.FormatUint(uint64(row.UserID), 10), row.Username, row.Type,
+			row.Description, formatDecimal(row.Quantity), row.Unit, formatDecimal(row.UnitPrice),
+			formatDecimal(row.Amount), row.IssuedAt.Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func (s *BillingService) scoped(scope StatementScope) *gorm.DB {
+	query := s.db.Model(&models.Statement{})
+	switch {
+	case scope.CustomerID != nil:
+		query = query.Where("kind = ? AND owner_id = ?", StatementCustomer, *scope.CustomerID)
+	case scope.ResellerID != nil:
+		query = query.Where("(kind = ? AND owner_id = ?) OR issuer_id = ?", StatementReseller, *scope.ResellerID, *scope.ResellerID)
+	}
+	return query
+}
+
+func (s *BillingService) packages(ids map[uint]bool) (map[uint]*models.Package, error) {
+	packages := make(map[uint]*models.Package, len(ids))
+	if len(ids) == 0 {
+		return packages, nil
+	}
+	list := make([]uint, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+
+	var loaded []models.Package
+	if err := s.db.Unscoped().Preload("OverageTiers").Where("id IN ?", list).Find(&loaded).Error; err != nil {
+		return nil, fmt.Errorf("failed to load packages: %v", err)
+	}
+	for i := range loaded {
+		packages[loaded[i].ID] = &loaded[i]
+	}
+	return packages, nil
+}
+
+// accountLines prices an account's readings of a month with days in it,
+// grouped by currency, at retail for the customer or at wholesale for its
+// reseller.
+func accountLines(userID uint, username string, readings []models.MeterReading, packages map[uint]*models.Package, days int, wholesale bool) map[string][]models.StatementLine {
+	lines := map[string][]models.StatementLine{}
+	line := func(pkg *models.Package, l models.StatementLine) {
+		l.UserID = userID
+		l.Username = username
+		l.PackageID = &pkg.ID
+		currency := pkg.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+		lines[currency] = append(lines[currency], l)
+	}
+	packageOf := func(reading models.MeterReading) *models.Package {
+		if reading.PackageID == nil {
+			return nil
+		}
+		return packages[*reading.PackageID]
+	}
+
+	// Each package for the days it was held, in the order it was first held
+	var order []*models.Package
+	held := map[uint]int{}
+	for _, reading := range readings {
+		if pkg := packageOf(reading); pkg != nil {
+			if held[pkg.ID] == 0 {
+				order = append(order, pkg)
+			}
+			held[pkg.ID]++
+		}
+	}
+	for _, pkg := range order {
+		monthly := monthlyPrice(pkg, wholesale)
+		if monthly == 0 {
+			continue
+		}
+		n := held[pkg.ID]
+		line(pkg, models.StatementLine{
+			Type:        LinePackage,
+			Description: fmt.Sprintf("%s, %d of %d days", pkg.Name, n, days),
+			Quantity:    float64(n),
+			Unit:        "days",
+			UnitPrice:   roundTo(monthly/float64(days), 4),
+			Amount:      roundCents(monthly * float64(n) / float64(days)),
+		})
+	}
+
+	// Disk over the limit at its peak, priced by the package held that day
+	var peakOver int64
+	var peakPackage *models.Package
+	for _, reading := range readings {
+		pkg := packageOf(reading)
+		if pkg == nil || pkg.DiskQuotaMB == 0 {
+			continue
+		}
+		if over := reading.DiskMB - int64(pkg.DiskQuotaMB); over > peakOver {
+			peakOver, peakPackage = over, pkg
+		}
+	}
+	if peakPackage != nil {
+		gb := float64(peakOver) / 1024
+		if amount, rate := tieredPrice(overageTiers(peakPackage, wholesale), "disk", gb); amount > 0 {
+			line(peakPackage, models.StatementLine{
+				Type:        LineDiskOverage,
+				Description: fmt.Sprintf("Disk over the %s limit at its peak", peakPackage.Name),
+				Quantity:    roundCents(gb),
+				Unit:        "GB",
+				UnitPrice:   roundTo(rate, 4),
+				Amount:      amount,
+			})
+		}
+	}
+
+	// Bandwidth over the limits of the days metered; any day on an
+	// unlimited package leaves the month unlimited
+	var used int64
+	var allowance float64
+	var lastPackage *models.Package
+	unlimited := false
+	for _, reading := range readings {
+		used += reading.BandwidthMB
+		pkg := packageOf(reading)
+		if pkg == nil || pkg.BandwidthMB == 0 {
+			unlimited = true
+			continue
+		}
+		allowance += float64(pkg.BandwidthMB) / float64(days)
+		lastPackage = pkg
+	}
+	if !unlimited && lastPackage != nil && float64(used) > allowance {
+		gb := (float64(used) - allowance) / 1024
+		if amount, rate := tieredPrice(overageTiers(lastPackage, wholesale), "bandwidth", gb); amount > 0 {
+			line(lastPackage, models.StatementLine{
+				Type:        LineBandwidthOverage,
+				Description: fmt.Sprintf("Bandwidth over the %s limit", lastPackage.Name),
+				Quantity:    roundCents(gb),
+				Unit:        "GB",
+				UnitPrice:   roundTo(rate, 4),
+				Amount:      amount,
+			})
+		}
+	}
+	return lines
+}
+
+// monthlyPrice is what a package costs for a month of its billing cycle,
+// at retail or at wholesale.
+func monthlyPrice(pkg *models.Package, wholesale bool) float64 {
+	price := pkg.Price
+	if wholesale {
+		price = pkg.WholesalePrice
+	}
+	switch pkg.BillingCycle {
+	case "quarterly":
+		return price / 3
+	case "yearly":
+		return price / 12
+	}
+	return price
+}
+
+// overageTiers returns the package's retail or wholesale tiers.
+func overageTiers(pkg *models.Package, wholesale bool) []models.OverageTier {
+	var tiers []models.OverageTier
+	for _, tier := range pkg.OverageTiers {
+		if tier.Wholesale == wholesale {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
+// tieredPrice prices an overage with the resource's tiers and returns the
+// amount with the average price per GB.
+func tieredPrice(tiers []models.OverageTier, resource string, gb float64) (float64, float64) {
+	var applicable []models.OverageTier
+	for _, tier := range tiers {
+		if tier.Resource == resource {
+			applicable = append(applicable, tier)
+		}
+	}
+	sort.Slice(applicable, func(i, j int) bool {
+		a, b := applicable[i].UpToGB, applicable[j].UpToGB
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+
+	var amount, lower float64
+	remaining := gb
+	for _, tier := range applicable {
+		span := remaining
+		if tier.UpToGB > 0 {
+			span = math.Min(remaining, tier.UpToGB-lower)
+			lower = tier.UpToGB
+		}
+		if span <= 0 {
+			continue
+		}
+		amount += span * tier.PricePerGB
+		remaining -= span
+		if remaining <= 0 {
+			break
+		}
+	}
+	if gb <= 0 {
+		return 0, 0
+	}
+	return roundCents(amount), amount / gb
+}
+
+// parsePeriod parses a month that has ended and returns its first day and
+// the first day of the next.
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	start, end, err := parseMonth(period)
+	if err != nil {
+		return start, end, err
+	}
+	if end.After(time.Now()) {
+		return start, end, ErrInvalidPeriod
+	}
+	return start, end, nil
+}
+
+func parseMonth(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidPeriod
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+func roundCents(amount float64) float64 {
+	return roundTo(amount, 2)
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+func formatDecimal(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountLinesWholesale(t *testing.T) {
+	pkg := &models.Package{
+		ID:             1,
+		Name:           "Basic",
+		Price:          30,
+		WholesalePrice: 15,
+		DiskQuotaMB:    1024,
+		OverageTiers: []models.OverageTier{
+			{Resource: "disk", PricePerGB: 1},
+			{Resource: "disk", PricePerGB: 0.5, Wholesale: true},
+		},
+	}
+	packages := map[uint]*models.Package{pkg.ID: pkg}
+
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	var readings []models.MeterReading
+	for day := 0; day < 30; day++ {
+		readings = append(readings, models.MeterReading{UserID: 5, Date: start.AddDate(0, 0, day), PackageID: &pkg.ID, DiskMB: 3072})
+	}
+
+	amounts := func(wholesale bool) map[string]float64 {
+		lines := accountLines(5, "jane", readings, packages, 30, wholesale)
+		require.Len(t, lines, 1)
+		result := map[string]float64{}
+		for _, line := range lines["USD"] {
+			result[line.Type] = line.Amount
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]float64{LinePackage: 30, LineDiskOverage: 2}, amounts(false))
+	assert.Equal(t, map[string]float64{LinePackage: 15, LineDiskOverage: 1}, amounts(true), "resellers pay the wholesale price and tiers")
+}
+
+func TestMonthlyPrice(t *testing.T) {
+	pkg := &models.Package{Price: 120, WholesalePrice: 60, BillingCycle: "yearly"}
+	assert.Equal(t, 10.0, monthlyPrice(pkg, false))
+	assert.Equal(t, 5.0, monthlyPrice(pkg, true))
+
+	pkg.BillingCycle = "quarterly"
+	assert.Equal(t, 40.0, monthlyPrice(pkg, false))
+}
+
+func TestMeterKeepsPastDayTerms(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.Stats{}, &models.MeterReading{})
+
+	name := testutil.UniqueName("meter")
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: AccountActive}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.MeterReading{})
+		db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Stats{})
+		db.Unscoped().Delete(user)
+	}()
+
+	s := NewBillingService(db, utils.NewLogger())
+	yesterday := time.Now().AddDate(0, 0, -1)
+	_, err := s.Meter(yesterday)
+	require.NoError(t, err)
+
+	// The account is suspended today and its late bandwidth comes in
+	require.NoError(t, db.Model(user).Update("status", AccountSuspended).Error)
+	require.NoError(t, db.Create(&models.Stats{UserID: user.ID, Date: yesterday, BandwidthMB: 300}).Error)
+	_, err = s.Meter(yesterday)
+	require.NoError(t, err)
+	_, err = s.Meter(time.Now())
+	require.NoError(t, err)
+
+	var readings []models.MeterReading
+	require.NoError(t, db.Where("user_id = ?", user.ID).Order("date").Find(&readings).Error)
+	require.Len(t, readings, 2)
+	assert.Equal(t, AccountActive, readings[0].Status, "yesterday is billed as it was read")
+	assert.Equal(t, int64(300), readings[0].BandwidthMB)
+	assert.Equal(t, AccountSuspended, readings[1].Status)
+}
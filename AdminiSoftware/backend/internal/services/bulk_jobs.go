@@ -0,0 +1,706 @@
+package services
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Bulk operations.
+const (
+	BulkCreate        = "create"
+	BulkSuspend       = "suspend"
+	BulkUnsuspend     = "unsuspend"
+	BulkChangePackage = "change_package"
+	BulkResetPassword = "reset_password"
+	BulkDelete        = "delete"
+)
+
+// Bulk job and item states.
+const (
+	BulkJobQueued    = "queued"
+	BulkJobRunning   = "running"
+	BulkJobCompleted = "completed"
+	BulkJobCancelled = "cancelled"
+	BulkJobFailed    = "failed"
+
+	BulkItemPending   = "pending"
+	BulkItemSucceeded = "succeeded"
+	BulkItemFailed    = "failed"
+	BulkItemSkipped   = "skipped"
+)
+
+const (
+	defaultBulkConcurrency = 4
+	MaxBulkConcurrency     = 16
+	MaxBulkItems           = 5000
+
+	// A running job's node touches its heartbeat and looks for a
+	// cancellation this often; a job whose heartbeat is older than
+	// bulkJobStale lost its node
+	bulkJobHeartbeat = 15 * time.Second
+	bulkJobStale     = 2 * time.Minute
+)
+
+var (
+	ErrBulkJobNotFound      = errors.New("bulk job not found")
+	ErrBulkJobFinished      = errors.New("bulk job has already finished")
+	ErrBulkUnknownOperation = errors.New("unknown bulk operation")
+	ErrBulkNoItems          = errors.New("bulk job has no accounts to work on")
+	ErrBulkTooManyItems     = fmt.Errorf("bulk jobs are limited to %d accounts", MaxBulkItems)
+	ErrBulkPackageRequired  = errors.New("package_id is required to change packages")
+	ErrBulkInvalidCSV       = errors.New("invalid CSV")
+)
+
+// BulkJobRequest describes a bulk job to start.
+type BulkJobRequest struct {
+	Operation   string
+	ResellerID  *uint  // limits the job to the reseller's accounts
+	ActorID     uint   // who started the job
+	AccountIDs  []uint // accounts to work on, for every operation but create
+	CSV         string // for create: username,email,password,domain,package_id
+	PackageID   uint   // for change_package
+	Force       bool   // for change_package: apply although usage exceeds the new limits
+	Reason      string // recorded with suspensions, deletions and package changes
+	DryRun      bool   // check every item without changing anything
+	Concurrency int    // items worked on at once
+	ClientIP    string // recorded with password resets
+}
+
+// bulkAccountRow is one row of an account import. It is only kept in
+// memory, as it holds the password.
+type bulkAccountRow struct {
+	Username  string
+	Email     string
+	Password  string
+	Domain    string
+	PackageID *uint
+}
+
+type bulkJobRegistry struct {
+	mutex   sync.Mutex
+	cancels map[uint]context.CancelFunc
+}
+
+// bulkJobs holds the running jobs of this process, so that a cancellation
+// takes effect at once when it reaches the node running the job.
+var bulkJobs = &bulkJobRegistry{cancels: make(map[uint]context.CancelFunc)}
+
+func (r *bulkJobRegistry) add(jobID uint, cancel context.CancelFunc) {
+	r.mutex.Lock()
+	r.cancels[jobID] = cancel
+	r.mutex.Unlock()
+}
+
+func (r *bulkJobRegistry) remove(jobID uint) {
+	r.mutex.Lock()
+	delete(r.cancels, jobID)
+	r.mutex.Unlock()
+}
+
+func (r *bulkJobRegistry) cancel(jobID uint) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cancel, ok := r.cancels[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// BulkJobService runs operations on many accounts as background jobs that
+// record a result per account. Each item goes through the same service as
+// a single change would, so quotas, reseller pools, the password policy and
+// the account lifecycle all apply.
+type BulkJobService struct {
+	db        *gorm.DB
+	accounts  *AccountService
+	lifecycle *AccountLifecycle
+	packages  *PackageChangeService
+	pools     *ResellerPoolService
+	passwords *auth.PasswordPolicy
+	resets    *auth.PasswordResetManager
+	mail      *MailQueue
+	logger    *utils.Logger
+}
+
+func NewBulkJobService(db *gorm.DB, logger *utils.Logger) *BulkJobService {
+	return &BulkJobService{
+		db:        db,
+		accounts:  NewAccountService(db, logger),
+		lifecycle: NewAccountLifecycle(db, logger),
+		packages:  NewPackageChangeService(db, logger),
+		pools:     NewResellerPoolService(db),
+		passwords: auth.NewPasswordPolicy(db),
+		resets:    auth.NewPasswordResetManager(db),
+		mail:      NewMailQueue(db, logger),
+		logger:    logger,
+	}
+}
+
+// Start records a bulk job and its items and runs it in the background.
+// Accounts outside the reseller scope and import rows that cannot be parsed
+// are recorded as failed items rather than failing the job.
+func (s *BulkJobService) Start(req BulkJobRequest) (*models.BulkJob, error) {
+	switch req.Operation {
+	case BulkCreate, BulkSuspend, BulkUnsuspend, BulkChangePackage, BulkResetPassword, BulkDelete:
+	default:
+		return nil, ErrBulkUnknownOperation
+	}
+	if req.Operation == BulkChangePackage && req.PackageID == 0 {
+		return nil, ErrBulkPackageRequired
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = defaultBulkConcurrency
+	}
+	if req.Concurrency > MaxBulkConcurrency {
+		req.Concurrency = MaxBulkConcurrency
+	}
+
+	var items []models.BulkJobItem
+	var rows []bulkAccountRow
+	var err error
+	if req.Operation == BulkCreate {
+		items, rows, err = parseBulkAccounts(req.CSV)
+	} else {
+		items, err = s.accountItems(req.AccountIDs, req.ResellerID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrBulkNoItems
+	}
+	if len(items) > MaxBulkItems {
+		return nil, ErrBulkTooManyItems
+	}
+
+	now := time.Now()
+	job := &models.BulkJob{
+		Operation:   req.Operation,
+		Status:      BulkJobQueued,
+		DryRun:      req.DryRun,
+		Concurrency: req.Concurrency,
+		ResellerID:  req.ResellerID,
+		CreatedBy:   req.ActorID,
+		Node:        cluster.NodeID(),
+		HeartbeatAt: &now,
+		Force:       req.Force,
+		Reason:      req.Reason,
+		Total:       len(items),
+	}
+	if req.PackageID != 0 {
+		job.PackageID = &req.PackageID
+	}
+	for _, item := range items {
+		if item.Status == BulkItemFailed {
+			job.Failed++
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].JobID = job.ID
+		}
+		return tx.CreateInBatches(items, 500).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulk job: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bulkJobs.add(job.ID, cancel)
+	go s.run(ctx, *job, items, rows, req.ClientIP)
+
+	s.logger.Info(fmt.Sprintf("Bulk %s job %d over %d accounts started by user %d (dry run: %t)",
+		job.Operation, job.ID, job.Total, req.ActorID, job.DryRun))
+	return job, nil
+}
+
+// Get returns a job with its items. A reseller scope hides other resellers'
+// jobs and the administrators'.
+func (s *BulkJobService) Get(jobID uint, resellerID *uint) (*models.BulkJob, error) {
+	var job models.BulkJob
+	query := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position") })
+	if resellerID != nil {
+		query = query.Where("reseller_id = ?", *resellerID)
+	}
+	if err := query.First(&job, jobID).Error; err != nil {
+		return nil, ErrBulkJobNotFound
+	}
+	return &job, nil
+}
+
+// List returns the most recent jobs, without their items.
+func (s *BulkJobService) List(resellerID *uint, limit int) ([]models.BulkJob, error) {
+	var jobs []models.BulkJob
+	query := s.db.Order("created_at DESC").Limit(limit)
+	if resellerID != nil {
+		query = query.Where("reseller_id = ?", *resellerID)
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bulk jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// Cancel stops a job. The request is recorded on the job, which the node
+// running it picks up with its next heartbeat, or at once when that is this
+// node. Items already being worked on finish; the rest are skipped.
+func (s *BulkJobService) Cancel(jobID uint, resellerID *uint) error {
+	var job models.BulkJob
+	query := s.db
+	if resellerID != nil {
+		query = query.Where("reseller_id = ?", *resellerID)
+	}
+	if err := query.First(&job, jobID).Error; err != nil {
+		return ErrBulkJobNotFound
+	}
+
+	result := s.db.Model(&models.BulkJob{}).
+		Where("id = ? AND status IN ?", job.ID, []string{BulkJobQueued, BulkJobRunning}).
+		Update("cancel_requested", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel bulk job: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrBulkJobFinished
+	}
+	bulkJobs.cancel(job.ID)
+	return nil
+}
+
+// FailInterrupted fails the jobs this node was running before it restarted,
+// and those of any node that stopped sending heartbeats. Their remaining
+// items cannot be resumed as imports keep passwords in memory only.
+func (s *BulkJobService) FailInterrupted() {
+	s.failInterrupted(true)
+}
+
+// StartRecovery fails the jobs of nodes that stopped sending heartbeats
+// every interval until the process exits.
+func (s *BulkJobService) StartRecovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.failInterrupted(false)
+	}
+}
+
+func (s *BulkJobService) failInterrupted(restarted bool) {
+	query := s.db.Where("status IN ?", []string{BulkJobQueued, BulkJobRunning})
+	stale := s.db.Where("heartbeat_at IS NULL OR heartbeat_at < ?", time.Now().Add(-bulkJobStale))
+	if restarted {
+		query = query.Where(stale.Or("node = ?", cluster.NodeID()))
+	} else {
+		query = query.Where(stale)
+	}
+
+	var jobs []models.BulkJob
+	if err := query.Find(&jobs).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to load interrupted bulk jobs: %v", err))
+		return
+	}
+	for _, job := range jobs {
+		// Another node may be failing the same job
+		claimed := s.db.Model(&models.BulkJob{}).
+			Where("id = ? AND status IN ?", job.ID, []string{BulkJobQueued, BulkJobRunning}).
+			Updates(map[string]interface{}{
+				"status":      BulkJobFailed,
+				"error":       "interrupted: node " + job.Node + " stopped running it",
+				"finished_at": time.Now(),
+			})
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+		skipped := s.db.Model(&models.BulkJobItem{}).Where("job_id = ? AND status = ?", job.ID, BulkItemPending).
+			Updates(map[string]interface{}{"status": BulkItemSkipped, "message": "interrupted"})
+		s.db.Model(&models.BulkJob{}).Where("id = ?", job.ID).
+			Update("skipped", gorm.Expr("skipped + ?", skipped.RowsAffected))
+		s.logger.Error(fmt.Sprintf("Bulk %s job %d on node %s was interrupted", job.Operation, job.ID, job.Node))
+	}
+}
+
+// heartbeat shows the job is alive and cancels it when a cancellation was
+// recorded, until done is closed.
+func (s *BulkJobService) heartbeat(jobID uint, done <-chan struct{}) {
+	ticker := time.NewTicker(bulkJobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.db.Model(&models.BulkJob{}).Where("id = ?", jobID).Update("heartbeat_at", time.Now())
+			var job models.BulkJob
+			if err := s.db.Select("id", "cancel_requested").First(&job, jobID).Error; err == nil && job.CancelRequested {
+				bulkJobs.cancel(jobID)
+			}
+		}
+	}
+}
+
+// BulkJobErrorStatus returns the status a handler answers a bulk job error
+// with.
+func BulkJobErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, ErrBulkJobNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, ErrBulkJobFinished):
+		return http.StatusConflict, true
+	case errors.Is(err, ErrBulkUnknownOperation), errors.Is(err, ErrBulkNoItems), errors.Is(err, ErrBulkTooManyItems),
+		errors.Is(err, ErrBulkPackageRequired), errors.Is(err, ErrBulkInvalidCSV):
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
+
+func (s *BulkJobService) accountItems(ids []uint, resellerID *uint) ([]models.BulkJobItem, error) {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > MaxBulkItems {
+		return nil, ErrBulkTooManyItems
+	}
+
+	var accounts []models.User
+	query := s.db.Where("id IN ? AND role = ?", unique, "user")
+	if resellerID != nil {
+		query = query.Where("reseller_id = ?", *resellerID)
+	}
+	if len(unique) > 0 {
+		if err := query.Find(&accounts).Error; err != nil {
+			return nil, fmt.Errorf("failed to load accounts: %v", err)
+		}
+	}
+	found := make(map[uint]models.User, len(accounts))
+	for _, account := range accounts {
+		found[account.ID] = account
+	}
+
+	items := make([]models.BulkJobItem, 0, len(unique))
+	for i, id := range unique {
+		userID := id
+		item := models.BulkJobItem{Position: i + 1, UserID: &userID, Status: BulkItemPending}
+		if account, ok := found[id]; ok {
+			item.Target = account.Username
+		} else {
+			item.Status = BulkItemFailed
+			item.Message = ErrAccountNotFound.Error()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseBulkAccounts reads an account import: username, email, password,
+// domain and optionally package_id per line, with an optional header line.
+func parseBulkAccounts(data string) ([]models.BulkJobItem, []bulkAccountRow, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var items []models.BulkJobItem
+	var rows []bulkAccountRow
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrBulkInvalidCSV, err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "username") {
+			continue
+		}
+		if len(items) >= MaxBulkItems {
+			return nil, nil, ErrBulkTooManyItems
+		}
+
+		item := models.BulkJobItem{Position: len(items) + 1, Status: BulkItemPending}
+		var row bulkAccountRow
+		if len(record) < 4 || len(record) > 5 {
+			item.Status = BulkItemFailed
+			item.Message = fmt.Sprintf("line %d: expected username, email, password, domain and optionally package_id", line)
+		} else {
+			row = bulkAccountRow{
+				Username: strings.TrimSpace(record[0]),
+				Email:    strings.TrimSpace(record[1]),
+				Password: record[2],
+				Domain:   strings.ToLower(strings.TrimSpace(record[3])),
+			}
+			item.Target = row.Username
+			if len(record) == 5 && strings.TrimSpace(record[4]) != "" {
+				id, err := strconv.ParseUint(strings.TrimSpace(record[4]), 10, 32)
+				if err != nil {
+					item.Status = BulkItemFailed
+					item.Message = fmt.Sprintf("line %d: invalid package_id", line)
+				} else {
+					packageID := uint(id)
+					row.PackageID = &packageID
+				}
+			}
+			if item.Status == BulkItemPending && (row.Username == "" || row.Email == "" || row.Password == "") {
+				item.Status = BulkItemFailed
+				item.Message = fmt.Sprintf("line %d: username, email and password are required", line)
+			}
+		}
+		items = append(items, item)
+		rows = append(rows, row)
+	}
+	return items, rows, nil
+}
+
+func (s *BulkJobService) run(ctx context.Context, job models.BulkJob, items []models.BulkJobItem, rows []bulkAccountRow, clientIP string) {
+	defer bulkJobs.remove(job.ID)
+	done := make(chan struct{})
+	defer close(done)
+	go s.heartbeat(job.ID, done)
+
+	started := time.Now()
+	s.db.Model(&job).Updates(map[string]interface{}{"status": BulkJobRunning, "started_at": started, "heartbeat_at": started})
+
+	slots := make(chan struct{}, job.Concurrency)
+	var wg sync.WaitGroup
+	cancelled := false
+
+	for i := range items {
+		if items[i].Status != BulkItemPending {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+			if ctx.Err() != nil {
+				<-slots
+			}
+		}
+		if ctx.Err() != nil {
+			cancelled = true
+			s.finishItem(&job, &items[i], BulkItemSkipped, "cancelled")
+			continue
+		}
+
+		wg.Add(1)
+		go func(item *models.BulkJobItem, row *bulkAccountRow) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			message, err := s.apply(&job, item, row, clientIP)
+			if err != nil {
+				s.finishItem(&job, item, BulkItemFailed, err.Error())
+				return
+			}
+			s.finishItem(&job, item, BulkItemSucceeded, message)
+		}(&items[i], bulkRow(rows, i))
+	}
+	wg.Wait()
+
+	status := BulkJobCompleted
+	if cancelled {
+		status = BulkJobCancelled
+	}
+	s.db.Model(&job).Updates(map[string]interface{}{"status": status, "finished_at": time.Now()})
+
+	var result models.BulkJob
+	s.db.First(&result, job.ID)
+	s.logger.Info(fmt.Sprintf("Bulk %s job %d %s in %s: %d succeeded, %d failed, %d skipped",
+		job.Operation, job.ID, status, time.Since(started).Round(time.Second), result.Succeeded, result.Failed, result.Skipped))
+}
+
+func bulkRow(rows []bulkAccountRow, i int) *bulkAccountRow {
+	if i < len(rows) {
+		return &rows[i]
+	}
+	return nil
+}
+
+// finishItem records an item's result and counts it on the job. Counters are
+// incremented in the database as items finish concurrently.
+func (s *BulkJobService) finishItem(job *models.BulkJob, item *models.BulkJobItem, status, message string) {
+	item.Status = status
+	item.Message = message
+	if err := s.db.Model(item).Updates(map[string]interface{}{
+		"status":  status,
+		"message": message,
+		"user_id": item.UserID,
+	}).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to record item %d of bulk job %d: %v", item.Position, job.ID, err))
+	}
+
+	counter := map[string]string{
+		BulkItemSucceeded: "succeeded",
+		BulkItemFailed:    "failed",
+		BulkItemSkipped:   "skipped",
+	}[status]
+	s.db.Model(&models.BulkJob{}).Where("id = ?", job.ID).Update(counter, gorm.Expr(counter+" + 1"))
+}
+
+// apply works on one item and describes what it did, or would do in a dry
+// run.
+func (s *BulkJobService) apply(job *models.BulkJob, item *models.BulkJobItem, row *bulkAccountRow, clientIP string) (string, error) {
+	if job.Operation == BulkCreate {
+		return s.createAccount(job, item, row)
+	}
+
+	var user models.User
+	query := s.db.Where("id = ?", *item.UserID)
+	if job.ResellerID != nil {
+		query = query.Where("reseller_id = ?", *job.ResellerID)
+	}
+	if err := query.First(&user).Error; err != nil {
+		return "", ErrAccountNotFound
+	}
+
+	switch job.Operation {
+	case BulkSuspend:
+		return s.transition(job, &user, AccountSuspended, "suspended")
+	case BulkUnsuspend:
+		return s.transition(job, &user, AccountActive, "reactivated")
+	case BulkDelete:
+		return s.transition(job, &user, AccountTerminated, "terminated")
+	case BulkChangePackage:
+		return s.changePackage(job, &user)
+	case BulkResetPassword:
+		return s.resetPassword(job, &user, clientIP)
+	}
+	return "", ErrBulkUnknownOperation
+}
+
+func (s *BulkJobService) transition(job *models.BulkJob, user *models.User, to, done string) (string, error) {
+	if job.DryRun {
+		from := user.Status
+		if from == "" {
+			from = AccountActive
+		}
+		if !CanTransition(from, to) {
+			return "", &AccountTransitionError{From: from, To: to}
+		}
+		return "would be " + done, nil
+	}
+
+	transition, err := s.lifecycle.Transition(user.ID, to, job.Reason, job.CreatedBy)
+	if err != nil {
+		return "", err
+	}
+	if transition.Warnings != "" {
+		return done + " with warnings: " + transition.Warnings, nil
+	}
+	return done, nil
+}
+
+func (s *BulkJobService) changePackage(job *models.BulkJob, user *models.User) (string, error) {
+	if job.DryRun {
+		plan, err := s.packages.Plan(user.ID, *job.PackageID)
+		if err != nil {
+			return "", err
+		}
+		if user.ResellerID != nil {
+			if err := s.pools.checkAccount(s.db, *user.ResellerID, job.PackageID, user.ID); err != nil {
+				return "", err
+			}
+		}
+		if len(plan.Violations) > 0 && !job.Force {
+			return "", &PackageDowngradeError{Violations: plan.Violations}
+		}
+		return fmt.Sprintf("would %s to %s", plan.Direction, plan.To.Name), nil
+	}
+
+	result, err := s.packages.Change(user.ID, *job.PackageID, PackageChangeOptions{
+		ActorID: job.CreatedBy,
+		Force:   job.Force,
+		Reason:  job.Reason,
+	})
+	if err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("%s to %s", result.Change.Direction, result.Change.ToPackageName)
+	if len(result.Warnings) > 0 {
+		message += " with warnings: " + strings.Join(result.Warnings, "; ")
+	}
+	return message, nil
+}
+
+func (s *BulkJobService) resetPassword(job *models.BulkJob, user *models.User, clientIP string) (string, error) {
+	if user.Email == "" {
+		return "", errors.New("account has no email address")
+	}
+	if job.DryRun {
+		if user.Status != AccountActive || s.passwords.DirectoryManaged(user.ID) {
+			return "", auth.ErrResetNotPermitted
+		}
+		return "reset link would be sent to " + user.Email, nil
+	}
+
+	token, err := s.resets.Issue(user, clientIP)
+	if err != nil {
+		return "", err
+	}
+	resetURL := PanelURL(s.db, user.ResellerID) + "/reset-password?token=" + url.QueryEscape(token)
+	if err := s.mail.EnqueueTemplateUntil(MailTemplatePasswordReset, user.ResellerID, user.Email, map[string]interface{}{
+		"User":      NewMailUser(user),
+		"ResetURL":  resetURL,
+		"ExpiresIn": fmt.Sprintf("%d minutes", int(s.resets.TTL().Minutes())),
+	}, time.Now().Add(s.resets.TTL())); err != nil {
+		return "", err
+	}
+	return "reset link sent to " + user.Email, nil
+}
+
+// createAccount creates one account of an import through
+// AccountService.Provision, so it is checked and set up as any other new
+// account. A dry run checks each row on its own, so rows that only clash
+// with each other, or only overfill the reseller's pool together, pass.
+func (s *BulkJobService) createAccount(job *models.BulkJob, item *models.BulkJobItem, row *bulkAccountRow) (string, error) {
+	req := NewAccount{
+		Username:   row.Username,
+		Email:      row.Email,
+		Password:   row.Password,
+		Domain:     row.Domain,
+		PackageID:  row.PackageID,
+		ResellerID: job.ResellerID,
+	}
+
+	if job.DryRun {
+		if err := s.accounts.checkNew(req); err != nil {
+			return "", err
+		}
+		if job.ResellerID != nil {
+			if err := s.pools.checkAccount(s.db, *job.ResellerID, row.PackageID, 0); err != nil {
+				return "", err
+			}
+		}
+		return "would be created", nil
+	}
+
+	user, err := s.accounts.Provision(req)
+	if err != nil {
+		return "", err
+	}
+	item.UserID = &user.ID
+	return "created", nil
+}
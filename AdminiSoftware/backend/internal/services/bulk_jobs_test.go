@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkJobFailInterrupted(t *testing.T) {
+	db := testutil.DB(t, &models.BulkJob{}, &models.BulkJobItem{})
+	service := NewBulkJobService(db, utils.NewLogger())
+
+	now := time.Now()
+	stale := now.Add(-2 * bulkJobStale)
+	otherNode := testutil.UniqueName("node")
+	jobs := map[string]*models.BulkJob{
+		"live elsewhere":  {Node: otherNode, HeartbeatAt: &now},
+		"stale elsewhere": {Node: otherNode, HeartbeatAt: &stale},
+		"ours":            {Node: cluster.NodeID(), HeartbeatAt: &now},
+	}
+	for name, job := range jobs {
+		job.Operation = BulkSuspend
+		job.Status = BulkJobRunning
+		job.Reason = name
+		require.NoError(t, db.Create(job).Error)
+		require.NoError(t, db.Create(&models.BulkJobItem{JobID: job.ID, Position: 1, Status: BulkItemPending}).Error)
+	}
+	defer func() {
+		for _, job := range jobs {
+			db.Where("job_id = ?", job.ID).Delete(&models.BulkJobItem{})
+			db.Delete(job)
+		}
+	}()
+
+	status := func(job *models.BulkJob) string {
+		var current models.BulkJob
+		require.NoError(t, db.First(&current, job.ID).Error)
+		return current.Status
+	}
+
+	// The recovery loop leaves jobs whose node is still beating alone
+	service.failInterrupted(false)
+	assert.Equal(t, BulkJobRunning, status(jobs["live elsewhere"]))
+	assert.Equal(t, BulkJobFailed, status(jobs["stale elsewhere"]))
+	assert.Equal(t, BulkJobRunning, status(jobs["ours"]))
+
+	// A cancellation is recorded for the node running the job
+	require.NoError(t, service.Cancel(jobs["live elsewhere"].ID, nil))
+	var cancelled models.BulkJob
+	require.NoError(t, db.First(&cancelled, jobs["live elsewhere"].ID).Error)
+	assert.True(t, cancelled.CancelRequested)
+	assert.ErrorIs(t, service.Cancel(jobs["stale elsewhere"].ID, nil), ErrBulkJobFinished)
+
+	// After a restart this node's own jobs cannot still be running
+	service.FailInterrupted()
+	assert.Equal(t, BulkJobRunning, status(jobs["live elsewhere"]))
+	assert.Equal(t, BulkJobFailed, status(jobs["ours"]))
+
+	var skipped models.BulkJob
+	require.NoError(t, db.First(&skipped, jobs["ours"].ID).Error)
+	assert.Equal(t, 1, skipped.Skipped)
+}
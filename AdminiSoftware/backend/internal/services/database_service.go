@@ -100,6 +100,7 @@ func (s *DatabaseService) dropMongoDatabase(database *models.Database) error {
 package services
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
 	"fmt"
@@ -109,14 +110,18 @@ import (
 )
 
 type DatabaseService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db        *gorm.DB
+	passwords *auth.PasswordPolicy
+	quotas    *QuotaService
+	logger    *utils.Logger
 }
 
 func NewDatabaseService(db *gorm.DB, logger *utils.Logger) *DatabaseService {
 	return &DatabaseService{
-		db:     db,
-		logger: logger,
+		db:        db,
+		passwords: auth.NewPasswordPolicy(db),
+		quotas:    NewQuotaService(db),
+		logger:    logger,
 	}
 }
 
@@ -127,6 +132,13 @@ func (s *DatabaseService) CreateDatabase(userID uint, req *models.CreateDatabase
 		return nil, fmt.Errorf("database name already exists")
 	}
 
+	if err := s.passwords.Validate(req.Password, auth.PasswordSubject{
+		Kind:     auth.PasswordKindDatabase,
+		Username: req.Username,
+	}); err != nil {
+		return nil, err
+	}
+
 	// Create database record
 	database := &models.Database{
 		UserID:   userID,
@@ -137,7 +149,12 @@ func (s *DatabaseService) CreateDatabase(userID uint, req *models.CreateDatabase
 		Size:     0,
 	}
 
-	if err := s.db.Create(database).Error; err != nil {
+	if err := s.quotas.Create(userID, QuotaDatabases, func(tx *gorm.DB) error {
+		return tx.Create(database).Error
+	}); err != nil {
+		if _, ok := QuotaErrorStatus(err); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to create database record: %v", err)
 	}
 
@@ -149,6 +166,7 @@ func (s *DatabaseService) CreateDatabase(userID uint, req *models.CreateDatabase
 
 	// Update status
 	s.db.Model(database).Update("status", "active")
+	s.recordPassword(database.ID, req.Password)
 
 	s.logger.Info(fmt.Sprintf("Database created: %s for user %d", database.Name, userID))
 	return database, nil
@@ -234,9 +252,18 @@ func (s *DatabaseService) UpdateDatabase(id uint, userID uint, req *models.Updat
 
 	// Update password if provided
 	if req.Password != "" {
+		if err := s.passwords.Validate(req.Password, auth.PasswordSubject{
+			Kind:     auth.PasswordKindDatabase,
+			OwnerID:  database.ID,
+			Username: database.Username,
+		}); err != nil {
+			return nil, err
+		}
+
 		if err := s.updateDatabasePassword(&database, req.Password); err != nil {
 			return nil, fmt.Errorf("failed to update database password: %v", err)
 		}
+		s.recordPassword(database.ID, req.Password)
 	}
 
 	// Update status if provided
@@ -251,6 +278,18 @@ func (s *DatabaseService) UpdateDatabase(id uint, userID uint, req *models.Updat
 	return &database, nil
 }
 
+// recordPassword keeps a hash of the database password for the reuse check;
+// the server itself stores its own hash.
+func (s *DatabaseService) recordPassword(databaseID uint, password string) {
+	hash, err := utils.HashPassword(password)
+	if err == nil {
+		err = s.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindDatabase, OwnerID: databaseID}, hash)
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to record password history of database %d: %v", databaseID, err))
+	}
+}
+
 func (s *DatabaseService) updateDatabasePassword(db *models.Database, password string) error {
 	switch db.Type {
 	case "mysql":
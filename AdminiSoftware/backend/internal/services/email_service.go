@@ -48,6 +48,7 @@ func (s *EmailService) DeleteForwarder(id uint) error {
 package services
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
 	"errors"
@@ -57,14 +58,18 @@ import (
 )
 
 type EmailService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db        *gorm.DB
+	passwords *auth.PasswordPolicy
+	quotas    *QuotaService
+	logger    *utils.Logger
 }
 
 func NewEmailService(db *gorm.DB, logger *utils.Logger) *EmailService {
 	return &EmailService{
-		db:     db,
-		logger: logger,
+		db:        db,
+		passwords: auth.NewPasswordPolicy(db),
+		quotas:    NewQuotaService(db),
+		logger:    logger,
 	}
 }
 
@@ -82,6 +87,13 @@ func (s *EmailService) CreateEmailAccount(email *models.EmailAccount) error {
 
 	// Hash password
 	if email.Password != "" {
+		if err := s.passwords.Validate(email.Password, auth.PasswordSubject{
+			Kind:  auth.PasswordKindEmail,
+			Email: email.Email,
+		}); err != nil {
+			return err
+		}
+
 		hashedPassword, err := utils.HashPassword(email.Password)
 		if err != nil {
 			return err
@@ -95,7 +107,9 @@ func (s *EmailService) CreateEmailAccount(email *models.EmailAccount) error {
 		email.QuotaMB = 1000 // 1GB default
 	}
 
-	if err := s.db.Create(email).Error; err != nil {
+	if err := s.quotas.Create(email.UserID, QuotaEmailAccounts, func(tx *gorm.DB) error {
+		return tx.Create(email).Error
+	}); err != nil {
 		s.logger.Error("Failed to create email account", map[string]interface{}{
 			"error": err.Error(),
 			"email": email.Email,
@@ -103,6 +117,9 @@ func (s *EmailService) CreateEmailAccount(email *models.EmailAccount) error {
 		return err
 	}
 
+	if email.PasswordHash != "" {
+		s.recordPassword(email.ID, email.PasswordHash)
+	}
 	return nil
 }
 
@@ -113,8 +130,14 @@ func (s *EmailService) UpdateEmailAccount(emailID uint, updates map[string]inter
 	}
 
 	// Hash password if provided
+	hashedPassword := ""
 	if password, ok := updates["password"]; ok && password != "" {
-		hashedPassword, err := utils.HashPassword(password.(string))
+		if err := s.passwords.Validate(password.(string), s.passwordSubject(&email)); err != nil {
+			return err
+		}
+
+		var err error
+		hashedPassword, err = utils.HashPassword(password.(string))
 		if err != nil {
 			return err
 		}
@@ -130,6 +153,9 @@ func (s *EmailService) UpdateEmailAccount(emailID uint, updates map[string]inter
 		return err
 	}
 
+	if hashedPassword != "" {
+		s.recordPassword(email.ID, hashedPassword)
+	}
 	return nil
 }
 
@@ -230,16 +256,20 @@ func (s *EmailService) ChangeEmailPassword(emailID uint, newPassword string) err
 		return errors.New("password cannot be empty")
 	}
 
-	hashedPassword, err := utils.HashPassword(newPassword)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %v", err)
-	}
-
 	var email models.EmailAccount
 	if err := s.db.First(&email, emailID).Error; err != nil {
 		return errors.New("email account not found")
 	}
 
+	if err := s.passwords.Validate(newPassword, s.passwordSubject(&email)); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
 	if err := s.db.Model(&email).Update("password_hash", hashedPassword).Error; err != nil {
 		s.logger.Error("Failed to change email password", map[string]interface{}{
 			"error": err.Error(),
@@ -248,5 +278,20 @@ func (s *EmailService) ChangeEmailPassword(emailID uint, newPassword string) err
 		return err
 	}
 
+	s.recordPassword(email.ID, hashedPassword)
 	return nil
 }
+
+func (s *EmailService) passwordSubject(email *models.EmailAccount) auth.PasswordSubject {
+	return auth.PasswordSubject{
+		Kind:    auth.PasswordKindEmail,
+		OwnerID: email.ID,
+		Email:   email.Email,
+	}
+}
+
+func (s *EmailService) recordPassword(emailID uint, hash string) {
+	if err := s.passwords.Record(auth.PasswordSubject{Kind: auth.PasswordKindEmail, OwnerID: emailID}, hash); err != nil {
+		s.logger.Error(err.Error())
+	}
+}
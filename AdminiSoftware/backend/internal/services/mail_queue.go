@@ -0,0 +1,416 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Delivery states of an OutboundMail.
+const (
+	MailQueued  = "queued"
+	MailSending = "sending"
+	MailSent    = "sent"
+	MailFailed  = "failed"
+)
+
+const (
+	maxMailAttempts = 8
+	mailRetryBase   = time.Minute
+	mailRetryMax    = 6 * time.Hour
+	mailBatchSize   = 50
+	mailDialTimeout = 30 * time.Second
+	// A message left "sending" this long belongs to a node that died
+	// mid-delivery and is picked up again
+	mailStaleSending = 10 * time.Minute
+)
+
+// ErrMailNotRetryable is returned for messages that have not failed, or
+// whose link has expired.
+var ErrMailNotRetryable = errors.New("only failed emails that have not expired can be retried")
+
+// smtpConfig comes from SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASSWORD,
+// SMTP_FROM and SMTP_TLS. SMTP_TLS is "starttls" (used when the server
+// offers it), "implicit" for SMTPS, or "none" for a local sink such as
+// MailHog.
+type smtpConfig struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     mail.Address
+	tls      string
+}
+
+func smtpConfigFromEnv() smtpConfig {
+	config := smtpConfig{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		username: os.Getenv("SMTP_USER"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		tls:      strings.ToLower(os.Getenv("SMTP_TLS")),
+	}
+	if config.host == "" {
+		config.host = "localhost"
+	}
+	if config.port == "" {
+		config.port = "25"
+	}
+	if config.tls == "" {
+		config.tls = "starttls"
+	}
+
+	config.from = mail.Address{Name: "AdminiSoftware", Address: "noreply@localhost"}
+	if from, err := mail.ParseAddress(os.Getenv("SMTP_FROM")); err == nil {
+		config.from = *from
+	}
+	return config
+}
+
+// MailQueue is the panel's persistent outbox. Messages are stored before
+// they are sent, so a failing or unreachable SMTP server delays mail rather
+// than losing it, and every node can deliver from the same queue.
+type MailQueue struct {
+	db     *gorm.DB
+	logger *utils.Logger
+	smtp   smtpConfig
+}
+
+func NewMailQueue(db *gorm.DB, logger *utils.Logger) *MailQueue {
+	return &MailQueue{
+		db:     db,
+		logger: logger,
+		smtp:   smtpConfigFromEnv(),
+	}
+}
+
+// EnqueueTemplate renders a template for a customer of resellerID, nil for
+// the panel's own customers, and queues it.
+func (q *MailQueue) EnqueueTemplate(name string, resellerID *uint, recipient string, data map[string]interface{}) error {
+	return q.enqueueTemplate(name, resellerID, recipient, data, nil)
+}
+
+// EnqueueTemplateUntil queues a template carrying a link that stops working
+// at expiresAt. The message is not delivered after that, and its body, link
+// included, is dropped.
+func (q *MailQueue) EnqueueTemplateUntil(name string, resellerID *uint, recipient string, data map[string]interface{}, expiresAt time.Time) error {
+	return q.enqueueTemplate(name, resellerID, recipient, data, &expiresAt)
+}
+
+func (q *MailQueue) enqueueTemplate(name string, resellerID *uint, recipient string, data map[string]interface{}, expiresAt *time.Time) error {
+	rendered, err := RenderMailTemplate(q.db, name, resellerID, data)
+	if err != nil {
+		return err
+	}
+
+	// Mail comes from the configured address under the reseller's name
+	sender := mail.Address{Name: rendered.Sender, Address: q.smtp.from.Address}
+	return q.Enqueue(&models.OutboundMail{
+		Sender:    sender.String(),
+		Recipient: recipient,
+		Subject:   rendered.Subject,
+		TextBody:  rendered.TextBody,
+		HTMLBody:  rendered.HTMLBody,
+		Template:  name,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Enqueue stores a message for delivery on the next pass of the queue.
+func (q *MailQueue) Enqueue(message *models.OutboundMail) error {
+	if _, err := mail.ParseAddress(message.Recipient); err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", message.Recipient, err)
+	}
+	if message.Sender == "" {
+		message.Sender = q.smtp.from.String()
+	}
+	message.Status = MailQueued
+	message.NextAttemptAt = time.Now()
+
+	if err := q.db.Create(message).Error; err != nil {
+		return fmt.Errorf("failed to queue email: %v", err)
+	}
+	return nil
+}
+
+// Retry queues a failed message again with a fresh set of attempts.
+func (q *MailQueue) Retry(id uint) error {
+	result := q.db.Model(&models.OutboundMail{}).
+		Where("id = ? AND status = ? AND (expires_at IS NULL OR expires_at > ?)", id, MailFailed, time.Now()).
+		Updates(map[string]interface{}{
+			"status":          MailQueued,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to retry email: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMailNotRetryable
+	}
+	return nil
+}
+
+// StartDelivery sends due messages until the process exits.
+func (q *MailQueue) StartDelivery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		q.deliverDue()
+	}
+}
+
+func (q *MailQueue) deliverDue() {
+	q.expire()
+
+	now := time.Now()
+	var due []models.OutboundMail
+	if err := q.db.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND updated_at < ?)",
+		MailQueued, now, MailSending, now.Add(-mailStaleSending)).
+		Order("next_attempt_at").Limit(mailBatchSize).Find(&due).Error; err != nil {
+		q.logger.Error(fmt.Sprintf("Failed to load mail queue: %v", err))
+		return
+	}
+
+	for i := range due {
+		message := &due[i]
+		if message.ExpiresAt != nil && now.After(*message.ExpiresAt) {
+			continue
+		}
+		if !q.claim(message) {
+			continue
+		}
+
+		err := q.send(message)
+		q.finish(message, err)
+	}
+}
+
+// expire gives up on messages whose link expired before they were sent and
+// drops the bodies of every expired message.
+func (q *MailQueue) expire() {
+	now := time.Now()
+	if err := q.db.Model(&models.OutboundMail{}).
+		Where("expires_at <= ? AND status IN ?", now, []string{MailQueued, MailSending}).
+		Updates(map[string]interface{}{
+			"status":     MailFailed,
+			"last_error": "expired before it could be delivered",
+			"text_body":  "",
+			"html_body":  "",
+		}).Error; err != nil {
+		q.logger.Error(fmt.Sprintf("Failed to expire queued email: %v", err))
+	}
+	if err := q.db.Model(&models.OutboundMail{}).
+		Where("expires_at <= ? AND (text_body <> '' OR html_body <> '')", now).
+		Updates(map[string]interface{}{"text_body": "", "html_body": ""}).Error; err != nil {
+		q.logger.Error(fmt.Sprintf("Failed to drop bodies of expired email: %v", err))
+	}
+}
+
+// claim marks the message as being sent and counts the attempt. It fails
+// when another node claimed the message first.
+func (q *MailQueue) claim(message *models.OutboundMail) bool {
+	result := q.db.Model(&models.OutboundMail{}).
+		Where("id = ? AND status = ? AND attempts = ?", message.ID, message.Status, message.Attempts).
+		Updates(map[string]interface{}{
+			"status":   MailSending,
+			"attempts": message.Attempts + 1,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	message.Attempts++
+	return true
+}
+
+func (q *MailQueue) finish(message *models.OutboundMail, sendErr error) {
+	updates := map[string]interface{}{}
+	if sendErr == nil {
+		now := time.Now()
+		updates["status"] = MailSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+		// Delivered mail may hold reset links; the log keeps only the envelope
+		updates["text_body"] = ""
+		updates["html_body"] = ""
+	} else {
+		updates["last_error"] = sendErr.Error()
+
+		// The server refused the message outright; retrying will not help
+		var smtpErr *textproto.Error
+		permanent := errors.As(sendErr, &smtpErr) && smtpErr.Code >= 500
+
+		if permanent || message.Attempts >= maxMailAttempts {
+			updates["status"] = MailFailed
+			q.logger.Error(fmt.Sprintf("Giving up on email %d to %s after %d attempts: %v", message.ID, message.Recipient, message.Attempts, sendErr))
+		} else {
+			updates["status"] = MailQueued
+			updates["next_attempt_at"] = time.Now().Add(mailRetryDelay(message.Attempts))
+		}
+	}
+
+	if err := q.db.Model(message).Updates(updates).Error; err != nil {
+		q.logger.Error(fmt.Sprintf("Failed to update email %d: %v", message.ID, err))
+	}
+}
+
+// mailRetryDelay doubles from a minute with every attempt, up to six hours.
+func mailRetryDelay(attempts int) time.Duration {
+	delay := mailRetryBase
+	for i := 1; i < attempts && delay < mailRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > mailRetryMax {
+		delay = mailRetryMax
+	}
+	return delay
+}
+
+func (q *MailQueue) send(message *models.OutboundMail) error {
+	sender, err := mail.ParseAddress(message.Sender)
+	if err != nil {
+		sender = &q.smtp.from
+	}
+	body, err := buildMailMessage(message, sender)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(q.smtp.host, q.smtp.port)
+	var conn net.Conn
+	if q.smtp.tls == "implicit" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: mailDialTimeout}, "tcp", address, &tls.Config{ServerName: q.smtp.host})
+	} else {
+		conn, err = net.DialTimeout("tcp", address, mailDialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+
+	client, err := smtp.NewClient(conn, q.smtp.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if q.smtp.tls == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: q.smtp.host}); err != nil {
+				return err
+			}
+		}
+	}
+	if q.smtp.username != "" {
+		// PlainAuth refuses to send the password unencrypted except to
+		// localhost
+		if err := client.Auth(smtp.PlainAuth("", q.smtp.username, q.smtp.password, q.smtp.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.Recipient); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMailMessage formats the message as MIME, with an HTML alternative
+// when the template has one.
+func buildMailMessage(message *models.OutboundMail, sender *mail.Address) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(sender.Address, "@"); at >= 0 {
+		domain = sender.Address[at+1:]
+	}
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+
+	header("From", sender.String())
+	header("To", message.Recipient)
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%d.%s@%s>", message.ID, hex.EncodeToString(nonce), domain))
+	header("MIME-Version", "1.0")
+
+	if message.HTMLBody == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, message.TextBody); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", message.TextBody},
+		{"text/html; charset=utf-8", message.HTMLBody},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(writer, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable encodes body, which also turns its line breaks into
+// CRLF.
+func writeQuotedPrintable(w io.Writer, body string) error {
+	encoder := quotedprintable.NewWriter(w)
+	if _, err := encoder.Write([]byte(body)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailTemplatesSeeOnlyMailUser(t *testing.T) {
+	for _, name := range MailTemplateNames() {
+		template, ok := DefaultMailTemplate(name)
+		require.True(t, ok, name)
+		assert.NoError(t, ValidateMailTemplate(template), name)
+	}
+
+	// A reseller's template cannot reach the hash or other account fields
+	for _, body := range []string{"{{.User.Password}}", "{{.User.ID}}", "{{.User.Role}}"} {
+		template, _ := DefaultMailTemplate(MailTemplatePasswordReset)
+		template.TextBody = body
+		assert.Error(t, ValidateMailTemplate(template), body)
+	}
+}
+
+func TestBuildMailMessage(t *testing.T) {
+	sender := &mail.Address{Name: "Example Hosting", Address: "noreply@example.com"}
+	message := &models.OutboundMail{
+		ID:        12,
+		Recipient: "jane@example.com",
+		Subject:   "Réinitialisation",
+		TextBody:  "Hello\nReset: https://panel.example.com/reset-password?token=abc",
+	}
+
+	raw, err := buildMailMessage(message, sender)
+	require.NoError(t, err)
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", parsed.Header.Get("To"))
+	assert.Contains(t, parsed.Header.Get("Message-ID"), "@example.com>")
+	assert.NotContains(t, parsed.Header.Get("Subject"), "é", "the subject is encoded")
+	assert.Equal(t, "text/plain; charset=utf-8", parsed.Header.Get("Content-Type"))
+
+	message.HTMLBody = "<p>Hello</p>"
+	raw, err = buildMailMessage(message, sender)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "multipart/alternative; boundary=")
+	assert.Contains(t, string(raw), "text/html; charset=utf-8")
+}
+
+// TestMailHogDelivery sends through the MailHog instance whose HTTP API is
+// at MAILHOG_URL, e.g. http://localhost:8025, and whose SMTP listener is at
+// MAILHOG_SMTP, by default port 1025 on the same host.
+func TestMailHogDelivery(t *testing.T) {
+	apiURL := os.Getenv("MAILHOG_URL")
+	if apiURL == "" {
+		t.Skip("MAILHOG_URL is not set")
+	}
+	api, err := url.Parse(apiURL)
+	require.NoError(t, err)
+	smtpAddress := os.Getenv("MAILHOG_SMTP")
+	if smtpAddress == "" {
+		smtpAddress = net.JoinHostPort(api.Hostname(), "1025")
+	}
+	host, port, err := net.SplitHostPort(smtpAddress)
+	require.NoError(t, err)
+
+	queue := &MailQueue{smtp: smtpConfig{
+		host: host,
+		port: port,
+		from: mail.Address{Name: "AdminiSoftware", Address: "noreply@example.com"},
+		tls:  "none",
+	}}
+	recipient := fmt.Sprintf("mailhog-%d@example.com", time.Now().UnixNano())
+	require.NoError(t, queue.send(&models.OutboundMail{
+		Recipient: recipient,
+		Subject:   "Reset your password",
+		TextBody:  "Reset: https://panel.example.com/reset-password?token=abc",
+		HTMLBody:  "<p>Reset</p>",
+	}))
+
+	response, err := http.Get(strings.TrimRight(apiURL, "/") + "/api/v2/search?kind=to&query=" + url.QueryEscape(recipient))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	var result struct {
+		Total int `json:"total"`
+		Items []struct {
+			Content struct {
+				Headers map[string][]string `json:"Headers"`
+			} `json:"Content"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	require.Equal(t, 1, result.Total)
+	assert.Equal(t, []string{"Reset your password"}, result.Items[0].Content.Headers["Subject"])
+	assert.Equal(t, []string{"AdminiSoftware <noreply@example.com>"}, result.Items[0].Content.Headers["From"])
+}
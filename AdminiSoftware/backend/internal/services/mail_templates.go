@@ -0,0 +1,254 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"gorm.io/gorm"
+)
+
+// Names of the emails the panel sends. Each can be overridden per reseller.
+const (
+	MailTemplatePasswordReset   = "password_reset"
+	MailTemplatePasswordChanged = "password_changed"
+	MailTemplateTwoFactorReset  = "two_factor_reset"
+)
+
+// defaultMailTemplates are sent when neither the customer's reseller nor the
+// administrator has saved an override.
+var defaultMailTemplates = map[string]models.EmailTemplate{
+	MailTemplatePasswordReset: {
+		Subject: "Reset your {{.Brand.CompanyName}} password",
+		TextBody: `Hello {{.User.Username}},
+
+Someone asked to reset the password of your {{.Brand.CompanyName}} account. To choose a new password, open this link within {{.ExpiresIn}}:
+
+{{.ResetURL}}
+
+If you did not ask for this, ignore this email; your password has not changed.
+{{if .Brand.SupportURL}}
+Support: {{.Brand.SupportURL}}
+{{end}}`,
+		HTMLBody: `<p>Hello {{.User.Username}},</p>
+<p>Someone asked to reset the password of your {{.Brand.CompanyName}} account. To choose a new password, open this link within {{.ExpiresIn}}:</p>
+<p><a href="{{.ResetURL}}" style="color: {{.Brand.ThemeColor}}">Reset password</a></p>
+<p>If you did not ask for this, ignore this email; your password has not changed.</p>
+{{if .Brand.SupportURL}}<p><a href="{{.Brand.SupportURL}}">Support</a></p>{{end}}`,
+	},
+	MailTemplatePasswordChanged: {
+		Subject: "Your {{.Brand.CompanyName}} password was changed",
+		TextBody: `Hello {{.User.Username}},
+
+The password of your {{.Brand.CompanyName}} account was reset from {{.ClientIP}} and every session was signed out.
+
+If this was not you, contact support immediately.
+{{if .Brand.SupportURL}}
+Support: {{.Brand.SupportURL}}
+{{end}}`,
+		HTMLBody: `<p>Hello {{.User.Username}},</p>
+<p>The password of your {{.Brand.CompanyName}} account was reset from {{.ClientIP}} and every session was signed out.</p>
+<p>If this was not you, contact support immediately.</p>
+{{if .Brand.SupportURL}}<p><a href="{{.Brand.SupportURL}}">Support</a></p>{{end}}`,
+	},
+	MailTemplateTwoFactorReset: {
+		Subject: "Two-factor authentication of your {{.Brand.CompanyName}} account was turned off",
+		TextBody: `Hello {{.User.Username}},
+
+At your request, support turned off two-factor authentication for your {{.Brand.CompanyName}} account and signed out every session. Sign in with your password and set it up again.
+
+If you did not ask for this, contact support immediately.
+{{if .Brand.SupportURL}}
+Support: {{.Brand.SupportURL}}
+{{end}}`,
+		HTMLBody: `<p>Hello {{.User.Username}},</p>
+<p>At your request, support turned off two-factor authentication for your {{.Brand.CompanyName}} account and signed out every session. Sign in with your password and set it up again.</p>
+<p>If you did not ask for this, contact support immediately.</p>
+{{if .Brand.SupportURL}}<p><a href="{{.Brand.SupportURL}}">Support</a></p>{{end}}`,
+	},
+}
+
+// defaultBranding applies to customers whose reseller has not configured
+// any, matching the defaults of the branding page.
+var defaultBranding = models.Branding{
+	CompanyName:   "AdminiSoftware",
+	LogoURL:       "/assets/logos/adminisoftware-logo.svg",
+	ThemeColor:    "#3B82F6",
+	ShowPoweredBy: true,
+}
+
+// MailUser is what templates see of the recipient's account. Resellers edit
+// templates, so they get the names and address and nothing else of the user.
+type MailUser struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+func NewMailUser(user *models.User) MailUser {
+	return MailUser{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+	}
+}
+
+// RenderedMail is a template filled in for one recipient.
+type RenderedMail struct {
+	Sender   string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// MailTemplateNames lists the emails that can be overridden.
+func MailTemplateNames() []string {
+	return []string{MailTemplatePasswordReset, MailTemplatePasswordChanged, MailTemplateTwoFactorReset}
+}
+
+// DefaultMailTemplate returns the built-in version of a template.
+func DefaultMailTemplate(name string) (models.EmailTemplate, bool) {
+	template, ok := defaultMailTemplates[name]
+	template.Name = name
+	return template, ok
+}
+
+// ResolveMailTemplate returns the template a reseller's customers receive:
+// the reseller's own, else the administrator's, else the built-in one.
+func ResolveMailTemplate(db *gorm.DB, name string, resellerID *uint) (models.EmailTemplate, error) {
+	if resellerID != nil {
+		var template models.EmailTemplate
+		if err := db.Where("reseller_id = ? AND name = ?", *resellerID, name).First(&template).Error; err == nil {
+			return template, nil
+		}
+	}
+
+	var template models.EmailTemplate
+	if err := db.Where("reseller_id IS NULL AND name = ?", name).First(&template).Error; err == nil {
+		return template, nil
+	}
+
+	template, ok := DefaultMailTemplate(name)
+	if !ok {
+		return models.EmailTemplate{}, fmt.Errorf("unknown email template %q", name)
+	}
+	return template, nil
+}
+
+// RenderMailTemplate fills in a template with data, adding the reseller's
+// branding as .Brand. The HTML body is escaped for HTML, the rest is not.
+func RenderMailTemplate(db *gorm.DB, name string, resellerID *uint, data map[string]interface{}) (*RenderedMail, error) {
+	template, err := ResolveMailTemplate(db, name, resellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	brand := resellerBranding(db, resellerID)
+	values := map[string]interface{}{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Brand"] = brand
+
+	return renderMail(template, values, brand.CompanyName)
+}
+
+// resellerBranding returns the branding a reseller's customers see, or the
+// default for customers without a reseller or whose reseller has none.
+func resellerBranding(db *gorm.DB, resellerID *uint) models.Branding {
+	brand := defaultBranding
+	if resellerID != nil {
+		var branding models.Branding
+		if err := db.Where("user_id = ?", *resellerID).First(&branding).Error; err == nil {
+			brand = branding
+		}
+	}
+	if brand.CompanyName == "" {
+		brand.CompanyName = defaultBranding.CompanyName
+	}
+	return brand
+}
+
+// mailTemplateSamples is the data each template is rendered with, less
+// .Brand, used to check templates before they are saved. A template may
+// only use what its sample provides.
+var mailTemplateSamples = map[string]map[string]interface{}{
+	MailTemplatePasswordReset: {
+		"User":      MailUser{Username: "customer", Email: "customer@example.com"},
+		"ResetURL":  "https://panel.example.com/reset-password?token=sample",
+		"ExpiresIn": "60 minutes",
+	},
+	MailTemplatePasswordChanged: {
+		"User":     MailUser{Username: "customer", Email: "customer@example.com"},
+		"ClientIP": "192.0.2.1",
+	},
+	MailTemplateTwoFactorReset: {
+		"User":     MailUser{Username: "customer", Email: "customer@example.com"},
+		"ClientIP": "192.0.2.1",
+	},
+}
+
+// ValidateMailTemplate checks that a template parses and renders with
+// sample data before it is saved.
+func ValidateMailTemplate(template models.EmailTemplate) error {
+	sample, ok := mailTemplateSamples[template.Name]
+	if !ok {
+		return fmt.Errorf("unknown email template %q", template.Name)
+	}
+
+	values := map[string]interface{}{"Brand": defaultBranding}
+	for key, value := range sample {
+		values[key] = value
+	}
+	_, err := renderMail(template, values, defaultBranding.CompanyName)
+	return err
+}
+
+func renderMail(template models.EmailTemplate, data map[string]interface{}, senderName string) (*RenderedMail, error) {
+	subject, err := renderText(template.Name+" subject", template.Subject, data)
+	if err != nil {
+		return nil, err
+	}
+	text, err := renderText(template.Name, template.TextBody, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var html string
+	if template.HTMLBody != "" {
+		parsed, err := htmltemplate.New(template.Name).Option("missingkey=error").Parse(template.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTML of %s: %v", template.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := parsed.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render HTML of %s: %v", template.Name, err)
+		}
+		html = buf.String()
+	}
+
+	return &RenderedMail{
+		Sender: senderName,
+		// A subject never spans lines, whatever the template produces
+		Subject:  strings.Join(strings.Fields(subject), " "),
+		TextBody: text,
+		HTMLBody: html,
+	}, nil
+}
+
+func renderText(name, body string, data map[string]interface{}) (string, error) {
+	parsed, err := texttemplate.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Directions of a package change.
+const (
+	PackageUpgrade   = "upgrade"
+	PackageDowngrade = "downgrade"
+	PackageLateral   = "lateral"
+)
+
+// quotaDiskMB is reported alongside the counted resources when a package
+// change is planned.
+const quotaDiskMB = "disk_mb"
+
+var (
+	ErrSamePackage     = errors.New("account already has this package")
+	ErrPackageNotFound = errors.New("package not found")
+	ErrPackageInactive = errors.New("package is not active")
+)
+
+// PackageDowngradeError is returned when the account uses more than the new
+// package allows and the change was not forced.
+type PackageDowngradeError struct {
+	Violations []QuotaUsage
+}
+
+func (e *PackageDowngradeError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s %d of %d", v.Resource, v.Used, v.Limit))
+	}
+	return "account uses more than the new package allows: " + strings.Join(parts, ", ")
+}
+
+// PackageChangePlan describes what moving an account to a package means.
+type PackageChangePlan struct {
+	From       *models.Package `json:"from"`
+	To         *models.Package `json:"to"`
+	Direction  string          `json:"direction"`
+	Usage      []QuotaUsage    `json:"usage"`      // against the new package
+	Violations []QuotaUsage    `json:"violations"` // resources over the new limits
+}
+
+// PackageChangeOptions controls how a change is applied.
+type PackageChangeOptions struct {
+	ActorID uint   // 0 when the system changes the package
+	Force   bool   // apply even if usage exceeds the new limits
+	Reason  string // recorded in the history
+}
+
+// PackageChangeResult is a completed change and any side effects that
+// could not be applied to the server.
+type PackageChangeResult struct {
+	Change   models.PackageChange `json:"change"`
+	Warnings []string             `json:"warnings"`
+}
+
+// PackageChangeService moves accounts between packages: it checks the
+// account's usage against the new limits, applies the package's server
+// settings and records the change for billing.
+type PackageChangeService struct {
+	db     *gorm.DB
+	quotas *QuotaService
+	pools  *ResellerPoolService
+	logger *utils.Logger
+}
+
+func NewPackageChangeService(db *gorm.DB, logger *utils.Logger) *PackageChangeService {
+	return &PackageChangeService{
+		db:     db,
+		quotas: NewQuotaService(db),
+		pools:  NewResellerPoolService(db),
+		logger: logger,
+	}
+}
+
+// Plan previews moving the account to a package without changing anything.
+func (s *PackageChangeService) Plan(userID, packageID uint) (*PackageChangePlan, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("account not found")
+	}
+	return s.plan(s.db, &user, packageID)
+}
+
+// Change moves the account to a package. A change that leaves the account
+// over any new limit fails with a PackageDowngradeError unless forced, in
+// which case the violations are kept as warnings. The server settings are
+// applied after the change is committed; failures to do so are returned as
+// warnings, not errors, as the account is already on the new package.
+func (s *PackageChangeService) Change(userID, packageID uint, opts PackageChangeOptions) (*PackageChangeResult, error) {
+	var user models.User
+	var plan *PackageChangePlan
+	result := &PackageChangeResult{}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Held until commit so quota-checked creates wait for the new limits
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return errors.New("account not found")
+		}
+
+		var err error
+		plan, err = s.plan(tx, &user, packageID)
+		if err != nil {
+			return err
+		}
+		if user.ResellerID != nil {
+			if err := s.pools.CheckPackageChange(tx, *user.ResellerID, user.ID, packageID); err != nil {
+				return err
+			}
+		}
+		if len(plan.Violations) > 0 {
+			if !opts.Force {
+				return &PackageDowngradeError{Violations: plan.Violations}
+			}
+			result.Warnings = append(result.Warnings, (&PackageDowngradeError{Violations: plan.Violations}).Error())
+		}
+
+		fromPackageID := user.PackageID
+		if err := tx.Model(&user).Update("package_id", packageID).Error; err != nil {
+			return fmt.Errorf("failed to change package: %v", err)
+		}
+
+		result.Change = models.PackageChange{
+			UserID:        user.ID,
+			FromPackageID: fromPackageID,
+			ToPackageID:   packageID,
+			ToPackageName: plan.To.Name,
+			Direction:     plan.Direction,
+			ChangedBy:     opts.ActorID,
+			Forced:        opts.Force && len(plan.Violations) > 0,
+			Reason:        opts.Reason,
+		}
+		if plan.From != nil {
+			result.Change.FromPackageName = plan.From.Name
+		}
+		return tx.Create(&result.Change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Warnings = append(result.Warnings, s.applyPackage(&user, plan.To)...)
+	if len(result.Warnings) > 0 {
+		result.Change.Warnings = strings.Join(result.Warnings, "\n")
+		if err := s.db.Model(&result.Change).Update("warnings", result.Change.Warnings).Error; err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to record warnings of package change %d: %v", result.Change.ID, err))
+		}
+	}
+
+	s.logger.Info(fmt.Sprintf("Package of %s changed from %q to %q (%s) by user %d",
+		user.Username, result.Change.FromPackageName, result.Change.ToPackageName, plan.Direction, opts.ActorID))
+	return result, nil
+}
+
+// History returns the account's package changes, newest first.
+func (s *PackageChangeService) History(userID uint) ([]models.PackageChange, error) {
+	var changes []models.PackageChange
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load package history: %v", err)
+	}
+	return changes, nil
+}
+
+func (s *PackageChangeService) plan(tx *gorm.DB, user *models.User, packageID uint) (*PackageChangePlan, error) {
+	if user.PackageID != nil && *user.PackageID == packageID {
+		return nil, ErrSamePackage
+	}
+
+	var to models.Package
+	if err := tx.First(&to, packageID).Error; err != nil {
+		return nil, ErrPackageNotFound
+	}
+	if to.Status != "" && to.Status != "active" {
+		return nil, ErrPackageInactive
+	}
+	from, err := s.quotas.accountPackage(tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.quotas.usage(tx, user.ID, &to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Disk use comes from the latest statistics rather than a count
+	disk := QuotaUsage{Resource: quotaDiskMB, Limit: to.DiskQuotaMB, Unlimited: to.DiskQuotaMB == 0}
+	var stats models.Stats
+	if err := tx.Where("user_id = ?", user.ID).Order("date DESC").First(&stats).Error; err == nil {
+		disk.Used = stats.DiskUsageMB
+	}
+	usage = append(usage, disk)
+
+	plan := &PackageChangePlan{
+		From:       from,
+		To:         &to,
+		Direction:  packageDirection(from, &to),
+		Usage:      usage,
+		Violations: []QuotaUsage{},
+	}
+	for _, entry := range usage {
+		if !entry.Unlimited && entry.Used > int64(entry.Limit) {
+			plan.Violations = append(plan.Violations, entry)
+		}
+	}
+	return plan, nil
+}
+
+// packageDirection calls a change a downgrade if any limit shrinks or a
+// feature is lost, an upgrade if something grows and nothing shrinks.
+func packageDirection(from, to *models.Package) string {
+	if from == nil {
+		return PackageDowngrade
+	}
+
+	grew, shrank := false, false
+	compare := func(before, after int) {
+		// 0 is unlimited
+		switch {
+		case before == after:
+		case before == 0:
+			shrank = true
+		case after == 0 || after > before:
+			grew = true
+		default:
+			shrank = true
+		}
+	}
+	compareFeature := func(before, after bool) {
+		if before && !after {
+			shrank = true
+		} else if !before && after {
+			grew = true
+		}
+	}
+
+	compare(from.DiskQuotaMB, to.DiskQuotaMB)
+	compare(from.BandwidthMB, to.BandwidthMB)
+	compare(from.EmailAccounts, to.EmailAccounts)
+	compare(from.Databases, to.Databases)
+	compare(from.SubDomains, to.SubDomains)
+	compare(from.ParkedDomains, to.ParkedDomains)
+	compare(from.AddonDomains, to.AddonDomains)
+	compare(from.FTPAccounts, to.FTPAccounts)
+	compare(from.CronJobs, to.CronJobs)
+	compare(from.SSLCertificates, to.SSLCertificates)
+	compare(from.LVESpeed, to.LVESpeed)
+	compare(from.LVEMemoryMB, to.LVEMemoryMB)
+	compare(from.LVEIOKB, to.LVEIOKB)
+	compare(from.LVEEntryProcesses, to.LVEEntryProcesses)
+	compareFeature(from.CGIAccess, to.CGIAccess)
+	compareFeature(from.SSHAccess, to.SSHAccess)
+	compareFeature(from.SSLSupport, to.SSLSupport)
+
+	switch {
+	case shrank:
+		return PackageDowngrade
+	case grew:
+		return PackageUpgrade
+	}
+	return PackageLateral
+}
+
+// applyPackage puts the package's settings in force on the server: disk
+// quota, shell, CloudLinux LVE limits and PHP. Tools that are not installed
+// are skipped. It returns what could not be applied.
+func (s *PackageChangeService) applyPackage(user *models.User, pkg *models.Package) []string {
+	var warnings []string
+	run := func(what string, name string, args ...string) {
+		if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to apply %s: %v: %s", what, err, strings.TrimSpace(string(output))))
+		}
+	}
+	installed := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+
+	if installed("setquota") {
+		blocks := strconv.Itoa(pkg.DiskQuotaMB * 1024) // 1 KB blocks, 0 is unlimited
+		run("disk quota", "setquota", "-u", user.Username, blocks, blocks, "0", "0", "-a")
+	}
+
+	shell := "/usr/sbin/nologin"
+	if pkg.SSHAccess {
+		shell = "/bin/bash"
+	}
+	if installed("usermod") {
+		run("shell access", "usermod", "-s", shell, user.Username)
+	}
+
+	if installed("lvectl") {
+		if pkg.LVESpeed == 0 && pkg.LVEMemoryMB == 0 && pkg.LVEIOKB == 0 && pkg.LVEEntryProcesses == 0 {
+			run("LVE limits", "lvectl", "set-user", user.Username, "--unlimited")
+		} else {
+			args := []string{"set-user", user.Username}
+			if pkg.LVESpeed > 0 {
+				args = append(args, fmt.Sprintf("--speed=%d%%", pkg.LVESpeed))
+			}
+			if pkg.LVEMemoryMB > 0 {
+				args = append(args, fmt.Sprintf("--pmem=%dM", pkg.LVEMemoryMB))
+			}
+			if pkg.LVEIOKB > 0 {
+				args = append(args, fmt.Sprintf("--io=%d", pkg.LVEIOKB))
+			}
+			if pkg.LVEEntryProcesses > 0 {
+				args = append(args, fmt.Sprintf("--maxEntryProcs=%d", pkg.LVEEntryProcesses))
+			}
+			run("LVE limits", "lvectl", args...)
+		}
+	}
+
+	if installed("selectorctl") && pkg.PHPVersion != "" {
+		run("PHP version", "selectorctl", "--set-user-current="+pkg.PHPVersion, "--user="+user.Username)
+		if pkg.PHPMemoryLimitMB > 0 {
+			run("PHP memory limit", "selectorctl", "--version="+pkg.PHPVersion, "--user="+user.Username,
+				fmt.Sprintf("--replace-options=memory_limit:%dM", pkg.PHPMemoryLimitMB))
+		}
+	}
+
+	for _, warning := range warnings {
+		s.logger.Error(fmt.Sprintf("Package change of %s: %s", user.Username, warning))
+	}
+	return warnings
+}
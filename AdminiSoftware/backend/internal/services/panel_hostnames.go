@@ -0,0 +1,313 @@
+package services
+
+import (
+	"AdminiSoftware/internal/cluster"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Panel hostname states.
+const (
+	PanelHostnamePending = "pending"
+	PanelHostnameActive  = "active"
+	PanelHostnameFailed  = "failed"
+)
+
+// panelCertRenewBefore is how long before expiry a certificate is renewed.
+const panelCertRenewBefore = 30 * 24 * time.Hour
+
+// panelHostnameRetry is how long a hostname whose certificate failed waits
+// before the renewal loop tries it again.
+const panelHostnameRetry = time.Hour
+
+var (
+	ErrPanelHostnameInvalid  = errors.New("invalid panel hostname")
+	ErrPanelHostnameTaken    = errors.New("panel hostname is already in use")
+	ErrPanelHostnameNotFound = errors.New("no panel hostname is set")
+	ErrPanelHostnameUnknown  = errors.New("panel hostname does not resolve yet; point it at this server and retry")
+)
+
+// PanelHostnameService serves the panel under resellers' own hostnames.
+// Setting a hostname issues a certificate for it with PANEL_CERT_COMMAND
+// and installs it with PANEL_VHOST_COMMAND; {hostname}, {cert} and {key}
+// are substituted, the last two being paths under PANEL_CERT_DIR. Either
+// command may be left empty when certificates or the web server are
+// managed outside the panel. Requests arriving on the hostname then get
+// the reseller's branding.
+type PanelHostnameService struct {
+	db            *gorm.DB
+	logger        *utils.Logger
+	certDir       string
+	certCommand   string
+	vhostCommand  string
+	removeCommand string
+}
+
+func NewPanelHostnameService(db *gorm.DB, logger *utils.Logger) *PanelHostnameService {
+	certDir := os.Getenv("PANEL_CERT_DIR")
+	if certDir == "" {
+		certDir = "/opt/adminisoftware/certs"
+	}
+	return &PanelHostnameService{
+		db:            db,
+		logger:        logger,
+		certDir:       certDir,
+		certCommand:   os.Getenv("PANEL_CERT_COMMAND"),
+		vhostCommand:  os.Getenv("PANEL_VHOST_COMMAND"),
+		removeCommand: os.Getenv("PANEL_VHOST_REMOVE_COMMAND"),
+	}
+}
+
+// Get returns the reseller's panel hostname.
+func (s *PanelHostnameService) Get(resellerID uint) (*models.PanelHostname, error) {
+	var hostname models.PanelHostname
+	if err := s.db.Where("reseller_id = ?", resellerID).First(&hostname).Error; err != nil {
+		return nil, ErrPanelHostnameNotFound
+	}
+	return &hostname, nil
+}
+
+// List returns every reseller's panel hostname.
+func (s *PanelHostnameService) List() ([]models.PanelHostname, error) {
+	var hostnames []models.PanelHostname
+	if err := s.db.Order("hostname").Find(&hostnames).Error; err != nil {
+		return nil, fmt.Errorf("failed to load panel hostnames: %v", err)
+	}
+	return hostnames, nil
+}
+
+// Set gives the reseller a panel hostname, replacing any it had. The
+// hostname is left pending for StartRenewal to issue its certificate, so
+// only the node holding the renewal lease runs the certificate command.
+func (s *PanelHostnameService) Set(resellerID uint, name string) (*models.PanelHostname, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if !utils.IsValidDomain(name) || !strings.Contains(name, ".") {
+		return nil, ErrPanelHostnameInvalid
+	}
+	if frontend, err := url.Parse(os.Getenv("FRONTEND_URL")); err == nil && strings.EqualFold(frontend.Hostname(), name) {
+		return nil, ErrPanelHostnameTaken
+	}
+
+	var count int64
+	s.db.Model(&models.PanelHostname{}).Where("hostname = ? AND reseller_id <> ?", name, resellerID).Count(&count)
+	if count > 0 {
+		return nil, ErrPanelHostnameTaken
+	}
+	// A site hosted here under the same name, or under a domain of it,
+	// belongs to someone; only the reseller and its customers may hand it
+	// over to the panel
+	if hostedForOthers(s.db, resellerID, name) {
+		return nil, ErrPanelHostnameTaken
+	}
+
+	hostname, err := s.Get(resellerID)
+	if err == nil && hostname.Hostname == name && hostname.Status == PanelHostnameActive {
+		return hostname, nil
+	}
+	if err == nil {
+		if hostname.Hostname != name {
+			if err := s.removeVhost(hostname.Hostname); err != nil {
+				s.logger.Error(fmt.Sprintf("Failed to remove panel hostname %s: %v", hostname.Hostname, err))
+			}
+		}
+		if err := s.db.Model(hostname).Updates(map[string]interface{}{
+			"hostname":               name,
+			"status":                 PanelHostnamePending,
+			"last_error":             "",
+			"certificate_path":       "",
+			"key_path":               "",
+			"certificate_expires_at": nil,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to update panel hostname: %v", err)
+		}
+		s.db.First(hostname, hostname.ID)
+	} else {
+		hostname = &models.PanelHostname{ResellerID: resellerID, Hostname: name, Status: PanelHostnamePending}
+		if err := s.db.Create(hostname).Error; err != nil {
+			return nil, fmt.Errorf("failed to store panel hostname: %v", err)
+		}
+	}
+
+	return hostname, nil
+}
+
+// Remove stops serving the reseller's panel hostname.
+func (s *PanelHostnameService) Remove(resellerID uint) error {
+	hostname, err := s.Get(resellerID)
+	if err != nil {
+		return err
+	}
+	if err := s.removeVhost(hostname.Hostname); err != nil {
+		return err
+	}
+	if err := s.db.Delete(hostname).Error; err != nil {
+		return fmt.Errorf("failed to remove panel hostname: %v", err)
+	}
+	return nil
+}
+
+// Issue obtains a certificate for the hostname and installs its vhost. A
+// failure is recorded on the hostname and retried by StartRenewal.
+func (s *PanelHostnameService) Issue(id uint) error {
+	var hostname models.PanelHostname
+	if err := s.db.First(&hostname, id).Error; err != nil {
+		return ErrPanelHostnameNotFound
+	}
+	now := time.Now()
+	fail := func(err error) error {
+		s.db.Model(&hostname).Updates(map[string]interface{}{
+			"status":     PanelHostnameFailed,
+			"last_error": err.Error(),
+			"checked_at": now,
+		})
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	addresses, _ := net.DefaultResolver.LookupHost(ctx, hostname.Hostname)
+	cancel()
+	if len(addresses) == 0 {
+		return fail(ErrPanelHostnameUnknown)
+	}
+
+	updates := map[string]interface{}{
+		"status":     PanelHostnameActive,
+		"last_error": "",
+		"checked_at": now,
+	}
+	cert := filepath.Join(s.certDir, hostname.Hostname+".crt")
+	key := filepath.Join(s.certDir, hostname.Hostname+".key")
+	if s.certCommand != "" {
+		if err := os.MkdirAll(s.certDir, 0700); err != nil {
+			return fail(fmt.Errorf("failed to create %s: %v", s.certDir, err))
+		}
+		if err := s.run(s.certCommand, hostname.Hostname, cert, key); err != nil {
+			return fail(fmt.Errorf("certificate: %v", err))
+		}
+		expires, err := certificateExpiry(cert)
+		if err != nil {
+			return fail(err)
+		}
+		updates["certificate_path"] = cert
+		updates["key_path"] = key
+		updates["certificate_expires_at"] = expires
+	}
+	if s.vhostCommand != "" {
+		if err := s.run(s.vhostCommand, hostname.Hostname, cert, key); err != nil {
+			return fail(fmt.Errorf("vhost: %v", err))
+		}
+	}
+
+	if err := s.db.Model(&hostname).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update panel hostname: %v", err)
+	}
+	s.logger.Info(fmt.Sprintf("Panel hostname %s is active", hostname.Hostname))
+	return nil
+}
+
+// StartRenewal issues certificates for new hostnames, retries failed ones
+// after panelHostnameRetry and renews certificates due to expire.
+func (s *PanelHostnameService) StartRenewal(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !cluster.Leader(s.db, "panel-hostname-renewal", 2*interval) {
+			continue
+		}
+		now := time.Now()
+		var hostnames []models.PanelHostname
+		s.db.Where("status = ?", PanelHostnamePending).
+			Or("status = ? AND (checked_at IS NULL OR checked_at < ?)", PanelHostnameFailed, now.Add(-panelHostnameRetry)).
+			Or("status = ? AND certificate_expires_at < ?", PanelHostnameActive, now.Add(panelCertRenewBefore)).
+			Find(&hostnames)
+		for _, hostname := range hostnames {
+			s.issueLogged(hostname.ID)
+		}
+	}
+}
+
+// Branding returns the branding of the reseller whose panel hostname the
+// request came in on, with that reseller, or the default branding and nil.
+func (s *PanelHostnameService) Branding(host string) (models.Branding, *uint) {
+	resellerID := s.resellerFor(host)
+	return resellerBranding(s.db, resellerID), resellerID
+}
+
+func (s *PanelHostnameService) resellerFor(host string) *uint {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	var hostname models.PanelHostname
+	if err := s.db.Where("hostname = ? AND status = ?", strings.ToLower(host), PanelHostnameActive).
+		First(&hostname).Error; err != nil {
+		return nil
+	}
+	return &hostname.ResellerID
+}
+
+func (s *PanelHostnameService) issueLogged(id uint) {
+	if err := s.Issue(id); err != nil {
+		s.logger.Error(fmt.Sprintf("Panel hostname %d not issued: %v", id, err))
+	}
+}
+
+func (s *PanelHostnameService) removeVhost(hostname string) error {
+	if s.removeCommand == "" {
+		return nil
+	}
+	return s.run(s.removeCommand, hostname, "", "")
+}
+
+func (s *PanelHostnameService) run(command, hostname, cert, key string) error {
+	args := strings.Fields(command)
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{hostname}", hostname)
+		arg = strings.ReplaceAll(arg, "{cert}", cert)
+		args[i] = strings.ReplaceAll(arg, "{key}", key)
+	}
+	return runCommand(args[0], args[1:]...)
+}
+
+// PanelURL is the address a reseller's customers use to reach the panel:
+// its panel hostname when that is active, or FRONTEND_URL.
+func PanelURL(db *gorm.DB, resellerID *uint) string {
+	if resellerID != nil {
+		var hostname models.PanelHostname
+		if err := db.Where("reseller_id = ? AND status = ?", *resellerID, PanelHostnameActive).
+			First(&hostname).Error; err == nil {
+			return "https://" + hostname.Hostname
+		}
+	}
+	return strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+}
+
+// certificateExpiry reads when the PEM certificate at path expires.
+func certificateExpiry(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read certificate: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("%s is not a PEM certificate", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	return cert.NotAfter, nil
+}
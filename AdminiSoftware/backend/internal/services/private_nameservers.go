@@ -0,0 +1,419 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// nameserverTTL is the TTL of the NS and address records the panel writes.
+const nameserverTTL = 86400
+
+var (
+	ErrNameserverCount    = errors.New("set between two and four nameservers, or none to use the server's")
+	ErrNameserverHostname = errors.New("nameserver hostnames must be distinct hosts under a domain, such as ns1.example.com")
+	ErrNameserverAddress  = errors.New("each nameserver needs a valid IPv4 or IPv6 address")
+	ErrNameserverTaken    = errors.New("nameserver hostname is used by another reseller")
+	ErrNameserverForeign  = errors.New("nameserver hostname is under a domain hosted for another account")
+)
+
+// zoneDomainTypes are the domains that have zones of their own and so
+// carry NS records; subdomains live in their parent's zone.
+var zoneDomainTypes = []string{"primary", "addon", "parked"}
+
+// NameserverEntry is one of the nameservers a reseller sets.
+type NameserverEntry struct {
+	Hostname string `json:"hostname"`
+	IPv4     string `json:"ipv4"`
+	IPv6     string `json:"ipv6"`
+}
+
+// GlueInstruction tells a reseller what to register for one nameserver.
+// A nameserver under a domain it serves itself needs glue records at the
+// registrar of that domain; without them resolvers cannot find it.
+type GlueInstruction struct {
+	Hostname     string   `json:"hostname"`
+	Domain       string   `json:"domain"` // the domain the glue is registered for
+	IPv4         string   `json:"ipv4,omitempty"`
+	IPv6         string   `json:"ipv6,omitempty"`
+	HostedHere   bool     `json:"hosted_here"` // the domain's zone is on this server and has the address records
+	Resolves     bool     `json:"resolves"`    // the hostname already resolves to its addresses
+	Resolved     []string `json:"resolved"`
+	Instructions []string `json:"instructions"`
+}
+
+// NameserverService manages resellers' private nameservers and keeps the
+// NS records of their customers' zones on them. Customers of resellers
+// without private nameservers, and of administrators, get the server's
+// nameservers from DEFAULT_NAMESERVERS.
+type NameserverService struct {
+	db     *gorm.DB
+	logger *utils.Logger
+}
+
+func NewNameserverService(db *gorm.DB, logger *utils.Logger) *NameserverService {
+	return &NameserverService{db: db, logger: logger}
+}
+
+// Defaults returns the server's own nameservers.
+func (s *NameserverService) Defaults() []string {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("DEFAULT_NAMESERVERS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// For returns the nameservers zones of a reseller's customers use.
+func (s *NameserverService) For(resellerID *uint) []string {
+	if resellerID != nil {
+		var hosts []string
+		s.db.Model(&models.PrivateNameserver{}).Where("reseller_id = ?", *resellerID).
+			Order("position").Pluck("hostname", &hosts)
+		if len(hosts) > 0 {
+			return hosts
+		}
+	}
+	return s.Defaults()
+}
+
+// List returns the reseller's private nameservers in order.
+func (s *NameserverService) List(resellerID uint) ([]models.PrivateNameserver, error) {
+	var nameservers []models.PrivateNameserver
+	if err := s.db.Where("reseller_id = ?", resellerID).Order("position").Find(&nameservers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load nameservers: %v", err)
+	}
+	return nameservers, nil
+}
+
+// Set replaces the reseller's private nameservers and moves its customers'
+// zones onto them. Nameservers under a domain hosted here get their
+// address records in its zone. With no entries, the zones go back to the
+// server's nameservers.
+//
+// A hostname under a domain hosted here for anyone but the reseller and
+// its customers is refused. One under a domain hosted elsewhere is kept
+// unverified, and gives way to a reseller whose customers host the domain
+// here: that reseller's zones move back to the server's nameservers.
+func (s *NameserverService) Set(resellerID uint, entries []NameserverEntry) ([]models.PrivateNameserver, error) {
+	if len(entries) == 1 || len(entries) > 4 {
+		return nil, ErrNameserverCount
+	}
+
+	nameservers := make([]models.PrivateNameserver, 0, len(entries))
+	seen := map[string]bool{}
+	for i, entry := range entries {
+		hostname := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry.Hostname)), ".")
+		if !utils.IsValidDomain(hostname) || strings.Count(hostname, ".") < 2 || seen[hostname] {
+			return nil, ErrNameserverHostname
+		}
+		seen[hostname] = true
+
+		ipv4, ipv6 := strings.TrimSpace(entry.IPv4), strings.TrimSpace(entry.IPv6)
+		if ipv4 == "" && ipv6 == "" {
+			return nil, ErrNameserverAddress
+		}
+		if ip := net.ParseIP(ipv4); ipv4 != "" && (ip == nil || ip.To4() == nil) {
+			return nil, ErrNameserverAddress
+		}
+		if ip := net.ParseIP(ipv6); ipv6 != "" && (ip == nil || ip.To4() != nil) {
+			return nil, ErrNameserverAddress
+		}
+
+		_, hosted := s.parentDomain(resellerID, hostname)
+		if hosted == nil && hostedForOthers(s.db, resellerID, hostname) {
+			return nil, ErrNameserverForeign
+		}
+		taken := s.db.Model(&models.PrivateNameserver{}).Where("hostname = ? AND reseller_id <> ?", hostname, resellerID)
+		if hosted != nil {
+			taken = taken.Where("verified")
+		}
+		var count int64
+		taken.Count(&count)
+		if count > 0 {
+			return nil, ErrNameserverTaken
+		}
+		nameservers = append(nameservers, models.PrivateNameserver{
+			ResellerID: resellerID,
+			Position:   i + 1,
+			Hostname:   hostname,
+			IPv4:       ipv4,
+			IPv6:       ipv6,
+			Verified:   hosted != nil,
+		})
+	}
+
+	var displaced []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("reseller_id = ?", resellerID).Delete(&models.PrivateNameserver{}).Error; err != nil {
+			return fmt.Errorf("failed to remove nameservers: %v", err)
+		}
+		for _, nameserver := range nameservers {
+			if !nameserver.Verified {
+				continue
+			}
+			var squatters []models.PrivateNameserver
+			if err := tx.Where("hostname = ? AND NOT verified", nameserver.Hostname).Find(&squatters).Error; err != nil {
+				return fmt.Errorf("failed to load nameservers: %v", err)
+			}
+			for _, squatter := range squatters {
+				displaced = append(displaced, squatter.ResellerID)
+				if err := tx.Where("reseller_id = ?", squatter.ResellerID).Delete(&models.PrivateNameserver{}).Error; err != nil {
+					return fmt.Errorf("failed to remove nameservers of reseller %d: %v", squatter.ResellerID, err)
+				}
+			}
+		}
+		if len(nameservers) > 0 {
+			if err := tx.Create(&nameservers).Error; err != nil {
+				return fmt.Errorf("failed to store nameservers: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range displaced {
+		s.logger.Info(fmt.Sprintf("Reseller %d lost unverified nameservers to reseller %d", id, resellerID))
+		if _, err := s.Apply(id); err != nil {
+			s.logger.Error(err.Error())
+		}
+	}
+	for _, nameserver := range nameservers {
+		if err := s.publishAddresses(resellerID, nameserver); err != nil {
+			s.logger.Error(err.Error())
+		}
+	}
+	if _, err := s.Apply(resellerID); err != nil {
+		return nameservers, err
+	}
+	return nameservers, nil
+}
+
+// Apply puts the reseller's nameservers on every zone of its customers
+// and returns how many zones changed.
+func (s *NameserverService) Apply(resellerID uint) (int, error) {
+	var domainIDs []uint
+	if err := s.db.Model(&models.Domain{}).
+		Joins("JOIN users ON users.id = domains.user_id").
+		Where("users.reseller_id = ? AND domains.type IN ?", resellerID, zoneDomainTypes).
+		Pluck("domains.id", &domainIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to load customer domains: %v", err)
+	}
+	id := resellerID
+	return s.applyToDomains(domainIDs, s.For(&id))
+}
+
+// ApplyToDomain gives a new zone the nameservers of its owner's reseller.
+func (s *NameserverService) ApplyToDomain(domain *models.Domain) error {
+	if !containsString(zoneDomainTypes, domain.Type) {
+		return nil
+	}
+	var owner models.User
+	if err := s.db.First(&owner, domain.UserID).Error; err != nil {
+		return fmt.Errorf("failed to load owner of %s: %v", domain.Name, err)
+	}
+	_, err := s.applyToDomains([]uint{domain.ID}, s.For(owner.ResellerID))
+	return err
+}
+
+// Glue returns what the reseller has to register for each of its
+// nameservers, and whether each already resolves.
+func (s *NameserverService) Glue(resellerID uint) ([]GlueInstruction, error) {
+	nameservers, err := s.List(resellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions := make([]GlueInstruction, 0, len(nameservers))
+	for _, nameserver := range nameservers {
+		domain, hosted := s.parentDomain(resellerID, nameserver.Hostname)
+		glue := GlueInstruction{
+			Hostname:   nameserver.Hostname,
+			Domain:     domain,
+			IPv4:       nameserver.IPv4,
+			IPv6:       nameserver.IPv6,
+			HostedHere: hosted != nil,
+		}
+
+		var addresses []string
+		for _, address := range []string{nameserver.IPv4, nameserver.IPv6} {
+			if address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+		glue.Instructions = append(glue.Instructions, fmt.Sprintf(
+			"At the registrar of %s, register the child nameserver (glue record) %s with %s.",
+			domain, nameserver.Hostname, strings.Join(addresses, " and ")))
+		if hosted == nil {
+			glue.Instructions = append(glue.Instructions, fmt.Sprintf(
+				"In the DNS of %s, add address records for %s pointing at %s.",
+				domain, nameserver.Hostname, strings.Join(addresses, " and ")))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		resolved, _ := net.DefaultResolver.LookupHost(ctx, nameserver.Hostname)
+		cancel()
+		glue.Resolved = resolved
+		glue.Resolves = len(resolved) > 0
+		for _, address := range addresses {
+			if !containsString(resolved, net.ParseIP(address).String()) {
+				glue.Resolves = false
+			}
+		}
+		if !glue.Resolves {
+			glue.Instructions = append(glue.Instructions, fmt.Sprintf(
+				"%s does not resolve to its addresses yet; registrars can take up to 48 hours to publish glue.",
+				nameserver.Hostname))
+		}
+		instructions = append(instructions, glue)
+	}
+	return instructions, nil
+}
+
+// applyToDomains replaces the apex NS records of the domains' zones with
+// hosts, leaving zones that already have them untouched.
+func (s *NameserverService) applyToDomains(domainIDs []uint, hosts []string) (int, error) {
+	if len(domainIDs) == 0 || len(hosts) == 0 {
+		return 0, nil
+	}
+
+	var records []models.DNS
+	if err := s.db.Where("domain_id IN ? AND type = ? AND name IN ?", domainIDs, "NS", []string{"@", ""}).
+		Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("failed to load NS records: %v", err)
+	}
+	current := map[uint][]string{}
+	for _, record := range records {
+		current[record.DomainID] = append(current[record.DomainID], strings.TrimSuffix(strings.ToLower(record.Value), "."))
+	}
+
+	want := append([]string(nil), hosts...)
+	sort.Strings(want)
+	var changed []uint
+	for _, id := range domainIDs {
+		have := current[id]
+		sort.Strings(have)
+		if strings.Join(have, " ") != strings.Join(want, " ") {
+			changed = append(changed, id)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("domain_id IN ? AND type = ? AND name IN ?", changed, "NS", []string{"@", ""}).
+			Delete(&models.DNS{}).Error; err != nil {
+			return fmt.Errorf("failed to remove NS records: %v", err)
+		}
+		created := make([]models.DNS, 0, len(changed)*len(hosts))
+		for _, id := range changed {
+			for _, host := range hosts {
+				created = append(created, models.DNS{
+					DomainID: id,
+					Name:     "@",
+					Type:     "NS",
+					Value:    host,
+					TTL:      nameserverTTL,
+					Status:   "active",
+				})
+			}
+		}
+		if err := tx.CreateInBatches(&created, 500).Error; err != nil {
+			return fmt.Errorf("failed to create NS records: %v", err)
+		}
+		return bumpZoneSerials(tx, changed)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
+
+// publishAddresses writes the nameserver's A and AAAA records into the
+// zone of its domain when the reseller or one of its customers hosts that
+// domain here.
+func (s *NameserverService) publishAddresses(resellerID uint, nameserver models.PrivateNameserver) error {
+	_, domain := s.parentDomain(resellerID, nameserver.Hostname)
+	if domain == nil {
+		return nil
+	}
+	label := strings.TrimSuffix(nameserver.Hostname, "."+domain.Name)
+
+	for recordType, address := range map[string]string{"A": nameserver.IPv4, "AAAA": nameserver.IPv6} {
+		if address == "" {
+			continue
+		}
+		if err := s.db.Where("domain_id = ? AND name = ? AND type = ?", domain.ID, label, recordType).
+			Delete(&models.DNS{}).Error; err != nil {
+			return fmt.Errorf("failed to replace %s record of %s: %v", recordType, nameserver.Hostname, err)
+		}
+		if err := s.db.Create(&models.DNS{
+			DomainID: domain.ID,
+			Name:     label,
+			Type:     recordType,
+			Value:    address,
+			TTL:      nameserverTTL,
+			Status:   "active",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to create %s record of %s: %v", recordType, nameserver.Hostname, err)
+		}
+	}
+	return bumpZoneSerials(s.db, []uint{domain.ID})
+}
+
+// parentDomain returns the domain a nameserver host is under: the closest
+// one the reseller or its customers host here, or else the hostname less
+// its first label.
+func (s *NameserverService) parentDomain(resellerID uint, hostname string) (string, *models.Domain) {
+	labels := strings.Split(hostname, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+		var domain models.Domain
+		if err := s.db.Joins("JOIN users ON users.id = domains.user_id").
+			Where("domains.name = ? AND (users.id = ? OR users.reseller_id = ?)", name, resellerID, resellerID).
+			First(&domain).Error; err == nil {
+			return name, &domain
+		}
+	}
+	return strings.Join(labels[1:], "."), nil
+}
+
+// hostedForOthers reports whether the hostname, or a domain it is under,
+// is hosted here for an account that is neither the reseller nor one of
+// its customers.
+func hostedForOthers(db *gorm.DB, resellerID uint, hostname string) bool {
+	labels := strings.Split(hostname, ".")
+	names := make([]string, 0, len(labels))
+	for i := 0; i < len(labels)-1; i++ {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+
+	var count int64
+	db.Model(&models.Domain{}).Joins("JOIN users ON users.id = domains.user_id").
+		Where("domains.name IN ? AND users.id <> ? AND (users.reseller_id IS NULL OR users.reseller_id <> ?)", names, resellerID, resellerID).
+		Count(&count)
+	return count > 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostedForOthers(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.Domain{})
+
+	name := testutil.UniqueName("hosted")
+	reseller := &models.User{Username: name + "r", Email: name + "r@example.com", Password: "x", Role: "reseller", Status: "active"}
+	require.NoError(t, db.Create(reseller).Error)
+	customer := &models.User{Username: name + "c", Email: name + "c@example.com", Password: "x", Role: "user", Status: "active", ResellerID: &reseller.ID}
+	require.NoError(t, db.Create(customer).Error)
+	stranger := &models.User{Username: name + "s", Email: name + "s@example.com", Password: "x", Role: "user", Status: "active"}
+	require.NoError(t, db.Create(stranger).Error)
+
+	own := &models.Domain{UserID: customer.ID, Name: name + "-own.example", Type: "primary"}
+	foreign := &models.Domain{UserID: stranger.ID, Name: name + "-foreign.example", Type: "primary"}
+	require.NoError(t, db.Create(own).Error)
+	require.NoError(t, db.Create(foreign).Error)
+	defer func() {
+		db.Unscoped().Delete(own)
+		db.Unscoped().Delete(foreign)
+		db.Unscoped().Delete(stranger)
+		db.Unscoped().Delete(customer)
+		db.Unscoped().Delete(reseller)
+	}()
+
+	assert.False(t, hostedForOthers(db, reseller.ID, "ns1."+own.Name), "a customer's domain is the reseller's to use")
+	assert.False(t, hostedForOthers(db, reseller.ID, "ns1."+name+"-elsewhere.example"))
+	assert.True(t, hostedForOthers(db, reseller.ID, foreign.Name))
+	assert.True(t, hostedForOthers(db, reseller.ID, "panel."+foreign.Name), "subdomains of another account's domain are refused")
+	assert.True(t, hostedForOthers(db, reseller.ID, "a.b."+foreign.Name))
+	assert.False(t, hostedForOthers(db, stranger.ID, "panel."+foreign.Name))
+}
@@ -0,0 +1,518 @@
+package services
+
+import (
+	"AdminiSoftware/internal/auth"
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Provisioning actions, recorded as the last action on a service.
+const (
+	ProvisionCreate         = "create"
+	ProvisionSuspend        = "suspend"
+	ProvisionUnsuspend      = "unsuspend"
+	ProvisionTerminate      = "terminate"
+	ProvisionChangePackage  = "change_package"
+	ProvisionChangePassword = "change_password"
+	ProvisionLogin          = "login"
+)
+
+// staleProvisioning is how long a create may hold a service ID before
+// another request may assume it died and take the ID over.
+const staleProvisioning = 10 * time.Minute
+
+var (
+	ErrServiceNotFound   = errors.New("service not found")
+	ErrServiceInProgress = errors.New("service is still being provisioned, try again shortly")
+	ErrServiceConflict   = errors.New("service ID is already provisioned as another account")
+	ErrServiceTerminated = errors.New("service has been terminated")
+	ErrServicePackage    = errors.New("a package ID or name is required")
+)
+
+// ProvisionRequest is a create call from a billing module. The package is
+// given by ID or, as billing products usually refer to it, by name.
+type ProvisionRequest struct {
+	ServiceID string
+	Username  string
+	Email     string
+	Password  string
+	Domain    string
+	PackageID uint
+	Package   string
+}
+
+// ServiceUsage is what a billing system's usage update pulls for a
+// service. Disk use is the latest figure, bandwidth this month's total; a
+// limit of 0 means unlimited.
+type ServiceUsage struct {
+	ServiceID        string       `json:"service_id"`
+	UserID           uint         `json:"user_id"`
+	Username         string       `json:"username"`
+	Status           string       `json:"status"`
+	Package          string       `json:"package"`
+	DiskUsedMB       int64        `json:"disk_used_mb"`
+	DiskLimitMB      int64        `json:"disk_limit_mb"`
+	BandwidthUsedMB  int64        `json:"bandwidth_used_mb"`
+	BandwidthLimitMB int64        `json:"bandwidth_limit_mb"`
+	Quotas           []QuotaUsage `json:"quotas,omitempty"`
+}
+
+// ProvisioningService carries out what billing modules such as WHMCS and
+// Blesta ask of a hosting server. Every call names the billing system's
+// service ID and may be repeated: creating a service that exists returns
+// its account, and suspending a suspended account or terminating a
+// terminated one succeeds without doing anything.
+//
+// Services are kept apart per reseller, so a reseller's billing system only
+// sees the services it created. resellerID is 0 for administrators.
+type ProvisioningService struct {
+	db        *gorm.DB
+	accounts  *AccountService
+	packages  *PackageChangeService
+	lifecycle *AccountLifecycle
+	quotas    *QuotaService
+	logins    *auth.SSOLoginManager
+	logger    *utils.Logger
+}
+
+func NewProvisioningService(db *gorm.DB, logger *utils.Logger) *ProvisioningService {
+	return &ProvisioningService{
+		db:        db,
+		accounts:  NewAccountService(db, logger),
+		packages:  NewPackageChangeService(db, logger),
+		lifecycle: NewAccountLifecycle(db, logger),
+		quotas:    NewQuotaService(db),
+		logins:    auth.NewSSOLoginManager(db),
+		logger:    logger,
+	}
+}
+
+// Create provisions the service's account. If the service already exists
+// as an account of the same username, that account is returned and created
+// is false. A create that died after making the account but before linking
+// it leaves an account of the username, made for the same reseller since
+// the service was claimed and linked to no other service; a retry adopts it.
+func (s *ProvisioningService) Create(resellerID uint, req ProvisionRequest) (service *models.ProvisionedService, created bool, err error) {
+	pkg, err := s.resolvePackage(resellerID, req.PackageID, req.Package)
+	if err != nil {
+		return nil, false, err
+	}
+
+	service, err = s.claim(resellerID, req.ServiceID)
+	if err != nil {
+		return nil, false, err
+	}
+	if service.UserID != nil {
+		if service.User.Username != req.Username {
+			return nil, false, ErrServiceConflict
+		}
+		if service.User.Status == AccountTerminated || service.User.Status == AccountPurged {
+			return nil, false, ErrServiceTerminated
+		}
+		return service, false, nil
+	}
+
+	// Only a create taken over from one that died can have left an account
+	orphan, err := s.orphan(resellerID, service, req.Username)
+	if err != nil {
+		return nil, false, err
+	}
+	if orphan != nil {
+		if err := s.link(service, orphan); err != nil {
+			return nil, false, err
+		}
+		s.record(service, ProvisionCreate)
+		s.logger.Info(fmt.Sprintf("Service %s adopted account %s left by an interrupted create", req.ServiceID, orphan.Username))
+		return service, true, nil
+	}
+
+	account := NewAccount{
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  req.Password,
+		Domain:    req.Domain,
+		PackageID: &pkg.ID,
+	}
+	if resellerID != 0 {
+		account.ResellerID = &resellerID
+	}
+	user, err := s.accounts.Provision(account)
+	if err != nil {
+		// Release the ID so the billing system can retry with corrected data
+		s.db.Delete(&models.ProvisionedService{}, service.ID)
+		return nil, false, err
+	}
+
+	if err := s.link(service, user); err != nil {
+		return nil, false, err
+	}
+	s.record(service, ProvisionCreate)
+	s.logger.Info(fmt.Sprintf("Service %s provisioned as account %s", req.ServiceID, user.Username))
+	return service, true, nil
+}
+
+// Get returns the service with its account.
+func (s *ProvisioningService) Get(resellerID uint, serviceID string) (*models.ProvisionedService, error) {
+	return s.service(resellerID, serviceID)
+}
+
+// Suspend suspends the service's account. changed is false if it already
+// was.
+func (s *ProvisioningService) Suspend(resellerID uint, serviceID, reason string, actorID uint) (bool, error) {
+	return s.transition(resellerID, serviceID, AccountSuspended, ProvisionSuspend, reason, actorID)
+}
+
+// Unsuspend reactivates the service's account.
+func (s *ProvisioningService) Unsuspend(resellerID uint, serviceID string, actorID uint) (bool, error) {
+	return s.transition(resellerID, serviceID, AccountActive, ProvisionUnsuspend, "", actorID)
+}
+
+// Terminate terminates the service's account, which is purged once its
+// grace period ends.
+func (s *ProvisioningService) Terminate(resellerID uint, serviceID, reason string, actorID uint) (bool, error) {
+	return s.transition(resellerID, serviceID, AccountTerminated, ProvisionTerminate, reason, actorID)
+}
+
+// ChangePackage moves the service's account to a package. Moving it to the
+// package it has succeeds without a change.
+func (s *ProvisioningService) ChangePackage(resellerID uint, serviceID string, packageID uint, packageName string, force bool, actorID uint) (*PackageChangeResult, error) {
+	service, err := s.live(resellerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := s.resolvePackage(resellerID, packageID, packageName)
+	if err != nil {
+		return nil, err
+	}
+	if service.User.PackageID != nil && *service.User.PackageID == pkg.ID {
+		return nil, nil
+	}
+
+	result, err := s.packages.Change(service.User.ID, pkg.ID, PackageChangeOptions{
+		ActorID: actorID,
+		Force:   force,
+		Reason:  "billing service " + serviceID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.record(service, ProvisionChangePackage)
+	return result, nil
+}
+
+// ChangePassword sets the panel password of the service's account.
+func (s *ProvisioningService) ChangePassword(resellerID uint, serviceID, password string) error {
+	service, err := s.live(resellerID, serviceID)
+	if err != nil {
+		return err
+	}
+	if err := s.accounts.SetPassword(service.User.ID, password); err != nil {
+		return err
+	}
+	s.record(service, ProvisionChangePassword)
+	return nil
+}
+
+// LoginURL returns a one-time link that signs the customer into the panel,
+// for the client area's login button. Accounts with a second factor get
+// auth.ErrSSOLoginMFA and must sign in themselves.
+func (s *ProvisioningService) LoginURL(resellerID uint, serviceID string, tokenID uint, clientIP string) (string, time.Duration, error) {
+	service, err := s.live(resellerID, serviceID)
+	if err != nil {
+		return "", 0, err
+	}
+	if service.User.Status != AccountActive {
+		return "", 0, ErrAccountNotActive
+	}
+
+	token, err := s.logins.Issue(service.User, tokenID, clientIP)
+	if err != nil {
+		return "", 0, err
+	}
+	s.record(service, ProvisionLogin)
+	loginURL := PanelURL(s.db, service.User.ResellerID) + "/sso?token=" + url.QueryEscape(token)
+	return loginURL, s.logins.TTL(), nil
+}
+
+// Usage reports the service's use against its package.
+func (s *ProvisioningService) Usage(resellerID uint, serviceID string) (*ServiceUsage, error) {
+	service, err := s.service(resellerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.usage([]models.ProvisionedService{*service})
+	if err != nil {
+		return nil, err
+	}
+	if quotas, err := s.quotas.Usage(service.User.ID); err == nil {
+		usage[0].Quotas = quotas
+	}
+	return &usage[0], nil
+}
+
+// UsageAll reports every live service of the reseller, as a usage update
+// run pulls them.
+func (s *ProvisioningService) UsageAll(resellerID uint) ([]ServiceUsage, error) {
+	var services []models.ProvisionedService
+	if err := s.db.Preload("User").Preload("User.Package").
+		Joins("JOIN users ON users.id = provisioned_services.user_id AND users.deleted_at IS NULL").
+		Where("provisioned_services.reseller_id = ?", resellerID).
+		Order("provisioned_services.id").Find(&services).Error; err != nil {
+		return nil, fmt.Errorf("failed to load services: %v", err)
+	}
+	return s.usage(services)
+}
+
+// ProvisioningErrorStatus returns the status a handler answers a
+// provisioning error with.
+func ProvisioningErrorStatus(err error) (int, bool) {
+	var downgrade *PackageDowngradeError
+	switch {
+	case errors.Is(err, ErrServiceNotFound), errors.Is(err, ErrPackageNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, ErrServiceInProgress), errors.Is(err, ErrServiceConflict), errors.Is(err, ErrServiceTerminated),
+		errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrEmailTaken), errors.Is(err, ErrDomainTaken),
+		errors.Is(err, ErrPasswordNotSettable), errors.Is(err, ErrAccountNotActive), errors.Is(err, auth.ErrSSOLoginMFA),
+		errors.As(err, &downgrade):
+		return http.StatusConflict, true
+	case errors.Is(err, ErrServicePackage), errors.Is(err, ErrPackageInactive):
+		return http.StatusBadRequest, true
+	}
+	if status, ok := ResellerPoolErrorStatus(err); ok {
+		return status, true
+	}
+	return AccountLifecycleErrorStatus(err)
+}
+
+// claim reserves the service ID for a create. If the ID is taken, the
+// existing service is returned with its account, unless another create of
+// it is still running.
+func (s *ProvisioningService) claim(resellerID uint, serviceID string) (*models.ProvisionedService, error) {
+	service := &models.ProvisionedService{ResellerID: resellerID, ServiceID: serviceID}
+	createErr := s.db.Create(service).Error
+	if createErr == nil {
+		return service, nil
+	}
+
+	var existing models.ProvisionedService
+	if err := s.db.Where("reseller_id = ? AND service_id = ?", resellerID, serviceID).First(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to reserve service %s: %v", serviceID, createErr)
+	}
+	if existing.UserID == nil {
+		// Take over a create that died, if no one else did first
+		result := s.db.Model(&models.ProvisionedService{}).
+			Where("id = ? AND user_id IS NULL AND updated_at < ?", existing.ID, time.Now().Add(-staleProvisioning)).
+			Update("updated_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return nil, ErrServiceInProgress
+		}
+		return &existing, nil
+	}
+
+	var user models.User
+	if err := s.db.Unscoped().First(&user, *existing.UserID).Error; err != nil {
+		return nil, ErrServiceTerminated
+	}
+	existing.User = &user
+	return &existing, nil
+}
+
+// orphan finds the account an interrupted create of the service made: one
+// of the username and reseller, created since the service was claimed and
+// not linked to any service.
+func (s *ProvisioningService) orphan(resellerID uint, service *models.ProvisionedService, username string) (*models.User, error) {
+	if time.Since(service.CreatedAt) < staleProvisioning {
+		return nil, nil
+	}
+	query := s.db.Where("username = ? AND role = ? AND created_at >= ?", username, "user", service.CreatedAt)
+	if resellerID != 0 {
+		query = query.Where("reseller_id = ?", resellerID)
+	} else {
+		query = query.Where("reseller_id IS NULL")
+	}
+	var user models.User
+	err := query.Where("NOT EXISTS (SELECT 1 FROM provisioned_services WHERE provisioned_services.user_id = users.id)").
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for an account of service %s: %v", service.ServiceID, err)
+	}
+	return &user, nil
+}
+
+// link records the service's account.
+func (s *ProvisioningService) link(service *models.ProvisionedService, user *models.User) error {
+	result := s.db.Model(&models.ProvisionedService{}).Where("id = ? AND user_id IS NULL", service.ID).Update("user_id", user.ID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to link service %s to account %d: %v", service.ServiceID, user.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrServiceInProgress
+	}
+	service.UserID = &user.ID
+	service.User = user
+	return nil
+}
+
+// service finds a provisioned service with its account, including one
+// that has been purged.
+func (s *ProvisioningService) service(resellerID uint, serviceID string) (*models.ProvisionedService, error) {
+	var service models.ProvisionedService
+	if err := s.db.Where("reseller_id = ? AND service_id = ? AND user_id IS NOT NULL", resellerID, serviceID).
+		First(&service).Error; err != nil {
+		return nil, ErrServiceNotFound
+	}
+
+	var user models.User
+	if err := s.db.Unscoped().Preload("Package").First(&user, *service.UserID).Error; err != nil {
+		return nil, ErrServiceNotFound
+	}
+	if user.Status == "" {
+		user.Status = AccountActive
+	}
+	service.User = &user
+	return &service, nil
+}
+
+// live finds a service whose account has not been terminated.
+func (s *ProvisioningService) live(resellerID uint, serviceID string) (*models.ProvisionedService, error) {
+	service, err := s.service(resellerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if service.User.Status == AccountTerminated || service.User.Status == AccountPurged {
+		return nil, ErrServiceTerminated
+	}
+	return service, nil
+}
+
+func (s *ProvisioningService) transition(resellerID uint, serviceID, to, action, reason string, actorID uint) (bool, error) {
+	service, err := s.service(resellerID, serviceID)
+	if err != nil {
+		return false, err
+	}
+
+	status := service.User.Status
+	switch {
+	case status == to, to == AccountTerminated && status == AccountPurged:
+		return false, nil
+	case status == AccountTerminated || status == AccountPurged:
+		return false, ErrServiceTerminated
+	}
+
+	if reason == "" {
+		reason = "billing service " + serviceID
+	}
+	if _, err := s.lifecycle.Transition(service.User.ID, to, reason, actorID); err != nil {
+		return false, err
+	}
+	s.record(service, action)
+	s.logger.Info(fmt.Sprintf("Service %s (%s): %s", serviceID, service.User.Username, action))
+	return true, nil
+}
+
+// resolvePackage finds the package a billing product names. A reseller may
+// name its own packages and the administrators'; its allocation decides
+// which of those it may use.
+func (s *ProvisioningService) resolvePackage(resellerID, packageID uint, name string) (*models.Package, error) {
+	query := s.db.Model(&models.Package{})
+	switch {
+	case packageID != 0:
+		query = query.Where("id = ?", packageID)
+	case name != "":
+		query = query.Where("name = ?", name)
+	default:
+		return nil, ErrServicePackage
+	}
+	if resellerID != 0 {
+		query = query.Where("reseller_id IS NULL OR reseller_id = ?", resellerID)
+	}
+
+	var pkg models.Package
+	if err := query.First(&pkg).Error; err != nil {
+		return nil, ErrPackageNotFound
+	}
+	return &pkg, nil
+}
+
+func (s *ProvisioningService) record(service *models.ProvisionedService, action string) {
+	now := time.Now()
+	service.LastAction = action
+	service.LastActionAt = &now
+	if err := s.db.Model(service).Updates(map[string]interface{}{
+		"last_action":    action,
+		"last_action_at": now,
+	}).Error; err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to record %s of service %s: %v", action, service.ServiceID, err))
+	}
+}
+
+// usage reads disk and bandwidth use of the services' accounts in two
+// queries.
+func (s *ProvisioningService) usage(services []models.ProvisionedService) ([]ServiceUsage, error) {
+	userIDs := make([]uint, 0, len(services))
+	for _, service := range services {
+		userIDs = append(userIDs, *service.UserID)
+	}
+
+	type figure struct {
+		UserID uint
+		Total  int64
+	}
+	disk := map[uint]int64{}
+	bandwidth := map[uint]int64{}
+	if len(userIDs) > 0 {
+		var figures []figure
+		if err := s.db.Raw(`SELECT stats.user_id, stats.disk_usage_mb AS total FROM stats
+			WHERE stats.user_id IN ? AND stats.deleted_at IS NULL
+			AND stats.date = (SELECT MAX(latest.date) FROM stats latest WHERE latest.user_id = stats.user_id AND latest.deleted_at IS NULL)`,
+			userIDs).Scan(&figures).Error; err != nil {
+			return nil, fmt.Errorf("failed to read disk use: %v", err)
+		}
+		for _, f := range figures {
+			disk[f.UserID] = f.Total
+		}
+
+		now := time.Now()
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		figures = nil
+		if err := s.db.Model(&models.Stats{}).
+			Select("user_id, COALESCE(SUM(bandwidth_mb), 0) AS total").
+			Where("user_id IN ? AND date >= ?", userIDs, monthStart).
+			Group("user_id").Scan(&figures).Error; err != nil {
+			return nil, fmt.Errorf("failed to read bandwidth: %v", err)
+		}
+		for _, f := range figures {
+			bandwidth[f.UserID] = f.Total
+		}
+	}
+
+	usage := make([]ServiceUsage, 0, len(services))
+	for _, service := range services {
+		user := service.User
+		entry := ServiceUsage{
+			ServiceID:       service.ServiceID,
+			UserID:          user.ID,
+			Username:        user.Username,
+			Status:          user.Status,
+			DiskUsedMB:      disk[user.ID],
+			BandwidthUsedMB: bandwidth[user.ID],
+		}
+		if user.Package != nil {
+			entry.Package = user.Package.Name
+			entry.DiskLimitMB = int64(user.Package.DiskQuotaMB)
+			entry.BandwidthLimitMB = int64(user.Package.BandwidthMB)
+		}
+		usage = append(usage, entry)
+	}
+	return usage, nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisioningAdoptsOrphan(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.ProvisionedService{})
+
+	name := testutil.UniqueName("orphan")
+	reseller := uint(time.Now().UnixNano() % 1000000)
+	claimed := time.Now().Add(-2 * staleProvisioning)
+	service := &models.ProvisionedService{ResellerID: reseller, ServiceID: name, CreatedAt: claimed}
+	require.NoError(t, db.Create(service).Error)
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "user", Status: "active", ResellerID: &reseller}
+	require.NoError(t, db.Create(user).Error)
+	defer func() {
+		db.Where("reseller_id = ?", reseller).Delete(&models.ProvisionedService{})
+		db.Unscoped().Delete(user)
+	}()
+
+	s := &ProvisioningService{db: db}
+
+	// A create still within its window is left alone
+	fresh := &models.ProvisionedService{ResellerID: reseller, ServiceID: name + "-fresh", CreatedAt: time.Now()}
+	orphan, err := s.orphan(reseller, fresh, name)
+	require.NoError(t, err)
+	assert.Nil(t, orphan)
+
+	orphan, err = s.orphan(reseller+1, service, name)
+	require.NoError(t, err)
+	assert.Nil(t, orphan, "another reseller's account is not adopted")
+
+	orphan, err = s.orphan(reseller, service, name)
+	require.NoError(t, err)
+	require.NotNil(t, orphan)
+	assert.Equal(t, user.ID, orphan.ID)
+
+	require.NoError(t, s.link(service, orphan))
+	assert.Equal(t, user.ID, *service.UserID)
+	assert.ErrorIs(t, s.link(service, orphan), ErrServiceInProgress, "a service is linked once")
+
+	// Once linked, the account is no longer an orphan of any service
+	other := &models.ProvisionedService{ResellerID: reseller, ServiceID: name + "-other", CreatedAt: claimed}
+	require.NoError(t, db.Create(other).Error)
+	orphan, err = s.orphan(reseller, other, name)
+	require.NoError(t, err)
+	assert.Nil(t, orphan)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Resources limited by an account's package.
+const (
+	QuotaEmailAccounts   = "email_accounts"
+	QuotaDatabases       = "databases"
+	QuotaSubdomains      = "subdomains"
+	QuotaAddonDomains    = "addon_domains"
+	QuotaParkedDomains   = "parked_domains"
+	QuotaCronJobs        = "cron_jobs"
+	QuotaSSLCertificates = "ssl_certificates"
+)
+
+var (
+	ErrUnknownQuota     = errors.New("unknown quota resource")
+	ErrAccountNotActive = errors.New("account is not active")
+	ErrSSLNotInPackage  = errors.New("SSL certificates are not included in your package")
+)
+
+// QuotaExceededError is returned when creating a resource would take the
+// account past its package limit.
+type QuotaExceededError struct {
+	Resource string
+	Limit    int
+	Used     int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s limit reached: %d of %d used, upgrade your package to add more",
+		quotaResources[e.Resource].label, e.Used, e.Limit)
+}
+
+// QuotaUsage is an account's use of one resource against its limit.
+type QuotaUsage struct {
+	Resource  string `json:"resource"`
+	Used      int64  `json:"used"`
+	Limit     int    `json:"limit"`
+	Unlimited bool   `json:"unlimited"`
+}
+
+type quotaResource struct {
+	label string
+	limit func(pkg *models.Package) int
+	count func(tx *gorm.DB, userID uint) *gorm.DB
+}
+
+// quotaResources says how each resource is limited and counted.
+var quotaResources = map[string]quotaResource{
+	QuotaEmailAccounts: {
+		label: "Email account",
+		limit: func(pkg *models.Package) int { return pkg.EmailAccounts },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.Email{}).Where("user_id = ?", userID)
+		},
+	},
+	QuotaDatabases: {
+		label: "Database",
+		limit: func(pkg *models.Package) int { return pkg.Databases },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.Database{}).Where("user_id = ?", userID)
+		},
+	},
+	QuotaSubdomains: {
+		label: "Subdomain",
+		limit: func(pkg *models.Package) int { return pkg.SubDomains },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.Domain{}).Where("user_id = ? AND type = ?", userID, "subdomain")
+		},
+	},
+	QuotaAddonDomains: {
+		label: "Addon domain",
+		limit: func(pkg *models.Package) int { return pkg.AddonDomains },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.Domain{}).Where("user_id = ? AND type = ?", userID, "addon")
+		},
+	},
+	QuotaParkedDomains: {
+		label: "Parked domain",
+		limit: func(pkg *models.Package) int { return pkg.ParkedDomains },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.Domain{}).Where("user_id = ? AND type = ?", userID, "parked")
+		},
+	},
+	QuotaCronJobs: {
+		label: "Cron job",
+		limit: func(pkg *models.Package) int { return pkg.CronJobs },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.CronJob{}).Where("user_id = ?", userID)
+		},
+	},
+	QuotaSSLCertificates: {
+		label: "SSL certificate",
+		limit: func(pkg *models.Package) int { return pkg.SSLCertificates },
+		count: func(tx *gorm.DB, userID uint) *gorm.DB {
+			return tx.Model(&models.SSL{}).Where("user_id = ?", userID)
+		},
+	},
+}
+
+// QuotaNames lists the resources in the order usage is reported.
+func QuotaNames() []string {
+	return []string{
+		QuotaEmailAccounts, QuotaDatabases, QuotaSubdomains, QuotaAddonDomains,
+		QuotaParkedDomains, QuotaCronJobs, QuotaSSLCertificates,
+	}
+}
+
+// QuotaService enforces package limits. Every path that creates a limited
+// resource goes through Create, which counts and inserts in one transaction
+// while holding the account row, so concurrent requests cannot both take
+// the last slot.
+type QuotaService struct {
+	db *gorm.DB
+}
+
+func NewQuotaService(db *gorm.DB) *QuotaService {
+	return &QuotaService{db: db}
+}
+
+// Create checks that the account has room for one more of the resource and
+// calls create with the transaction to insert it. Accounts without a
+// package, such as administrators and resellers, are not limited.
+func (s *QuotaService) Create(userID uint, resource string, create func(tx *gorm.DB) error) error {
+	quota, ok := quotaResources[resource]
+	if !ok {
+		return ErrUnknownQuota
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return fmt.Errorf("failed to load account: %v", err)
+		}
+		if user.Status != "active" {
+			return ErrAccountNotActive
+		}
+
+		pkg, err := s.accountPackage(tx, &user)
+		if err != nil {
+			return err
+		}
+		if pkg != nil {
+			if resource == QuotaSSLCertificates && !pkg.SSLSupport {
+				return ErrSSLNotInPackage
+			}
+			if limit := quota.limit(pkg); limit > 0 {
+				var used int64
+				if err := quota.count(tx, userID).Count(&used).Error; err != nil {
+					return fmt.Errorf("failed to count %s: %v", resource, err)
+				}
+				if used >= int64(limit) {
+					return &QuotaExceededError{Resource: resource, Limit: limit, Used: used}
+				}
+			}
+		}
+
+		return create(tx)
+	})
+}
+
+// Usage reports the account's use of every limited resource.
+func (s *QuotaService) Usage(userID uint) ([]QuotaUsage, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load account: %v", err)
+	}
+	pkg, err := s.accountPackage(s.db, &user)
+	if err != nil {
+		return nil, err
+	}
+	return s.usage(s.db, userID, pkg)
+}
+
+// usage reports the account's use of every limited resource against pkg,
+// which need not be the account's own package.
+func (s *QuotaService) usage(tx *gorm.DB, userID uint, pkg *models.Package) ([]QuotaUsage, error) {
+	usage := make([]QuotaUsage, 0, len(quotaResources))
+	for _, name := range QuotaNames() {
+		quota := quotaResources[name]
+		entry := QuotaUsage{Resource: name, Unlimited: true}
+		if err := quota.count(tx, userID).Count(&entry.Used).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %v", name, err)
+		}
+		if pkg != nil {
+			entry.Limit = quota.limit(pkg)
+			entry.Unlimited = entry.Limit == 0
+		}
+		usage = append(usage, entry)
+	}
+	return usage, nil
+}
+
+func (s *QuotaService) accountPackage(tx *gorm.DB, user *models.User) (*models.Package, error) {
+	if user.PackageID == nil {
+		return nil, nil
+	}
+	var pkg models.Package
+	if err := tx.First(&pkg, *user.PackageID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load package of account %d: %v", user.ID, err)
+	}
+	return &pkg, nil
+}
+
+// QuotaErrorStatus returns the status a handler answers a quota error with:
+// 402 when a package upgrade would allow the request, 409 when the account
+// cannot create anything in its current state.
+func QuotaErrorStatus(err error) (int, bool) {
+	var exceeded *QuotaExceededError
+	switch {
+	case errors.As(err, &exceeded), errors.Is(err, ErrSSLNotInPackage):
+		return http.StatusPaymentRequired, true
+	case errors.Is(err, ErrAccountNotActive):
+		return http.StatusConflict, true
+	}
+	return 0, false
+}
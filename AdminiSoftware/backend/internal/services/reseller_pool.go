@@ -0,0 +1,391 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrResellerNotFound  = errors.New("reseller not found")
+	ErrPackageNotAllowed = errors.New("package is not available to this reseller")
+	ErrPackageRequired   = errors.New("accounts of this reseller need a package with limited disk and bandwidth")
+)
+
+// poolReleased lists the states whose accounts no longer draw on their
+// reseller's pool. A terminated account is checked against the pool again
+// before it is restored.
+var poolReleased = []string{AccountTerminated, AccountPurged}
+
+// ResellerPoolError is returned when an account or package would not fit
+// in what is left of the reseller's pool.
+type ResellerPoolError struct {
+	Resource  string
+	Limit     int
+	Allocated int64
+	Requested int64
+}
+
+func (e *ResellerPoolError) Error() string {
+	switch {
+	case e.Resource == "account":
+		return fmt.Sprintf("reseller account limit reached: %d of %d created", e.Allocated, e.Limit)
+	case e.Requested == 0:
+		return fmt.Sprintf("a package with unlimited %s does not fit in the reseller pool of %d MB", e.Resource, e.Limit)
+	}
+	return fmt.Sprintf("reseller %s pool exceeded: %d MB of %d MB allocated, %d MB more requested",
+		e.Resource, e.Allocated, e.Limit, e.Requested)
+}
+
+// ResellerPoolUsage compares a reseller's allocation with what its accounts
+// have been given and what they actually use.
+type ResellerPoolUsage struct {
+	ResellerID           uint                       `json:"reseller_id"`
+	Username             string                     `json:"username"`
+	Allocation           *models.ResellerAllocation `json:"allocation"` // nil when unlimited
+	Accounts             int64                      `json:"accounts"`
+	DiskAllocatedMB      int64                      `json:"disk_allocated_mb"`
+	BandwidthAllocatedMB int64                      `json:"bandwidth_allocated_mb"`
+	UnlimitedAccounts    int64                      `json:"unlimited_accounts"` // accounts without a disk or bandwidth limit
+	DiskUsedMB           int64                      `json:"disk_used_mb"`
+	BandwidthUsedMB      int64                      `json:"bandwidth_used_mb"` // this month
+	Oversold             bool                       `json:"oversold"`
+}
+
+// ResellerPoolService keeps resellers within their allocation. Accounts are
+// created and packages assigned while holding the reseller's row, so
+// concurrent requests cannot overdraw the pool.
+type ResellerPoolService struct {
+	db *gorm.DB
+}
+
+func NewResellerPoolService(db *gorm.DB) *ResellerPoolService {
+	return &ResellerPoolService{db: db}
+}
+
+// Allocation returns the reseller's pool, or nil if it is unlimited.
+func (s *ResellerPoolService) Allocation(resellerID uint) (*models.ResellerAllocation, error) {
+	return s.allocation(s.db, resellerID)
+}
+
+// SetAllocation replaces the reseller's pool and the administrator packages
+// it may assign.
+func (s *ResellerPoolService) SetAllocation(allocation *models.ResellerAllocation, packageIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var reseller models.User
+		if err := tx.Where("id = ? AND role = ?", allocation.ResellerID, "reseller").First(&reseller).Error; err != nil {
+			return ErrResellerNotFound
+		}
+
+		var packages []models.Package
+		if len(packageIDs) > 0 {
+			if err := tx.Where("id IN ? AND reseller_id IS NULL", packageIDs).Find(&packages).Error; err != nil {
+				return fmt.Errorf("failed to load packages: %v", err)
+			}
+			if len(packages) != len(packageIDs) {
+				return ErrPackageNotFound
+			}
+		}
+
+		var existing models.ResellerAllocation
+		if err := tx.Where("reseller_id = ?", allocation.ResellerID).First(&existing).Error; err == nil {
+			allocation.ID = existing.ID
+			allocation.CreatedAt = existing.CreatedAt
+		}
+		allocation.Packages = nil
+		if err := tx.Save(allocation).Error; err != nil {
+			return fmt.Errorf("failed to save allocation: %v", err)
+		}
+		if err := tx.Model(allocation).Association("Packages").Replace(packages); err != nil {
+			return fmt.Errorf("failed to save allowed packages: %v", err)
+		}
+		allocation.Packages = packages
+		return nil
+	})
+}
+
+// CreateAccount creates a customer of the reseller if the pool has room for
+// it and its package.
+func (s *ResellerPoolService) CreateAccount(resellerID uint, account *models.User) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.lock(tx, resellerID); err != nil {
+			return err
+		}
+		if err := s.checkAccount(tx, resellerID, account.PackageID, 0); err != nil {
+			return err
+		}
+		account.ResellerID = &resellerID
+		return tx.Create(account).Error
+	})
+}
+
+// CheckNewAccount checks, within the caller's transaction, that the pool has
+// room for another account without a package. It locks the reseller's row
+// until the transaction ends.
+func (s *ResellerPoolService) CheckNewAccount(tx *gorm.DB, resellerID uint) error {
+	if err := s.lock(tx, resellerID); err != nil {
+		return err
+	}
+	return s.checkAccount(tx, resellerID, nil, 0)
+}
+
+// CheckPackageChange checks, within the caller's transaction, that the
+// reseller's account may move to the package. It locks the reseller's row
+// until the transaction ends.
+func (s *ResellerPoolService) CheckPackageChange(tx *gorm.DB, resellerID, userID, packageID uint) error {
+	if err := s.lock(tx, resellerID); err != nil {
+		return err
+	}
+	return s.checkAccount(tx, resellerID, &packageID, userID)
+}
+
+// CheckRestore checks, within the caller's transaction, that the pool has
+// room to take a terminated account back with its package. It locks the
+// reseller's row until the transaction ends.
+func (s *ResellerPoolService) CheckRestore(tx *gorm.DB, resellerID uint, packageID *uint) error {
+	if err := s.lock(tx, resellerID); err != nil {
+		return err
+	}
+	return s.checkAccount(tx, resellerID, packageID, 0)
+}
+
+// CheckPackage checks that a package the reseller defines fits in its pool
+// on its own: no account can be given more than the whole pool.
+func (s *ResellerPoolService) CheckPackage(resellerID uint, pkg *models.Package) error {
+	allocation, err := s.allocation(s.db, resellerID)
+	if err != nil || allocation == nil {
+		return err
+	}
+	if err := fitsPool("disk", allocation.DiskMB, pkg.DiskQuotaMB); err != nil {
+		return err
+	}
+	return fitsPool("bandwidth", allocation.BandwidthMB, pkg.BandwidthMB)
+}
+
+// Usage reports one reseller's allocation against its accounts.
+func (s *ResellerPoolService) Usage(resellerID uint) (*ResellerPoolUsage, error) {
+	var reseller models.User
+	if err := s.db.First(&reseller, resellerID).Error; err != nil {
+		return nil, ErrResellerNotFound
+	}
+	return s.usage(&reseller)
+}
+
+// Report compares every reseller's allocation with its accounts.
+func (s *ResellerPoolService) Report() ([]ResellerPoolUsage, error) {
+	var resellers []models.User
+	if err := s.db.Where("role = ?", "reseller").Order("username").Find(&resellers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list resellers: %v", err)
+	}
+
+	report := make([]ResellerPoolUsage, 0, len(resellers))
+	for i := range resellers {
+		usage, err := s.usage(&resellers[i])
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, *usage)
+	}
+	return report, nil
+}
+
+func (s *ResellerPoolService) usage(reseller *models.User) (*ResellerPoolUsage, error) {
+	allocation, err := s.allocation(s.db, reseller.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &ResellerPoolUsage{
+		ResellerID: reseller.ID,
+		Username:   reseller.Username,
+		Allocation: allocation,
+	}
+
+	var allocated struct {
+		Accounts  int64
+		Disk      int64
+		Bandwidth int64
+		Unlimited int64
+	}
+	if err := s.db.Model(&models.User{}).
+		Select(`COUNT(*) AS accounts,
+			COALESCE(SUM(packages.disk_quota_mb), 0) AS disk,
+			COALESCE(SUM(packages.bandwidth_mb), 0) AS bandwidth,
+			COUNT(*) FILTER (WHERE packages.id IS NULL OR packages.disk_quota_mb = 0 OR packages.bandwidth_mb = 0) AS unlimited`).
+		Joins("LEFT JOIN packages ON packages.id = users.package_id").
+		Where("users.reseller_id = ? AND COALESCE(users.status, '') NOT IN ?", reseller.ID, poolReleased).
+		Scan(&allocated).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum allocations of reseller %d: %v", reseller.ID, err)
+	}
+	usage.Accounts = allocated.Accounts
+	usage.DiskAllocatedMB = allocated.Disk
+	usage.BandwidthAllocatedMB = allocated.Bandwidth
+	usage.UnlimitedAccounts = allocated.Unlimited
+
+	// Disk use is each account's latest figure, bandwidth this month's total
+	if err := s.db.Raw(`SELECT COALESCE(SUM(stats.disk_usage_mb), 0) FROM stats
+		JOIN users ON users.id = stats.user_id
+		WHERE users.reseller_id = ? AND users.deleted_at IS NULL AND COALESCE(users.status, '') NOT IN ? AND stats.deleted_at IS NULL
+		AND stats.date = (SELECT MAX(latest.date) FROM stats latest WHERE latest.user_id = stats.user_id AND latest.deleted_at IS NULL)`,
+		reseller.ID, poolReleased).Scan(&usage.DiskUsedMB).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum disk use of reseller %d: %v", reseller.ID, err)
+	}
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if err := s.db.Model(&models.Stats{}).
+		Select("COALESCE(SUM(stats.bandwidth_mb), 0)").
+		Joins("JOIN users ON users.id = stats.user_id").
+		Where("users.reseller_id = ? AND users.deleted_at IS NULL AND COALESCE(users.status, '') NOT IN ? AND stats.date >= ?",
+			reseller.ID, poolReleased, monthStart).
+		Scan(&usage.BandwidthUsedMB).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum bandwidth of reseller %d: %v", reseller.ID, err)
+	}
+
+	if allocation != nil {
+		usage.Oversold = (allocation.DiskMB > 0 && (usage.DiskAllocatedMB > int64(allocation.DiskMB) || usage.UnlimitedAccounts > 0)) ||
+			(allocation.BandwidthMB > 0 && (usage.BandwidthAllocatedMB > int64(allocation.BandwidthMB) || usage.UnlimitedAccounts > 0))
+	}
+	return usage, nil
+}
+
+func (s *ResellerPoolService) allocation(tx *gorm.DB, resellerID uint) (*models.ResellerAllocation, error) {
+	var allocation models.ResellerAllocation
+	err := tx.Preload("Packages").Where("reseller_id = ?", resellerID).First(&allocation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load allocation of reseller %d: %v", resellerID, err)
+	}
+	return &allocation, nil
+}
+
+func (s *ResellerPoolService) lock(tx *gorm.DB, resellerID uint) error {
+	var reseller models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reseller, resellerID).Error; err != nil {
+		return ErrResellerNotFound
+	}
+	return nil
+}
+
+// checkAccount checks that an account of the reseller may have the package.
+// excludeUserID is the account changing package, 0 for a new account.
+func (s *ResellerPoolService) checkAccount(tx *gorm.DB, resellerID uint, packageID *uint, excludeUserID uint) error {
+	allocation, err := s.allocation(tx, resellerID)
+	if err != nil {
+		return err
+	}
+
+	// Another reseller's package is refused whether or not this reseller
+	// has an allocation
+	var pkg *models.Package
+	if packageID != nil {
+		pkg = &models.Package{}
+		if err := tx.First(pkg, *packageID).Error; err != nil {
+			return ErrPackageNotFound
+		}
+		if !packageAllowed(allocation, pkg, resellerID) {
+			return ErrPackageNotAllowed
+		}
+	}
+	if allocation == nil {
+		return nil
+	}
+
+	accounts := tx.Model(&models.User{}).
+		Where("users.reseller_id = ? AND users.id <> ? AND COALESCE(users.status, '') NOT IN ?", resellerID, excludeUserID, poolReleased).
+		Session(&gorm.Session{})
+
+	if excludeUserID == 0 && allocation.MaxAccounts > 0 {
+		var count int64
+		if err := accounts.Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count accounts: %v", err)
+		}
+		if count >= int64(allocation.MaxAccounts) {
+			return &ResellerPoolError{Resource: "account", Limit: allocation.MaxAccounts, Allocated: count}
+		}
+	}
+
+	if allocation.AllowOverselling || (allocation.DiskMB == 0 && allocation.BandwidthMB == 0) {
+		return nil
+	}
+	if pkg == nil {
+		return ErrPackageRequired
+	}
+
+	var allocated struct {
+		Disk      int64
+		Bandwidth int64
+	}
+	if err := accounts.
+		Select("COALESCE(SUM(packages.disk_quota_mb), 0) AS disk, COALESCE(SUM(packages.bandwidth_mb), 0) AS bandwidth").
+		Joins("JOIN packages ON packages.id = users.package_id").
+		Scan(&allocated).Error; err != nil {
+		return fmt.Errorf("failed to sum allocations: %v", err)
+	}
+
+	if err := fitsRemaining("disk", allocation.DiskMB, allocated.Disk, pkg.DiskQuotaMB); err != nil {
+		return err
+	}
+	return fitsRemaining("bandwidth", allocation.BandwidthMB, allocated.Bandwidth, pkg.BandwidthMB)
+}
+
+// packageAllowed reports whether the reseller may assign the package: its
+// own always, the administrator's if there is no allocation or it lists the
+// package or lists none, and never another reseller's.
+func packageAllowed(allocation *models.ResellerAllocation, pkg *models.Package, resellerID uint) bool {
+	if pkg.ResellerID != nil {
+		return *pkg.ResellerID == resellerID
+	}
+	if allocation == nil || len(allocation.Packages) == 0 {
+		return true
+	}
+	for _, allowed := range allocation.Packages {
+		if allowed.ID == pkg.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// fitsPool checks a package limit against a pool limit, 0 being unlimited
+// for both.
+func fitsPool(resource string, pool, requested int) error {
+	if pool == 0 {
+		return nil
+	}
+	if requested == 0 || requested > pool {
+		return &ResellerPoolError{Resource: resource, Limit: pool, Requested: int64(requested)}
+	}
+	return nil
+}
+
+func fitsRemaining(resource string, pool int, allocated int64, requested int) error {
+	if pool == 0 {
+		return nil
+	}
+	if requested == 0 || allocated+int64(requested) > int64(pool) {
+		return &ResellerPoolError{Resource: resource, Limit: pool, Allocated: allocated, Requested: int64(requested)}
+	}
+	return nil
+}
+
+// ResellerPoolErrorStatus returns the status a handler answers a pool error
+// with, as QuotaErrorStatus does for an account's own limits.
+func ResellerPoolErrorStatus(err error) (int, bool) {
+	var exceeded *ResellerPoolError
+	switch {
+	case errors.As(err, &exceeded):
+		return http.StatusPaymentRequired, true
+	case errors.Is(err, ErrPackageNotAllowed), errors.Is(err, ErrPackageRequired):
+		return http.StatusForbidden, true
+	case errors.Is(err, ErrPackageNotFound):
+		return http.StatusNotFound, true
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/testutil"
+	"AdminiSoftware/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageAllowed(t *testing.T) {
+	reseller, other := uint(7), uint(8)
+	own := &models.Package{ID: 1, ResellerID: &reseller}
+	foreign := &models.Package{ID: 2, ResellerID: &other}
+	listed := &models.Package{ID: 3}
+	unlisted := &models.Package{ID: 4}
+
+	// Without an allocation only other resellers' packages are refused
+	assert.True(t, packageAllowed(nil, own, reseller))
+	assert.True(t, packageAllowed(nil, unlisted, reseller))
+	assert.False(t, packageAllowed(nil, foreign, reseller))
+
+	allocation := &models.ResellerAllocation{ResellerID: reseller}
+	assert.True(t, packageAllowed(allocation, unlisted, reseller), "an empty list allows every administrator package")
+
+	allocation.Packages = []models.Package{*listed}
+	assert.True(t, packageAllowed(allocation, own, reseller))
+	assert.True(t, packageAllowed(allocation, listed, reseller))
+	assert.False(t, packageAllowed(allocation, unlisted, reseller))
+	assert.False(t, packageAllowed(allocation, foreign, reseller))
+}
+
+func TestFitsRemaining(t *testing.T) {
+	assert.NoError(t, fitsRemaining("disk", 0, 5000, 0), "an unlimited pool takes anything")
+	assert.NoError(t, fitsRemaining("disk", 1000, 600, 400))
+
+	err := fitsRemaining("disk", 1000, 600, 500)
+	assert.Equal(t, &ResellerPoolError{Resource: "disk", Limit: 1000, Allocated: 600, Requested: 500}, err)
+	assert.EqualError(t, err, "reseller disk pool exceeded: 600 MB of 1000 MB allocated, 500 MB more requested")
+
+	err = fitsRemaining("bandwidth", 1000, 0, 0)
+	assert.EqualError(t, err, "a package with unlimited bandwidth does not fit in the reseller pool of 1000 MB")
+}
+
+func TestPoolReleasesTerminatedAccounts(t *testing.T) {
+	db := testutil.DB(t, &models.User{}, &models.Package{}, &models.ResellerAllocation{}, &models.AccountTransition{})
+
+	name := testutil.UniqueName("pool")
+	reseller := &models.User{Username: name, Email: name + "@example.com", Password: "x", Role: "reseller", Status: AccountActive}
+	require.NoError(t, db.Create(reseller).Error)
+	allocation := &models.ResellerAllocation{ResellerID: reseller.ID, MaxAccounts: 1}
+	require.NoError(t, db.Create(allocation).Error)
+	customer := &models.User{Username: name + "c", Email: name + "c@example.com", Password: "x", Role: "user", Status: AccountTerminated, ResellerID: &reseller.ID}
+	require.NoError(t, db.Create(customer).Error)
+	defer func() {
+		db.Where("user_id = ?", customer.ID).Delete(&models.AccountTransition{})
+		db.Delete(allocation)
+		db.Unscoped().Where("reseller_id = ?", reseller.ID).Delete(&models.User{})
+		db.Unscoped().Delete(reseller)
+	}()
+
+	pools := NewResellerPoolService(db)
+	usage, err := pools.Usage(reseller.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Accounts, "terminated accounts do not count")
+
+	replacement := &models.User{Username: name + "r", Email: name + "r@example.com", Password: "x", Role: "user", Status: AccountActive}
+	require.NoError(t, pools.CreateAccount(reseller.ID, replacement))
+
+	// The pool is full again, so the terminated account cannot come back
+	_, err = NewAccountLifecycle(db, utils.NewLogger()).Transition(customer.ID, AccountActive, "restore", 0)
+	var exceeded *ResellerPoolError
+	assert.ErrorAs(t, err, &exceeded)
+	status, ok := AccountLifecycleErrorStatus(err)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusPaymentRequired, status)
+}
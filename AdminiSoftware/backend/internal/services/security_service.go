@@ -94,6 +94,7 @@ func (bfp *BruteForceProtection) RecordAttempt(ip string, successful bool) {
 package services
 
 import (
+	"AdminiSoftware/internal/auth"
 	"AdminiSoftware/internal/models"
 	"AdminiSoftware/internal/utils"
 	"errors"
@@ -105,14 +106,18 @@ import (
 )
 
 type SecurityService struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db         *gorm.DB
+	bruteForce *auth.BruteForceProtection
+	twoFactor  *auth.TwoFactorManager
+	logger     *utils.Logger
 }
 
-func NewSecurityService(db *gorm.DB, logger *utils.Logger) *SecurityService {
+func NewSecurityService(db *gorm.DB, bruteForce *auth.BruteForceProtection, logger *utils.Logger) *SecurityService {
 	return &SecurityService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		bruteForce: bruteForce,
+		twoFactor:  auth.NewTwoFactorManager(db),
+		logger:     logger,
 	}
 }
 
@@ -133,33 +138,11 @@ func (s *SecurityService) RecordLoginAttempt(ip string, success bool, username s
 		return err
 	}
 
-	// Check for brute force patterns
-	if !success {
-		if err := s.checkBruteForce(ip); err != nil {
-			s.logger.Warn("Brute force detected", map[string]interface{}{
-				"ip": ip,
-				"username": username,
-			})
-		}
-	}
-
-	return nil
-}
-
-func (s *SecurityService) checkBruteForce(ip string) error {
-	// Count failed attempts in the last 15 minutes
-	since := time.Now().Add(-15 * time.Minute)
-	var count int64
-
-	if err := s.db.Model(&models.LoginAttempt{}).
-		Where("ip_address = ? AND success = false AND timestamp >= ?", ip, since).
-		Count(&count).Error; err != nil {
-		return err
-	}
-
-	// If more than 5 failed attempts, block the IP
-	if count >= 5 {
-		return s.BlockIP(ip, "Brute force attack detected", 3600) // Block for 1 hour
+	// Lockouts are decided by the shared brute-force protection
+	if success {
+		s.bruteForce.RecordSuccess(auth.SourcePanel, ip, username)
+	} else {
+		s.bruteForce.RecordFailure(auth.SourcePanel, ip, username)
 	}
 
 	return nil
@@ -223,93 +206,47 @@ func (s *SecurityService) UnblockIP(ip string) error {
 }
 
 // Two-Factor Authentication
-func (s *SecurityService) Enable2FA(userID uint) (*models.TwoFactorAuth, error) {
-	// Check if 2FA is already enabled
-	var existing models.TwoFactorAuth
-	if err := s.db.Where("user_id = ?", userID).First(&existing).Error; err == nil {
-		return nil, errors.New("2FA is already enabled for this user")
-	}
-
-	// Generate secret key
-	secret, err := utils.GenerateTOTPSecret()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate TOTP secret: %v", err)
-	}
-
-	tfa := models.TwoFactorAuth{
-		UserID:      userID,
-		Secret:      secret,
-		IsEnabled:   false, // Will be enabled after verification
-		BackupCodes: utils.GenerateBackupCodes(),
-	}
-
-	if err := s.db.Create(&tfa).Error; err != nil {
-		s.logger.Error("Failed to create 2FA record", map[string]interface{}{
-			"error": err.Error(),
-			"user_id": userID,
-		})
-		return nil, err
+func (s *SecurityService) Enable2FA(userID uint) (string, string, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return "", "", errors.New("user not found")
 	}
-
-	return &tfa, nil
+	return s.twoFactor.Begin(&user)
 }
 
+// Verify2FA checks a TOTP or backup code, confirming a pending enrolment.
 func (s *SecurityService) Verify2FA(userID uint, code string) error {
-	var tfa models.TwoFactorAuth
-	if err := s.db.Where("user_id = ?", userID).First(&tfa).Error; err != nil {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
 		return errors.New("2FA not found for user")
 	}
 
-	// Verify TOTP code
-	if !utils.VerifyTOTP(tfa.Secret, code) {
+	if !user.TwoFactorEnabled {
+		_, err := s.twoFactor.Confirm(&user, code)
+		return err
+	}
+	// Verify TOTP code, which is rejected if already used
+	if !s.twoFactor.VerifyTOTP(&user, code) {
 		// Check backup codes
 		if !s.verifyBackupCode(userID, code) {
 			return errors.New("invalid 2FA code")
 		}
 	}
-
-	// Enable 2FA if not already enabled
-	if !tfa.IsEnabled {
-		tfa.IsEnabled = true
-		if err := s.db.Save(&tfa).Error; err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
+// verifyBackupCode uses up one of the user's hashed backup codes.
 func (s *SecurityService) verifyBackupCode(userID uint, code string) bool {
-	var tfa models.TwoFactorAuth
-	if err := s.db.Where("user_id = ?", userID).First(&tfa).Error; err != nil {
-		return false
-	}
-
-	for i, backupCode := range tfa.BackupCodes {
-		if backupCode == code {
-			// Remove used backup code
-			tfa.BackupCodes = append(tfa.BackupCodes[:i], tfa.BackupCodes[i+1:]...)
-			s.db.Save(&tfa)
-			return true
-		}
-	}
-
-	return false
+	return s.twoFactor.VerifyBackupCode(userID, code)
 }
 
 func (s *SecurityService) Disable2FA(userID uint) error {
-	if err := s.db.Where("user_id = ?", userID).Delete(&models.TwoFactorAuth{}).Error; err != nil {
-		s.logger.Error("Failed to disable 2FA", map[string]interface{}{
-			"error": err.Error(),
-			"user_id": userID,
-		})
+	if err := s.twoFactor.Disable(userID); err != nil {
+		s.logger.Error(err.Error())
 		return err
 	}
 
-	s.logger.Info("2FA disabled for user", map[string]interface{}{
-		"user_id": userID,
-	})
-
+	s.logger.Info(fmt.Sprintf("2FA disabled for user %d", userID))
 	return nil
 }
 
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"AdminiSoftware/internal/models"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfLinesPerPage fits 9pt Courier with 12pt leading on an A4 page.
+const pdfLinesPerPage = 62
+
+// statementPDF lays a statement out as a plain PDF. It uses a monospaced
+// base font, which keeps the columns aligned without font metrics and
+// needs nothing embedded.
+func statementPDF(issuer, billedTo string, statement *models.Statement) []byte {
+	if issuer == "" {
+		issuer = "AdminiSoftware"
+	}
+	row := "%-16s %-38s %8s %-4s %10s %10s"
+	lines := []string{
+		issuer,
+		"",
+		"Statement " + statement.Number,
+		fmt.Sprintf("Period: %s to %s", statement.PeriodStart.Format("2006-01-02"), statement.PeriodEnd.Format("2006-01-02")),
+		"Billed to: " + billedTo,
+		"Issued: " + statement.CreatedAt.Format("2006-01-02"),
+		"",
+		fmt.Sprintf(row, "Account", "Description", "Qty", "Unit", "Unit price", "Amount"),
+		strings.Repeat("-", 91),
+	}
+	for _, line := range statement.Lines {
+		lines = append(lines, fmt.Sprintf(row,
+			truncate(line.Username, 16), truncate(line.Description, 38), formatDecimal(line.Quantity),
+			line.Unit, fmt.Sprintf("%.4f", line.UnitPrice), fmt.Sprintf("%.2f", line.Amount)))
+	}
+	lines = append(lines,
+		strings.Repeat("-", 91),
+		fmt.Sprintf("%80s %10s", "Total "+statement.Currency, fmt.Sprintf("%.2f", statement.Total)),
+	)
+	return simplePDF(lines)
+}
+
+// simplePDF writes lines of text onto as many A4 pages as they need.
+func simplePDF(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects are the catalog, the page tree and the font, then a page and
+	// its content stream for each page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		var content bytes.Buffer
+		content.WriteString("BT\n/F1 9 Tf\n12 TL\n40 800 Td\n")
+		for _, line := range page {
+			content.WriteString("(" + pdfEscape(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfEscape makes text safe inside a PDF string. Characters outside
+// printable ASCII are replaced, as the base font cannot show them reliably.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "~"
+}
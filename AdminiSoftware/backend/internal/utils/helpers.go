@@ -319,14 +319,3 @@ func SlugifyString(s string) string {
 	s = strings.ReplaceAll(s, "_", "-")
 	return s
 }
-
-func GetClientIP(remoteAddr, xForwardedFor, xRealIP string) string {
-	if xRealIP != "" {
-		return xRealIP
-	}
-	if xForwardedFor != "" {
-		ips := strings.Split(xForwardedFor, ",")
-		return strings.TrimSpace(ips[0])
-	}
-	return strings.Split(remoteAddr, ":")[0]
-}
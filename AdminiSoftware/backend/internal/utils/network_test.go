@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{"8.8.8.8", "1.1.1.1", "2606:4700::1111"} {
+		assert.True(t, IsPublicIP(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "224.0.0.1", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1",
+	} {
+		assert.False(t, IsPublicIP(net.ParseIP(address)), address)
+	}
+	assert.False(t, IsPublicIP(nil))
+}
+
+func TestPublicHTTPClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := PublicHTTPClient(5 * time.Second).Get(server.URL)
+	assert.True(t, errors.Is(err, ErrNonPublicAddress), "got %v", err)
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// PasswordRules are the composition rules a password must satisfy. They are
+// the stateless part of the password policy; history, age, dictionary and
+// breach checks live in auth.PasswordPolicy.
+type PasswordRules struct {
+	MinLength     int  `json:"min_length"`
+	MaxLength     int  `json:"max_length"` // 0 means no limit
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// DefaultPasswordRules apply until an administrator configures the policy.
+// bcrypt ignores everything past 72 bytes, hence the maximum.
+var DefaultPasswordRules = PasswordRules{
+	MinLength:     8,
+	MaxLength:     72,
+	RequireUpper:  true,
+	RequireLower:  true,
+	RequireDigit:  true,
+	RequireSymbol: true,
+}
+
+// Violations lists every rule the password breaks, or nil when it passes.
+func (r PasswordRules) Violations(password string) []string {
+	var violations []string
+
+	length := len([]rune(password))
+	if length < r.MinLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters long", r.MinLength))
+	}
+	if r.MaxLength > 0 && len(password) > r.MaxLength {
+		violations = append(violations, fmt.Sprintf("password must be at most %d bytes long", r.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, ch := range password {
+		switch {
+		case unicode.IsUpper(ch):
+			hasUpper = true
+		case unicode.IsLower(ch):
+			hasLower = true
+		case unicode.IsDigit(ch):
+			hasDigit = true
+		case !unicode.IsSpace(ch):
+			hasSymbol = true
+		}
+	}
+
+	if r.RequireUpper && !hasUpper {
+		violations = append(violations, "password must contain at least one uppercase letter")
+	}
+	if r.RequireLower && !hasLower {
+		violations = append(violations, "password must contain at least one lowercase letter")
+	}
+	if r.RequireDigit && !hasDigit {
+		violations = append(violations, "password must contain at least one digit")
+	}
+	if r.RequireSymbol && !hasSymbol {
+		violations = append(violations, "password must contain at least one special character")
+	}
+	return violations
+}
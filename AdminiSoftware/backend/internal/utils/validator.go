@@ -80,28 +80,9 @@ func (v *Validator) ValidateUsername(username string) error {
 }
 
 func (v *Validator) ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters long")
+	if violations := DefaultPasswordRules.Violations(password); len(violations) > 0 {
+		return fmt.Errorf("%s", violations[0])
 	}
-
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(password)
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
-	hasDigit := regexp.MustCompile(`[0-9]`).MatchString(password)
-	hasSpecial := regexp.MustCompile(`[!@#$%^&*()_+\-=\[\]{};':"\\|,.<>\/?]`).MatchString(password)
-
-	if !hasUpper {
-		return fmt.Errorf("password must contain at least one uppercase letter")
-	}
-	if !hasLower {
-		return fmt.Errorf("password must contain at least one lowercase letter")
-	}
-	if !hasDigit {
-		return fmt.Errorf("password must contain at least one digit")
-	}
-	if !hasSpecial {
-		return fmt.Errorf("password must contain at least one special character")
-	}
-
 	return nil
 }
 
@@ -182,16 +163,10 @@ func IsValidUsername(username string) bool {
 	return usernameRegex.MatchString(username)
 }
 
+// IsValidPassword checks the default composition rules only; use
+// auth.PasswordPolicy wherever a password is actually set.
 func IsValidPassword(password string) bool {
-	if len(password) < 8 {
-		return false
-	}
-	
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(password)
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
-	hasNumber := regexp.MustCompile(`[0-9]`).MatchString(password)
-	
-	return hasUpper && hasLower && hasNumber
+	return len(DefaultPasswordRules.Violations(password)) == 0
 }
 
 func SanitizeString(input string) string {
@@ -1,20 +1,23 @@
-
 package whm
 
 import (
 	"AdminiSoftware/internal/models"
+	"AdminiSoftware/internal/services"
+	"AdminiSoftware/internal/utils"
 	"gorm.io/gorm"
 )
 
 type Manager struct {
-	db     *gorm.DB
-	client *Client
+	db        *gorm.DB
+	client    *Client
+	lifecycle *services.AccountLifecycle
 }
 
 func NewManager(db *gorm.DB, client *Client) *Manager {
 	return &Manager{
-		db:     db,
-		client: client,
+		db:        db,
+		client:    client,
+		lifecycle: services.NewAccountLifecycle(db, utils.NewLogger()),
 	}
 }
 
@@ -23,11 +26,11 @@ func (m *Manager) SyncAccounts() error {
 	if err != nil {
 		return err
 	}
-	
+
 	for _, account := range accounts {
 		var user models.User
 		result := m.db.Where("username = ?", account.Username).First(&user)
-		
+
 		if result.Error == gorm.ErrRecordNotFound {
 			// Create new user
 			user = models.User{
@@ -37,13 +40,12 @@ func (m *Manager) SyncAccounts() error {
 				Status:   getStatus(account.Suspended),
 			}
 			m.db.Create(&user)
-		} else {
-			// Update existing user
-			user.Status = getStatus(account.Suspended)
-			m.db.Save(&user)
+		} else if status := getStatus(account.Suspended); status != user.Status && services.CanTransition(user.Status, status) {
+			// Suspensions made in WHM apply here as well
+			m.lifecycle.Transition(user.ID, status, "synced from WHM", 0)
 		}
 	}
-	
+
 	return nil
 }
 
@@ -54,22 +56,22 @@ func (m *Manager) CreateAccountFromUser(user *models.User, plan string) error {
 		Plan:     plan,
 		Password: "temp_password", // Should be generated securely
 	}
-	
+
 	return m.client.CreateAccount(params)
 }
 
-func (m *Manager) SuspendUser(userID uint) error {
+func (m *Manager) SuspendUser(userID uint, reason string) error {
 	var user models.User
 	if err := m.db.First(&user, userID).Error; err != nil {
 		return err
 	}
-	
-	if err := m.client.SuspendAccount(user.Username); err != nil {
+
+	if err := m.client.SuspendAccount(user.Username, reason); err != nil {
 		return err
 	}
-	
-	user.Status = "suspended"
-	return m.db.Save(&user).Error
+
+	_, err := m.lifecycle.Transition(user.ID, services.AccountSuspended, reason, 0)
+	return err
 }
 
 func (m *Manager) UnsuspendUser(userID uint) error {
@@ -77,13 +79,13 @@ func (m *Manager) UnsuspendUser(userID uint) error {
 	if err := m.db.First(&user, userID).Error; err != nil {
 		return err
 	}
-	
+
 	if err := m.client.UnsuspendAccount(user.Username); err != nil {
 		return err
 	}
-	
-	user.Status = "active"
-	return m.db.Save(&user).Error
+
+	_, err := m.lifecycle.Transition(user.ID, services.AccountActive, "", 0)
+	return err
 }
 
 func (m *Manager) TerminateUser(userID uint) error {
@@ -91,12 +93,14 @@ func (m *Manager) TerminateUser(userID uint) error {
 	if err := m.db.First(&user, userID).Error; err != nil {
 		return err
 	}
-	
+
 	if err := m.client.TerminateAccount(user.Username); err != nil {
 		return err
 	}
-	
-	return m.db.Delete(&user).Error
+
+	// The local data is kept for the purge grace period
+	_, err := m.lifecycle.Transition(user.ID, services.AccountTerminated, "terminated in WHM", 0)
+	return err
 }
 
 func getStatus(suspended bool) string {